@@ -11,6 +11,7 @@ import (
 
 	"golang.org/x/crypto/hkdf"
 
+	"code.kerpass.org/golang/internal/algos"
 	"code.kerpass.org/golang/internal/utils"
 	"code.kerpass.org/golang/pkg/ephemsec"
 )
@@ -49,7 +50,7 @@ func fillVector(schemename string, vect *ephemsec.TestVector) error {
 	}
 	vect.ResponderStaticKey = utils.HexBinary(RStaticKey.Bytes())
 	vect.InitiatorRemoteStaticKey = utils.HexBinary(RStaticKey.PublicKey().Bytes())
-	switch scheme.KeyExchangePattern() {
+	switch scheme.DHPattern() {
 	case "E1S1":
 		Z, err = doE1S1(RStaticKey, IEphemKey.PublicKey())
 		if nil != err {
@@ -87,6 +88,15 @@ func fillVector(schemename string, vect *ephemsec.TestVector) error {
 		return fmt.Errorf("Invalid KeyExchange pattern %s", scheme.KeyExchangePattern())
 	}
 
+	// generate KEM shared secret
+	if kem := scheme.Kem(); nil != kem {
+		Zk, err := doKem(kem, vect)
+		if nil != err {
+			return fmt.Errorf("Failed KEM exchange, got error %w", err)
+		}
+		Z = append(Z, Zk...)
+	}
+
 	// generate shared psk
 	psk := make([]byte, 32)
 	rng.Read(psk) // rng.Read can not fail
@@ -186,6 +196,34 @@ func doE2S2(e *ecdh.PrivateKey, s *ecdh.PrivateKey, rE *ecdh.PublicKey, rS *ecdh
 	return Z, nil
 }
 
+// doKem generates Responder KEM key and Initiator KEM ciphertext, it returns the Responder
+// decapsulated KEM shared secret.
+func doKem(kem algos.Kem, vect *ephemsec.TestVector) ([]byte, error) {
+	seed := make([]byte, 64)
+	rng.Read(seed)
+	RKemKey, err := kem.NewKey(seed)
+	if nil != err {
+		return nil, fmt.Errorf("Failed generating Responder KEM key, got error %w", err)
+	}
+	vect.ResponderKemKey = utils.HexBinary(RKemKey.Bytes())
+	vect.InitiatorRemoteKemKey = utils.HexBinary(RKemKey.PublicKey())
+
+	// Initiator encapsulation uses crypto rand, vectors record its outputs
+	Ik, ct, err := kem.Encapsulate(RKemKey.PublicKey())
+	if nil != err {
+		return nil, fmt.Errorf("Failed KEM encapsulation, got error %w", err)
+	}
+	vect.KemCiphertext = utils.HexBinary(ct)
+	vect.KemSecret = utils.HexBinary(Ik)
+
+	Zk, err := RKemKey.Decapsulate(ct)
+	if nil != err {
+		return nil, fmt.Errorf("Failed KEM decapsulation, got error %w", err)
+	}
+
+	return Zk, nil
+}
+
 func makeSalt(context []byte, schemename string) []byte {
 	rv := make([]byte, 0, 2+len(context)+2+len(schemename))
 	rv = append(rv, byte('C'))
@@ -74,6 +74,20 @@ func parseFlags(progname string, args []string) *Cmd {
 		return err
 	})
 
+	var kems []string
+	const kemDoc = `
+	KEM name, when set only hybrid post quantum schemes are generated.
+	Add more than 1 by repeating this option.
+	Supported KEMs %+v.
+	`
+	flags.Func("kem", dedent(fmt.Sprintf(kemDoc, algos.ListKems())), func(v string) error {
+		_, err := algos.GetKem(v)
+		if nil == err {
+			kems = append(kems, v)
+		}
+		return err
+	})
+
 	var codes []string
 	const codeDoc = `
 	OTP/OTK encoding pattern of form T600B32P9.
@@ -119,7 +133,7 @@ func parseFlags(progname string, args []string) *Cmd {
 	if len(codes) == 0 {
 		codes = defaultCodes
 	}
-	cmd.Schemes = makeSchemeList(hashes, curves, codes)
+	cmd.Schemes = makeSchemeList(hashes, curves, kems, codes)
 
 	// set cmd.Repeat
 	cmd.Repeat = int(repeat)
@@ -156,17 +170,25 @@ func dedent(multilines string) string {
 	return sb.String()
 }
 
-func makeSchemeList(hashes, curves, codes []string) []string {
+func makeSchemeList(hashes, curves, kems, codes []string) []string {
 	var schemes []string
 	keyexs := []string{"E1S1", "E1S2", "E2S2"}
 	for _, hash := range hashes {
 		for _, curve := range curves {
 			for _, keyex := range keyexs {
 				for _, code := range codes {
-					schemes = append(
-						schemes,
-						fmt.Sprintf("Kerpass_%s_%s_%s_%s", hash, curve, keyex, code),
-					)
+					if 0 == len(kems) {
+						schemes = append(
+							schemes,
+							fmt.Sprintf("Kerpass_%s_%s_%s_%s", hash, curve, keyex, code),
+						)
+					}
+					for _, kem := range kems {
+						schemes = append(
+							schemes,
+							fmt.Sprintf("Kerpass_%s_%s+%s_%sK1_%s", hash, curve, kem, keyex, code),
+						)
+					}
 				}
 			}
 		}
@@ -0,0 +1,219 @@
+package algos
+
+import (
+	"crypto/mlkem"
+
+	"code.kerpass.org/golang/internal/utils"
+)
+
+const (
+	KEM_MLKEM768  = "MLKEM768"
+	KEM_MLKEM1024 = "MLKEM1024"
+)
+
+var kemRegistry *utils.Registry[string, Kem]
+
+// Kem is a Key Encapsulation Mechanism.
+//
+// KerPass uses Kem in combination with a Curve ECDH, resulting in hybrid key exchanges that
+// stay secure as long as one of the 2 key exchanges is not broken.
+type Kem interface {
+	// Name returns the Kem name, eg "MLKEM768".
+	Name() string
+
+	// PublicKeyLen returns the Kem encapsulation key byte size.
+	PublicKeyLen() int
+
+	// CiphertextLen returns the Kem ciphertext byte size.
+	CiphertextLen() int
+
+	// GenerateKey returns a new random KemKey.
+	GenerateKey() (KemKey, error)
+
+	// NewKey derives a KemKey from seed. It errors if seed is invalid.
+	NewKey(seed []byte) (KemKey, error)
+
+	// Encapsulate generates a shared secret and the ciphertext that allows the owner of
+	// the pubkey KemKey to recover it. It errors if pubkey is invalid.
+	Encapsulate(pubkey []byte) (sharedKey, ciphertext []byte, err error)
+}
+
+// KemKey is a Kem private decapsulation key.
+type KemKey interface {
+	// PublicKey returns the encoded encapsulation key.
+	PublicKey() []byte
+
+	// Bytes returns the KemKey seed.
+	Bytes() []byte
+
+	// Decapsulate recovers the shared secret from ciphertext. It errors if ciphertext is invalid.
+	Decapsulate(ciphertext []byte) ([]byte, error)
+}
+
+// MustRegisterKem adds kem to the Kem registry. It panics if kem name is already in use.
+func MustRegisterKem(kem Kem) {
+	err := RegisterKem(kem)
+	if nil != err {
+		panic(err)
+	}
+}
+
+// RegisterKem adds kem to the Kem registry. It errors if kem name is already in use or kem is nil.
+func RegisterKem(kem Kem) error {
+	if nil == kem {
+		return newError("nil kem")
+	}
+	return wrapError(
+		utils.RegistrySet(kemRegistry, kem.Name(), kem),
+		"failed registering Kem algorithm, %s",
+		kem.Name(),
+	)
+}
+
+// GetKem loads Kem implementation from the registry. It errors if no Kem was registered with name.
+func GetKem(name string) (Kem, error) {
+	kem, found := utils.RegistryGet(kemRegistry, name)
+	if !found {
+		return nil, newError("unsupported Kem algorithm, %s", name)
+	}
+
+	return kem, nil
+}
+
+// ListKems returns a slice containing the names of the registered Kems.
+func ListKems() []string {
+	kemIdx := utils.RegistryEntries(kemRegistry)
+	rv := make([]string, 0, len(kemIdx))
+	for name, _ := range kemIdx {
+		rv = append(rv, name)
+	}
+	return rv
+}
+
+// mlkem768 implements Kem using ML-KEM-768 (FIPS 203).
+type mlkem768 struct{}
+
+func (_ mlkem768) Name() string {
+	return KEM_MLKEM768
+}
+
+func (_ mlkem768) PublicKeyLen() int {
+	return mlkem.EncapsulationKeySize768
+}
+
+func (_ mlkem768) CiphertextLen() int {
+	return mlkem.CiphertextSize768
+}
+
+func (_ mlkem768) GenerateKey() (KemKey, error) {
+	dk, err := mlkem.GenerateKey768()
+	if nil != err {
+		return nil, wrapError(err, "failed generating ML-KEM-768 key")
+	}
+
+	return mlkem768Key{dk: dk}, nil
+}
+
+func (_ mlkem768) NewKey(seed []byte) (KemKey, error) {
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if nil != err {
+		return nil, wrapError(err, "invalid ML-KEM-768 seed")
+	}
+
+	return mlkem768Key{dk: dk}, nil
+}
+
+func (_ mlkem768) Encapsulate(pubkey []byte) ([]byte, []byte, error) {
+	ek, err := mlkem.NewEncapsulationKey768(pubkey)
+	if nil != err {
+		return nil, nil, wrapError(err, "invalid ML-KEM-768 encapsulation key")
+	}
+	sharedKey, ciphertext := ek.Encapsulate()
+
+	return sharedKey, ciphertext, nil
+}
+
+type mlkem768Key struct {
+	dk *mlkem.DecapsulationKey768
+}
+
+func (self mlkem768Key) PublicKey() []byte {
+	return self.dk.EncapsulationKey().Bytes()
+}
+
+func (self mlkem768Key) Bytes() []byte {
+	return self.dk.Bytes()
+}
+
+func (self mlkem768Key) Decapsulate(ciphertext []byte) ([]byte, error) {
+	sharedKey, err := self.dk.Decapsulate(ciphertext)
+
+	return sharedKey, wrapError(err, "failed ML-KEM-768 decapsulation")
+}
+
+// mlkem1024 implements Kem using ML-KEM-1024 (FIPS 203).
+type mlkem1024 struct{}
+
+func (_ mlkem1024) Name() string {
+	return KEM_MLKEM1024
+}
+
+func (_ mlkem1024) PublicKeyLen() int {
+	return mlkem.EncapsulationKeySize1024
+}
+
+func (_ mlkem1024) CiphertextLen() int {
+	return mlkem.CiphertextSize1024
+}
+
+func (_ mlkem1024) GenerateKey() (KemKey, error) {
+	dk, err := mlkem.GenerateKey1024()
+	if nil != err {
+		return nil, wrapError(err, "failed generating ML-KEM-1024 key")
+	}
+
+	return mlkem1024Key{dk: dk}, nil
+}
+
+func (_ mlkem1024) NewKey(seed []byte) (KemKey, error) {
+	dk, err := mlkem.NewDecapsulationKey1024(seed)
+	if nil != err {
+		return nil, wrapError(err, "invalid ML-KEM-1024 seed")
+	}
+
+	return mlkem1024Key{dk: dk}, nil
+}
+
+func (_ mlkem1024) Encapsulate(pubkey []byte) ([]byte, []byte, error) {
+	ek, err := mlkem.NewEncapsulationKey1024(pubkey)
+	if nil != err {
+		return nil, nil, wrapError(err, "invalid ML-KEM-1024 encapsulation key")
+	}
+	sharedKey, ciphertext := ek.Encapsulate()
+
+	return sharedKey, ciphertext, nil
+}
+
+type mlkem1024Key struct {
+	dk *mlkem.DecapsulationKey1024
+}
+
+func (self mlkem1024Key) PublicKey() []byte {
+	return self.dk.EncapsulationKey().Bytes()
+}
+
+func (self mlkem1024Key) Bytes() []byte {
+	return self.dk.Bytes()
+}
+
+func (self mlkem1024Key) Decapsulate(ciphertext []byte) ([]byte, error) {
+	sharedKey, err := self.dk.Decapsulate(ciphertext)
+
+	return sharedKey, wrapError(err, "failed ML-KEM-1024 decapsulation")
+}
+
+func init() {
+	kemRegistry = utils.NewRegistry[string, Kem]()
+	MustRegisterKem(mlkem768{})
+	MustRegisterKem(mlkem1024{})
+}
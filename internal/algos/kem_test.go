@@ -0,0 +1,53 @@
+package algos
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKemRegistry(t *testing.T) {
+	for _, name := range []string{KEM_MLKEM768, KEM_MLKEM1024} {
+		t.Run(name, func(t *testing.T) {
+			kem, err := GetKem(name)
+			if nil != err {
+				t.Fatalf("failed GetKem, got error %v", err)
+			}
+			key, err := kem.GenerateKey()
+			if nil != err {
+				t.Fatalf("failed GenerateKey, got error %v", err)
+			}
+			if kem.PublicKeyLen() != len(key.PublicKey()) {
+				t.Fatalf("failed PublicKeyLen control")
+			}
+			sharedKey, ct, err := kem.Encapsulate(key.PublicKey())
+			if nil != err {
+				t.Fatalf("failed Encapsulate, got error %v", err)
+			}
+			if kem.CiphertextLen() != len(ct) {
+				t.Fatalf("failed CiphertextLen control")
+			}
+
+			// decapsulate with a KemKey restored from seed
+			key, err = kem.NewKey(key.Bytes())
+			if nil != err {
+				t.Fatalf("failed NewKey, got error %v", err)
+			}
+			decapsulated, err := key.Decapsulate(ct)
+			if nil != err {
+				t.Fatalf("failed Decapsulate, got error %v", err)
+			}
+			if !bytes.Equal(sharedKey, decapsulated) {
+				t.Fatal("failed shared key control")
+			}
+		})
+	}
+
+	err := RegisterKem(mlkem768{})
+	if nil == err {
+		t.Fatal("RegisterKem succeeded with duplicated name")
+	}
+	_, err = GetKem("unknown")
+	if nil == err {
+		t.Fatal("GetKem succeeded with unknown name")
+	}
+}
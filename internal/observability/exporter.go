@@ -0,0 +1,99 @@
+package observability
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// Exporter receives the spans & measurements produced by an Observability.
+// Exporter are called synchronously, implementations that forward data to a remote collector
+// (for example an OpenTelemetry SDK) shall buffer it. Exporter shall be safe for concurrent use.
+type Exporter interface {
+	// ExportSpan is called when a Span ends.
+	ExportSpan(span SpanData)
+
+	// ExportMetric is called when a Measurement is recorded.
+	ExportMetric(m Measurement)
+}
+
+// MemExporter is an Exporter that keeps spans & measurements in memory.
+// It is intended for tests.
+type MemExporter struct {
+	mut          sync.Mutex
+	spans        []SpanData
+	measurements []Measurement
+}
+
+// ExportSpan implements Exporter.
+func (self *MemExporter) ExportSpan(span SpanData) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+	self.spans = append(self.spans, span)
+}
+
+// ExportMetric implements Exporter.
+func (self *MemExporter) ExportMetric(m Measurement) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+	self.measurements = append(self.measurements, m)
+}
+
+// Spans returns the exported spans in completion order.
+func (self *MemExporter) Spans() []SpanData {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+	return slices.Clone(self.spans)
+}
+
+// Measurements returns the exported measurements in recording order.
+func (self *MemExporter) Measurements() []Measurement {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+	return slices.Clone(self.measurements)
+}
+
+// Sum returns the sum of the name measurements that have all attrs.
+func (self *MemExporter) Sum(name string, attrs ...slog.Attr) float64 {
+	var rv float64
+	for _, m := range self.Measurements() {
+		if name == m.Name && hasAttrs(m.Attrs, attrs) {
+			rv += m.Value
+		}
+	}
+
+	return rv
+}
+
+// Count returns the number of name measurements that have all attrs.
+func (self *MemExporter) Count(name string, attrs ...slog.Attr) int {
+	var rv int
+	for _, m := range self.Measurements() {
+		if name == m.Name && hasAttrs(m.Attrs, attrs) {
+			rv += 1
+		}
+	}
+
+	return rv
+}
+
+// Reset clears exported spans & measurements.
+func (self *MemExporter) Reset() {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+	self.spans = nil
+	self.measurements = nil
+}
+
+var _ Exporter = &MemExporter{}
+
+// hasAttrs returns true if all attrs are in set.
+func hasAttrs(set []slog.Attr, attrs []slog.Attr) bool {
+	for _, attr := range attrs {
+		if !slices.ContainsFunc(set, attr.Equal) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,6 +1,7 @@
 package observability
 
 import (
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -10,13 +11,37 @@ import (
 // Middleware holds configuration for HTTP Observability
 type Middleware struct {
 	TraceIdHeader string
+
+	// Exporter receives request spans & measurements, when nil the Exporter of the incoming
+	// request Context Observability is used.
+	Exporter Exporter
 }
 
 // Wrap returns an Handler that add Observability to http Request Context and call next.
+// Wrap starts a Span for each request, the Span continues the trace propagated by the
+// W3C traceparent request header if present.
 func (self Middleware) Wrap(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		t0 := time.Now()
 
+		var obs Observability
+		if parent := GetObservability(r.Context()); nil != parent {
+			obs = *parent
+		}
+		if nil != self.Exporter {
+			obs.Exporter = self.Exporter
+		}
+		ctx := SetObservability(r.Context(), &obs)
+
+		remote, _ := ParseTraceParent(r.Header.Get(TraceParentHeader))
+		ctx, span := StartSpanWithParent(
+			ctx,
+			"HTTP "+r.Method,
+			remote,
+			slog.String("http.request.method", r.Method),
+			slog.String("url.path", r.URL.Path),
+		)
+
 		var tId string
 		if "" != self.TraceIdHeader {
 			tId = r.Header.Get(self.TraceIdHeader)
@@ -24,12 +49,18 @@ func (self Middleware) Wrap(next http.Handler) http.Handler {
 		if "" == tId {
 			tId = uuid.New().String()
 		}
+		log := obs.Log().With("tId", tId)
+		GetObservability(ctx).Logger = log
 
-		log := GetObservability(r.Context()).Log().With("tId", tId)
-		obs := Observability{Logger: log}
-		ctx := SetObservability(r.Context(), &obs)
-		sw := statusRecorder{ResponseWriter: w}
+		sw := statusRecorder{ResponseWriter: w, status: http.StatusOK}
 		next.ServeHTTP(&sw, r.Clone(ctx))
+
+		span.SetAttrs(slog.Int("http.response.status_code", sw.status))
+		var err error
+		if sw.status >= 500 {
+			err = newError("server error status %d", sw.status)
+		}
+		span.End(err)
 		log.Info(
 			"processed HTTP request",
 			"method", r.Method,
@@ -52,4 +83,9 @@ func (self *statusRecorder) WriteHeader(statusCode int) {
 	self.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap returns the wrapped ResponseWriter, this allows http.ResponseController to access its features.
+func (self *statusRecorder) Unwrap() http.ResponseWriter {
+	return self.ResponseWriter
+}
+
 var _ http.ResponseWriter = &statusRecorder{}
@@ -0,0 +1,84 @@
+package observability
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Metric names used by kerpass packages.
+// Metrics follow OpenTelemetry naming conventions, durations are recorded in seconds.
+const (
+	// MetricEnrollments counts completed server enrollments, "outcome" attribute is "success" or "failure".
+	MetricEnrollments = "kerpass.enroll.completed"
+
+	// MetricOtpValidations counts server OTP validations, "outcome" attribute is "valid", "invalid" or "error".
+	MetricOtpValidations = "kerpass.otp.validations"
+
+	// MetricHandshakeFailures counts failed noise handshake messages, "protocol" attribute names the protocol.
+	MetricHandshakeFailures = "kerpass.noise.handshake.failures"
+
+	// MetricStoreLatency records credential store operation durations, "store" & "op" attributes
+	// identify the store and the operation.
+	MetricStoreLatency = "kerpass.store.duration"
+)
+
+// InstrumentKind identifies the kind of instrument that produced a Measurement.
+type InstrumentKind int
+
+const (
+	// Counter measurements are increments of a monotonic sum.
+	Counter InstrumentKind = iota + 1
+
+	// Histogram measurements are individual values of a distribution.
+	Histogram
+)
+
+// String returns the kind name.
+func (self InstrumentKind) String() string {
+	switch self {
+	case Counter:
+		return "counter"
+	case Histogram:
+		return "histogram"
+	default:
+		return "unknown"
+	}
+}
+
+// Measurement is a single value recorded by an instrument.
+type Measurement struct {
+	Name  string
+	Kind  InstrumentKind
+	Value float64
+	Attrs []slog.Attr
+	Time  time.Time
+}
+
+// Add increments counter name by value.
+// It does nothing if the Observability has no Exporter.
+func (self *Observability) Add(name string, value float64, attrs ...slog.Attr) {
+	self.measure(Counter, name, value, attrs)
+}
+
+// Record records value in histogram name.
+// It does nothing if the Observability has no Exporter.
+func (self *Observability) Record(name string, value float64, attrs ...slog.Attr) {
+	self.measure(Histogram, name, value, attrs)
+}
+
+// Timer returns a function that records in histogram name the time elapsed since Timer was called.
+// It is intended to be used as defer obs.Timer(name, attrs...)().
+func (self *Observability) Timer(name string, attrs ...slog.Attr) func() {
+	t0 := time.Now()
+	return func() {
+		self.Record(name, time.Since(t0).Seconds(), attrs...)
+	}
+}
+
+func (self *Observability) measure(kind InstrumentKind, name string, value float64, attrs []slog.Attr) {
+	exp := self.exporter()
+	if nil == exp {
+		return
+	}
+	exp.ExportMetric(Measurement{Name: name, Kind: kind, Value: value, Attrs: attrs, Time: time.Now()})
+}
@@ -11,10 +11,12 @@ const (
 	observabilityKey = contextKey("OBSERVABILITY")
 )
 
-// Observability holds Loggers & Metrics.
+// Observability holds Logger, metrics & traces Exporter and current Span.
 // nil *Observability are safe to use.
 type Observability struct {
-	Logger *slog.Logger
+	Logger   *slog.Logger
+	Exporter Exporter
+	span     *Span
 }
 
 // Log returns inner Logger or slog.Default().
@@ -26,6 +28,24 @@ func (self *Observability) Log() *slog.Logger {
 	return self.Logger
 }
 
+// Span returns current Span, it returns nil if there is no current Span.
+func (self *Observability) Span() *Span {
+	if nil == self {
+		return nil
+	}
+
+	return self.span
+}
+
+// exporter returns inner Exporter or nil.
+func (self *Observability) exporter() Exporter {
+	if nil == self {
+		return nil
+	}
+
+	return self.Exporter
+}
+
 // GetObservability returns ctx Observability.
 func GetObservability(ctx context.Context) *Observability {
 	var rv *Observability
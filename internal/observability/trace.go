@@ -0,0 +1,196 @@
+package observability
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// TraceParentHeader is the W3C Trace Context header used for span propagation over HTTP.
+const TraceParentHeader = "traceparent"
+
+// TraceId identifies a trace, it is compatible with OpenTelemetry trace IDs.
+type TraceId [16]byte
+
+// IsValid returns true if the TraceId is not zero.
+func (self TraceId) IsValid() bool {
+	return TraceId{} != self
+}
+
+// String returns the TraceId hex encoding.
+func (self TraceId) String() string {
+	return hex.EncodeToString(self[:])
+}
+
+// SpanId identifies a span within a trace, it is compatible with OpenTelemetry span IDs.
+type SpanId [8]byte
+
+// IsValid returns true if the SpanId is not zero.
+func (self SpanId) IsValid() bool {
+	return SpanId{} != self
+}
+
+// String returns the SpanId hex encoding.
+func (self SpanId) String() string {
+	return hex.EncodeToString(self[:])
+}
+
+// SpanContext holds the identifiers that are propagated to child spans.
+type SpanContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+	Flags   byte
+}
+
+// IsValid returns true if both TraceId and SpanId are valid.
+func (self SpanContext) IsValid() bool {
+	return self.TraceId.IsValid() && self.SpanId.IsValid()
+}
+
+// TraceParent returns the W3C traceparent header value for the SpanContext.
+func (self SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", self.TraceId, self.SpanId, self.Flags)
+}
+
+// ParseTraceParent parses a W3C traceparent header value.
+// It errors if v is malformed or contains zero identifiers.
+func ParseTraceParent(v string) (SpanContext, error) {
+	var rv SpanContext
+
+	// version "-" trace-id "-" parent-id "-" trace-flags
+	if 55 != len(v) || '-' != v[2] || '-' != v[35] || '-' != v[52] {
+		return rv, newError("malformed traceparent")
+	}
+	var version [1]byte
+	var flags [1]byte
+	for _, field := range []struct {
+		src string
+		dst []byte
+	}{
+		{src: v[0:2], dst: version[:]},
+		{src: v[3:35], dst: rv.TraceId[:]},
+		{src: v[36:52], dst: rv.SpanId[:]},
+		{src: v[53:55], dst: flags[:]},
+	} {
+		_, err := hex.Decode(field.dst, []byte(field.src))
+		if nil != err {
+			return rv, newError("malformed traceparent, got error %v", err)
+		}
+	}
+	if 0xFF == version[0] {
+		return rv, newError("invalid traceparent version")
+	}
+	if !rv.IsValid() {
+		return rv, newError("invalid traceparent identifiers")
+	}
+	rv.Flags = flags[0]
+
+	return rv, nil
+}
+
+// SpanData holds the information exported when a Span ends.
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Attrs       []slog.Attr
+	Err         error
+}
+
+// Span tracks an operation duration & outcome.
+// nil *Span are safe to use.
+type Span struct {
+	mut   sync.Mutex
+	data  SpanData
+	exp   Exporter
+	ended bool
+}
+
+// Context returns the Span SpanContext.
+func (self *Span) Context() SpanContext {
+	if nil == self {
+		return SpanContext{}
+	}
+
+	return self.data.SpanContext
+}
+
+// SetAttrs adds attrs to the Span.
+func (self *Span) SetAttrs(attrs ...slog.Attr) {
+	if nil == self {
+		return
+	}
+	self.mut.Lock()
+	defer self.mut.Unlock()
+	self.data.Attrs = append(self.data.Attrs, attrs...)
+}
+
+// End terminates the Span with err status and exports it.
+// Only the first call to End has an effect.
+func (self *Span) End(err error) {
+	if nil == self {
+		return
+	}
+	self.mut.Lock()
+	if self.ended {
+		self.mut.Unlock()
+		return
+	}
+	self.ended = true
+	self.data.End = time.Now()
+	self.data.Err = err
+	data := self.data
+	self.mut.Unlock()
+
+	if nil != self.exp {
+		self.exp.ExportSpan(data)
+	}
+}
+
+// StartSpan starts a Span that is a child of ctx current Span.
+// It returns a Context that holds the new Span.
+func StartSpan(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, *Span) {
+	parent := GetObservability(ctx).Span().Context()
+
+	return StartSpanWithParent(ctx, name, parent, attrs...)
+}
+
+// StartSpanWithParent starts a Span that is a child of parent, a new trace is started if parent is not valid.
+// This allows continuing a trace propagated by a remote peer.
+// It returns a Context that holds the new Span.
+func StartSpanWithParent(ctx context.Context, name string, parent SpanContext, attrs ...slog.Attr) (context.Context, *Span) {
+	obs := GetObservability(ctx)
+
+	span := &Span{
+		data: SpanData{
+			Name:   name,
+			Parent: parent,
+			Start:  time.Now(),
+			Attrs:  attrs,
+		},
+		exp: obs.exporter(),
+	}
+	sc := &span.data.SpanContext
+	if parent.IsValid() {
+		sc.TraceId = parent.TraceId
+		sc.Flags = parent.Flags
+	} else {
+		rand.Read(sc.TraceId[:])
+		sc.Flags = 0x01 // sampled
+	}
+	rand.Read(sc.SpanId[:])
+
+	var child Observability
+	if nil != obs {
+		child = *obs
+	}
+	child.span = span
+
+	return SetObservability(ctx, &child), span
+}
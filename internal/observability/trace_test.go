@@ -0,0 +1,102 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceParent(valid)
+	if nil != err {
+		t.Fatalf("failed ParseTraceParent, got error %v", err)
+	}
+	if valid != sc.TraceParent() {
+		t.Fatalf("failed TraceParent round trip, got %s", sc.TraceParent())
+	}
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		_, err = ParseTraceParent(v)
+		if nil == err {
+			t.Errorf("ParseTraceParent succeeded with %q", v)
+		}
+	}
+}
+
+func TestStartSpanExport(t *testing.T) {
+	exp := &MemExporter{}
+	ctx := SetObservability(context.Background(), &Observability{Exporter: exp})
+
+	ctx, parent := StartSpan(ctx, "parent")
+	cctx, child := StartSpan(ctx, "child", slog.String("k", "v"))
+	GetObservability(cctx).Add("test.counter", 2, slog.String("k", "v"))
+	child.End(errors.New("failed"))
+	parent.End(nil)
+	parent.End(errors.New("ignored"))
+
+	spans := exp.Spans()
+	if 2 != len(spans) {
+		t.Fatalf("failed spans count control, got %d", len(spans))
+	}
+	if "child" != spans[0].Name || nil == spans[0].Err {
+		t.Errorf("failed child span control, got %+v", spans[0])
+	}
+	if spans[0].Parent != parent.Context() || spans[0].SpanContext.TraceId != parent.Context().TraceId {
+		t.Error("child span is not linked to parent")
+	}
+	if nil != spans[1].Err {
+		t.Errorf("parent span exported with error %v", spans[1].Err)
+	}
+	if 2 != exp.Sum("test.counter", slog.String("k", "v")) || 0 != exp.Count("test.counter", slog.String("k", "x")) {
+		t.Error("failed counter control")
+	}
+
+	// nil Observability & Span are safe to use
+	var obs *Observability
+	obs.Add("test.counter", 1)
+	obs.Timer("test.histogram")()
+	obs.Span().End(nil)
+}
+
+func TestMiddlewareSpan(t *testing.T) {
+	exp := &MemExporter{}
+	var inner SpanContext
+	hdlr := Middleware{Exporter: exp}.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = GetObservability(r.Context()).Span().Context()
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodPost, "/enroll", nil)
+	req.Header.Set(TraceParentHeader, traceparent)
+	hdlr.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exp.Spans()
+	if 1 != len(spans) {
+		t.Fatalf("failed spans count control, got %d", len(spans))
+	}
+	span := spans[0]
+	if "4bf92f3577b34da6a3ce929d0e0e4736" != span.SpanContext.TraceId.String() {
+		t.Errorf("span did not continue remote trace, got trace %s", span.SpanContext.TraceId)
+	}
+	if "00f067aa0ba902b7" != span.Parent.SpanId.String() {
+		t.Errorf("failed span parent control, got %s", span.Parent.SpanId)
+	}
+	if inner != span.SpanContext {
+		t.Error("request Context does not hold the middleware span")
+	}
+	if !hasAttrs(span.Attrs, []slog.Attr{slog.Int("http.response.status_code", http.StatusTeapot)}) {
+		t.Errorf("failed status attribute control, got %v", span.Attrs)
+	}
+}
@@ -0,0 +1,301 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxMsgSize is the message size limit used when ConnConfig.MaxMsgSize is 0.
+	// It matches the noise protocol message size limit.
+	DefaultMaxMsgSize = 0xFFFF
+)
+
+// ConnConfig holds configuration of Transports built on top of a net.Conn.
+type ConnConfig struct {
+	// ReadTimeout limits the time allowed for reading a message. 0 disables the limit.
+	ReadTimeout time.Duration
+
+	// WriteTimeout limits the time allowed for writing a message. 0 disables the limit.
+	WriteTimeout time.Duration
+
+	// MaxMsgSize limits the size of exchanged messages. 0 means DefaultMaxMsgSize.
+	MaxMsgSize int
+}
+
+// Check returns an error if the ConnConfig is invalid.
+func (self ConnConfig) Check() error {
+	if self.ReadTimeout < 0 || self.WriteTimeout < 0 {
+		return newError("invalid negative timeout")
+	}
+	if self.MaxMsgSize < 0 {
+		return newError("invalid negative MaxMsgSize")
+	}
+
+	return nil
+}
+
+// maxMsgSize returns the effective message size limit.
+func (self ConnConfig) maxMsgSize() int {
+	if 0 == self.MaxMsgSize {
+		return DefaultMaxMsgSize
+	}
+
+	return self.MaxMsgSize
+}
+
+// connState holds the net.Conn management logic shared by connection oriented Transports.
+type connState struct {
+	ctx    context.Context
+	conn   net.Conn
+	cfg    ConnConfig
+	stop   func() bool
+	closer sync.Once
+}
+
+// init binds conn to ctx, so that conn is closed when ctx is done.
+func (self *connState) init(ctx context.Context, conn net.Conn, cfg ConnConfig) error {
+	if nil == ctx {
+		return newError("nil ctx")
+	}
+	if nil == conn {
+		return newError("nil conn")
+	}
+	err := cfg.Check()
+	if nil != err {
+		return wrapError(err, "invalid ConnConfig")
+	}
+	self.ctx = ctx
+	self.conn = conn
+	self.cfg = cfg
+	self.stop = context.AfterFunc(ctx, func() { conn.Close() })
+
+	return nil
+}
+
+// setReadDeadline applies the configured ReadTimeout to the next read operations.
+func (self *connState) setReadDeadline() error {
+	var deadline time.Time
+	if self.cfg.ReadTimeout > 0 {
+		deadline = time.Now().Add(self.cfg.ReadTimeout)
+	}
+
+	return self.conn.SetReadDeadline(deadline)
+}
+
+// setWriteDeadline applies the configured WriteTimeout to the next write operations.
+func (self *connState) setWriteDeadline() error {
+	var deadline time.Time
+	if self.cfg.WriteTimeout > 0 {
+		deadline = time.Now().Add(self.cfg.WriteTimeout)
+	}
+
+	return self.conn.SetWriteDeadline(deadline)
+}
+
+// ioError wraps err adding the bound context error if the context is done.
+func (self *connState) ioError(err error, msg string, args ...any) error {
+	if nil == err {
+		return nil
+	}
+	if cerr := context.Cause(self.ctx); nil != cerr {
+		err = errors.Join(cerr, err)
+	} else if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = errors.Join(TimeoutError, err)
+	}
+
+	return wrapError(err, msg, args...)
+}
+
+// close unbinds the context and closes the underlying net.Conn.
+func (self *connState) close() error {
+	var err error
+	self.closer.Do(func() {
+		self.stop()
+		err = self.conn.Close()
+	})
+
+	return wrapError(err, "failed closing conn")
+}
+
+// ConnTransport is a Transport that exchanges messages over a net.Conn.
+// It uses the same 2 bytes length prefix framing as RWTransport.
+//
+// ConnTransport is bound to the context used to create it, the underlying net.Conn
+// is closed when this context is done.
+type ConnTransport struct {
+	connState
+	rmut sync.Mutex
+	wmut sync.Mutex
+}
+
+// NewConnTransport returns a ConnTransport that uses conn for exchanging messages.
+// It errors if ctx or conn is nil or cfg is invalid.
+func NewConnTransport(ctx context.Context, conn net.Conn, cfg ConnConfig) (*ConnTransport, error) {
+	if cfg.maxMsgSize() > 0xFFFF {
+		return nil, newError("MaxMsgSize larger than %d", 0xFFFF)
+	}
+	rv := &ConnTransport{}
+	err := rv.init(ctx, conn, cfg)
+	if nil != err {
+		return nil, wrapError(err, "failed connState initialization")
+	}
+
+	return rv, nil
+}
+
+// ReadBytes reads next message from the underlying net.Conn.
+// It errors if the message is larger than the configured MaxMsgSize.
+func (self *ConnTransport) ReadBytes() ([]byte, error) {
+	self.rmut.Lock()
+	defer self.rmut.Unlock()
+
+	err := self.setReadDeadline()
+	if nil != err {
+		return nil, self.ioError(err, "failed setting read deadline")
+	}
+
+	// read size
+	psb := make([]byte, 2)
+	_, err = io.ReadFull(self.conn, psb)
+	if nil != err {
+		return nil, self.ioError(err, "failed reading data size")
+	}
+	psz := int(binary.BigEndian.Uint16(psb))
+	if psz > self.cfg.maxMsgSize() {
+		return nil, wrapError(SizeLimitError, "incoming message larger than %d", self.cfg.maxMsgSize())
+	}
+
+	// read data
+	data := make([]byte, psz)
+	_, err = io.ReadFull(self.conn, data)
+	if nil != err {
+		return nil, self.ioError(err, "failed reading data")
+	}
+
+	return data, nil
+}
+
+// WriteBytes writes data to the underlying net.Conn.
+// It errors if data is larger than the configured MaxMsgSize.
+func (self *ConnTransport) WriteBytes(data []byte) error {
+	if len(data) > self.cfg.maxMsgSize() {
+		return wrapError(SizeLimitError, "data larger than %d", self.cfg.maxMsgSize())
+	}
+
+	self.wmut.Lock()
+	defer self.wmut.Unlock()
+
+	err := self.setWriteDeadline()
+	if nil != err {
+		return self.ioError(err, "failed setting write deadline")
+	}
+
+	// prefix data with uint16 length
+	pdata := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(pdata, uint16(len(data)))
+	copy(pdata[2:], data)
+
+	_, err = self.conn.Write(pdata)
+
+	return self.ioError(err, "failed writing data") // nil if err is nil
+}
+
+// Close closes the underlying net.Conn.
+func (self *ConnTransport) Close() error {
+	return self.close()
+}
+
+// Conn returns the underlying net.Conn.
+func (self *ConnTransport) Conn() net.Conn {
+	return self.conn
+}
+
+var _ Transport = &ConnTransport{}
+
+// Listener accepts incoming connections and wraps them in ConnTransport.
+type Listener struct {
+	net.Listener
+	Cfg ConnConfig
+}
+
+// Listen announces on the local network address and returns a Listener that produces ConnTransport
+// configured with cfg.
+//
+// Refers to net.Listen documentation for a description of the network & address parameters.
+func Listen(ctx context.Context, network, address string, cfg ConnConfig) (*Listener, error) {
+	err := cfg.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid ConnConfig")
+	}
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, network, address)
+	if nil != err {
+		return nil, wrapError(err, "failed listening on %s %s", network, address)
+	}
+
+	return &Listener{Listener: ln, Cfg: cfg}, nil
+}
+
+// AcceptTransport waits for the next incoming connection and returns it wrapped in a ConnTransport
+// bound to ctx.
+//
+// AcceptTransport returns early with an error if ctx is done before a connection is received.
+func (self *Listener) AcceptTransport(ctx context.Context) (*ConnTransport, error) {
+	type deadliner interface {
+		SetDeadline(t time.Time) error
+	}
+	dl, canCancel := self.Listener.(deadliner)
+	if canCancel {
+		stop := context.AfterFunc(ctx, func() { dl.SetDeadline(time.Now()) })
+		defer func() {
+			if !stop() {
+				// ctx was done, the listener deadline needs to be cleared
+				dl.SetDeadline(time.Time{})
+			}
+		}()
+	}
+
+	conn, err := self.Listener.Accept()
+	if nil != err {
+		if cerr := context.Cause(ctx); nil != cerr {
+			err = errors.Join(cerr, err)
+		}
+		return nil, wrapError(err, "failed accepting connection")
+	}
+	tr, err := NewConnTransport(ctx, conn, self.Cfg)
+	if nil != err {
+		conn.Close()
+		return nil, wrapError(err, "failed creating ConnTransport")
+	}
+
+	return tr, nil
+}
+
+// Dial connects to address and returns a ConnTransport bound to ctx.
+//
+// Refers to net.Dial documentation for a description of the network & address parameters.
+func Dial(ctx context.Context, network, address string, cfg ConnConfig) (*ConnTransport, error) {
+	err := cfg.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid ConnConfig")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if nil != err {
+		return nil, wrapError(err, "failed dialing %s %s", network, address)
+	}
+	tr, err := NewConnTransport(ctx, conn, cfg)
+	if nil != err {
+		conn.Close()
+		return nil, wrapError(err, "failed creating ConnTransport")
+	}
+
+	return tr, nil
+}
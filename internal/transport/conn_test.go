@@ -0,0 +1,212 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestConnTransportEcho(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cfg := ConnConfig{ReadTimeout: time.Second, WriteTimeout: time.Second}
+	ln := listenTest(t, ctx, cfg)
+
+	go echoServe(t, ctx, ln)
+
+	cli, err := Dial(ctx, "tcp", ln.Addr().String(), cfg)
+	if nil != err {
+		t.Fatalf("failed Dial, got error %v", err)
+	}
+	defer cli.Close()
+
+	for i, wmsg := range [][]byte{[]byte("datagram"), {}, make([]byte, DefaultMaxMsgSize)} {
+		err = cli.WriteBytes(wmsg)
+		if nil != err {
+			t.Fatalf("failed WriteBytes #%d, got error %v", i, err)
+		}
+		rmsg, err := cli.ReadBytes()
+		if nil != err {
+			t.Fatalf("failed ReadBytes #%d, got error %v", i, err)
+		}
+		if !slices.Equal(rmsg, wmsg) {
+			t.Fatalf("failed rmsg control #%d", i)
+		}
+	}
+}
+
+func TestNewConnTransportNilCtx(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	defer srv.Close()
+
+	_, err := NewConnTransport(nil, cli, ConnConfig{})
+	if nil == err {
+		t.Fatal("NewConnTransport did not fail with nil ctx")
+	}
+}
+
+func TestConnTransportMaxMsgSize(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ln := listenTest(t, ctx, ConnConfig{MaxMsgSize: 8})
+
+	srvErr := make(chan error, 1)
+	go func() {
+		srv, err := ln.AcceptTransport(ctx)
+		if nil != err {
+			srvErr <- err
+			return
+		}
+		defer srv.Close()
+		_, err = srv.ReadBytes()
+		srvErr <- err
+	}()
+
+	cli, err := Dial(ctx, "tcp", ln.Addr().String(), ConnConfig{})
+	if nil != err {
+		t.Fatalf("failed Dial, got error %v", err)
+	}
+	defer cli.Close()
+
+	err = cli.WriteBytes([]byte("larger than 8"))
+	if nil != err {
+		t.Fatalf("failed WriteBytes, got error %v", err)
+	}
+	err = <-srvErr
+	if !errors.Is(err, SizeLimitError) {
+		t.Fatalf("server ReadBytes did not fail with SizeLimitError, got error %v", err)
+	}
+
+	// the limit also applies to written messages
+	limited, err := Dial(ctx, "tcp", ln.Addr().String(), ConnConfig{MaxMsgSize: 4})
+	if nil != err {
+		t.Fatalf("failed Dial, got error %v", err)
+	}
+	defer limited.Close()
+	err = limited.WriteBytes([]byte("12345"))
+	if !errors.Is(err, SizeLimitError) {
+		t.Fatalf("WriteBytes did not fail with SizeLimitError, got error %v", err)
+	}
+}
+
+func TestConnTransportReadTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ln := listenTest(t, ctx, ConnConfig{})
+
+	// server accepts but never writes
+	go func() {
+		srv, err := ln.AcceptTransport(ctx)
+		if nil == err {
+			<-ctx.Done()
+			srv.Close()
+		}
+	}()
+
+	cli, err := Dial(ctx, "tcp", ln.Addr().String(), ConnConfig{ReadTimeout: 50 * time.Millisecond})
+	if nil != err {
+		t.Fatalf("failed Dial, got error %v", err)
+	}
+	defer cli.Close()
+
+	_, err = cli.ReadBytes()
+	if !errors.Is(err, TimeoutError) {
+		t.Fatalf("ReadBytes did not fail with TimeoutError, got error %v", err)
+	}
+}
+
+func TestConnTransportCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ln := listenTest(t, ctx, ConnConfig{})
+
+	go func() {
+		srv, err := ln.AcceptTransport(ctx)
+		if nil == err {
+			<-ctx.Done()
+			srv.Close()
+		}
+	}()
+
+	cctx, ccancel := context.WithCancel(ctx)
+	cli, err := Dial(cctx, "tcp", ln.Addr().String(), ConnConfig{})
+	if nil != err {
+		t.Fatalf("failed Dial, got error %v", err)
+	}
+	defer cli.Close()
+
+	time.AfterFunc(50*time.Millisecond, ccancel)
+	_, err = cli.ReadBytes()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadBytes did not fail with context.Canceled, got error %v", err)
+	}
+}
+
+func TestListenerAcceptCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ln := listenTest(t, ctx, ConnConfig{})
+
+	actx, acancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer acancel()
+	_, err := ln.AcceptTransport(actx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AcceptTransport did not fail with context.DeadlineExceeded, got error %v", err)
+	}
+
+	// the Listener remains usable
+	go func() {
+		cli, err := Dial(ctx, "tcp", ln.Addr().String(), ConnConfig{})
+		if nil == err {
+			cli.WriteBytes([]byte("hello"))
+			cli.Close()
+		}
+	}()
+	srv, err := ln.AcceptTransport(ctx)
+	if nil != err {
+		t.Fatalf("failed AcceptTransport after cancellation, got error %v", err)
+	}
+	defer srv.Close()
+	msg, err := srv.ReadBytes()
+	if nil != err || "hello" != string(msg) {
+		t.Fatalf("failed ReadBytes, got msg %q & error %v", msg, err)
+	}
+}
+
+func listenTest(t *testing.T, ctx context.Context, cfg ConnConfig) *Listener {
+	ln, err := Listen(ctx, "tcp", "127.0.0.1:0", cfg)
+	if nil != err {
+		t.Fatalf("failed Listen, got error %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	return ln
+}
+
+// echoServe accepts a single connection and echoes received messages until error.
+func echoServe(t *testing.T, ctx context.Context, ln *Listener) {
+	srv, err := ln.AcceptTransport(ctx)
+	if nil != err {
+		t.Errorf("failed AcceptTransport, got error %v", err)
+		return
+	}
+	defer srv.Close()
+	echo(srv)
+}
+
+func echo(tr Transport) {
+	for {
+		msg, err := tr.ReadBytes()
+		if nil != err {
+			return
+		}
+		err = tr.WriteBytes(msg)
+		if nil != err {
+			return
+		}
+	}
+}
@@ -15,6 +15,9 @@ const (
 	EncryptionError    = errorFlag("transport: encryption error")
 	ReadLimitError     = errorFlag("transport: set read limit exceeded")
 	WriteLimitError    = errorFlag("transport: set write limit exceeded")
+	SizeLimitError     = errorFlag("transport: message size limit exceeded")
+	TimeoutError       = errorFlag("transport: timeout")
+	ProtocolError      = errorFlag("transport: protocol error")
 	noError            = errorFlag("")
 )
 
@@ -0,0 +1,489 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket opcodes & close codes, refers to RFC 6455 sections 5.2 & 7.4.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsCloseNormal        = 1000
+	wsCloseProtocolError = 1002
+	wsCloseInvalidData   = 1007
+	wsCloseTooBig        = 1009
+
+	wsMaxControlSize = 125
+	wsCloseTimeout   = time.Second
+	wsGUID           = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// WSTransport is a Transport that exchanges binary WebSocket messages.
+//
+// WSTransport implements the subset of RFC 6455 required for exchanging protocol messages. Extensions
+// and subprotocols are not supported. Ping frames are answered and close frames are acknowledged
+// while reading messages. Text messages are accepted only if they are valid UTF-8.
+//
+// WSTransport is bound to the context used to create it, the underlying net.Conn is closed when this
+// context is done.
+type WSTransport struct {
+	connState
+	br     *bufio.Reader
+	client bool
+	rmut   sync.Mutex
+	wmut   sync.Mutex
+	closed bool // protected by wmut, true once a close frame was sent
+}
+
+// newWSTransport returns a WSTransport that reads from br and writes to conn.
+func newWSTransport(ctx context.Context, conn net.Conn, br *bufio.Reader, client bool, cfg ConnConfig) (*WSTransport, error) {
+	rv := &WSTransport{br: br, client: client}
+	err := rv.init(ctx, conn, cfg)
+	if nil != err {
+		return nil, wrapError(err, "failed connState initialization")
+	}
+	if nil == rv.br {
+		rv.br = bufio.NewReader(conn)
+	}
+
+	return rv, nil
+}
+
+// WSUpgrade upgrades the HTTP server connection to the WebSocket protocol and returns a WSTransport
+// bound to ctx. If the upgrade fails, WSUpgrade replies to the client with an HTTP error.
+func WSUpgrade(ctx context.Context, w http.ResponseWriter, r *http.Request, cfg ConnConfig) (*WSTransport, error) {
+	err := cfg.Check()
+	if nil != err {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return nil, wrapError(err, "invalid ConnConfig")
+	}
+	if http.MethodGet != r.Method {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, newError("invalid upgrade method %s", r.Method)
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return nil, newError("missing websocket upgrade headers")
+	}
+	if "13" != r.Header.Get("Sec-WebSocket-Version") {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, newError("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if kb, err := base64.StdEncoding.DecodeString(key); nil != err || 16 != len(kb) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return nil, newError("invalid Sec-WebSocket-Key")
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if nil != err {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return nil, wrapError(err, "failed hijacking connection")
+	}
+
+	// clear deadlines that may have been set by the http.Server
+	conn.SetDeadline(time.Time{})
+
+	var sb strings.Builder
+	sb.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	sb.WriteString("Upgrade: websocket\r\n")
+	sb.WriteString("Connection: Upgrade\r\n")
+	sb.WriteString("Sec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n")
+	if cfg.WriteTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+	}
+	_, err = io.WriteString(conn, sb.String())
+	if nil != err {
+		conn.Close()
+		return nil, wrapError(err, "failed writing upgrade response")
+	}
+
+	tr, err := newWSTransport(ctx, conn, brw.Reader, false, cfg)
+	if nil != err {
+		conn.Close()
+		return nil, wrapError(err, "failed creating WSTransport")
+	}
+
+	return tr, nil
+}
+
+// WSDial opens a WebSocket connection to rawurl and returns a WSTransport bound to ctx.
+//
+// rawurl scheme shall be ws or wss.
+func WSDial(ctx context.Context, rawurl string, cfg ConnConfig) (*WSTransport, error) {
+	err := cfg.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid ConnConfig")
+	}
+	u, err := url.Parse(rawurl)
+	if nil != err {
+		return nil, wrapError(err, "invalid url")
+	}
+
+	var conn net.Conn
+	address := u.Host
+	switch u.Scheme {
+	case "ws":
+		if "" == u.Port() {
+			address = net.JoinHostPort(u.Hostname(), "80")
+		}
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	case "wss":
+		if "" == u.Port() {
+			address = net.JoinHostPort(u.Hostname(), "443")
+		}
+		var dialer tls.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	default:
+		return nil, newError("invalid url scheme %s", u.Scheme)
+	}
+	if nil != err {
+		return nil, wrapError(err, "failed dialing %s", address)
+	}
+
+	tr, err := wsClientHandshake(ctx, conn, u, cfg)
+	if nil != err {
+		conn.Close()
+		return nil, wrapError(err, "failed websocket handshake")
+	}
+
+	return tr, nil
+}
+
+// wsClientHandshake sends the upgrade request over conn and validates the server response.
+func wsClientHandshake(ctx context.Context, conn net.Conn, u *url.URL, cfg ConnConfig) (*WSTransport, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	kb := make([]byte, 16)
+	rand.Read(kb)
+	key := base64.StdEncoding.EncodeToString(kb)
+
+	hu := *u
+	hu.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hu.String(), nil)
+	if nil != err {
+		return nil, wrapError(err, "failed creating upgrade request")
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	err = req.Write(conn)
+	if nil != err {
+		return nil, wrapError(err, "failed writing upgrade request")
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if nil != err {
+		return nil, wrapError(err, "failed reading upgrade response")
+	}
+	resp.Body.Close()
+	if http.StatusSwitchingProtocols != resp.StatusCode {
+		return nil, wrapError(ProtocolError, "upgrade refused, got status %d", resp.StatusCode)
+	}
+	if !headerHasToken(resp.Header, "Connection", "upgrade") || !headerHasToken(resp.Header, "Upgrade", "websocket") {
+		return nil, wrapError(ProtocolError, "missing websocket upgrade headers")
+	}
+	if wsAcceptKey(key) != resp.Header.Get("Sec-WebSocket-Accept") {
+		return nil, wrapError(ProtocolError, "invalid Sec-WebSocket-Accept")
+	}
+
+	return newWSTransport(ctx, conn, br, true, cfg)
+}
+
+// ReadBytes returns the next data message received from the WebSocket peer.
+// It errors if the message is larger than the configured MaxMsgSize or if the peer closed the connection.
+func (self *WSTransport) ReadBytes() ([]byte, error) {
+	self.rmut.Lock()
+	defer self.rmut.Unlock()
+
+	err := self.setReadDeadline()
+	if nil != err {
+		return nil, self.ioError(err, "failed setting read deadline")
+	}
+
+	maxsize := self.cfg.maxMsgSize()
+	var msg []byte
+	var fin, started, text bool
+	var opcode byte
+	var payload []byte
+	for {
+		fin, opcode, payload, err = self.readFrame(maxsize - len(msg))
+		if nil != err {
+			return nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			err = self.writeFrame(wsOpPong, payload)
+			if nil != err {
+				return nil, wrapError(err, "failed answering ping")
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			self.writeClose(wsCloseNormal)
+			return nil, wrapError(io.EOF, "peer closed the connection")
+		case wsOpText, wsOpBinary:
+			if started {
+				self.writeClose(wsCloseProtocolError)
+				return nil, wrapError(ProtocolError, "new message started before previous message completion")
+			}
+			started = true
+			text = wsOpText == opcode
+			msg = append(msg, payload...)
+		case wsOpContinuation:
+			if !started {
+				self.writeClose(wsCloseProtocolError)
+				return nil, wrapError(ProtocolError, "unexpected continuation frame")
+			}
+			msg = append(msg, payload...)
+		default:
+			self.writeClose(wsCloseProtocolError)
+			return nil, wrapError(ProtocolError, "unsupported opcode %d", opcode)
+		}
+		if started && fin {
+			break
+		}
+	}
+	if text && !utf8.Valid(msg) {
+		// RFC 6455 section 8.1, invalid text data fails the WebSocket connection
+		self.writeClose(wsCloseInvalidData)
+		return nil, wrapError(ProtocolError, "invalid UTF-8 text message")
+	}
+	if nil == msg {
+		msg = []byte{}
+	}
+
+	return msg, nil
+}
+
+// readFrame reads next frame from the WebSocket connection.
+// It errors if the frame payload is larger than maxsize.
+func (self *WSTransport) readFrame(maxsize int) (bool, byte, []byte, error) {
+	hdr := make([]byte, 8)
+	_, err := io.ReadFull(self.br, hdr[:2])
+	if nil != err {
+		return false, 0, nil, self.ioError(err, "failed reading frame header")
+	}
+	fin := 0 != (hdr[0] & 0x80)
+	opcode := hdr[0] & 0x0F
+	if 0 != (hdr[0] & 0x70) {
+		self.writeClose(wsCloseProtocolError)
+		return fin, opcode, nil, wrapError(ProtocolError, "unsupported frame extension bits")
+	}
+	masked := 0 != (hdr[1] & 0x80)
+	if masked == self.client {
+		// RFC 6455 section 5.1, client to server frames are masked, server to client frames are not
+		self.writeClose(wsCloseProtocolError)
+		return fin, opcode, nil, wrapError(ProtocolError, "invalid frame masking")
+	}
+
+	var size uint64
+	switch psz := hdr[1] & 0x7F; psz {
+	case 126:
+		_, err = io.ReadFull(self.br, hdr[:2])
+		size = uint64(binary.BigEndian.Uint16(hdr[:2]))
+	case 127:
+		_, err = io.ReadFull(self.br, hdr)
+		size = binary.BigEndian.Uint64(hdr)
+	default:
+		size = uint64(psz)
+	}
+	if nil != err {
+		return fin, opcode, nil, self.ioError(err, "failed reading frame size")
+	}
+	if opcode >= wsOpClose {
+		if !fin || size > wsMaxControlSize {
+			self.writeClose(wsCloseProtocolError)
+			return fin, opcode, nil, wrapError(ProtocolError, "invalid control frame")
+		}
+	} else if size > uint64(max(maxsize, 0)) {
+		self.writeClose(wsCloseTooBig)
+		return fin, opcode, nil, wrapError(SizeLimitError, "incoming message larger than %d", self.cfg.maxMsgSize())
+	}
+
+	var mask [4]byte
+	if masked {
+		_, err = io.ReadFull(self.br, mask[:])
+		if nil != err {
+			return fin, opcode, nil, self.ioError(err, "failed reading frame mask")
+		}
+	}
+	payload := make([]byte, int(size))
+	_, err = io.ReadFull(self.br, payload)
+	if nil != err {
+		return fin, opcode, nil, self.ioError(err, "failed reading frame payload")
+	}
+	if masked {
+		wsMask(mask, payload)
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// WriteBytes sends data as a binary WebSocket message.
+// It errors if data is larger than the configured MaxMsgSize.
+func (self *WSTransport) WriteBytes(data []byte) error {
+	if len(data) > self.cfg.maxMsgSize() {
+		return wrapError(SizeLimitError, "data larger than %d", self.cfg.maxMsgSize())
+	}
+
+	return self.writeFrame(wsOpBinary, data)
+}
+
+// writeFrame writes a single frame with FIN bit set.
+func (self *WSTransport) writeFrame(opcode byte, payload []byte) error {
+	self.wmut.Lock()
+	defer self.wmut.Unlock()
+
+	if self.closed {
+		return wrapError(io.ErrClosedPipe, "close frame already sent")
+	}
+
+	var err error
+	if wsOpClose == opcode {
+		// close frames are sent on a best effort basis, they shall not block for long...
+		self.closed = true
+		timeout := self.cfg.WriteTimeout
+		if 0 == timeout || timeout > wsCloseTimeout {
+			timeout = wsCloseTimeout
+		}
+		err = self.conn.SetWriteDeadline(time.Now().Add(timeout))
+	} else {
+		err = self.setWriteDeadline()
+	}
+	if nil != err {
+		return self.ioError(err, "failed setting write deadline")
+	}
+
+	size := len(payload)
+	frame := make([]byte, 0, 14+size)
+	frame = append(frame, 0x80|opcode)
+	var maskbit byte
+	if self.client {
+		maskbit = 0x80
+	}
+	switch {
+	case size < 126:
+		frame = append(frame, maskbit|byte(size))
+	case size <= 0xFFFF:
+		frame = append(frame, maskbit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(size))
+	default:
+		frame = append(frame, maskbit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(size))
+	}
+	if self.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		wsMask(mask, frame[start:])
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err = self.conn.Write(frame)
+
+	return self.ioError(err, "failed writing frame") // nil if err is nil
+}
+
+// writeClose sends a close frame with status code, errors are ignored.
+func (self *WSTransport) writeClose(code uint16) {
+	self.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, code))
+}
+
+// Close sends a close frame to the peer and closes the underlying net.Conn.
+func (self *WSTransport) Close() error {
+	self.writeClose(wsCloseNormal)
+
+	return self.close()
+}
+
+// Conn returns the underlying net.Conn.
+func (self *WSTransport) Conn() net.Conn {
+	return self.conn
+}
+
+var _ Transport = &WSTransport{}
+
+// WSHandler is an http.Handler that upgrades incoming requests to the WebSocket protocol
+// and serves the resulting WSTransport using Serve.
+type WSHandler struct {
+	Cfg ConnConfig
+
+	// Serve is called with the upgraded request context. The WSTransport is closed when Serve returns.
+	Serve func(ctx context.Context, tr Transport) error
+}
+
+// ServeHTTP implements http.Handler.
+func (self WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tr, err := WSUpgrade(ctx, w, r, self.Cfg)
+	if nil != err {
+		return
+	}
+	defer tr.Close()
+
+	if nil != self.Serve {
+		self.Serve(ctx, tr)
+	}
+}
+
+var _ http.Handler = WSHandler{}
+
+// wsAcceptKey returns the Sec-WebSocket-Accept value that corresponds to key.
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(wsGUID))
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// wsMask applies mask to data in place.
+func wsMask(mask [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= mask[i%4]
+	}
+}
+
+// headerHasToken returns true if the comma separated name header values contain token.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for part := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,315 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWSTransportEcho(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cfg := ConnConfig{ReadTimeout: time.Second, WriteTimeout: time.Second, MaxMsgSize: 1 << 17}
+	srv := wsEchoServer(t, cfg)
+
+	cli, err := WSDial(ctx, wsUrl(srv), cfg)
+	if nil != err {
+		t.Fatalf("failed WSDial, got error %v", err)
+	}
+	defer cli.Close()
+
+	// sizes exercise the 3 frame size encodings
+	for i, wmsg := range [][]byte{[]byte("datagram"), {}, make([]byte, 300), make([]byte, 1<<17)} {
+		err = cli.WriteBytes(wmsg)
+		if nil != err {
+			t.Fatalf("failed WriteBytes #%d, got error %v", i, err)
+		}
+		rmsg, err := cli.ReadBytes()
+		if nil != err {
+			t.Fatalf("failed ReadBytes #%d, got error %v", i, err)
+		}
+		if !slices.Equal(rmsg, wmsg) {
+			t.Fatalf("failed rmsg control #%d", i)
+		}
+	}
+}
+
+func TestWSTransportFragmentsAndPing(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// server side WSTransport is obtained from a raw client that crafts frames
+	trc := make(chan *WSTransport, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tr, err := WSUpgrade(ctx, w, r, ConnConfig{})
+		if nil != err {
+			t.Errorf("failed WSUpgrade, got error %v", err)
+			return
+		}
+		trc <- tr
+		<-ctx.Done()
+	}))
+	defer srv.Close()
+
+	conn, br := wsRawDial(t, srv)
+	defer conn.Close()
+	tr := <-trc
+	defer tr.Close()
+
+	// message split in 3 fragments with an interleaved ping
+	mask := [4]byte{1, 2, 3, 4}
+	frames := slices.Concat(
+		wsRawFrame(wsOpBinary, false, mask, []byte("hello ")),
+		wsRawFrame(wsOpPing, true, mask, []byte("ping")),
+		wsRawFrame(wsOpContinuation, false, mask, []byte("fragmented ")),
+		wsRawFrame(wsOpContinuation, true, mask, []byte("world")),
+	)
+	_, err := conn.Write(frames)
+	if nil != err {
+		t.Fatalf("failed writing raw frames, got error %v", err)
+	}
+	msg, err := tr.ReadBytes()
+	if nil != err {
+		t.Fatalf("failed ReadBytes, got error %v", err)
+	}
+	if "hello fragmented world" != string(msg) {
+		t.Fatalf("failed msg control, got %q", msg)
+	}
+
+	// the ping shall have been answered
+	hdr := make([]byte, 2)
+	_, err = io.ReadFull(br, hdr)
+	if nil != err {
+		t.Fatalf("failed reading pong header, got error %v", err)
+	}
+	if (0x80|wsOpPong) != hdr[0] || 4 != hdr[1] {
+		t.Fatalf("failed pong header control, got % X", hdr)
+	}
+	payload := make([]byte, 4)
+	io.ReadFull(br, payload)
+	if "ping" != string(payload) {
+		t.Fatalf("failed pong payload control, got %q", payload)
+	}
+
+	// unmasked client frames are rejected
+	_, err = conn.Write(wsRawFrame(wsOpBinary, true, [4]byte{}, []byte("unmasked")))
+	if nil != err {
+		t.Fatalf("failed writing raw frame, got error %v", err)
+	}
+	_, err = tr.ReadBytes()
+	if !errors.Is(err, ProtocolError) {
+		t.Fatalf("ReadBytes did not fail with ProtocolError, got error %v", err)
+	}
+}
+
+func TestWSTransportInvalidText(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	trc := make(chan *WSTransport, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tr, err := WSUpgrade(ctx, w, r, ConnConfig{})
+		if nil != err {
+			t.Errorf("failed WSUpgrade, got error %v", err)
+			return
+		}
+		trc <- tr
+		<-ctx.Done()
+	}))
+	defer srv.Close()
+
+	conn, br := wsRawDial(t, srv)
+	defer conn.Close()
+	tr := <-trc
+	defer tr.Close()
+
+	// a multi byte character split across fragments is valid
+	mask := [4]byte{1, 2, 3, 4}
+	euro := []byte("€")
+	frames := slices.Concat(
+		wsRawFrame(wsOpText, false, mask, euro[:1]),
+		wsRawFrame(wsOpContinuation, true, mask, euro[1:]),
+	)
+	_, err := conn.Write(frames)
+	if nil != err {
+		t.Fatalf("failed writing raw frames, got error %v", err)
+	}
+	msg, err := tr.ReadBytes()
+	if nil != err {
+		t.Fatalf("failed ReadBytes, got error %v", err)
+	}
+	if "€" != string(msg) {
+		t.Fatalf("failed msg control, got %q", msg)
+	}
+
+	// invalid UTF-8 text fails the connection with status 1007
+	_, err = conn.Write(wsRawFrame(wsOpText, true, mask, []byte{0xC3, 0x28}))
+	if nil != err {
+		t.Fatalf("failed writing raw frame, got error %v", err)
+	}
+	_, err = tr.ReadBytes()
+	if !errors.Is(err, ProtocolError) {
+		t.Fatalf("ReadBytes did not fail with ProtocolError, got error %v", err)
+	}
+	frame := make([]byte, 4)
+	_, err = io.ReadFull(br, frame)
+	if nil != err {
+		t.Fatalf("failed reading close frame, got error %v", err)
+	}
+	if (0x80|wsOpClose) != frame[0] || 2 != frame[1] || wsCloseInvalidData != binary.BigEndian.Uint16(frame[2:]) {
+		t.Fatalf("failed close frame control, got % X", frame)
+	}
+}
+
+func TestWSTransportMaxMsgSize(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	srvErr := make(chan error, 1)
+	srv := httptest.NewServer(WSHandler{
+		Cfg: ConnConfig{MaxMsgSize: 8},
+		Serve: func(_ context.Context, tr Transport) error {
+			_, err := tr.ReadBytes()
+			srvErr <- err
+			return err
+		},
+	})
+	defer srv.Close()
+
+	cli, err := WSDial(ctx, wsUrl(srv), ConnConfig{})
+	if nil != err {
+		t.Fatalf("failed WSDial, got error %v", err)
+	}
+	defer cli.Close()
+
+	err = cli.WriteBytes([]byte("larger than 8"))
+	if nil != err {
+		t.Fatalf("failed WriteBytes, got error %v", err)
+	}
+	err = <-srvErr
+	if !errors.Is(err, SizeLimitError) {
+		t.Fatalf("server ReadBytes did not fail with SizeLimitError, got error %v", err)
+	}
+
+	// server closed the connection
+	_, err = cli.ReadBytes()
+	if nil == err {
+		t.Fatal("client ReadBytes did not fail after server close")
+	}
+}
+
+func TestWSTransportCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	srv := wsEchoServer(t, ConnConfig{})
+
+	cctx, ccancel := context.WithCancel(ctx)
+	cli, err := WSDial(cctx, wsUrl(srv), ConnConfig{})
+	if nil != err {
+		t.Fatalf("failed WSDial, got error %v", err)
+	}
+	defer cli.Close()
+
+	time.AfterFunc(50*time.Millisecond, ccancel)
+	_, err = cli.ReadBytes()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadBytes did not fail with context.Canceled, got error %v", err)
+	}
+}
+
+func TestWSDialRefused(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := WSDial(ctx, wsUrl(srv), ConnConfig{})
+	if !errors.Is(err, ProtocolError) {
+		t.Fatalf("WSDial did not fail with ProtocolError, got error %v", err)
+	}
+
+	_, err = WSDial(ctx, srv.URL, ConnConfig{})
+	if nil == err {
+		t.Fatal("WSDial succeeded with http url scheme")
+	}
+}
+
+func wsEchoServer(t *testing.T, cfg ConnConfig) *httptest.Server {
+	srv := httptest.NewServer(WSHandler{
+		Cfg: cfg,
+		Serve: func(_ context.Context, tr Transport) error {
+			echo(tr)
+			return nil
+		},
+	})
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func wsUrl(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// wsRawDial performs the WebSocket client handshake and returns the raw connection.
+func wsRawDial(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if nil != err {
+		t.Fatalf("failed Dial, got error %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Write(conn)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if nil != err {
+		t.Fatalf("failed reading upgrade response, got error %v", err)
+	}
+	// value from RFC 6455 section 1.3
+	if "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" != resp.Header.Get("Sec-WebSocket-Accept") {
+		t.Fatalf("failed Sec-WebSocket-Accept control")
+	}
+
+	return conn, br
+}
+
+// wsRawFrame returns a frame masked with mask unless mask is zero.
+func wsRawFrame(opcode byte, fin bool, mask [4]byte, payload []byte) []byte {
+	var b0, maskbit byte = opcode, 0
+	if fin {
+		b0 |= 0x80
+	}
+	masked := [4]byte{} != mask
+	if masked {
+		maskbit = 0x80
+	}
+	frame := []byte{b0}
+	if len(payload) < 126 {
+		frame = append(frame, maskbit|byte(len(payload)))
+	} else {
+		frame = append(frame, maskbit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	if masked {
+		frame = append(frame, mask[:]...)
+	}
+	start := len(frame)
+	frame = append(frame, payload...)
+	if masked {
+		wsMask(mask, frame[start:])
+	}
+
+	return frame
+}
@@ -18,6 +18,16 @@ const (
 	TagAgentCardCreate    = 16
 	TagAgentCardChallenge = 17
 	TagAppOTK             = 16
+	TagAppOTP             = 17
+
+	// Tag in range 32768-65535 have a 3 bytes long CBOR encoding & belong to the IANA
+	// first come first served range, they do not collide with Tags registered by other specs
+
+	// TagEnvelope wraps versioned AgentMsg & AppMsg
+	TagEnvelope = 52048
+
+	// TagHello is used by both CardAgent & CardApp
+	TagHello = 52049
 )
 
 // AgentMsg is implemented by all message types that may be sent by the CardAgent.
@@ -95,6 +105,12 @@ type AgentCardChallenge struct {
 
 	// Server generated nonce
 	INonce []byte `json:"nonce" cbor:"7,keyasint"`
+
+	// key 8 is reserved for the KEM ciphertext of hybrid post quantum schemes
+
+	// CheckDigit requests the CardApp to append the Alphabet CheckDigit of the masked OTP
+	// This allows the Verifier to distinguish typing mistakes from invalid OTP
+	CheckDigit bool `json:"chk,omitempty" cbor:"9,keyasint,omitempty"`
 }
 
 // AgentTag returns TagAgentCardChallenge for CBOR marshaling.
@@ -129,7 +145,7 @@ func (self *AgentCardChallenge) Check() error {
 	if self.E.Curve() != curve {
 		return newError("invalid E not on Scheme curve")
 	}
-	switch sch.KeyExchangePattern() {
+	switch sch.DHPattern() {
 	case "E1S2", "E2S2":
 		if self.S.IsZero() {
 			return newError("missing S public key")
@@ -180,6 +196,10 @@ func UnmarshalAgentMsg(srzmsg []byte) (AgentMsg, error) {
 		msg := &AgentCardChallenge{}
 		err = wrapError(cbor.Unmarshal(tag.Content, msg), "failed cbor.Unmarshal")
 		agentmsg = msg
+	case TagHello:
+		msg := &Hello{}
+		err = wrapError(cbor.Unmarshal(tag.Content, msg), "failed cbor.Unmarshal")
+		agentmsg = msg
 	default:
 		err = newError("invalid AgentMsg tag")
 	}
@@ -255,6 +275,147 @@ func (self *AppOTK) Check() error {
 	return nil
 }
 
+// AppOTP is sent by CardApp to Agent in response to AgentCardChallenge, when the Scheme code
+// is a numeric or alphanumeric OTP that may be typed by the user.
+type AppOTP struct {
+	// CardId is the Card UserId as registered with authentication server
+	CardId []byte `json:"cId" cbor:"1,keyasint"`
+
+	// EPHEMSEC scheme in compressed form
+	Scheme uint16 `json:"scheme" cbor:"2,keyasint"`
+
+	// CardApp generated OTP masked with the AgentCardChallenge OtpPad, formatted with the
+	// Scheme Alphabet without separators
+	OTP string `json:"otp" cbor:"3,keyasint"`
+
+	// CardApp Ephemeral public key
+	// Used when Scheme KeyExchange pattern is E2S2
+	E credentials.PublicKeyHandle `json:"E" cbor:"4,keyasint,omitzero"`
+
+	// CheckDigit is true if OTP ends with the Alphabet CheckDigit of the masked OTP
+	CheckDigit bool `json:"chk,omitempty" cbor:"5,keyasint,omitempty"`
+}
+
+// NewAppOTP returns an AppOTP for the Card with cardId UserId, which OTP is digits masked with pad.
+// If check is true, the OTP ends with the Alphabet CheckDigit of the masked digits.
+// It errors if digits or pad are not compatible with the Scheme Alphabet.
+func NewAppOTP(cardId []byte, scheme uint16, digits []byte, pad []byte, check bool) (*AppOTP, error) {
+	sch, err := ephemsec.GetScheme(scheme)
+	if nil != err {
+		return nil, wrapError(err, "failed Scheme lookup")
+	}
+	alphabet := sch.Alphabet()
+	masked, err := ApplyPad(alphabet, digits, pad, nil)
+	if nil != err {
+		return nil, wrapError(err, "failed applying pad")
+	}
+	var otp string
+	if check {
+		otp, err = alphabet.FormatCheck(masked, 0, 0)
+	} else {
+		otp, err = alphabet.Format(masked, 0, 0)
+	}
+	if nil != err {
+		return nil, wrapError(err, "failed OTP formatting")
+	}
+
+	return &AppOTP{CardId: cardId, Scheme: scheme, OTP: otp, CheckDigit: check}, nil
+}
+
+// AppTag returns TagAppOTP for CBOR marshaling.
+func (self *AppOTP) AppTag() uint64 {
+	return TagAppOTP
+}
+
+// Check returns an error if the AppOTP is invalid.
+func (self *AppOTP) Check() error {
+	if 0 == len(self.CardId) {
+		return newError("invalid CardId, empty")
+	}
+
+	// check Scheme
+	sch, err := ephemsec.GetScheme(self.Scheme)
+	if nil != err {
+		return wrapError(err, "failed Scheme lookup")
+	}
+	alphabet := sch.Alphabet()
+	if 0 == alphabet.Size() {
+		return newError("invalid Scheme, code is not an OTP")
+	}
+
+	// check OTP
+	size := sch.P()
+	if self.CheckDigit {
+		size += 1
+	}
+	_, err = self.masked(sch)
+	if nil != err || len(self.OTP) != size {
+		return newError("invalid OTP, not %d Alphabet characters", size)
+	}
+
+	return nil
+}
+
+// Digits returns the OTP digits after removing pad.
+// pad is the OtpPad of the AgentCardChallenge that the AppOTP responds to.
+func (self *AppOTP) Digits(pad []byte) ([]byte, error) {
+	sch, err := ephemsec.GetScheme(self.Scheme)
+	if nil != err {
+		return nil, wrapError(err, "failed Scheme lookup")
+	}
+	masked, err := self.masked(sch)
+	if nil != err {
+		return nil, wrapError(err, "failed OTP decoding")
+	}
+
+	return RemovePad(sch.Alphabet(), masked, pad, masked[:0])
+}
+
+// masked returns the decoded OTP digits, validating the CheckDigit if present.
+func (self *AppOTP) masked(sch *ephemsec.Scheme) ([]byte, error) {
+	if self.CheckDigit {
+		return sch.Alphabet().DecodeCheck(self.OTP, 0, sch.P(), nil)
+	}
+
+	return sch.Alphabet().Decode(self.OTP, 0, sch.P(), nil)
+}
+
+// ApplyPad appends to dst the digits masked with pad, adding each pad digit modulo the
+// Alphabet size. The CardApp applies the pad before displaying or transferring the OTP.
+// It errors if pad and digits sizes differ or if they contain digits not in the Alphabet.
+func ApplyPad(alphabet ephemsec.Alphabet, digits []byte, pad []byte, dst []byte) ([]byte, error) {
+	return maskDigits(alphabet, digits, pad, dst, 1)
+}
+
+// RemovePad appends to dst the digits unmasked with pad, subtracting each pad digit modulo the
+// Alphabet size. dst may be digits[:0] to remove the pad in place.
+// It errors if pad and digits sizes differ or if they contain digits not in the Alphabet.
+func RemovePad(alphabet ephemsec.Alphabet, digits []byte, pad []byte, dst []byte) ([]byte, error) {
+	return maskDigits(alphabet, digits, pad, dst, -1)
+}
+
+func maskDigits(alphabet ephemsec.Alphabet, digits []byte, pad []byte, dst []byte, sign int) ([]byte, error) {
+	base := alphabet.Size()
+	if base < 2 {
+		return nil, newError("invalid Alphabet, size < 2")
+	}
+	if len(pad) != len(digits) {
+		return nil, newError("invalid pad, size differs from digits size")
+	}
+	err := checkPad(pad, base, len(digits))
+	if nil != err {
+		return nil, wrapError(err, "failed pad validation")
+	}
+	for pos, digit := range digits {
+		if int(digit) >= base {
+			return nil, newError("invalid digit at position %d, not in [0..%d) interval", pos, base)
+		}
+		dst = append(dst, byte((int(digit)+sign*int(pad[pos])+base)%base))
+	}
+
+	return dst, nil
+}
+
 // MarshalAppMsg validates and CBOR-marshals an AppMsg with its proper CBOR tag.
 func MarshalAppMsg(msg AppMsg) ([]byte, error) {
 	var err error
@@ -284,6 +445,14 @@ func UnmarshalAppMsg(srzmsg []byte) (AppMsg, error) {
 		msg := &AppOTK{}
 		err = wrapError(cbor.Unmarshal(tag.Content, msg), "failed cbor.Unmarshal")
 		appmsg = msg
+	case TagAppOTP:
+		msg := &AppOTP{}
+		err = wrapError(cbor.Unmarshal(tag.Content, msg), "failed cbor.Unmarshal")
+		appmsg = msg
+	case TagHello:
+		msg := &Hello{}
+		err = wrapError(cbor.Unmarshal(tag.Content, msg), "failed cbor.Unmarshal")
+		appmsg = msg
 	default:
 		err = newError("invalid AppMsg tag")
 	}
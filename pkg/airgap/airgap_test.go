@@ -3,6 +3,7 @@ package airgap
 import (
 	"crypto/ecdh"
 	"crypto/rand"
+	"slices"
 	"strings"
 	"testing"
 
@@ -182,6 +183,141 @@ func TestAppOTK_Invalid(t *testing.T) {
 	}
 }
 
+// Test AppOTP validation
+func TestAppOTP_Valid(t *testing.T) {
+	msg := validAppOTP(t)
+	if err := msg.Check(); err != nil {
+		t.Errorf("Check() failed for valid AppOTP: %v", err)
+	}
+}
+
+func TestAppOTP_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*AppOTP)
+		want   string
+	}{
+		{"card_id_empty", func(m *AppOTP) {
+			m.CardId = nil
+		}, "CardId"},
+		{"unknown_scheme", func(m *AppOTP) {
+			m.Scheme = 0
+		}, "Scheme"},
+		{"otk_scheme", func(m *AppOTP) {
+			m.Scheme = ephemsec.SHA512_X25519_E1S1_T1024B256P33
+		}, "not an OTP"},
+		{"otp_too_short", func(m *AppOTP) {
+			m.OTP = m.OTP[1:]
+		}, "OTP"},
+		{"otp_invalid_char", func(m *AppOTP) {
+			m.OTP = "1234567X"
+		}, "OTP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := validAppOTP(t)
+			tt.modify(msg)
+
+			err := msg.Check()
+			if err == nil {
+				t.Errorf("Check() succeeded, wanted error containing %q", tt.want)
+			} else if !errorContains(err, tt.want) {
+				t.Errorf("Check() error = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// Test pad application & removal
+func TestPad_RoundTrip(t *testing.T) {
+	tests := []struct {
+		code uint16
+	}{
+		{ephemsec.SHA512_X25519_E1S1_T600B10P8},
+		{ephemsec.SHA512_X25519_E1S2_T600B32P9},
+		{ephemsec.SHA512_X25519_E1S1_T600B32P9},
+	}
+
+	for _, tt := range tests {
+		scheme, err := ephemsec.GetScheme(tt.code)
+		if err != nil {
+			t.Fatalf("Failed to get scheme: %v", err)
+		}
+		t.Run(scheme.Name(), func(t *testing.T) {
+			alphabet := scheme.Alphabet()
+			digits := randomDigits(t, scheme.B(), scheme.P())
+			pad := randomDigits(t, scheme.B(), scheme.P())
+
+			masked, err := ApplyPad(alphabet, digits, pad, nil)
+			if err != nil {
+				t.Fatalf("ApplyPad() failed: %v", err)
+			}
+			for pos := range digits {
+				if int(masked[pos]) != (int(digits[pos])+int(pad[pos]))%scheme.B() {
+					t.Fatalf("ApplyPad() invalid digit at position %d", pos)
+				}
+			}
+			unmasked, err := RemovePad(alphabet, masked, pad, nil)
+			if err != nil {
+				t.Fatalf("RemovePad() failed: %v", err)
+			}
+			if !slices.Equal(digits, unmasked) {
+				t.Errorf("RemovePad() got %v, want %v", unmasked, digits)
+			}
+
+			// AppOTP round trip
+			msg, err := NewAppOTP(make([]byte, 32), tt.code, digits, pad, false)
+			if err != nil {
+				t.Fatalf("NewAppOTP() failed: %v", err)
+			}
+			data, err := MarshalAppMsg(msg)
+			if err != nil {
+				t.Fatalf("MarshalAppMsg() failed: %v", err)
+			}
+			decoded, err := UnmarshalAppMsg(data)
+			if err != nil {
+				t.Fatalf("UnmarshalAppMsg() failed: %v", err)
+			}
+			appotp, ok := decoded.(*AppOTP)
+			if !ok {
+				t.Fatalf("UnmarshalAppMsg() got %T, want *AppOTP", decoded)
+			}
+			otp, err := appotp.Digits(pad)
+			if err != nil {
+				t.Fatalf("Digits() failed: %v", err)
+			}
+			if !slices.Equal(digits, otp) {
+				t.Errorf("Digits() got %v, want %v", otp, digits)
+			}
+		})
+	}
+}
+
+func TestPad_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		digits []byte
+		pad    []byte
+		want   string
+	}{
+		{"size_mismatch", []byte{1, 2, 3}, []byte{1, 2}, "size"},
+		{"pad_out_of_range", []byte{1, 2}, []byte{1, 10}, "pad"},
+		{"digit_out_of_range", []byte{1, 10}, []byte{1, 2}, "digit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ApplyPad(ephemsec.B10Alphabet, tt.digits, tt.pad, nil)
+			if err == nil {
+				t.Errorf("ApplyPad() succeeded, wanted error containing %q", tt.want)
+			} else if !errorContains(err, tt.want) {
+				t.Errorf("ApplyPad() error = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
 // Test Marshal/Unmarshal round trips
 func TestAgentMsg_RoundTrip(t *testing.T) {
 	tests := []struct {
@@ -238,6 +374,21 @@ func TestAppMsg_RoundTrip(t *testing.T) {
 	if decoded.AppTag() != TagAppOTK {
 		t.Errorf("Tag mismatch: got %d, want %d", decoded.AppTag(), TagAppOTK)
 	}
+
+	msg2 := validAppOTP(t)
+	data, err = MarshalAppMsg(msg2)
+	if err != nil {
+		t.Fatalf("MarshalAppMsg() failed: %v", err)
+	}
+
+	decoded, err = UnmarshalAppMsg(data)
+	if err != nil {
+		t.Fatalf("UnmarshalAppMsg() failed: %v", err)
+	}
+
+	if decoded.AppTag() != TagAppOTP {
+		t.Errorf("Tag mismatch: got %d, want %d", decoded.AppTag(), TagAppOTP)
+	}
 }
 
 // Test Unmarshal with invalid/corrupted data
@@ -344,7 +495,7 @@ func validAgentCardChallenge(t *testing.T, schemeCode uint16) *AgentCardChalleng
 	}
 
 	// Determine if S key is required based on key exchange pattern
-	pattern := scheme.KeyExchangePattern()
+	pattern := scheme.DHPattern()
 	needSKey := (pattern == "E1S2" || pattern == "E2S2")
 
 	msg := &AgentCardChallenge{
@@ -371,3 +522,26 @@ func validAppOTK(t *testing.T) *AppOTK {
 		OTK:    make([]byte, 32), // Must be >= 4 per spec
 	}
 }
+
+// Helper: Creates valid AppOTP
+func validAppOTP(t *testing.T) *AppOTP {
+	t.Helper()
+	return &AppOTP{
+		CardId: []byte("alice"),
+		Scheme: ephemsec.SHA512_X25519_E1S1_T600B10P8,
+		OTP:    "12345678",
+	}
+}
+
+// Helper: Generate random digits in [0..base) interval
+func randomDigits(t *testing.T, base int, size int) []byte {
+	t.Helper()
+	digits := make([]byte, size)
+	if _, err := rand.Read(digits); err != nil {
+		t.Fatalf("Failed to generate digits: %v", err)
+	}
+	for pos, digit := range digits {
+		digits[pos] = byte(int(digit) % base)
+	}
+	return digits
+}
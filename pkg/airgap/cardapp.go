@@ -0,0 +1,100 @@
+package airgap
+
+import (
+	"crypto/rand"
+	"time"
+
+	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/ephemsec"
+)
+
+// AnswerChallenge generates the CardApp response to acc.
+//
+// If cId is positive, it uses the Card with cId ID, otherwise it selects the most recently used
+// Card of acc Realm that answers the acc Scheme. The used Card is marked as used in store.
+// It returns an AppOTP if the acc Scheme code is an OTP, an AppOTK otherwise.
+// The AppOTP CardId is the Card UserId, hence Cards without UserId can not answer OTP challenges.
+// It errors wrapping credentials.ErrNotFound if no Card can answer acc.
+func AnswerChallenge(store credentials.ClientCredStore, acc *AgentCardChallenge, cId int) (AppMsg, error) {
+	err := acc.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid AgentCardChallenge")
+	}
+	sch, err := ephemsec.GetScheme(acc.Scheme)
+	if nil != err {
+		return nil, wrapError(err, "failed Scheme lookup")
+	}
+	if nil != sch.Kem() {
+		return nil, newError("unsupported Scheme, ClientCard has no KEM key")
+	}
+	curve := sch.Curve().Curve
+	isOtp := 0 != sch.Alphabet().Size()
+
+	// select card
+	sel := credentials.CardSelection{RealmId: acc.RealmId, Scheme: acc.Scheme}
+	var card credentials.ClientCard
+	if cId > 0 {
+		err = store.LoadCard(cId, &card)
+		if nil != err {
+			return nil, wrapError(err, "failed loading card")
+		}
+		if !sel.Match(&card) {
+			return nil, wrapError(credentials.ErrNotFound, "card does not match AgentCardChallenge")
+		}
+	} else {
+		sel.Limit = 1
+		cards, err := store.SelectCards(sel)
+		if nil != err {
+			return nil, wrapError(err, "failed selecting card")
+		}
+		if 0 == len(cards) {
+			return nil, wrapError(credentials.ErrNotFound, "no card for AgentCardChallenge")
+		}
+		card = cards[0]
+	}
+
+	// generate the card code
+	now := time.Now().Unix()
+	eps := ephemsec.State{
+		Context:        acc.Context,
+		Nonce:          acc.INonce,
+		Time:           now,
+		StaticKey:      card.Kh.PrivateKey,
+		RemoteEphemKey: acc.E.PublicKey,
+		Psk:            card.Psk,
+	}
+	if !acc.S.IsZero() {
+		eps.RemoteStaticKey = acc.S.PublicKey
+	}
+	var ephemKey credentials.PublicKeyHandle
+	if "E2S2" == sch.DHPattern() {
+		eps.EphemKey, err = curve.GenerateKey(rand.Reader)
+		if nil != err {
+			return nil, wrapError(err, "failed generating ephemeral key")
+		}
+		ephemKey.PublicKey = eps.EphemKey.PublicKey()
+	}
+	code, err := eps.EPHEMSEC(sch, ephemsec.Responder, nil)
+	if nil != err {
+		return nil, wrapError(err, "failed EPHEMSEC")
+	}
+
+	var msg AppMsg
+	if !isOtp {
+		msg = &AppOTK{CardId: card.IdToken, OTK: code, E: ephemKey}
+	} else {
+		appotp, err := NewAppOTP([]byte(card.UserId), acc.Scheme, code, acc.OtpPad, acc.CheckDigit)
+		if nil != err {
+			return nil, wrapError(err, "failed generating AppOTP")
+		}
+		appotp.E = ephemKey
+		msg = appotp
+	}
+
+	err = store.SetCardLastUsed(card.ID, now)
+	if nil != err {
+		return nil, wrapError(err, "failed marking card used")
+	}
+
+	return msg, nil
+}
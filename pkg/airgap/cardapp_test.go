@@ -0,0 +1,444 @@
+package airgap
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/ephemsec"
+	"code.kerpass.org/golang/pkg/slp"
+)
+
+func TestAnswerChallenge(t *testing.T) {
+	tests := []struct {
+		name string
+		code uint16
+	}{
+		{"OTP_E1S1", ephemsec.SHA512_X25519_E1S1_T600B10P8},
+		{"OTP_E1S2", ephemsec.SHA512_X25519_E1S2_T600B32P9},
+		{"OTP_E2S2", ephemsec.SHA512_X25519_E2S2_T600B10P8},
+		{"OTK_E1S2", ephemsec.SHA512_X25519_E1S2_T1024B256P33},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := credentials.NewMemClientCredStore()
+			realmId := randomBytes(t, 32)
+			cards := []*credentials.Card{
+				newCard(t, realmId, ecdh.X25519()),
+				newCard(t, realmId, ecdh.X25519()),
+				newCard(t, realmId, ecdh.P256()),
+				newCard(t, randomBytes(t, 32), ecdh.X25519()),
+			}
+			for _, card := range cards {
+				if err := store.CreateCard(card); err != nil {
+					t.Fatalf("CreateCard() failed: %v", err)
+				}
+			}
+			// cards[1] is the most recently used X25519 card of the realm
+			if err := store.SetCardLastUsed(cards[1].ID, 1000); err != nil {
+				t.Fatalf("SetCardLastUsed() failed: %v", err)
+			}
+			if err := store.SetCardLastUsed(cards[2].ID, 2000); err != nil {
+				t.Fatalf("SetCardLastUsed() failed: %v", err)
+			}
+
+			srv := newServerChallenge(t, tt.code, realmId)
+			msg, err := AnswerChallenge(store, srv.acc, 0)
+			if err != nil {
+				t.Fatalf("AnswerChallenge() failed: %v", err)
+			}
+
+			var cardId, wantId []byte
+			var digits []byte
+			var cardE credentials.PublicKeyHandle
+			switch m := msg.(type) {
+			case *AppOTP:
+				cardId, cardE = m.CardId, m.E
+				wantId = []byte(cards[1].UserId)
+				digits, err = m.Digits(srv.acc.OtpPad)
+				if err != nil {
+					t.Fatalf("Digits() failed: %v", err)
+				}
+			case *AppOTK:
+				cardId, cardE, digits = m.CardId, m.E, m.OTK
+				wantId = cards[1].IdToken
+			default:
+				t.Fatalf("AnswerChallenge() returned %T", msg)
+			}
+			if string(cardId) != string(wantId) {
+				t.Fatalf("AnswerChallenge() selected the wrong card")
+			}
+
+			// server side verification
+			params := srv.params
+			params.RemoteStaticKey = cards[1].Kh.PublicKey()
+			params.Psk = cards[1].Psk
+			if !cardE.IsZero() {
+				params.RemoteEphemKey = cardE.PublicKey
+			}
+			verifier := ephemsec.Verifier{Scheme: srv.sch}
+			res, err := verifier.VerifyDigits(&params, digits)
+			if err != nil {
+				t.Fatalf("VerifyDigits() failed: %v", err)
+			}
+			if !res.Match {
+				t.Errorf("VerifyDigits() got no match")
+			}
+
+			// selected card is now the most recently used
+			var card credentials.ClientCard
+			if err := store.LoadCard(cards[1].ID, &card); err != nil {
+				t.Fatalf("LoadCard() failed: %v", err)
+			}
+			if card.LastUsed <= 2000 {
+				t.Errorf("LastUsed not updated, got %d", card.LastUsed)
+			}
+		})
+	}
+}
+
+func TestAnswerChallenge_CardId(t *testing.T) {
+	store := credentials.NewMemClientCredStore()
+	realmId := randomBytes(t, 32)
+	card0 := newCard(t, realmId, ecdh.X25519())
+	card1 := newCard(t, realmId, ecdh.P256())
+	for _, card := range []*credentials.Card{card0, card1} {
+		if err := store.CreateCard(card); err != nil {
+			t.Fatalf("CreateCard() failed: %v", err)
+		}
+	}
+	srv := newServerChallenge(t, ephemsec.SHA512_X25519_E1S1_T600B10P8, realmId)
+
+	msg, err := AnswerChallenge(store, srv.acc, card0.ID)
+	if err != nil {
+		t.Fatalf("AnswerChallenge() failed: %v", err)
+	}
+	if string(msg.(*AppOTP).CardId) != card0.UserId {
+		t.Errorf("AnswerChallenge() did not use card %d", card0.ID)
+	}
+
+	// card1 keys are not on the Scheme curve
+	_, err = AnswerChallenge(store, srv.acc, card1.ID)
+	if !errors.Is(err, credentials.ErrNotFound) {
+		t.Errorf("AnswerChallenge() error = %v, want %v", err, credentials.ErrNotFound)
+	}
+
+	// card2 has no UserId, it can answer OTK but not OTP challenges
+	card2 := newCard(t, realmId, ecdh.X25519())
+	card2.UserId = ""
+	if err := store.CreateCard(card2); err != nil {
+		t.Fatalf("CreateCard() failed: %v", err)
+	}
+	// card2 is the most recently used card
+	if err := store.SetCardLastUsed(card2.ID, time.Now().Unix()+60); err != nil {
+		t.Fatalf("SetCardLastUsed() failed: %v", err)
+	}
+	_, err = AnswerChallenge(store, srv.acc, card2.ID)
+	if !errors.Is(err, credentials.ErrNotFound) {
+		t.Errorf("AnswerChallenge() error = %v, want %v", err, credentials.ErrNotFound)
+	}
+	msg, err = AnswerChallenge(store, srv.acc, 0)
+	if err != nil {
+		t.Fatalf("AnswerChallenge() failed: %v", err)
+	}
+	if string(msg.(*AppOTP).CardId) != card0.UserId {
+		t.Errorf("AnswerChallenge() selected a card without UserId")
+	}
+	otk := newServerChallenge(t, ephemsec.SHA512_X25519_E1S2_T1024B256P33, realmId)
+	msg, err = AnswerChallenge(store, otk.acc, 0)
+	if err != nil {
+		t.Fatalf("AnswerChallenge() failed: %v", err)
+	}
+	if string(msg.(*AppOTK).CardId) != string(card2.IdToken) {
+		t.Errorf("AnswerChallenge() did not use the most recently used card")
+	}
+
+	// no card in realm
+	srv = newServerChallenge(t, ephemsec.SHA512_X25519_E1S1_T600B10P8, randomBytes(t, 32))
+	_, err = AnswerChallenge(store, srv.acc, 0)
+	if !errors.Is(err, credentials.ErrNotFound) {
+		t.Errorf("AnswerChallenge() error = %v, want %v", err, credentials.ErrNotFound)
+	}
+}
+
+func TestAnswerChallenge_CheckDigit(t *testing.T) {
+	store := credentials.NewMemClientCredStore()
+	realmId := randomBytes(t, 32)
+	card := newCard(t, realmId, ecdh.X25519())
+	if err := store.CreateCard(card); err != nil {
+		t.Fatalf("CreateCard() failed: %v", err)
+	}
+	srv := newServerChallenge(t, ephemsec.SHA512_X25519_E1S2_T600B32P9, realmId)
+	srv.acc.CheckDigit = true
+
+	msg, err := AnswerChallenge(store, srv.acc, 0)
+	if err != nil {
+		t.Fatalf("AnswerChallenge() failed: %v", err)
+	}
+	appotp := msg.(*AppOTP)
+	if !appotp.CheckDigit || len(appotp.OTP) != srv.sch.P()+1 {
+		t.Fatalf("AnswerChallenge() got OTP %q without check digit", appotp.OTP)
+	}
+	if err := appotp.Check(); err != nil {
+		t.Fatalf("Check() failed: %v", err)
+	}
+	digits, err := appotp.Digits(srv.acc.OtpPad)
+	if err != nil {
+		t.Fatalf("Digits() failed: %v", err)
+	}
+	params := srv.params
+	params.RemoteStaticKey = card.Kh.PublicKey()
+	params.Psk = card.Psk
+	verifier := ephemsec.Verifier{Scheme: srv.sch}
+	res, err := verifier.VerifyDigits(&params, digits)
+	if err != nil {
+		t.Fatalf("VerifyDigits() failed: %v", err)
+	}
+	if !res.Match {
+		t.Errorf("VerifyDigits() got no match")
+	}
+
+	// a single mistyped character is detected
+	alphabet := []rune(string(srv.sch.Alphabet()))
+	otp := []rune(appotp.OTP)
+	for _, r := range alphabet {
+		if r != otp[0] {
+			otp[0] = r
+			break
+		}
+	}
+	appotp.OTP = string(otp)
+	_, err = appotp.Digits(srv.acc.OtpPad)
+	if !errors.Is(err, ephemsec.ErrMalformedCode) {
+		t.Errorf("Digits() error = %v, want %v", err, ephemsec.ErrMalformedCode)
+	}
+}
+
+func TestAnswerChallenge_GetServerOtps(t *testing.T) {
+	ctx := context.Background()
+	curve := ecdh.X25519()
+	schemes := []uint16{
+		ephemsec.SHA512_X25519_E1S1_T600B10P8,
+		ephemsec.SHA512_X25519_E1S2_T600B32P9,
+		ephemsec.SHA512_X25519_E2S2_T600B10P8,
+		ephemsec.SHA512_X25519_E1S2_T1024B256P33,
+	}
+
+	// authentication server, the Card is registered with its UserId
+	realmId := [32]byte(randomBytes(t, 32))
+	scs, err := credentials.NewMemServerCredStore()
+	if err != nil {
+		t.Fatalf("NewMemServerCredStore() failed: %v", err)
+	}
+	if err := scs.SaveRealm(ctx, &credentials.Realm{RealmId: realmId[:], AppName: "test app"}); err != nil {
+		t.Fatalf("SaveRealm() failed: %v", err)
+	}
+	kst := credentials.NewMemKeyStore()
+	sk := credentials.ServerKey{RealmId: realmId[:], Certificate: []byte("TBD")}
+	sk.Kh.PrivateKey, err = curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	var acts []slp.AuthContext
+	for _, code := range schemes {
+		sch, err := ephemsec.GetScheme(code)
+		if err != nil {
+			t.Fatalf("Failed to get scheme: %v", err)
+		}
+		if err := kst.SaveServerKey(ctx, sch.Name(), sk); err != nil {
+			t.Fatalf("SaveServerKey() failed: %v", err)
+		}
+		acts = append(acts, slp.AuthContext{
+			RealmId:              realmId,
+			AuthMethod:           slp.AuthMethod{Protocol: slp.SlpDirect, Scheme: code},
+			AppContextUrl:        "https://app.example.com/context",
+			AuthServerGetChalUrl: "https://auth.example.com/get-card-chal",
+			AuthServerLoginUrl:   "https://auth.example.com/login",
+			AppStartUrl:          "https://app.example.com",
+		})
+	}
+	chf, err := slp.NewChallengeFactoryImpl(5*time.Minute, kst, scs, acts)
+	if err != nil {
+		t.Fatalf("NewChallengeFactoryImpl() failed: %v", err)
+	}
+
+	card := newCard(t, realmId[:], curve)
+	idh, err := credentials.NewIdHasher(nil)
+	if err != nil {
+		t.Fatalf("NewIdHasher() failed: %v", err)
+	}
+	card.IdToken, err = idh.IdTokenOfUserId(realmId[:], card.UserId, nil)
+	if err != nil {
+		t.Fatalf("IdTokenOfUserId() failed: %v", err)
+	}
+	sc := credentials.ServerCard{RealmId: realmId[:], Psk: card.Psk}
+	sc.Kh.PublicKey = card.Kh.PublicKey()
+	if err := scs.SaveCard(ctx, credentials.OtpId{Realm: realmId[:], Username: card.UserId}, &sc); err != nil {
+		t.Fatalf("SaveCard() failed: %v", err)
+	}
+	store := credentials.NewMemClientCredStore()
+	if err := store.CreateCard(card); err != nil {
+		t.Fatalf("CreateCard() failed: %v", err)
+	}
+
+	var ccs []*slp.CardChalResponse
+	var codes [][]byte
+	for _, act := range acts {
+		// Agent side, forwards the server challenge to the CardApp
+		var chal slp.CardChallenge
+		err := chf.GetCardChallenge(ctx, &slp.CardChallengeRequest{
+			RealmId:        realmId[:],
+			SelectedMethod: act.AuthMethod,
+			AppContextUrl:  act.AppContextUrl,
+		}, &chal)
+		if err != nil {
+			t.Fatalf("GetCardChallenge() failed: %v", err)
+		}
+		var aac slp.AgentAuthContext
+		if err := chf.GetAgentAuthContext(ctx, chal.SessionId, &aac); err != nil {
+			t.Fatalf("GetAgentAuthContext() failed: %v", err)
+		}
+		ach, err := aac.Sum(nil)
+		if err != nil {
+			t.Fatalf("Sum() failed: %v", err)
+		}
+		ach, err = slp.EphemSecContextHash(realmId[:], ach, ach[:0])
+		if err != nil {
+			t.Fatalf("EphemSecContextHash() failed: %v", err)
+		}
+		sch, err := ephemsec.GetScheme(act.AuthMethod.Scheme)
+		if err != nil {
+			t.Fatalf("Failed to get scheme: %v", err)
+		}
+		acc := &AgentCardChallenge{
+			RealmId: realmId[:],
+			Context: ach,
+			Scheme:  act.AuthMethod.Scheme,
+			E:       chal.E,
+			S:       chal.S,
+			INonce:  chal.INonce,
+		}
+		if sch.B() < 256 {
+			acc.OtpPad = randomDigits(t, sch.B(), sch.P())
+		}
+
+		// CardApp answer, relayed by the Agent to the server
+		msg, err := AnswerChallenge(store, acc, 0)
+		if err != nil {
+			t.Fatalf("AnswerChallenge() failed: %v", err)
+		}
+		cc := &slp.CardChalResponse{SessionId: chal.SessionId}
+		var digits []byte
+		switch m := msg.(type) {
+		case *AppOTP:
+			cc.CardId, cc.E = m.CardId, m.E
+			digits, err = m.Digits(acc.OtpPad)
+			if err != nil {
+				t.Fatalf("Digits() failed: %v", err)
+			}
+		case *AppOTK:
+			cc.CardId, cc.E, digits = m.CardId, m.E, m.OTK
+		}
+		cc.SyncHint = digits[len(digits)-1]
+		ccs = append(ccs, cc)
+		codes = append(codes, digits)
+	}
+
+	// server side derivation
+	results, err := chf.GetServerOtps(ctx, ccs, 0)
+	if err != nil {
+		t.Fatalf("GetServerOtps() failed: %v", err)
+	}
+	for pos, res := range results {
+		if res.Err != nil {
+			t.Fatalf("Scheme %d: GetServerOtps() result error: %v", schemes[pos], res.Err)
+		}
+		if !bytes.Equal(res.Otp, codes[pos]) {
+			t.Errorf("Scheme %d: GetServerOtps() did not derive the CardApp code", schemes[pos])
+		}
+	}
+}
+
+// serverChallenge holds an AgentCardChallenge & the server Verifier inputs.
+type serverChallenge struct {
+	sch    *ephemsec.Scheme
+	acc    *AgentCardChallenge
+	params ephemsec.VerifierParams
+}
+
+// Helper: Creates an AgentCardChallenge as the authentication server does
+func newServerChallenge(t *testing.T, code uint16, realmId []byte) *serverChallenge {
+	t.Helper()
+	sch, err := ephemsec.GetScheme(code)
+	if err != nil {
+		t.Fatalf("Failed to get scheme: %v", err)
+	}
+	curve := sch.Curve().Curve
+	ephemKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	staticKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	rv := &serverChallenge{
+		sch: sch,
+		acc: &AgentCardChallenge{
+			RealmId: realmId,
+			Context: randomBytes(t, 32),
+			Scheme:  code,
+			E:       credentials.PublicKeyHandle{PublicKey: ephemKey.PublicKey()},
+			INonce:  randomBytes(t, 32),
+		},
+	}
+	rv.params = ephemsec.VerifierParams{
+		Context:  rv.acc.Context,
+		Nonce:    rv.acc.INonce,
+		EphemKey: ephemKey,
+	}
+	if "E1S1" != sch.DHPattern() {
+		rv.acc.S = credentials.PublicKeyHandle{PublicKey: staticKey.PublicKey()}
+		rv.params.StaticKey = staticKey
+	}
+	if sch.B() < 256 {
+		rv.acc.OtpPad = randomDigits(t, sch.B(), sch.P())
+	}
+
+	return rv
+}
+
+// Helper: Creates a Card which keys are on curve
+func newCard(t *testing.T, realmId []byte, curve ecdh.Curve) *credentials.Card {
+	t.Helper()
+	sk, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return &credentials.Card{
+		RealmId: credentials.RealmId(realmId),
+		IdToken: credentials.IdToken(randomBytes(t, 32)),
+		UserId:  hex.EncodeToString(randomBytes(t, 8)),
+		Kh:      credentials.PrivateKeyHandle{PrivateKey: sk},
+		Psk:     randomBytes(t, 32),
+		AppName: "test app",
+	}
+}
+
+// Helper: Generate random bytes
+func randomBytes(t *testing.T, size int) []byte {
+	t.Helper()
+	rv := make([]byte, size)
+	if _, err := rand.Read(rv); err != nil {
+		t.Fatalf("Failed to generate random bytes: %v", err)
+	}
+	return rv
+}
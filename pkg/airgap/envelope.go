@@ -0,0 +1,294 @@
+package airgap
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	// ProtocolVersion is the airgap protocol version implemented by this package.
+	// Version 0 designates legacy messages that are not wrapped in an Envelope.
+	ProtocolVersion = 1
+)
+
+// Capabilities flags advertised in Envelope & Hello.
+const (
+	// CapOTK signals support of AppOTK responses
+	CapOTK uint64 = 1 << iota
+
+	// CapOTP signals support of AppOTP responses
+	CapOTP
+
+	// CapFountain signals support of messages transferred in several Parts (animated QR code)
+	CapFountain
+)
+
+// Envelope wraps an AgentMsg or AppMsg with the sender protocol version & capabilities.
+//
+// Receivers ignore the message fields that they do not know, unless the field key is listed in
+// Critical. This allows extending messages without breaking deployed CardApps.
+type Envelope struct {
+	// Version of the airgap protocol used by the sender
+	Version uint16 `json:"v" cbor:"1,keyasint"`
+
+	// Capabilities of the sender, combination of Cap flags
+	Capabilities uint64 `json:"caps" cbor:"2,keyasint,omitempty"`
+
+	// Schemes supported by the sender, EPHEMSEC schemes in compressed form
+	Schemes []uint16 `json:"schemes" cbor:"3,keyasint,omitempty"`
+
+	// Critical lists the Msg field keys that the receiver must understand
+	Critical []int `json:"crit" cbor:"4,keyasint,omitempty"`
+
+	// Msg is the CBOR tagged AgentMsg or AppMsg
+	Msg cbor.RawMessage `json:"msg" cbor:"5,keyasint"`
+}
+
+// Check returns an error if the Envelope is invalid.
+// It errors wrapping ErrUnsupportedVersion if Version is greater than ProtocolVersion.
+func (self *Envelope) Check() error {
+	if nil == self {
+		return newError("nil Envelope")
+	}
+	if 0 == self.Version {
+		return newError("invalid Version, 0")
+	}
+	if self.Version > ProtocolVersion {
+		return wrapError(ErrUnsupportedVersion, "Version %d > %d", self.Version, ProtocolVersion)
+	}
+	if 0 == len(self.Msg) {
+		return newError("empty Msg")
+	}
+
+	return nil
+}
+
+// MarshalAgentEnvelope CBOR-marshals msg wrapped in env.
+// env Version defaults to ProtocolVersion.
+func MarshalAgentEnvelope(env Envelope, msg AgentMsg) ([]byte, error) {
+	srzmsg, err := MarshalAgentMsg(msg)
+	if nil != err {
+		return nil, wrapError(err, "failed MarshalAgentMsg")
+	}
+
+	return marshalEnvelope(env, srzmsg)
+}
+
+// UnmarshalAgentEnvelope CBOR-unmarshals an Envelope and the AgentMsg that it wraps.
+// Legacy messages that are not wrapped are accepted and returned with an Envelope which Version is 0.
+// It errors wrapping ErrUnsupportedVersion or ErrUnknownCritical if the msg can not be safely processed.
+func UnmarshalAgentEnvelope(srzenv []byte) (*Envelope, AgentMsg, error) {
+	env, err := unmarshalEnvelope(srzenv)
+	if nil != err {
+		return nil, nil, err
+	}
+	msg, err := UnmarshalAgentMsg(env.Msg)
+	if nil != err {
+		return nil, nil, wrapError(err, "failed UnmarshalAgentMsg")
+	}
+	err = checkCritical(env, msg)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	return env, msg, nil
+}
+
+// MarshalAppEnvelope CBOR-marshals msg wrapped in env.
+// env Version defaults to ProtocolVersion.
+func MarshalAppEnvelope(env Envelope, msg AppMsg) ([]byte, error) {
+	srzmsg, err := MarshalAppMsg(msg)
+	if nil != err {
+		return nil, wrapError(err, "failed MarshalAppMsg")
+	}
+
+	return marshalEnvelope(env, srzmsg)
+}
+
+// UnmarshalAppEnvelope CBOR-unmarshals an Envelope and the AppMsg that it wraps.
+// Legacy messages that are not wrapped are accepted and returned with an Envelope which Version is 0.
+// It errors wrapping ErrUnsupportedVersion or ErrUnknownCritical if the msg can not be safely processed.
+func UnmarshalAppEnvelope(srzenv []byte) (*Envelope, AppMsg, error) {
+	env, err := unmarshalEnvelope(srzenv)
+	if nil != err {
+		return nil, nil, err
+	}
+	msg, err := UnmarshalAppMsg(env.Msg)
+	if nil != err {
+		return nil, nil, wrapError(err, "failed UnmarshalAppMsg")
+	}
+	err = checkCritical(env, msg)
+	if nil != err {
+		return nil, nil, err
+	}
+
+	return env, msg, nil
+}
+
+// Hello advertises the protocol versions & capabilities of its sender.
+// It may be sent by the CardAgent or the CardApp, Negotiate determines the common parameters.
+type Hello struct {
+	// Minimum protocol version supported by the sender
+	MinVersion uint16 `json:"minV" cbor:"1,keyasint"`
+
+	// Maximum protocol version supported by the sender
+	MaxVersion uint16 `json:"maxV" cbor:"2,keyasint"`
+
+	// Capabilities of the sender, combination of Cap flags
+	Capabilities uint64 `json:"caps" cbor:"3,keyasint,omitempty"`
+
+	// Schemes supported by the sender, in order of preference
+	Schemes []uint16 `json:"schemes" cbor:"4,keyasint,omitempty"`
+}
+
+// AgentTag returns TagHello for CBOR marshaling.
+func (self *Hello) AgentTag() uint64 {
+	return TagHello
+}
+
+// AppTag returns TagHello for CBOR marshaling.
+func (self *Hello) AppTag() uint64 {
+	return TagHello
+}
+
+// Check returns an error if the Hello is invalid.
+func (self *Hello) Check() error {
+	if 0 == self.MinVersion {
+		return newError("invalid MinVersion, 0")
+	}
+	if self.MinVersion > self.MaxVersion {
+		return newError("invalid MaxVersion, lower than MinVersion")
+	}
+
+	return nil
+}
+
+// Agreement holds the parameters negotiated in between 2 Hello senders.
+type Agreement struct {
+	Version      uint16
+	Capabilities uint64
+	Schemes      []uint16
+}
+
+// Negotiate returns the Agreement in between local & remote Hello.
+// Agreement Version is the highest version supported by both sides, Capabilities are the common
+// capabilities & Schemes are the common Schemes in local order of preference.
+// It errors wrapping ErrUnsupportedVersion if local & remote have no common version.
+func Negotiate(local *Hello, remote *Hello) (*Agreement, error) {
+	err := local.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid local Hello")
+	}
+	err = remote.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid remote Hello")
+	}
+	version := min(local.MaxVersion, remote.MaxVersion)
+	if version < max(local.MinVersion, remote.MinVersion) {
+		return nil, wrapError(ErrUnsupportedVersion, "no common protocol version")
+	}
+	rv := Agreement{
+		Version:      version,
+		Capabilities: local.Capabilities & remote.Capabilities,
+	}
+	for _, scheme := range local.Schemes {
+		if slices.Contains(remote.Schemes, scheme) {
+			rv.Schemes = append(rv.Schemes, scheme)
+		}
+	}
+
+	return &rv, nil
+}
+
+func marshalEnvelope(env Envelope, srzmsg []byte) ([]byte, error) {
+	if 0 == env.Version {
+		env.Version = ProtocolVersion
+	}
+	env.Msg = srzmsg
+	err := env.Check()
+	if nil != err {
+		return nil, wrapError(err, "failed Envelope Check")
+	}
+	srzenv, err := cbor.Marshal(cbor.Tag{Number: TagEnvelope, Content: &env})
+
+	return srzenv, wrapError(err, "failed cbor.Marshal")
+}
+
+func unmarshalEnvelope(srzenv []byte) (*Envelope, error) {
+	tag := cbor.RawTag{}
+	err := cbor.Unmarshal(srzenv, &tag)
+	if nil != err {
+		return nil, wrapError(err, "failed reading msg tag")
+	}
+	if TagEnvelope != tag.Number {
+		// legacy msg
+		return &Envelope{Msg: srzenv}, nil
+	}
+
+	env := Envelope{}
+	err = cbor.Unmarshal(tag.Content, &env)
+	if nil != err {
+		return nil, wrapError(err, "failed cbor.Unmarshal")
+	}
+	err = env.Check()
+	if nil != err {
+		return nil, wrapError(err, "loaded an invalid Envelope")
+	}
+
+	return &env, nil
+}
+
+// checkCritical errors wrapping ErrUnknownCritical if env Msg holds a Critical field which key
+// is not known by msg.
+func checkCritical(env *Envelope, msg any) error {
+	if 0 == len(env.Critical) {
+		return nil
+	}
+	tag := cbor.RawTag{}
+	err := cbor.Unmarshal(env.Msg, &tag)
+	if nil != err {
+		return wrapError(err, "failed reading msg tag")
+	}
+	fields := map[int]cbor.RawMessage{}
+	err = cbor.Unmarshal(tag.Content, &fields)
+	if nil != err {
+		return wrapError(err, "failed reading msg fields")
+	}
+	known := fieldKeys(msg)
+	for _, key := range env.Critical {
+		if _, present := fields[key]; present && !slices.Contains(known, key) {
+			return wrapError(ErrUnknownCritical, "unknown critical field %d", key)
+		}
+	}
+
+	return nil
+}
+
+// fieldKeys returns the keys of the msg struct fields that have a "N,keyasint" cbor tag.
+func fieldKeys(msg any) []int {
+	rt := reflect.TypeOf(msg)
+	if reflect.Pointer == rt.Kind() {
+		rt = rt.Elem()
+	}
+	if reflect.Struct != rt.Kind() {
+		return nil
+	}
+	var rv []int
+	for i := range rt.NumField() {
+		field := rt.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("cbor"), ",")
+		if !slices.Contains(strings.Split(opts, ","), "keyasint") {
+			continue
+		}
+		key, err := strconv.Atoi(name)
+		if nil == err {
+			rv = append(rv, key)
+		}
+	}
+
+	return rv
+}
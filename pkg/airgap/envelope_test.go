@@ -0,0 +1,199 @@
+package airgap
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"code.kerpass.org/golang/pkg/ephemsec"
+)
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	env := Envelope{
+		Capabilities: CapOTP | CapFountain,
+		Schemes:      []uint16{ephemsec.SHA512_X25519_E1S1_T600B10P8},
+	}
+	msg := validAgentCardChallenge(t, ephemsec.SHA512_X25519_E1S1_T600B10P8)
+	data, err := MarshalAgentEnvelope(env, msg)
+	if err != nil {
+		t.Fatalf("MarshalAgentEnvelope() failed: %v", err)
+	}
+	// TagEnvelope 52048 is in the IANA first come first served range, 3 bytes long encoding
+	if !bytes.HasPrefix(data, []byte{0xd9, 0xcb, 0x50}) {
+		t.Errorf("TagEnvelope encoding mismatch: got % x", data[:3])
+	}
+
+	decenv, decoded, err := UnmarshalAgentEnvelope(data)
+	if err != nil {
+		t.Fatalf("UnmarshalAgentEnvelope() failed: %v", err)
+	}
+	if decenv.Version != ProtocolVersion {
+		t.Errorf("Version mismatch: got %d, want %d", decenv.Version, ProtocolVersion)
+	}
+	if decenv.Capabilities != env.Capabilities || !slices.Equal(decenv.Schemes, env.Schemes) {
+		t.Errorf("Envelope mismatch: got %+v, want %+v", decenv, env)
+	}
+	if decoded.AgentTag() != TagAgentCardChallenge {
+		t.Errorf("Tag mismatch: got %d, want %d", decoded.AgentTag(), TagAgentCardChallenge)
+	}
+
+	appdata, err := MarshalAppEnvelope(Envelope{}, validAppOTP(t))
+	if err != nil {
+		t.Fatalf("MarshalAppEnvelope() failed: %v", err)
+	}
+	_, appmsg, err := UnmarshalAppEnvelope(appdata)
+	if err != nil {
+		t.Fatalf("UnmarshalAppEnvelope() failed: %v", err)
+	}
+	if appmsg.AppTag() != TagAppOTP {
+		t.Errorf("Tag mismatch: got %d, want %d", appmsg.AppTag(), TagAppOTP)
+	}
+}
+
+func TestEnvelope_Legacy(t *testing.T) {
+	data, err := MarshalAgentMsg(validAgentCardCreate())
+	if err != nil {
+		t.Fatalf("MarshalAgentMsg() failed: %v", err)
+	}
+	env, msg, err := UnmarshalAgentEnvelope(data)
+	if err != nil {
+		t.Fatalf("UnmarshalAgentEnvelope() failed: %v", err)
+	}
+	if env.Version != 0 {
+		t.Errorf("Version mismatch: got %d, want 0", env.Version)
+	}
+	if msg.AgentTag() != TagAgentCardCreate {
+		t.Errorf("Tag mismatch: got %d, want %d", msg.AgentTag(), TagAgentCardCreate)
+	}
+}
+
+func TestEnvelope_UnknownFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		critical []int
+		wantErr  error
+	}{
+		{"optional", nil, nil},
+		{"critical_known", []int{1, 2}, nil},
+		{"critical_unknown", []int{99}, ErrUnknownCritical},
+		{"critical_absent", []int{100}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := Envelope{
+				Version:  ProtocolVersion,
+				Critical: tt.critical,
+				Msg:      extendedAgentMsg(t, validAgentCardCreate(), 99),
+			}
+			data, err := cbor.Marshal(cbor.Tag{Number: TagEnvelope, Content: &env})
+			if err != nil {
+				t.Fatalf("cbor.Marshal() failed: %v", err)
+			}
+
+			_, _, err = UnmarshalAgentEnvelope(data)
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("UnmarshalAgentEnvelope() failed: %v", err)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("UnmarshalAgentEnvelope() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvelope_UnsupportedVersion(t *testing.T) {
+	srzmsg, err := MarshalAgentMsg(validAgentCardCreate())
+	if err != nil {
+		t.Fatalf("MarshalAgentMsg() failed: %v", err)
+	}
+	env := Envelope{Version: ProtocolVersion + 1, Msg: srzmsg}
+	data, err := cbor.Marshal(cbor.Tag{Number: TagEnvelope, Content: &env})
+	if err != nil {
+		t.Fatalf("cbor.Marshal() failed: %v", err)
+	}
+
+	_, _, err = UnmarshalAgentEnvelope(data)
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("UnmarshalAgentEnvelope() error = %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	local := &Hello{
+		MinVersion:   1,
+		MaxVersion:   3,
+		Capabilities: CapOTK | CapOTP | CapFountain,
+		Schemes:      []uint16{ephemsec.SHA512_X25519_E1S2_T600B32P9, ephemsec.SHA512_X25519_E1S1_T600B10P8},
+	}
+	remote := &Hello{
+		MinVersion:   2,
+		MaxVersion:   4,
+		Capabilities: CapOTP,
+		Schemes:      []uint16{ephemsec.SHA512_X25519_E1S1_T600B10P8, ephemsec.SHA512_X25519_E1S2_T600B32P9},
+	}
+
+	agreement, err := Negotiate(local, remote)
+	if err != nil {
+		t.Fatalf("Negotiate() failed: %v", err)
+	}
+	if agreement.Version != 3 {
+		t.Errorf("Version mismatch: got %d, want 3", agreement.Version)
+	}
+	if agreement.Capabilities != CapOTP {
+		t.Errorf("Capabilities mismatch: got %b, want %b", agreement.Capabilities, CapOTP)
+	}
+	if !slices.Equal(agreement.Schemes, local.Schemes) {
+		t.Errorf("Schemes mismatch: got %v, want %v", agreement.Schemes, local.Schemes)
+	}
+
+	remote.MinVersion = 4
+	_, err = Negotiate(local, remote)
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Negotiate() error = %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
+
+func TestHello_RoundTrip(t *testing.T) {
+	hello := &Hello{MinVersion: 1, MaxVersion: 1, Capabilities: CapOTP}
+	data, err := MarshalAgentMsg(hello)
+	if err != nil {
+		t.Fatalf("MarshalAgentMsg() failed: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte{0xd9, 0xcb, 0x51}) {
+		t.Errorf("TagHello encoding mismatch: got % x", data[:3])
+	}
+	decoded, err := UnmarshalAppMsg(data)
+	if err != nil {
+		t.Fatalf("UnmarshalAppMsg() failed: %v", err)
+	}
+	if decoded.AppTag() != TagHello {
+		t.Errorf("Tag mismatch: got %d, want %d", decoded.AppTag(), TagHello)
+	}
+
+	if err := (&Hello{MinVersion: 2, MaxVersion: 1}).Check(); err == nil {
+		t.Errorf("Check() succeeded for invalid Hello")
+	}
+}
+
+// Helper: Returns msg CBOR encoding with an additional field
+func extendedAgentMsg(t *testing.T, msg AgentMsg, key int) []byte {
+	t.Helper()
+	srzmsg, err := cbor.Marshal(msg)
+	if err != nil {
+		t.Fatalf("cbor.Marshal() failed: %v", err)
+	}
+	fields := map[int]cbor.RawMessage{}
+	if err := cbor.Unmarshal(srzmsg, &fields); err != nil {
+		t.Fatalf("cbor.Unmarshal() failed: %v", err)
+	}
+	fields[key], _ = cbor.Marshal("extension")
+	srzmsg, err = cbor.Marshal(cbor.Tag{Number: msg.AgentTag(), Content: fields})
+	if err != nil {
+		t.Fatalf("cbor.Marshal() failed: %v", err)
+	}
+	return srzmsg
+}
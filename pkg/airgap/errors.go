@@ -9,8 +9,11 @@ type errorFlag string
 
 const (
 	// All package errors are wrapping Error
-	Error   = errorFlag("airgap: error")
-	noError = errorFlag("")
+	Error                 = errorFlag("airgap: error")
+	ErrChecksum           = errorFlag("airgap: Invalid checksum")
+	ErrUnsupportedVersion = errorFlag("airgap: Unsupported protocol version")
+	ErrUnknownCritical    = errorFlag("airgap: Unknown critical field")
+	noError               = errorFlag("")
 )
 
 // Error implements the error interface.
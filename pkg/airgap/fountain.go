@@ -0,0 +1,372 @@
+package airgap
+
+import (
+	"hash/crc32"
+	"slices"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	// DefaultFragmentSize allows transferring a Part in a version 10 QR code with M error correction.
+	DefaultFragmentSize = 150
+
+	maxFragments = 1024
+)
+
+// Part is a fragment of an airgap message. It allows transferring messages that exceed the
+// capacity of a single QR code, as an animated QR code.
+//
+// Parts are generated by a FountainEncoder, the first SeqLen Parts hold a single fragment of
+// the message, subsequent Parts mix several fragments. A FountainDecoder recovers the message
+// from any sufficient subset of Parts, hence the receiver may start scanning at any time.
+type Part struct {
+	_ struct{} `cbor:",toarray"`
+
+	// SeqNum starts at 1
+	SeqNum uint32
+
+	// SeqLen is the number of message fragments
+	SeqLen uint32
+
+	// MsgLen is the message size
+	MsgLen uint32
+
+	// Checksum is the CRC32 (IEEE) of the message
+	Checksum uint32
+
+	// Data is the XOR of the Part fragments
+	Data []byte
+}
+
+// Check returns an error if the Part is invalid.
+func (self *Part) Check() error {
+	if nil == self {
+		return newError("nil Part")
+	}
+	if 0 == self.SeqNum {
+		return newError("invalid SeqNum, 0")
+	}
+	if 0 == self.SeqLen || self.SeqLen > maxFragments {
+		return newError("invalid SeqLen")
+	}
+	if 0 == len(self.Data) {
+		return newError("empty Data")
+	}
+	if uint64(self.MsgLen) > uint64(self.SeqLen)*uint64(len(self.Data)) || uint64(self.MsgLen) <= uint64(self.SeqLen-1)*uint64(len(self.Data)) {
+		return newError("invalid MsgLen, inconsistent with SeqLen & Data size")
+	}
+
+	return nil
+}
+
+// MarshalText returns the Part text encoding, TextPrefix followed by the base45 encoding of
+// the Part CBOR encoding. The text only contains QR code alphanumeric mode characters.
+func (self *Part) MarshalText() ([]byte, error) {
+	err := self.Check()
+	if nil != err {
+		return nil, wrapError(err, "failed Part Check")
+	}
+	srzpart, err := cbor.Marshal(self)
+	if nil != err {
+		return nil, wrapError(err, "failed cbor.Marshal")
+	}
+
+	return AppendBase45([]byte(TextPrefix), srzpart), nil
+}
+
+// UnmarshalText loads the Part from its text encoding.
+// It errors if text is not a valid Part text encoding.
+func (self *Part) UnmarshalText(text []byte) error {
+	payload, found := strings.CutPrefix(strings.ToUpper(string(text)), TextPrefix)
+	if !found {
+		return newError("missing %s prefix", TextPrefix)
+	}
+	srzpart, err := DecodeBase45(payload)
+	if nil != err {
+		return wrapError(err, "failed base45 decoding")
+	}
+	err = cbor.Unmarshal(srzpart, self)
+	if nil != err {
+		return wrapError(err, "failed cbor.Unmarshal")
+	}
+
+	return wrapError(self.Check(), "loaded an invalid Part")
+}
+
+// FountainEncoder generates the Parts of a message.
+type FountainEncoder struct {
+	msg      []byte
+	msgLen   uint32
+	fragSize int
+	seqLen   uint32
+	checksum uint32
+	seqNum   uint32
+}
+
+// NewFountainEncoder returns a FountainEncoder that splits msg in fragments of at most
+// maxFragmentSize bytes. If maxFragmentSize is not positive, DefaultFragmentSize is used.
+// It errors if msg is empty or requires too many fragments.
+func NewFountainEncoder(msg []byte, maxFragmentSize int) (*FountainEncoder, error) {
+	if 0 == len(msg) {
+		return nil, newError("empty msg")
+	}
+	if maxFragmentSize <= 0 {
+		maxFragmentSize = DefaultFragmentSize
+	}
+	// fragments have the same size, the last one is zero padded
+	seqLen := (len(msg) + maxFragmentSize - 1) / maxFragmentSize
+	if seqLen > maxFragments {
+		return nil, newError("msg too large, requires more than %d fragments", maxFragments)
+	}
+	fragSize := (len(msg) + seqLen - 1) / seqLen
+	padded := make([]byte, seqLen*fragSize)
+	copy(padded, msg)
+
+	rv := FountainEncoder{
+		msg:      padded,
+		msgLen:   uint32(len(msg)),
+		fragSize: fragSize,
+		seqLen:   uint32(seqLen),
+		checksum: crc32.ChecksumIEEE(msg),
+	}
+
+	return &rv, nil
+}
+
+// SeqLen returns the number of message fragments.
+// The message may be transferred in a single QR code if SeqLen is 1.
+func (self *FountainEncoder) SeqLen() int {
+	return int(self.seqLen)
+}
+
+// NextPart returns the next Part of the message.
+// The first SeqLen Parts hold a single fragment, subsequent Parts mix several fragments.
+func (self *FountainEncoder) NextPart() *Part {
+	self.seqNum += 1
+	rv := Part{
+		SeqNum:   self.seqNum,
+		SeqLen:   self.seqLen,
+		MsgLen:   self.msgLen,
+		Checksum: self.checksum,
+		Data:     make([]byte, self.fragSize),
+	}
+	for _, idx := range chooseFragments(rv.SeqNum, rv.SeqLen, rv.Checksum) {
+		xorInto(rv.Data, self.msg[idx*self.fragSize:(idx+1)*self.fragSize])
+	}
+
+	return &rv
+}
+
+// FountainDecoder recovers a message from its Parts.
+type FountainDecoder struct {
+	ref       *Part
+	fragSize  int
+	fragments [][]byte
+	recovered int
+	mixed     []mixedPart
+	msg       []byte
+}
+
+// mixedPart is a received Part that mixes several fragments not yet recovered.
+type mixedPart struct {
+	indexes []int
+	data    []byte
+}
+
+// Receive adds p to the received Parts.
+// It errors if p is invalid or does not belong to the same message as previously received Parts.
+func (self *FountainDecoder) Receive(p *Part) error {
+	err := p.Check()
+	if nil != err {
+		return wrapError(err, "invalid Part")
+	}
+	if nil == self.ref {
+		ref := *p
+		ref.Data = nil
+		self.ref = &ref
+		self.fragSize = len(p.Data)
+		self.fragments = make([][]byte, p.SeqLen)
+	}
+	ref := self.ref
+	if ref.SeqLen != p.SeqLen || ref.MsgLen != p.MsgLen || ref.Checksum != p.Checksum || self.fragSize != len(p.Data) {
+		return newError("Part of a different message")
+	}
+	if self.Done() {
+		return nil
+	}
+
+	mp := mixedPart{
+		indexes: chooseFragments(p.SeqNum, p.SeqLen, p.Checksum),
+		data:    slices.Clone(p.Data),
+	}
+	self.reduce(&mp)
+	switch len(mp.indexes) {
+	case 0:
+		// redundant Part
+		return nil
+	case 1:
+		self.recover(mp.indexes[0], mp.data)
+	default:
+		self.mixed = append(self.mixed, mp)
+	}
+
+	return nil
+}
+
+// Done returns true if all the message fragments were recovered.
+func (self *FountainDecoder) Done() bool {
+	return nil != self.ref && self.recovered == int(self.ref.SeqLen)
+}
+
+// Progress returns the ratio of recovered fragments, in [0, 1] interval.
+func (self *FountainDecoder) Progress() float64 {
+	if nil == self.ref {
+		return 0
+	}
+	return float64(self.recovered) / float64(self.ref.SeqLen)
+}
+
+// Message returns the recovered message.
+// It errors if the message is not yet recovered, or wrapping ErrChecksum if its checksum is invalid.
+func (self *FountainDecoder) Message() ([]byte, error) {
+	if !self.Done() {
+		return nil, newError("message not yet recovered")
+	}
+	if nil == self.msg {
+		msg := slices.Concat(self.fragments...)[:self.ref.MsgLen]
+		if crc32.ChecksumIEEE(msg) != self.ref.Checksum {
+			return nil, wrapError(ErrChecksum, "invalid message checksum")
+		}
+		self.msg = msg
+	}
+
+	return self.msg, nil
+}
+
+// reduce removes the recovered fragments from mp.
+func (self *FountainDecoder) reduce(mp *mixedPart) {
+	mp.indexes = slices.DeleteFunc(mp.indexes, func(idx int) bool {
+		frag := self.fragments[idx]
+		if nil != frag {
+			xorInto(mp.data, frag)
+			return true
+		}
+		return false
+	})
+}
+
+// recover records fragment idx and reduces the mixed Parts, this may recover further fragments.
+func (self *FountainDecoder) recover(idx int, data []byte) {
+	queue := []mixedPart{{indexes: []int{idx}, data: data}}
+	for 0 != len(queue) {
+		mp := queue[0]
+		queue = queue[1:]
+		idx := mp.indexes[0]
+		if nil != self.fragments[idx] {
+			continue
+		}
+		self.fragments[idx] = mp.data
+		self.recovered += 1
+
+		remaining := self.mixed[:0]
+		for _, mixed := range self.mixed {
+			self.reduce(&mixed)
+			switch len(mixed.indexes) {
+			case 0:
+			case 1:
+				queue = append(queue, mixed)
+			default:
+				remaining = append(remaining, mixed)
+			}
+		}
+		self.mixed = remaining
+	}
+}
+
+// chooseFragments returns the indexes of the fragments mixed in Part seqNum.
+// The selection is deterministic, it uses a splitmix64 generator seeded with seqNum & checksum,
+// the number of mixed fragments follows the ideal soliton distribution.
+func chooseFragments(seqNum uint32, seqLen uint32, checksum uint32) []int {
+	if seqNum <= seqLen {
+		return []int{int(seqNum - 1)}
+	}
+	rng := splitmix64(uint64(seqNum)<<32 | uint64(checksum))
+
+	// sample degree with probability proportional to 1/degree
+	n := int(seqLen)
+	var total float64
+	for d := 1; d <= n; d++ {
+		total += 1 / float64(d)
+	}
+	target := rng.float64() * total
+	degree := n
+	for d := 1; d <= n; d++ {
+		target -= 1 / float64(d)
+		if target < 0 {
+			degree = d
+			break
+		}
+	}
+
+	// partial Fisher-Yates shuffle
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	for i := range degree {
+		j := i + int(rng.next()%uint64(n-i))
+		indexes[i], indexes[j] = indexes[j], indexes[i]
+	}
+	rv := indexes[:degree]
+	slices.Sort(rv)
+
+	return rv
+}
+
+// splitmix64 is a small deterministic generator, its output does not depend on the Go version.
+type splitmix64 uint64
+
+func (self *splitmix64) next() uint64 {
+	*self += 0x9E3779B97F4A7C15
+	z := uint64(*self)
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
+
+// float64 returns a float in [0, 1) interval.
+func (self *splitmix64) float64() float64 {
+	return float64(self.next()>>11) / (1 << 53)
+}
+
+func xorInto(dst []byte, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// TextParts returns the text encoding of the Parts that transfer msg.
+// It returns a single Part if msg fits in a fragment of maxFragmentSize bytes, otherwise it returns
+// twice as many Parts as fragments, that are to be displayed in a loop as an animated QR code.
+func TextParts(msg []byte, maxFragmentSize int) ([]string, error) {
+	enc, err := NewFountainEncoder(msg, maxFragmentSize)
+	if nil != err {
+		return nil, wrapError(err, "failed NewFountainEncoder")
+	}
+	count := enc.SeqLen()
+	if count > 1 {
+		count *= 2
+	}
+	rv := make([]string, 0, count)
+	for range count {
+		text, err := enc.NextPart().MarshalText()
+		if nil != err {
+			return nil, wrapError(err, "failed Part MarshalText")
+		}
+		rv = append(rv, string(text))
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,218 @@
+package airgap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBase45(t *testing.T) {
+	// RFC 9285 test vectors
+	testcases := []struct {
+		data string
+		text string
+	}{
+		{data: "AB", text: "BB8"},
+		{data: "Hello!!", text: "%69 VD92EX0"},
+		{data: "base-45", text: "UJCLQE7W581"},
+		{data: "ietf!", text: "QED8WEX0"},
+		{data: "", text: ""},
+	}
+	for _, tc := range testcases {
+		text := string(AppendBase45(nil, []byte(tc.data)))
+		if tc.text != text {
+			t.Errorf("failed AppendBase45(%q), got %q != %q", tc.data, text, tc.text)
+		}
+		data, err := DecodeBase45(tc.text)
+		if nil != err {
+			t.Fatalf("failed DecodeBase45(%q), got error %v", tc.text, err)
+		}
+		if tc.data != string(data) {
+			t.Errorf("failed DecodeBase45(%q), got %q != %q", tc.text, data, tc.data)
+		}
+	}
+}
+
+func TestBase45Invalid(t *testing.T) {
+	for _, text := range []string{"A", "BB8A", "GGW", "ab8", "ZZ"} {
+		_, err := DecodeBase45(text)
+		if nil == err {
+			t.Errorf("failed DecodeBase45(%q) error detection", text)
+		}
+	}
+}
+
+func TestPartText(t *testing.T) {
+	enc, err := NewFountainEncoder(randomMsg(t, 300), 100)
+	if nil != err {
+		t.Fatalf("failed NewFountainEncoder, got error %v", err)
+	}
+	part := enc.NextPart()
+	text, err := part.MarshalText()
+	if nil != err {
+		t.Fatalf("failed MarshalText, got error %v", err)
+	}
+	if !strings.HasPrefix(string(text), TextPrefix) {
+		t.Fatalf("failed MarshalText, missing prefix in %q", text)
+	}
+	if len(strings.Trim(string(text), b45Alphabet)) > 0 {
+		t.Fatalf("failed MarshalText, non alphanumeric characters in %q", text)
+	}
+
+	var loaded Part
+	err = loaded.UnmarshalText(text)
+	if nil != err {
+		t.Fatalf("failed UnmarshalText, got error %v", err)
+	}
+	if part.SeqNum != loaded.SeqNum || part.SeqLen != loaded.SeqLen || part.MsgLen != loaded.MsgLen ||
+		part.Checksum != loaded.Checksum || !bytes.Equal(part.Data, loaded.Data) {
+		t.Errorf("failed UnmarshalText, got %+v != %+v", loaded, part)
+	}
+
+	err = loaded.UnmarshalText(text[len(TextPrefix):])
+	if nil == err {
+		t.Error("failed UnmarshalText prefix check")
+	}
+}
+
+func TestFountainSinglePart(t *testing.T) {
+	msg := randomMsg(t, 80)
+	enc, err := NewFountainEncoder(msg, 0)
+	if nil != err {
+		t.Fatalf("failed NewFountainEncoder, got error %v", err)
+	}
+	if 1 != enc.SeqLen() {
+		t.Fatalf("failed SeqLen, got %d != 1", enc.SeqLen())
+	}
+	dec := FountainDecoder{}
+	err = dec.Receive(enc.NextPart())
+	if nil != err {
+		t.Fatalf("failed Receive, got error %v", err)
+	}
+	rmsg, err := dec.Message()
+	if nil != err {
+		t.Fatalf("failed Message, got error %v", err)
+	}
+	if !bytes.Equal(msg, rmsg) {
+		t.Error("failed message recovery")
+	}
+}
+
+func TestFountainLossy(t *testing.T) {
+	msg := randomMsg(t, 1000)
+	enc, err := NewFountainEncoder(msg, 64)
+	if nil != err {
+		t.Fatalf("failed NewFountainEncoder, got error %v", err)
+	}
+	seqLen := enc.SeqLen()
+	if 16 != seqLen {
+		t.Fatalf("failed SeqLen, got %d != 16", seqLen)
+	}
+
+	dec := FountainDecoder{}
+	count := 0
+	for !dec.Done() {
+		part := enc.NextPart()
+		if part.SeqNum > uint32(20*seqLen) {
+			t.Fatalf("failed message recovery, progress %.2f after %d parts", dec.Progress(), part.SeqNum)
+		}
+		// drop 1 part out of 3, including simple fragments
+		if 0 == part.SeqNum%3 {
+			continue
+		}
+		count += 1
+		err = dec.Receive(part)
+		if nil != err {
+			t.Fatalf("failed Receive, got error %v", err)
+		}
+	}
+	rmsg, err := dec.Message()
+	if nil != err {
+		t.Fatalf("failed Message, got error %v", err)
+	}
+	if !bytes.Equal(msg, rmsg) {
+		t.Error("failed message recovery")
+	}
+	t.Logf("recovered %d fragments from %d parts", seqLen, count)
+}
+
+func TestFountainChecksum(t *testing.T) {
+	enc, err := NewFountainEncoder(randomMsg(t, 200), 100)
+	if nil != err {
+		t.Fatalf("failed NewFountainEncoder, got error %v", err)
+	}
+	dec := FountainDecoder{}
+	for range enc.SeqLen() {
+		part := enc.NextPart()
+		part.Data[0] ^= 1
+		err = dec.Receive(part)
+		if nil != err {
+			t.Fatalf("failed Receive, got error %v", err)
+		}
+	}
+	_, err = dec.Message()
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("failed checksum verification, got error %v", err)
+	}
+}
+
+func TestFountainMismatch(t *testing.T) {
+	enc1, _ := NewFountainEncoder(randomMsg(t, 200), 100)
+	enc2, _ := NewFountainEncoder(randomMsg(t, 200), 100)
+	dec := FountainDecoder{}
+	err := dec.Receive(enc1.NextPart())
+	if nil != err {
+		t.Fatalf("failed Receive, got error %v", err)
+	}
+	err = dec.Receive(enc2.NextPart())
+	if nil == err {
+		t.Error("failed detecting Part of a different message")
+	}
+}
+
+func TestTextParts(t *testing.T) {
+	for _, size := range []int{100, 700} {
+		msg := randomMsg(t, size)
+		parts, err := TextParts(msg, 300)
+		if nil != err {
+			t.Fatalf("failed TextParts, got error %v", err)
+		}
+		expected := 1
+		if size > 300 {
+			expected = 6
+		}
+		if expected != len(parts) {
+			t.Fatalf("failed TextParts(%d), got %d parts != %d", size, len(parts), expected)
+		}
+		dec := FountainDecoder{}
+		for _, text := range parts {
+			var part Part
+			err = part.UnmarshalText([]byte(text))
+			if nil != err {
+				t.Fatalf("failed UnmarshalText, got error %v", err)
+			}
+			err = dec.Receive(&part)
+			if nil != err {
+				t.Fatalf("failed Receive, got error %v", err)
+			}
+		}
+		rmsg, err := dec.Message()
+		if nil != err {
+			t.Fatalf("failed Message, got error %v", err)
+		}
+		if !bytes.Equal(msg, rmsg) {
+			t.Error("failed message recovery")
+		}
+	}
+}
+
+func randomMsg(t *testing.T, size int) []byte {
+	msg := make([]byte, size)
+	_, err := rand.Read(msg)
+	if nil != err {
+		t.Fatalf("failed rand.Read, got error %v", err)
+	}
+	return msg
+}
@@ -0,0 +1,652 @@
+// Package qrcode implements a QR code (ISO/IEC 18004) encoder.
+//
+// It is used to display airgap messages, which text encoding only contains alphanumeric mode
+// characters. Encoded symbols are rendered as images or PNG without external dependencies.
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// Level is the QR code error correction level.
+type Level int
+
+const (
+	// LevelL tolerates about 7% of erroneous codewords
+	LevelL Level = iota
+	// LevelM tolerates about 15% of erroneous codewords
+	LevelM
+	// LevelQ tolerates about 25% of erroneous codewords
+	LevelQ
+	// LevelH tolerates about 30% of erroneous codewords
+	LevelH
+)
+
+const (
+	minVersion = 1
+	maxVersion = 40
+
+	// QuietZone is the width in modules of the light border that surrounds rendered symbols.
+	QuietZone = 4
+
+	alphanumChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+	modeAlphanum = 0x2
+	modeByte     = 0x4
+
+	penaltyN1 = 3
+	penaltyN2 = 3
+	penaltyN3 = 40
+	penaltyN4 = 10
+)
+
+// formatBits maps Level to its format information bits.
+var formatBits = [4]int{LevelL: 1, LevelM: 0, LevelQ: 3, LevelH: 2}
+
+// eccCodewordsPerBlock is indexed by Level & version.
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// numErrorCorrectionBlocks is indexed by Level & version.
+var numErrorCorrectionBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// Code is an encoded QR code symbol.
+type Code struct {
+	// Version in [1, 40] interval
+	Version int
+
+	// Size is the symbol width & height in modules
+	Size int
+
+	// Level is the error correction level
+	Level Level
+
+	// Mask in [0, 7] interval
+	Mask int
+
+	modules    []bool
+	isFunction []bool
+}
+
+// Encode returns the smallest QR code symbol that holds text at the given error correction level.
+// text is encoded in alphanumeric mode if it only contains alphanumeric mode characters, in byte
+// mode otherwise.
+// It errors wrapping ErrDataTooLong if text does not fit in a version 40 symbol.
+func Encode(text string, level Level) (*Code, error) {
+	if level < LevelL || level > LevelH {
+		return nil, newError("invalid Level %d", level)
+	}
+
+	var version int
+	var bb bitBuffer
+	for version = minVersion; version <= maxVersion; version++ {
+		bb = encodeSegment(text, version)
+		if nil != bb && len(bb) <= 8*numDataCodewords(version, level) {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, wrapError(ErrDataTooLong, "text of size %d does not fit in a QR code", len(text))
+	}
+
+	// terminator & padding
+	capacity := 8 * numDataCodewords(version, level)
+	bb.appendBits(0, min(4, capacity-len(bb)))
+	bb.appendBits(0, (8-len(bb)%8)%8)
+	for pad := uint32(0xEC); len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.appendBits(pad, 8)
+	}
+
+	size := 4*version + 17
+	rv := Code{
+		Version:    version,
+		Size:       size,
+		Level:      level,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+	rv.drawFunctionPatterns()
+	rv.drawCodewords(addEccAndInterleave(bb.bytes(), version, level))
+
+	minPenalty := -1
+	for mask := range 8 {
+		rv.applyMask(mask)
+		rv.drawFormatBits(mask)
+		penalty := rv.penaltyScore()
+		if minPenalty < 0 || penalty < minPenalty {
+			rv.Mask = mask
+			minPenalty = penalty
+		}
+		rv.applyMask(mask) // undo, XOR is its own inverse
+	}
+	rv.applyMask(rv.Mask)
+	rv.drawFormatBits(rv.Mask)
+	rv.isFunction = nil
+
+	return &rv, nil
+}
+
+// At returns true if the module at column x & row y is dark.
+// Coordinates outside of the symbol are light.
+func (self *Code) At(x, y int) bool {
+	if x < 0 || y < 0 || x >= self.Size || y >= self.Size {
+		return false
+	}
+	return self.modules[y*self.Size+x]
+}
+
+// Image returns the symbol rendered with scale pixels per module, surrounded by a QuietZone.
+func (self *Code) Image(scale int) *image.Paletted {
+	scale = max(1, scale)
+	width := (self.Size + 2*QuietZone) * scale
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, width, width), palette)
+	for y := range self.Size {
+		for x := range self.Size {
+			if !self.At(x, y) {
+				continue
+			}
+			x0 := (x + QuietZone) * scale
+			y0 := (y + QuietZone) * scale
+			for py := y0; py < y0+scale; py++ {
+				row := img.Pix[py*img.Stride : (py+1)*img.Stride]
+				for px := x0; px < x0+scale; px++ {
+					row[px] = 1
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+// PNG returns the PNG encoding of the symbol rendered with scale pixels per module.
+func (self *Code) PNG(scale int) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := png.Encode(&buf, self.Image(scale))
+	if nil != err {
+		return nil, wrapError(err, "failed png.Encode")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// bitBuffer is a sequence of bits, most significant first.
+type bitBuffer []bool
+
+func (self *bitBuffer) appendBits(val uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*self = append(*self, 1 == (val>>i)&1)
+	}
+}
+
+func (self bitBuffer) bytes() []byte {
+	rv := make([]byte, (len(self)+7)/8)
+	for i, bit := range self {
+		if bit {
+			rv[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return rv
+}
+
+// encodeSegment returns the mode indicator, character count & data bits of text for version.
+// It returns nil if the character count field of version can not hold the size of text.
+func encodeSegment(text string, version int) bitBuffer {
+	mode := modeByte
+	if 0 == len(strings.Trim(text, alphanumChars)) {
+		mode = modeAlphanum
+	}
+	if len(text) >= 1<<charCountBits(mode, version) {
+		return nil
+	}
+
+	var bb bitBuffer
+	if modeAlphanum == mode {
+		bb.appendBits(modeAlphanum, 4)
+		bb.appendBits(uint32(len(text)), charCountBits(modeAlphanum, version))
+		for i := 0; i < len(text); i += 2 {
+			if i+1 < len(text) {
+				val := 45*strings.IndexByte(alphanumChars, text[i]) + strings.IndexByte(alphanumChars, text[i+1])
+				bb.appendBits(uint32(val), 11)
+			} else {
+				bb.appendBits(uint32(strings.IndexByte(alphanumChars, text[i])), 6)
+			}
+		}
+	} else {
+		bb.appendBits(modeByte, 4)
+		bb.appendBits(uint32(len(text)), charCountBits(modeByte, version))
+		for i := range len(text) {
+			bb.appendBits(uint32(text[i]), 8)
+		}
+	}
+
+	return bb
+}
+
+func charCountBits(mode int, version int) int {
+	var idx int
+	switch {
+	case version <= 9:
+		idx = 0
+	case version <= 26:
+		idx = 1
+	default:
+		idx = 2
+	}
+	if modeAlphanum == mode {
+		return [3]int{9, 11, 13}[idx]
+	}
+	return [3]int{8, 16, 16}[idx]
+}
+
+// numRawDataModules returns the number of modules available for data & ecc codewords,
+// after excluding function patterns & format/version information.
+func numRawDataModules(version int) int {
+	rv := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		rv -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			rv -= 36
+		}
+	}
+	return rv
+}
+
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*numErrorCorrectionBlocks[level][version]
+}
+
+// addEccAndInterleave splits data in blocks, appends the Reed-Solomon ecc to each block and
+// interleaves the blocks codewords.
+func addEccAndInterleave(data []byte, version int, level Level) []byte {
+	numBlocks := numErrorCorrectionBlocks[level][version]
+	blockEccLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := numRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockEccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range numBlocks {
+		datLen := shortBlockLen - blockEccLen
+		if i >= numShortBlocks {
+			datLen += 1
+		}
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, data[k:k+datLen]...)
+		k += datLen
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			block = append(block, 0) // placeholder, skipped when interleaving
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	rv := make([]byte, 0, rawCodewords)
+	for i := range len(blocks[0]) {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockEccLen || j >= numShortBlocks {
+				rv = append(rv, block[i])
+			}
+		}
+	}
+
+	return rv
+}
+
+// reedSolomonDivisor returns the coefficients of the generator polynomial of the given degree,
+// highest power first, excluding the leading 1.
+func reedSolomonDivisor(degree int) []byte {
+	rv := make([]byte, degree)
+	rv[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range rv {
+			rv[j] = gfMultiply(rv[j], root)
+			if j+1 < len(rv) {
+				rv[j] ^= rv[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return rv
+}
+
+func reedSolomonRemainder(data []byte, divisor []byte) []byte {
+	rv := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ rv[0]
+		copy(rv, rv[1:])
+		rv[len(rv)-1] = 0
+		for i, coef := range divisor {
+			rv[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return rv
+}
+
+// gfMultiply returns the product of x & y in GF(2^8/0x11D).
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func (self *Code) setFunction(x, y int, dark bool) {
+	self.modules[y*self.Size+x] = dark
+	self.isFunction[y*self.Size+x] = true
+}
+
+func (self *Code) drawFunctionPatterns() {
+	size := self.Size
+
+	// timing patterns
+	for i := range size {
+		self.setFunction(6, i, 0 == i%2)
+		self.setFunction(i, 6, 0 == i%2)
+	}
+
+	// finder patterns, drawn after timing patterns that they partly overwrite
+	self.drawFinderPattern(3, 3)
+	self.drawFinderPattern(size-4, 3)
+	self.drawFinderPattern(3, size-4)
+
+	// alignment patterns, excluding the ones that overlap finder patterns
+	positions := alignmentPatternPositions(self.Version)
+	last := len(positions) - 1
+	for i, px := range positions {
+		for j, py := range positions {
+			if (0 == i && 0 == j) || (0 == i && last == j) || (last == i && 0 == j) {
+				continue
+			}
+			self.drawAlignmentPattern(px, py)
+		}
+	}
+
+	// reserve format information area, dummy mask
+	self.drawFormatBits(0)
+	self.drawVersion()
+}
+
+// drawFinderPattern draws a finder pattern & its separator centered at x, y.
+func (self *Code) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= self.Size || yy >= self.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			self.setFunction(xx, yy, 2 != dist && 4 != dist)
+		}
+	}
+}
+
+func (self *Code) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			self.setFunction(x+dx, y+dy, 1 != max(abs(dx), abs(dy)))
+		}
+	}
+}
+
+func alignmentPatternPositions(version int) []int {
+	if 1 == version {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := 26
+	if 32 != version {
+		step = (4*version + 2*numAlign + 1) / (2*numAlign - 2) * 2
+	}
+	rv := make([]int, numAlign)
+	rv[0] = 6
+	pos := 4*version + 17 - 7
+	for i := numAlign - 1; i > 0; i-- {
+		rv[i] = pos
+		pos -= step
+	}
+	return rv
+}
+
+// drawFormatBits draws the 2 copies of the error correction level & mask information.
+func (self *Code) drawFormatBits(mask int) {
+	data := formatBits[self.Level]<<3 | mask
+	rem := data
+	for range 10 {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	size := self.Size
+	for i := range 6 {
+		self.setFunction(8, i, getBit(bits, i))
+	}
+	self.setFunction(8, 7, getBit(bits, 6))
+	self.setFunction(8, 8, getBit(bits, 7))
+	self.setFunction(7, 8, getBit(bits, 8))
+	for i := 9; i < 15; i++ {
+		self.setFunction(14-i, 8, getBit(bits, i))
+	}
+
+	for i := range 8 {
+		self.setFunction(size-1-i, 8, getBit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		self.setFunction(8, size-15+i, getBit(bits, i))
+	}
+	self.setFunction(8, size-8, true) // dark module
+}
+
+// drawVersion draws the 2 copies of the version information, for version 7 and above.
+func (self *Code) drawVersion() {
+	if self.Version < 7 {
+		return
+	}
+	rem := self.Version
+	for range 12 {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := self.Version<<12 | rem
+
+	for i := range 18 {
+		bit := getBit(bits, i)
+		a := self.Size - 11 + i%3
+		b := i / 3
+		self.setFunction(a, b, bit)
+		self.setFunction(b, a, bit)
+	}
+}
+
+// drawCodewords places the codewords bits in the zigzag order, skipping function modules.
+func (self *Code) drawCodewords(data []byte) {
+	size := self.Size
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if 6 == right {
+			// skip vertical timing pattern
+			right = 5
+		}
+		upward := 0 == (right+1)&2
+		for vert := range size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if upward {
+					y = size - 1 - vert
+				}
+				if !self.isFunction[y*size+x] && i < 8*len(data) {
+					self.modules[y*size+x] = getBit(int(data[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask XORs the data modules with the mask pattern.
+func (self *Code) applyMask(mask int) {
+	for y := range self.Size {
+		for x := range self.Size {
+			if self.isFunction[y*self.Size+x] {
+				continue
+			}
+			if maskAt(mask, x, y) {
+				self.modules[y*self.Size+x] = !self.modules[y*self.Size+x]
+			}
+		}
+	}
+}
+
+func maskAt(mask int, x, y int) bool {
+	switch mask {
+	case 0:
+		return 0 == (x+y)%2
+	case 1:
+		return 0 == y%2
+	case 2:
+		return 0 == x%3
+	case 3:
+		return 0 == (x+y)%3
+	case 4:
+		return 0 == (x/3+y/2)%2
+	case 5:
+		return 0 == x*y%2+x*y%3
+	case 6:
+		return 0 == (x*y%2+x*y%3)%2
+	default:
+		return 0 == ((x+y)%2+x*y%3)%2
+	}
+}
+
+// penaltyScore evaluates the symbol readability, the encoder selects the mask with the lowest score.
+func (self *Code) penaltyScore() int {
+	size := self.Size
+	rv := 0
+
+	// runs of same color modules & finder like patterns, in rows then columns
+	for _, transposed := range []bool{false, true} {
+		for a := range size {
+			runColor := false
+			runLen := 0
+			history := finderHistory{size: size}
+			for b := range size {
+				x, y := b, a
+				if transposed {
+					x, y = a, b
+				}
+				module := self.At(x, y)
+				if module == runColor {
+					runLen += 1
+					if 5 == runLen {
+						rv += penaltyN1
+					} else if runLen > 5 {
+						rv += 1
+					}
+				} else {
+					history.add(runLen)
+					if !runColor {
+						rv += history.countPatterns() * penaltyN3
+					}
+					runColor = module
+					runLen = 1
+				}
+			}
+			rv += history.terminateAndCount(runColor, runLen) * penaltyN3
+		}
+	}
+
+	// 2x2 blocks of same color modules
+	for y := range size - 1 {
+		for x := range size - 1 {
+			module := self.At(x, y)
+			if module == self.At(x+1, y) && module == self.At(x, y+1) && module == self.At(x+1, y+1) {
+				rv += penaltyN2
+			}
+		}
+	}
+
+	// balance of dark & light modules
+	dark := 0
+	for _, module := range self.modules {
+		if module {
+			dark += 1
+		}
+	}
+	total := size * size
+	k := (abs(20*dark-10*total)+total-1)/total - 1
+	rv += k * penaltyN4
+
+	return rv
+}
+
+// finderHistory holds the lengths of the 7 last runs of a row or column, most recent first.
+type finderHistory struct {
+	size int
+	runs [7]int
+}
+
+func (self *finderHistory) add(runLen int) {
+	if 0 == self.runs[0] {
+		// add light border to initial run
+		runLen += self.size
+	}
+	copy(self.runs[1:], self.runs[:6])
+	self.runs[0] = runLen
+}
+
+// countPatterns returns the number of 1:1:3:1:1 finder like patterns bordered by light runs.
+func (self *finderHistory) countPatterns() int {
+	h := self.runs
+	n := h[1]
+	core := n > 0 && h[2] == n && h[3] == 3*n && h[4] == n && h[5] == n
+	rv := 0
+	if core && h[0] >= 4*n && h[6] >= n {
+		rv += 1
+	}
+	if core && h[6] >= 4*n && h[0] >= n {
+		rv += 1
+	}
+	return rv
+}
+
+func (self *finderHistory) terminateAndCount(runColor bool, runLen int) int {
+	if runColor {
+		self.add(runLen)
+		runLen = 0
+	}
+	// add light border to final run
+	runLen += self.size
+	self.add(runLen)
+	return self.countPatterns()
+}
+
+func getBit(x int, i int) bool {
+	return 0 != (x>>i)&1
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
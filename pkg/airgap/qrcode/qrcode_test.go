@@ -0,0 +1,285 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEncodeHelloWorld(t *testing.T) {
+	code, err := Encode("HELLO WORLD", LevelQ)
+	if nil != err {
+		t.Fatalf("failed Encode, got error %v", err)
+	}
+	if 1 != code.Version || 21 != code.Size {
+		t.Fatalf("failed Encode, got version %d & size %d", code.Version, code.Size)
+	}
+	codewords := readCodewords(t, code)
+	expected := []byte{
+		32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236,
+		168, 72, 22, 82, 217, 54, 156, 0, 46, 15, 180, 122, 16,
+	}
+	if !slices.Equal(expected, codewords) {
+		t.Errorf("failed Encode, got codewords %v != %v", codewords, expected)
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	testcases := []struct {
+		level Level
+		mask  int
+		bits  string
+	}{
+		{level: LevelL, mask: 0, bits: "111011111000100"},
+		{level: LevelM, mask: 0, bits: "101010000010010"},
+		{level: LevelH, mask: 7, bits: "000100000111011"},
+	}
+	for _, tc := range testcases {
+		code := newTestCode(1, tc.level)
+		code.drawFormatBits(tc.mask)
+		bits := readFormatBits(code)
+		if tc.bits != bitString(bits, 15) {
+			t.Errorf("failed drawFormatBits(%d, %d), got %s != %s", tc.level, tc.mask, bitString(bits, 15), tc.bits)
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	code := newTestCode(7, LevelL)
+	code.drawVersion()
+	bits := 0
+	for i := range 18 {
+		if code.At(code.Size-11+i%3, i/3) {
+			bits |= 1 << i
+		}
+		if code.At(i/3, code.Size-11+i%3) != code.At(code.Size-11+i%3, i/3) {
+			t.Fatalf("failed drawVersion, copies differ at bit %d", i)
+		}
+	}
+	expected := "000111110010010100"
+	if expected != bitString(bits, 18) {
+		t.Errorf("failed drawVersion, got %s != %s", bitString(bits, 18), expected)
+	}
+}
+
+func TestAlignmentPatternPositions(t *testing.T) {
+	testcases := []struct {
+		version   int
+		positions []int
+	}{
+		{version: 1, positions: nil},
+		{version: 2, positions: []int{6, 18}},
+		{version: 7, positions: []int{6, 22, 38}},
+		{version: 32, positions: []int{6, 34, 60, 86, 112, 138}},
+		{version: 40, positions: []int{6, 30, 58, 86, 114, 142, 170}},
+	}
+	for _, tc := range testcases {
+		positions := alignmentPatternPositions(tc.version)
+		if !slices.Equal(tc.positions, positions) {
+			t.Errorf("failed alignmentPatternPositions(%d), got %v != %v", tc.version, positions, tc.positions)
+		}
+	}
+}
+
+func TestEncodeReadBack(t *testing.T) {
+	testcases := []struct {
+		name  string
+		text  string
+		level Level
+	}{
+		{name: "alphanum-L", text: "KP:" + strings.Repeat("0123456789ABCDEF", 6), level: LevelL},
+		{name: "alphanum-M", text: "KP:" + strings.Repeat("$%*+-./: XYZ", 40), level: LevelM},
+		{name: "byte-Q", text: strings.Repeat("kerpass qr code ", 20), level: LevelQ},
+		{name: "byte-H", text: "https://idp.kerpass.org/", level: LevelH},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, err := Encode(tc.text, tc.level)
+			if nil != err {
+				t.Fatalf("failed Encode, got error %v", err)
+			}
+			text := decodeText(t, code)
+			if tc.text != text {
+				t.Errorf("failed read back, got %q != %q", text, tc.text)
+			}
+		})
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	_, err := Encode(strings.Repeat("x", 3000), LevelL)
+	if !errors.Is(err, ErrDataTooLong) {
+		t.Errorf("failed size check, got error %v", err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode("KP:TEST", LevelM)
+	if nil != err {
+		t.Fatalf("failed Encode, got error %v", err)
+	}
+	srzimg, err := code.PNG(3)
+	if nil != err {
+		t.Fatalf("failed PNG, got error %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(srzimg))
+	if nil != err {
+		t.Fatalf("failed png.Decode, got error %v", err)
+	}
+	width := (code.Size + 2*QuietZone) * 3
+	if width != img.Bounds().Dx() || width != img.Bounds().Dy() {
+		t.Fatalf("failed PNG, got bounds %v", img.Bounds())
+	}
+	for y := range code.Size {
+		for x := range code.Size {
+			r, _, _, _ := img.At((x+QuietZone)*3+1, (y+QuietZone)*3+1).RGBA()
+			if code.At(x, y) != (0 == r) {
+				t.Fatalf("failed PNG, invalid pixel for module %d, %d", x, y)
+			}
+		}
+	}
+}
+
+func newTestCode(version int, level Level) *Code {
+	size := 4*version + 17
+	return &Code{
+		Version:    version,
+		Size:       size,
+		Level:      level,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+}
+
+func readFormatBits(code *Code) int {
+	bits := 0
+	set := func(i int, x, y int) {
+		if code.At(x, y) {
+			bits |= 1 << i
+		}
+	}
+	for i := range 6 {
+		set(i, 8, i)
+	}
+	set(6, 8, 7)
+	set(7, 8, 8)
+	set(8, 7, 8)
+	for i := 9; i < 15; i++ {
+		set(i, 14-i, 8)
+	}
+	return bits
+}
+
+func bitString(bits int, size int) string {
+	var sb strings.Builder
+	for i := size - 1; i >= 0; i-- {
+		sb.WriteByte('0' + byte((bits>>i)&1))
+	}
+	return sb.String()
+}
+
+// readCodewords returns the unmasked codewords read from code, in placement order.
+func readCodewords(t *testing.T, code *Code) []byte {
+	format := readFormatBits(code) ^ 0x5412
+	if formatBits[code.Level] != format>>13 || code.Mask != (format>>10)&7 {
+		t.Fatalf("invalid format information %s", bitString(format, 15))
+	}
+
+	// recompute function modules
+	ref := newTestCode(code.Version, code.Level)
+	ref.drawFunctionPatterns()
+
+	size := code.Size
+	var bb bitBuffer
+	for right := size - 1; right >= 1; right -= 2 {
+		if 6 == right {
+			right = 5
+		}
+		upward := 0 == (right+1)&2
+		for vert := range size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if upward {
+					y = size - 1 - vert
+				}
+				if !ref.isFunction[y*size+x] {
+					bb = append(bb, code.At(x, y) != maskAt(code.Mask, x, y))
+				}
+			}
+		}
+	}
+
+	return bb.bytes()[:numRawDataModules(code.Version)/8]
+}
+
+// decodeText reads back the text encoded in code, verifying the error correction codewords.
+func decodeText(t *testing.T, code *Code) string {
+	codewords := readCodewords(t, code)
+	version, level := code.Version, code.Level
+
+	// deinterleave
+	numBlocks := numErrorCorrectionBlocks[level][version]
+	blockEccLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := numRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortDataLen := rawCodewords/numBlocks - blockEccLen
+	blocks := make([][]byte, numBlocks)
+	pos := 0
+	for i := range shortDataLen + 1 {
+		for j := range numBlocks {
+			if i < shortDataLen || j >= numShortBlocks {
+				blocks[j] = append(blocks[j], codewords[pos])
+				pos++
+			}
+		}
+	}
+	var data []byte
+	divisor := reedSolomonDivisor(blockEccLen)
+	for j := range numBlocks {
+		ecc := make([]byte, 0, blockEccLen)
+		for i := range blockEccLen {
+			ecc = append(ecc, codewords[pos+i*numBlocks+j])
+		}
+		if !slices.Equal(ecc, reedSolomonRemainder(blocks[j], divisor)) {
+			t.Fatalf("invalid ecc for block %d", j)
+		}
+		data = append(data, blocks[j]...)
+	}
+
+	// parse segment
+	bitPos := 0
+	read := func(n int) int {
+		rv := 0
+		for range n {
+			rv = rv<<1 | int((data[bitPos>>3]>>(7-bitPos&7))&1)
+			bitPos++
+		}
+		return rv
+	}
+	mode := read(4)
+	count := read(charCountBits(mode, version))
+	var sb strings.Builder
+	switch mode {
+	case modeAlphanum:
+		for ; count >= 2; count -= 2 {
+			val := read(11)
+			sb.WriteByte(alphanumChars[val/45])
+			sb.WriteByte(alphanumChars[val%45])
+		}
+		if 1 == count {
+			sb.WriteByte(alphanumChars[read(6)])
+		}
+	case modeByte:
+		for range count {
+			sb.WriteByte(byte(read(8)))
+		}
+	default:
+		t.Fatalf("unexpected mode %d", mode)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,63 @@
+package airgap
+
+import (
+	"strings"
+)
+
+const (
+	// TextPrefix starts the text encoding of airgap message Parts.
+	TextPrefix = "KP:"
+
+	// base45 alphabet (RFC 9285), it is a subset of the QR code alphanumeric mode characters
+	b45Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+	b45Base     = 45
+)
+
+// AppendBase45 appends the RFC 9285 base45 encoding of data to dst.
+func AppendBase45(dst []byte, data []byte) []byte {
+	for pos := 0; pos < len(data); pos += 2 {
+		if pos+1 < len(data) {
+			n := int(data[pos])<<8 | int(data[pos+1])
+			dst = append(dst, b45Alphabet[n%b45Base], b45Alphabet[(n/b45Base)%b45Base], b45Alphabet[n/(b45Base*b45Base)])
+		} else {
+			n := int(data[pos])
+			dst = append(dst, b45Alphabet[n%b45Base], b45Alphabet[n/b45Base])
+		}
+	}
+
+	return dst
+}
+
+// DecodeBase45 returns the data decoded from the RFC 9285 base45 text.
+// It errors if text is not a valid base45 encoding.
+func DecodeBase45(text string) ([]byte, error) {
+	if 1 == len(text)%3 {
+		return nil, newError("invalid base45 length")
+	}
+	rv := make([]byte, 0, 2*len(text)/3+1)
+	var digits [3]int
+	for pos := 0; pos < len(text); pos += 3 {
+		chunk := text[pos:min(pos+3, len(text))]
+		for i := range len(chunk) {
+			digits[i] = strings.IndexByte(b45Alphabet, chunk[i])
+			if digits[i] < 0 {
+				return nil, newError("invalid base45 character at position %d", pos+i)
+			}
+		}
+		n := digits[0] + digits[1]*b45Base
+		if 3 == len(chunk) {
+			n += digits[2] * b45Base * b45Base
+			if n > 0xFFFF {
+				return nil, newError("invalid base45 triplet at position %d", pos)
+			}
+			rv = append(rv, byte(n>>8), byte(n))
+		} else {
+			if n > 0xFF {
+				return nil, newError("invalid base45 pair at position %d", pos)
+			}
+			rv = append(rv, byte(n))
+		}
+	}
+
+	return rv, nil
+}
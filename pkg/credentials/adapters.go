@@ -22,6 +22,8 @@ type SrvStoreCard struct {
 	RealmId  RealmId
 	SealType sealType
 	KeyData  []byte
+	State    CardState
+	Label    string
 }
 
 // Check returns an error if the SrvStoreCard is invalid.
@@ -125,6 +127,8 @@ func (self *SrvStorageAdapter) ToCardStorage(aks *AccessKeys, src *ServerCard, d
 	dst.RealmId = src.RealmId
 	dst.SealType = KsSealNone
 	dst.KeyData = srzkeys
+	dst.State = src.State
+	dst.Label = src.Label
 
 	return nil
 }
@@ -154,6 +158,8 @@ func (self *SrvStorageAdapter) FromCardStorage(aks *AccessKeys, src *SrvStoreCar
 	dst.RealmId = src.RealmId
 	dst.Kh = ck.Kh
 	dst.Psk = ck.Psk
+	dst.State = src.State
+	dst.Label = src.Label
 
 	return nil
 
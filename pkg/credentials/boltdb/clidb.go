@@ -3,6 +3,7 @@ package boltdb
 
 import (
 	"bytes"
+	"cmp"
 	"crypto"
 	"encoding/binary"
 	"math"
@@ -40,14 +41,29 @@ func New(dbpath string) (credentials.ClientCredStore, error) {
 	err = db.Update(func(tx *bolt.Tx) error {
 		var err error
 
+		// sort indexes were added after the initial schema
+		// they are rebuilt when missing
+		reindex := nil == tx.Bucket([]byte("cardLblIdx")) || nil == tx.Bucket([]byte("cardUseIdx"))
+
 		// create db buckets
-		for _, bucketname := range []string{"cardTbl", "cardTknIdx", "cardRlmIdx", "realmTbl", "realmIdx"} {
+		for _, bucketname := range []string{"cardTbl", "cardTknIdx", "cardRlmIdx", "cardLblIdx", "cardUseIdx", "realmTbl", "realmIdx"} {
 			_, err = tx.CreateBucketIfNotExists([]byte(bucketname))
 			if nil != err {
 				return wrapError(err, "failed %s bucket creation", bucketname)
 			}
 		}
 
+		if reindex {
+			sch, err := loadSchema(tx)
+			if nil != err {
+				return wrapError(err, "failed loadSchema")
+			}
+			err = sch.reindexCards()
+			if nil != err {
+				return wrapError(err, "failed rebuilding sort indexes")
+			}
+		}
+
 		return nil
 	})
 	if nil != err {
@@ -197,6 +213,12 @@ func (self cliCredStore) CreateCard(card *credentials.Card) error {
 			return wrapError(err, "failed updating the cardTknIdx bucket")
 		}
 
+		// add entries in sort indexes
+		err = sch.indexCard(&csk)
+		if nil != err {
+			return wrapError(err, "failed updating sort indexes")
+		}
+
 		return nil
 	})
 
@@ -252,6 +274,12 @@ func (self cliCredStore) RemoveCard(cId int) (bool, error) {
 			return err
 		}
 
+		err = sch.unindexCard(&csk)
+		if nil != err {
+			// unlikely as sort indexes are writable
+			return err
+		}
+
 		removed = true
 
 		return nil
@@ -282,27 +310,34 @@ func (self cliCredStore) SetCardLabel(cId int, lbl string) error {
 			return wrapError(err, "failed loading schema")
 		}
 
-		var card credentials.ClientCard
-		found, err := sch.loadCardById(cId, &card)
-		if nil != err {
-			return wrapError(err, "failed loading card")
-		}
-		if !found {
-			return wrapError(ErrNotFound, "missing card")
-		}
-		card.ID = cId
-		card.Label = lbl
-		srzcard, err := cbor.Marshal(card)
-		if nil != err {
-			return wrapError(err, "failed cbor.Marshal of ClientCard")
-		}
-		err = sch.cardTbl.Put(byteId(cId), srzcard)
+		return sch.updateCard(cId, func(card *credentials.ClientCard) {
+			card.Label = lbl
+		})
+	})
+
+	return err
+}
+
+// SetCardLastUsed records that the card with cId ID was used at Unix time ts.
+// It errors if the card does not exist.
+func (self cliCredStore) SetCardLastUsed(cId int, ts int64) error {
+	db, err := bolt.Open(self.dbpath, 0600, &bolt.Options{Timeout: connectTimeout})
+	if nil != err {
+		return wrapError(err, "failed connecting to the database")
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		var err error
+
+		sch, err := loadSchema(tx)
 		if nil != err {
-			return wrapError(err, "failed storing card in cardTbl bucket")
+			return wrapError(err, "failed loading schema")
 		}
 
-		return nil
-
+		return sch.updateCard(cId, func(card *credentials.ClientCard) {
+			card.LastUsed = ts
+		})
 	})
 
 	return err
@@ -377,6 +412,7 @@ func (self cliCredStore) LoadInfo(cId int, dst *credentials.CardInfo) error {
 		dst.AppName = realm.AppName
 		dst.AppDesc = realm.AppDesc
 		dst.Label = card.Label
+		dst.LastUsed = card.LastUsed
 
 		return nil
 
@@ -485,11 +521,12 @@ func (self cliCredStore) ListInfo(qry credentials.CardQuery) ([]credentials.Card
 
 			// join card & realm into info
 			info := credentials.CardInfo{
-				ID:      card.ID,
-				RealmID: rId,
-				AppName: realm.AppName,
-				AppDesc: realm.AppDesc,
-				Label:   card.Label,
+				ID:       card.ID,
+				RealmID:  rId,
+				AppName:  realm.AppName,
+				AppDesc:  realm.AppDesc,
+				Label:    card.Label,
+				LastUsed: card.LastUsed,
 			}
 
 			infos = append(infos, info)
@@ -570,6 +607,206 @@ func (self cliCredStore) ListAppInfo(qry credentials.AppQuery) ([]credentials.Ap
 	return appList, nil
 }
 
+// SelectCards returns the ClientCards that match sel, most recently used first.
+func (self cliCredStore) SelectCards(sel credentials.CardSelection) ([]credentials.ClientCard, error) {
+	err := sel.Check()
+	if nil != err {
+		return nil, wrapError(err, "failed sel.Check")
+	}
+	db, err := bolt.Open(self.dbpath, 0600, &bolt.Options{Timeout: connectTimeout})
+	if nil != err {
+		return nil, wrapError(err, "failed connecting to the database")
+	}
+	defer db.Close()
+
+	var cards []credentials.ClientCard
+	err = db.View(func(tx *bolt.Tx) error {
+		sch, err := loadSchema(tx)
+		if nil != err {
+			return wrapError(err, "failed loading schema")
+		}
+
+		// iterates the sel.RealmId entries of cardRlmIdx
+		// keys in cardRlmIdx are [realmId|cardId]
+		c := sch.cardRlmIdx.Cursor()
+		for k, v := c.Seek(sel.RealmId); k != nil && bytes.HasPrefix(k, sel.RealmId); k, v = c.Next() {
+			uId := binary.BigEndian.Uint64(v)
+			if uId > math.MaxInt {
+				return wrapError(ErrValidation, "Invalid ClientCard.ID")
+			}
+			card := credentials.ClientCard{}
+			found, err := sch.loadCardById(int(uId), &card)
+			if nil != err {
+				return wrapError(err, "failed loading card")
+			}
+			if !found || !sel.Match(&card) {
+				continue
+			}
+			cards = append(cards, card)
+		}
+
+		return nil
+	})
+	if nil != err {
+		return nil, err
+	}
+
+	credentials.SortCards(cards)
+	if sel.Limit > 0 && len(cards) > sel.Limit {
+		cards = cards[:sel.Limit]
+	}
+
+	return cards, nil
+}
+
+// SearchInfo returns the CardPage of CardInfo that matches qry.
+// The Label & LastUsed sort indexes are read from the qry Cursor position, but the CardPage Total
+// forces a full count of the index entries, which loads the cards if qry has Text or RealmId.
+func (self cliCredStore) SearchInfo(qry credentials.CardSearch) (credentials.CardPage, error) {
+	pager, err := credentials.NewCardPager(&qry)
+	if nil != err {
+		return credentials.CardPage{}, wrapError(err, "failed NewCardPager")
+	}
+	db, err := bolt.Open(self.dbpath, 0600, &bolt.Options{Timeout: connectTimeout})
+	if nil != err {
+		return credentials.CardPage{}, wrapError(err, "failed connecting to the database")
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		sch, err := loadSchema(tx)
+		if nil != err {
+			return wrapError(err, "failed loading schema")
+		}
+
+		rlmCache := make(map[int]credentials.Realm)
+
+		// pass passes the CardInfo of the card with srzId ID to the pager method fn
+		pass := func(srzId []byte, fn func(*credentials.CardInfo)) error {
+			uId := binary.BigEndian.Uint64(srzId)
+			if uId > math.MaxInt {
+				return wrapError(ErrValidation, "Invalid ClientCard.ID")
+			}
+			card := credentials.ClientCard{}
+			found, err := sch.loadCardById(int(uId), &card)
+			if nil != err {
+				return wrapError(err, "failed loading card")
+			}
+			if !found {
+				// index entry of a missing card, db is corrupted
+				return nil
+			}
+			if len(qry.RealmId) > 0 && !bytes.Equal(qry.RealmId, card.RealmId) {
+				return nil
+			}
+			realm := credentials.Realm{}
+			rId, err := sch.loadRealmByKey(card.RealmId, rlmCache, &realm)
+			if nil != err {
+				return wrapError(err, "failed retrieving card realm")
+			}
+			fn(&credentials.CardInfo{
+				ID:       card.ID,
+				RealmID:  rId,
+				AppName:  realm.AppName,
+				AppDesc:  realm.AppDesc,
+				Label:    card.Label,
+				LastUsed: card.LastUsed,
+			})
+
+			return nil
+		}
+		add := func(srzId []byte) error {
+			return pass(srzId, pager.Add)
+		}
+
+		// scan calls add for the cards indexed in bkt by keys starting with prefix
+		// bkt values are 8 bytes card ID
+		scan := func(bkt *bolt.Bucket, prefix []byte) error {
+			c := bkt.Cursor()
+			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				err := add(v)
+				if nil != err {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// seek appends to the pager the cards indexed in bkt after the key of the Cursor position,
+		// the page ends after Limit cards. Total is counted with a separate full scan of bkt.
+		seek := func(bkt *bolt.Bucket, key func(*cardStoreKeys) []byte) error {
+			c := bkt.Cursor()
+			k, v := c.First()
+			if pos := pager.Position(); nil != pos {
+				var csk cardStoreKeys
+				readStoreKeys(&credentials.ClientCard{ID: pos.ID, Label: pos.Label, LastUsed: pos.LastUsed}, &csk)
+				k, v = c.Seek(key(&csk))
+			}
+			for ; k != nil && !pager.Full(); k, v = c.Next() {
+				err := pass(v, pager.Append)
+				if nil != err {
+					return err
+				}
+			}
+			count := func(srzId []byte) error {
+				return pass(srzId, pager.Count)
+			}
+			if "" == qry.Text && 0 == len(qry.RealmId) {
+				// all the indexed cards match, they are counted without loading
+				count = func([]byte) error {
+					pager.Count(&credentials.CardInfo{})
+					return nil
+				}
+			}
+			c = bkt.Cursor()
+			for k, v = c.First(); k != nil; k, v = c.Next() {
+				err := count(v)
+				if nil != err {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// the sort indexes deliver cards in qry.Sort order
+		// cards of a single Realm are ordered by ID in cardRlmIdx
+		switch {
+		case credentials.SortByLabel == qry.Sort:
+			return seek(sch.cardLblIdx, func(csk *cardStoreKeys) []byte { return csk.labelKey })
+		case credentials.SortByLastUsed == qry.Sort:
+			return seek(sch.cardUseIdx, func(csk *cardStoreKeys) []byte { return csk.usedKey })
+		case len(qry.RealmId) > 0:
+			return scan(sch.cardRlmIdx, qry.RealmId)
+		case credentials.SortByAppName == qry.Sort:
+			realms, err := sch.sortedRealms()
+			if nil != err {
+				return wrapError(err, "failed sorting realms")
+			}
+			for _, realm := range realms {
+				err = scan(sch.cardRlmIdx, realm.RealmId)
+				if nil != err {
+					return err
+				}
+			}
+			return nil
+		default:
+			c := sch.cardTbl.Cursor()
+			for k, _ := c.First(); k != nil; k, _ = c.Next() {
+				err = add(k)
+				if nil != err {
+					return err
+				}
+			}
+			return nil
+		}
+	})
+	if nil != err {
+		return credentials.CardPage{}, err
+	}
+
+	return pager.Page(), nil
+}
+
 // CardCount returns the number of Card in the ClientCredStore.
 func (self cliCredStore) CardCount() int {
 
@@ -603,6 +840,8 @@ type schema struct {
 	cardTbl    *bolt.Bucket
 	cardTknIdx *bolt.Bucket
 	cardRlmIdx *bolt.Bucket
+	cardLblIdx *bolt.Bucket
+	cardUseIdx *bolt.Bucket
 	realmTbl   *bolt.Bucket
 	realmIdx   *bolt.Bucket
 }
@@ -612,11 +851,14 @@ func loadSchema(tx *bolt.Tx) (schema, error) {
 		cardTbl:    tx.Bucket([]byte("cardTbl")),
 		cardTknIdx: tx.Bucket([]byte("cardTknIdx")),
 		cardRlmIdx: tx.Bucket([]byte("cardRlmIdx")),
+		cardLblIdx: tx.Bucket([]byte("cardLblIdx")),
+		cardUseIdx: tx.Bucket([]byte("cardUseIdx")),
 		realmTbl:   tx.Bucket([]byte("realmTbl")),
 		realmIdx:   tx.Bucket([]byte("realmIdx")),
 	}
 	var err error
-	if nil == rv.cardTbl || nil == rv.cardTknIdx || nil == rv.cardRlmIdx || nil == rv.realmTbl || nil == rv.realmIdx {
+	if nil == rv.cardTbl || nil == rv.cardTknIdx || nil == rv.cardRlmIdx || nil == rv.cardLblIdx || nil == rv.cardUseIdx ||
+		nil == rv.realmTbl || nil == rv.realmIdx {
 		err = newError("1 or more bucket is missing")
 	}
 
@@ -638,6 +880,96 @@ func (self schema) loadCardById(cId int, dst *credentials.ClientCard) (bool, err
 	return true, nil
 }
 
+// updateCard loads the card with cId ID, applies update to it and saves the result.
+// It errors if the card does not exist.
+func (self schema) updateCard(cId int, update func(card *credentials.ClientCard)) error {
+	var card credentials.ClientCard
+	found, err := self.loadCardById(cId, &card)
+	if nil != err {
+		return wrapError(err, "failed loading card")
+	}
+	if !found {
+		return wrapError(ErrNotFound, "missing card")
+	}
+	csk := cardStoreKeys{}
+	readStoreKeys(&card, &csk)
+	err = self.unindexCard(&csk)
+	if nil != err {
+		return wrapError(err, "failed removing sort indexes entries")
+	}
+
+	update(&card)
+	srzcard, err := cbor.Marshal(card)
+	if nil != err {
+		return wrapError(err, "failed cbor.Marshal of ClientCard")
+	}
+	err = self.cardTbl.Put(byteId(cId), srzcard)
+	if nil != err {
+		return wrapError(err, "failed storing card in cardTbl bucket")
+	}
+
+	readStoreKeys(&card, &csk)
+	err = self.indexCard(&csk)
+	if nil != err {
+		return wrapError(err, "failed updating sort indexes")
+	}
+
+	return nil
+}
+
+// indexCard adds the csk entries of the cardLblIdx & cardUseIdx sort indexes.
+func (self schema) indexCard(csk *cardStoreKeys) error {
+	err := self.cardLblIdx.Put(csk.labelKey, csk.cardId)
+	if nil != err {
+		return wrapError(err, "failed updating the cardLblIdx bucket")
+	}
+	err = self.cardUseIdx.Put(csk.usedKey, csk.cardId)
+	if nil != err {
+		return wrapError(err, "failed updating the cardUseIdx bucket")
+	}
+
+	return nil
+}
+
+// unindexCard removes the csk entries of the cardLblIdx & cardUseIdx sort indexes.
+func (self schema) unindexCard(csk *cardStoreKeys) error {
+	err := self.cardLblIdx.Delete(csk.labelKey)
+	if nil != err {
+		return wrapError(err, "failed updating the cardLblIdx bucket")
+	}
+	err = self.cardUseIdx.Delete(csk.usedKey)
+	if nil != err {
+		return wrapError(err, "failed updating the cardUseIdx bucket")
+	}
+
+	return nil
+}
+
+// reindexCards adds the sort indexes entries of all cards in cardTbl.
+func (self schema) reindexCards() error {
+	c := self.cardTbl.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		uId := binary.BigEndian.Uint64(k)
+		if uId > math.MaxInt {
+			return wrapError(ErrValidation, "Invalid ClientCard.ID")
+		}
+		card := credentials.ClientCard{}
+		err := cbor.Unmarshal(v, &card)
+		if nil != err {
+			return wrapError(err, "failed unmarshaling card")
+		}
+		card.ID = int(uId)
+		csk := cardStoreKeys{}
+		readStoreKeys(&card, &csk)
+		err = self.indexCard(&csk)
+		if nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (self schema) loadCardByKey(idtoken []byte, dst *credentials.ClientCard) (bool, error) {
 	srzId := self.cardTknIdx.Get(hash(idtoken))
 	if nil == srzId {
@@ -696,6 +1028,36 @@ func (self schema) loadRealmByKey(realmid []byte, realmCache map[int]credentials
 
 }
 
+// sortedRealms returns the Realms of realmTbl ordered by case folded AppName, then by ID.
+func (self schema) sortedRealms() ([]credentials.Realm, error) {
+	type rlmEntry struct {
+		rId   uint64
+		realm credentials.Realm
+	}
+	var entries []rlmEntry
+	c := self.realmTbl.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		entry := rlmEntry{rId: binary.BigEndian.Uint64(k)}
+		err := cbor.Unmarshal(v, &entry.realm)
+		if nil != err {
+			return nil, wrapError(err, "failed unmarshaling realm")
+		}
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(e0, e1 rlmEntry) int {
+		return cmp.Or(
+			strings.Compare(credentials.FoldText(e0.realm.AppName), credentials.FoldText(e1.realm.AppName)),
+			cmp.Compare(e0.rId, e1.rId),
+		)
+	})
+	realms := make([]credentials.Realm, len(entries))
+	for i, entry := range entries {
+		realms[i] = entry.realm
+	}
+
+	return realms, nil
+}
+
 // hash returns data digest
 //
 // digest is calculated using the hash function referenced by the hashAlgo constant
@@ -722,6 +1084,14 @@ type cardStoreKeys struct {
 	// hash of card IdToken
 	// key cardId in cardTknIdx bucket.
 	tokenKey []byte
+
+	// composite key [FoldText(Label) | 0x00 | cardId]
+	// key cardId in cardLblIdx bucket.
+	labelKey []byte
+
+	// composite key [descending LastUsed | cardId]
+	// key cardId in cardUseIdx bucket.
+	usedKey []byte
 }
 
 func readStoreKeys(card *credentials.ClientCard, dst *cardStoreKeys) {
@@ -738,6 +1108,21 @@ func readStoreKeys(card *credentials.ClientCard, dst *cardStoreKeys) {
 	// tokenKey
 	// IdToken is hashed to preserve privacy
 	dst.tokenKey = hash(card.IdToken)
+
+	// labelKey
+	lbl := credentials.FoldText(card.Label)
+	lk := make([]byte, len(lbl)+9)
+	copy(lk, lbl)
+	copy(lk[len(lbl)+1:], dst.cardId)
+	dst.labelKey = lk
+
+	// usedKey
+	// flipping the sign bit maps LastUsed to an uint64 with same ordering,
+	// the result is inverted for most recently used cards to come first.
+	uk := make([]byte, 16)
+	binary.BigEndian.PutUint64(uk, ^(uint64(card.LastUsed) ^ (1 << 63)))
+	copy(uk[8:], dst.cardId)
+	dst.usedKey = uk
 }
 
 // byteId returns 8 bytes BigEndian encoding of cid
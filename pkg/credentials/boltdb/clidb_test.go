@@ -557,6 +557,213 @@ func TestListAppInfo_RealmUpsert(t *testing.T) {
 	}
 }
 
+func TestSelectCards(t *testing.T) {
+	tmpdir := t.TempDir()
+	dbPath := path.Join(tmpdir, "card.db")
+	store, err := New(dbPath)
+	if nil != err {
+		t.Fatalf("failed New, got error %v", err)
+	}
+
+	realmId := make([]byte, 32)
+	rand.Read(realmId)
+	cards := make([]credentials.Card, 5)
+	for i := range cards {
+		card := &cards[i]
+		err = initCard(card)
+		if nil != err {
+			t.Fatalf("failed initCard #%d, got error %v", i, err)
+		}
+		if i < 4 {
+			card.RealmId = realmId
+		}
+		if 3 == i {
+			keypair, err := ecdh.P256().GenerateKey(rand.Reader)
+			if nil != err {
+				t.Fatalf("failed GenerateKey, got error %v", err)
+			}
+			card.Kh = credentials.PrivateKeyHandle{PrivateKey: keypair}
+		}
+		err = store.CreateCard(card)
+		if nil != err {
+			t.Fatalf("failed CreateCard #%d, got error %v", i, err)
+		}
+	}
+
+	err = store.SetCardLastUsed(cards[1].ID, 100)
+	if nil != err {
+		t.Fatalf("failed SetCardLastUsed, got error %v", err)
+	}
+	err = store.SetCardLastUsed(cards[2].ID, 200)
+	if nil != err {
+		t.Fatalf("failed SetCardLastUsed, got error %v", err)
+	}
+	err = store.SetCardLastUsed(1000, 200)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed SetCardLastUsed of missing card, got error %v", err)
+	}
+
+	selected, err := store.SelectCards(credentials.CardSelection{RealmId: realmId, Curve: ecdh.X25519()})
+	if nil != err {
+		t.Fatalf("failed SelectCards, got error %v", err)
+	}
+	expected := []int{cards[2].ID, cards[1].ID, cards[0].ID}
+	ids := make([]int, 0, len(selected))
+	for _, card := range selected {
+		ids = append(ids, card.ID)
+	}
+	if !reflect.DeepEqual(expected, ids) {
+		t.Errorf("failed SelectCards order, got %v != %v", ids, expected)
+	}
+	if 200 != selected[0].LastUsed {
+		t.Errorf("failed LastUsed control, got %d", selected[0].LastUsed)
+	}
+
+	selected, err = store.SelectCards(credentials.CardSelection{RealmId: realmId, Limit: 2})
+	if nil != err {
+		t.Fatalf("failed SelectCards, got error %v", err)
+	}
+	if 2 != len(selected) || cards[2].ID != selected[0].ID {
+		t.Errorf("failed SelectCards with Limit, got %d cards", len(selected))
+	}
+
+	var info credentials.CardInfo
+	err = store.LoadInfo(cards[2].ID, &info)
+	if nil != err {
+		t.Fatalf("failed LoadInfo, got error %v", err)
+	}
+	if 200 != info.LastUsed {
+		t.Errorf("failed CardInfo LastUsed control, got %d", info.LastUsed)
+	}
+}
+
+func TestSearchInfo(t *testing.T) {
+	tmpdir := t.TempDir()
+	dbPath := path.Join(tmpdir, "card.db")
+	store, err := New(dbPath)
+	if nil != err {
+		t.Fatalf("failed New, got error %v", err)
+	}
+
+	// 2 realms, "Zeta" with cards 0..2 & "alpha" with cards 3..5
+	realms := [2][32]byte{}
+	for i := range 2 {
+		rand.Read(realms[i][:])
+	}
+	labels := []string{"Work", "home", "", "Bank", "work phone", ""}
+	ids := make([]int, len(labels))
+	for i, lbl := range labels {
+		card := credentials.Card{}
+		err = initCard(&card)
+		if nil != err {
+			t.Fatalf("failed initCard #%d, got error %v", i, err)
+		}
+		if i < 3 {
+			card.RealmId = realms[0][:]
+			card.AppName = "Zeta"
+		} else {
+			card.RealmId = realms[1][:]
+			card.AppName = "alpha"
+		}
+		err = store.CreateCard(&card)
+		if nil != err {
+			t.Fatalf("failed CreateCard #%d, got error %v", i, err)
+		}
+		if "" != lbl {
+			err = store.SetCardLabel(card.ID, lbl)
+			if nil != err {
+				t.Fatalf("failed SetCardLabel #%d, got error %v", i, err)
+			}
+		}
+		ids[i] = card.ID
+	}
+	for i, ts := range map[int]int64{1: 300, 4: 200, 3: 100} {
+		err = store.SetCardLastUsed(ids[i], ts)
+		if nil != err {
+			t.Fatalf("failed SetCardLastUsed #%d, got error %v", i, err)
+		}
+	}
+
+	testcases := []struct {
+		qry      credentials.CardSearch
+		expected []int
+	}{
+		{qry: credentials.CardSearch{Sort: credentials.SortById}, expected: []int{0, 1, 2, 3, 4, 5}},
+		{qry: credentials.CardSearch{Sort: credentials.SortByLabel}, expected: []int{2, 5, 3, 1, 0, 4}},
+		{qry: credentials.CardSearch{Sort: credentials.SortByAppName}, expected: []int{3, 4, 5, 0, 1, 2}},
+		{qry: credentials.CardSearch{Sort: credentials.SortByLastUsed}, expected: []int{1, 4, 3, 0, 2, 5}},
+		{qry: credentials.CardSearch{Sort: credentials.SortByLabel, Text: "WORK"}, expected: []int{0, 4}},
+		{qry: credentials.CardSearch{Sort: credentials.SortByLastUsed, RealmId: realms[1][:]}, expected: []int{4, 3, 5}},
+		{qry: credentials.CardSearch{Sort: credentials.SortByAppName, RealmId: realms[0][:], Text: "o"}, expected: []int{0, 1}},
+	}
+	check := func(round string) {
+		for _, tc := range testcases {
+			expected := make([]int, len(tc.expected))
+			for i, pos := range tc.expected {
+				expected[i] = ids[pos]
+			}
+			qry := tc.qry
+			qry.Limit = 2
+			var got []int
+			for {
+				page, err := store.SearchInfo(qry)
+				if nil != err {
+					t.Fatalf("%s: failed SearchInfo(%+v), got error %v", round, qry, err)
+				}
+				if len(expected) != page.Total {
+					t.Errorf("%s: failed Total control for %+v, got %d != %d", round, qry, page.Total, len(expected))
+				}
+				for _, info := range page.Infos {
+					got = append(got, info.ID)
+				}
+				if "" == page.Next {
+					break
+				}
+				qry.Cursor = page.Next
+			}
+			if !reflect.DeepEqual(expected, got) {
+				t.Errorf("%s: failed SearchInfo(%+v) control, got %v != %v", round, tc.qry, got, expected)
+			}
+		}
+	}
+	check("indexed")
+
+	// databases created before the sort indexes get them rebuilt by New
+	db, err := bolt.Open(dbPath, 0600, nil)
+	if nil != err {
+		t.Fatalf("failed bolt.Open, got error %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte("cardLblIdx"))
+		if nil != err {
+			return err
+		}
+		return tx.DeleteBucket([]byte("cardUseIdx"))
+	})
+	db.Close()
+	if nil != err {
+		t.Fatalf("failed removing sort indexes, got error %v", err)
+	}
+	store, err = New(dbPath)
+	if nil != err {
+		t.Fatalf("failed New, got error %v", err)
+	}
+	check("reindexed")
+
+	// removed cards leave the sort indexes
+	_, err = store.RemoveCard(ids[1])
+	if nil != err {
+		t.Fatalf("failed RemoveCard, got error %v", err)
+	}
+	page, err := store.SearchInfo(credentials.CardSearch{Sort: credentials.SortByLastUsed, Limit: 1})
+	if nil != err {
+		t.Fatalf("failed SearchInfo, got error %v", err)
+	}
+	if 5 != page.Total || ids[4] != page.Infos[0].ID {
+		t.Errorf("failed SearchInfo after RemoveCard, got %+v", page)
+	}
+}
+
 func initCard(card *credentials.Card) error {
 	realmId := make([]byte, 32)
 	rand.Read(realmId)
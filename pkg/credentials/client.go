@@ -2,9 +2,13 @@ package credentials
 
 import (
 	"bytes"
+	"cmp"
+	"crypto/ecdh"
 	"slices"
 	"strings"
 	"sync"
+
+	"code.kerpass.org/golang/pkg/ephemsec"
 )
 
 type ClientCredStore interface {
@@ -39,6 +43,18 @@ type ClientCredStore interface {
 	// ListAppInfo returns a list of AppInfo that matches qry.
 	ListAppInfo(qry AppQuery) ([]AppInfo, error)
 
+	// SearchInfo returns the CardPage of CardInfo that matches qry.
+	// Following pages are obtained by setting qry.Cursor to the CardPage Next token.
+	SearchInfo(qry CardSearch) (CardPage, error)
+
+	// SelectCards returns the ClientCards that match sel, most recently used first.
+	// Cards that were never used are returned last, ordered by ID.
+	SelectCards(sel CardSelection) ([]ClientCard, error)
+
+	// SetCardLastUsed records that the card with cId ID was used at Unix time ts.
+	// It errors if the card does not exist.
+	SetCardLastUsed(cId int, ts int64) error
+
 	// CardCount returns the number of Card in the ClientCredStore.
 	// It returns -1 in case of error.
 	CardCount() int
@@ -148,6 +164,9 @@ type ClientCard struct {
 	Kh      PrivateKeyHandle `json:"sk" cbor:"4,keyasint"`                          // uses Kh.PrivateKey to obtain the ecdh.PrivateKey
 	Psk     []byte           `json:"psk" cbor:"5,keyasint"`
 	Label   string           `json:"label,omitempty" cbor:"9,keyasint,omitempty"`
+
+	// Unix time of the card last usage, 0 if the card was never used
+	LastUsed int64 `json:"last_used,omitempty" cbor:"10,keyasint,omitempty"`
 }
 
 // Check returns an error if the ClientCard is invalid.
@@ -178,6 +197,8 @@ type CardInfo struct {
 	AppName string `json:"app_name" cbor:"6,keyasint"`
 	AppDesc string `json:"app_desc,omitempty" cbor:"7,keyasint,omitempty"`
 	Label   string `json:"label,omitempty" cbor:"9,keyasint,omitempty"`
+
+	LastUsed int64 `json:"last_used,omitempty" cbor:"10,keyasint,omitempty"`
 }
 
 // CardQuery parametrizes ClientCredStore ListInfo.
@@ -197,6 +218,69 @@ func (self *CardQuery) Check() error {
 	return nil
 }
 
+// CardSelection parametrizes ClientCredStore SelectCards.
+type CardSelection struct {
+	RealmId []byte
+
+	// Curve of the card keys, nil selects cards of any curve
+	Curve ecdh.Curve
+
+	// Scheme is the EPHEMSEC scheme code that the cards answer, 0 selects cards of any scheme.
+	// Cards answer a scheme if their keys are on the scheme curve & the scheme has no KEM,
+	// OTP schemes additionally require a card UserId.
+	Scheme uint16
+
+	Limit int // maximum number of selected items
+}
+
+// Check returns an error if the CardSelection is invalid.
+func (self *CardSelection) Check() error {
+	realmId := RealmId(self.RealmId)
+	err := realmId.Check()
+	if nil != err {
+		return wrapError(err, "invalid RealmId")
+	}
+	if 0 != self.Scheme {
+		_, err = ephemsec.GetScheme(self.Scheme)
+		if nil != err {
+			return wrapError(err, "invalid Scheme")
+		}
+	}
+
+	return nil
+}
+
+// Match returns true if card matches the CardSelection.
+func (self *CardSelection) Match(card *ClientCard) bool {
+	if !bytes.Equal(self.RealmId, card.RealmId) {
+		return false
+	}
+	if nil != self.Curve && (nil == card.Kh.PrivateKey || self.Curve != card.Kh.PrivateKey.Curve()) {
+		return false
+	}
+	if 0 != self.Scheme {
+		sch, err := ephemsec.GetScheme(self.Scheme)
+		if nil != err || nil != sch.Kem() {
+			return false
+		}
+		if nil == card.Kh.PrivateKey || sch.Curve().Curve != card.Kh.PrivateKey.Curve() {
+			return false
+		}
+		if 0 != sch.Alphabet().Size() && "" == card.UserId {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SortCards sorts cards most recently used first, then by ID.
+func SortCards(cards []ClientCard) {
+	slices.SortFunc(cards, func(c0, c1 ClientCard) int {
+		return cmp.Or(cmp.Compare(c1.LastUsed, c0.LastUsed), cmp.Compare(c0.ID, c1.ID))
+	})
+}
+
 // AppInfo holds ClientCredStore Realm informations.
 type AppInfo struct {
 	RealmID   int    `json:"rid" cbor:"1,keyasint"`
@@ -340,6 +424,11 @@ func (self *MemClientCredStore) LoadCard(cId int, dst *ClientCard) error {
 	self.mut.Lock()
 	defer self.mut.Unlock()
 
+	return self.loadCard(cId, dst)
+}
+
+func (self *MemClientCredStore) loadCard(cId int, dst *ClientCard) error {
+
 	card, found := self.cardTbl[cId]
 	if !found {
 		return wrapError(ErrNotFound, "missing card")
@@ -365,6 +454,8 @@ func (self *MemClientCredStore) LoadCard(cId int, dst *ClientCard) error {
 
 	dst.Label = card.Label
 
+	dst.LastUsed = card.LastUsed
+
 	return nil
 
 }
@@ -394,6 +485,7 @@ func (self *MemClientCredStore) LoadInfo(cId int, dst *CardInfo) error {
 	dst.AppName = realm.AppName
 	dst.AppDesc = realm.AppDesc
 	dst.Label = card.Label
+	dst.LastUsed = card.LastUsed
 
 	return nil
 }
@@ -438,17 +530,64 @@ func (self *MemClientCredStore) ListInfo(qry CardQuery) ([]CardInfo, error) {
 	self.mut.Lock()
 	defer self.mut.Unlock()
 
+	infos, err := self.collectInfos(qry.RealmId, qry.MinId)
+	if nil != err {
+		return nil, err
+	}
+
+	// sort infos by ID
+	slices.SortFunc(infos, func(c0, c1 CardInfo) int {
+		return c0.ID - c1.ID
+	})
+
+	// enforce qry.Limit
+	if qry.Limit > 0 && len(infos) > qry.Limit {
+
+		infos = infos[0:qry.Limit]
+	}
+
+	return infos, nil
+
+}
+
+// SearchInfo returns the CardPage of CardInfo that matches qry.
+func (self *MemClientCredStore) SearchInfo(qry CardSearch) (CardPage, error) {
+	pager, err := NewCardPager(&qry)
+	if nil != err {
+		return CardPage{}, err
+	}
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	infos, err := self.collectInfos(qry.RealmId, 0)
+	if nil != err {
+		return CardPage{}, err
+	}
+	slices.SortFunc(infos, func(c0, c1 CardInfo) int {
+		return qry.Sort.Compare(&c0, &c1)
+	})
+	for i := range infos {
+		pager.Add(&infos[i])
+	}
+
+	return pager.Page(), nil
+}
+
+// collectInfos returns the unordered CardInfo of the cards in realmId which ID is greater than minId.
+// All cards are selected if realmId is empty.
+func (self *MemClientCredStore) collectInfos(realmId []byte, minId int) ([]CardInfo, error) {
 	var infos []CardInfo
 	rlmCache := make(map[int]Realm)
 
 	var targetRealm [32]byte
-	checkRealm := len(qry.RealmId) > 0
+	checkRealm := len(realmId) > 0
 	if checkRealm {
-		targetRealm = [32]byte(qry.RealmId)
+		targetRealm = [32]byte(realmId)
 	}
 
 	for cId, card := range self.cardTbl {
-		if qry.MinId > 0 && cId <= qry.MinId {
+		if minId > 0 && cId <= minId {
 			continue
 		}
 		rk := [32]byte(card.RealmId)
@@ -462,7 +601,7 @@ func (self *MemClientCredStore) ListInfo(qry CardQuery) ([]CardInfo, error) {
 		}
 		realm, found := rlmCache[rId]
 		if !found {
-			err = self.loadRealm(rId, &realm)
+			err := self.loadRealm(rId, &realm)
 			if nil != err {
 				return nil, wrapError(err, "failed loading realm")
 			}
@@ -470,28 +609,17 @@ func (self *MemClientCredStore) ListInfo(qry CardQuery) ([]CardInfo, error) {
 		}
 
 		info := CardInfo{
-			ID:      cId,
-			RealmID: rId,
-			AppName: realm.AppName,
-			AppDesc: realm.AppDesc,
-			Label:   card.Label,
+			ID:       cId,
+			RealmID:  rId,
+			AppName:  realm.AppName,
+			AppDesc:  realm.AppDesc,
+			Label:    card.Label,
+			LastUsed: card.LastUsed,
 		}
 		infos = append(infos, info)
 	}
 
-	// sort infos by ID
-	slices.SortFunc(infos, func(c0, c1 CardInfo) int {
-		return c0.ID - c1.ID
-	})
-
-	// enforce qry.Limit
-	if qry.Limit > 0 && len(infos) > qry.Limit {
-
-		infos = infos[0:qry.Limit]
-	}
-
 	return infos, nil
-
 }
 
 // ListAppInfo returns a list of AppInfo that matches qry.
@@ -547,6 +675,54 @@ func (self *MemClientCredStore) ListAppInfo(qry AppQuery) ([]AppInfo, error) {
 
 }
 
+// SelectCards returns the ClientCards that match sel, most recently used first.
+func (self *MemClientCredStore) SelectCards(sel CardSelection) ([]ClientCard, error) {
+	err := sel.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid CardSelection")
+	}
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	var cards []ClientCard
+	for cId, card := range self.cardTbl {
+		if !sel.Match(&card) {
+			continue
+		}
+		var dst ClientCard
+		err = self.loadCard(cId, &dst)
+		if nil != err {
+			return nil, wrapError(err, "failed copying card")
+		}
+		cards = append(cards, dst)
+	}
+	SortCards(cards)
+
+	// enforce sel.Limit
+	if sel.Limit > 0 && len(cards) > sel.Limit {
+		cards = cards[0:sel.Limit]
+	}
+
+	return cards, nil
+}
+
+// SetCardLastUsed records that the card with cId ID was used at Unix time ts.
+// It errors if the card does not exist.
+func (self *MemClientCredStore) SetCardLastUsed(cId int, ts int64) error {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	card, found := self.cardTbl[cId]
+	if !found {
+		return wrapError(ErrNotFound, "missing card")
+	}
+	card.LastUsed = ts
+	self.cardTbl[cId] = card
+
+	return nil
+}
+
 // CardCount returns the number of Card in the MemClientCredStore.
 func (self *MemClientCredStore) CardCount() int {
 	self.mut.Lock()
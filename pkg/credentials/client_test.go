@@ -4,7 +4,10 @@ import (
 	"crypto/ecdh"
 	"crypto/rand"
 	"errors"
+	"slices"
 	"testing"
+
+	"code.kerpass.org/golang/pkg/ephemsec"
 )
 
 // ============================================================================
@@ -701,6 +704,311 @@ func TestMemClientCredStore_CardCount_Lifecycle(t *testing.T) {
 	}
 }
 
+func TestMemClientCredStore_SelectCards_LastUsedOrder(t *testing.T) {
+	store := NewMemClientCredStore()
+	cards := seedCards(t, store, 0x01, 0x10, 4)
+	seedCards(t, store, 0x02, 0x20, 2)
+
+	if err := store.SetCardLastUsed(cards[2].ID, 200); err != nil {
+		t.Fatalf("SetCardLastUsed: %v", err)
+	}
+	if err := store.SetCardLastUsed(cards[1].ID, 100); err != nil {
+		t.Fatalf("SetCardLastUsed: %v", err)
+	}
+
+	selected, err := store.SelectCards(CardSelection{RealmId: testRealmId(t, 0x01)})
+	if err != nil {
+		t.Fatalf("SelectCards: %v", err)
+	}
+	// used cards first, most recent first, then never used cards by ID
+	expected := []int{cards[2].ID, cards[1].ID, cards[0].ID, cards[3].ID}
+	if len(selected) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(selected))
+	}
+	for i, card := range selected {
+		if card.ID != expected[i] {
+			t.Errorf("selected[%d].ID=%d, expected %d", i, card.ID, expected[i])
+		}
+	}
+	if selected[0].LastUsed != 200 {
+		t.Errorf("expected LastUsed 200, got %d", selected[0].LastUsed)
+	}
+
+	selected, err = store.SelectCards(CardSelection{RealmId: testRealmId(t, 0x01), Limit: 1})
+	if err != nil {
+		t.Fatalf("SelectCards: %v", err)
+	}
+	if len(selected) != 1 || selected[0].ID != cards[2].ID {
+		t.Errorf("expected most recently used card, got %v", selected)
+	}
+}
+
+func TestMemClientCredStore_SelectCards_CurveFilter(t *testing.T) {
+	store := NewMemClientCredStore()
+	seedCards(t, store, 0x01, 0x10, 2)
+	card := testCard(t, 0x01, 0x30, "App")
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	card.Kh = PrivateKeyHandle{PrivateKey: priv}
+	if err := store.CreateCard(card); err != nil {
+		t.Fatalf("CreateCard: %v", err)
+	}
+
+	selected, err := store.SelectCards(CardSelection{RealmId: testRealmId(t, 0x01), Curve: ecdh.P256()})
+	if err != nil {
+		t.Fatalf("SelectCards: %v", err)
+	}
+	if len(selected) != 1 || selected[0].ID != card.ID {
+		t.Fatalf("expected P256 card only, got %d results", len(selected))
+	}
+
+	selected, err = store.SelectCards(CardSelection{RealmId: testRealmId(t, 0x01)})
+	if err != nil {
+		t.Fatalf("SelectCards: %v", err)
+	}
+	if len(selected) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(selected))
+	}
+}
+
+func TestMemClientCredStore_SelectCards_SchemeFilter(t *testing.T) {
+	store := NewMemClientCredStore()
+	seedCards(t, store, 0x01, 0x10, 2)
+	card := testCard(t, 0x01, 0x30, "App")
+	card.UserId = "alice"
+	if err := store.CreateCard(card); err != nil {
+		t.Fatalf("CreateCard: %v", err)
+	}
+	p256 := testCard(t, 0x01, 0x31, "App")
+	p256.UserId = "bob"
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	p256.Kh = PrivateKeyHandle{PrivateKey: priv}
+	if err := store.CreateCard(p256); err != nil {
+		t.Fatalf("CreateCard: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		scheme uint16
+		count  int
+	}{
+		{"any", 0, 4},
+		{"otk_x25519", ephemsec.SHA512_X25519_E1S2_T1024B256P33, 3},
+		{"otp_x25519_requires_user_id", ephemsec.SHA512_X25519_E1S1_T600B10P8, 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, err := store.SelectCards(CardSelection{RealmId: testRealmId(t, 0x01), Scheme: tc.scheme})
+			if err != nil {
+				t.Fatalf("SelectCards: %v", err)
+			}
+			if len(selected) != tc.count {
+				t.Fatalf("expected %d results, got %d", tc.count, len(selected))
+			}
+			if 1 == tc.count && selected[0].ID != card.ID {
+				t.Errorf("expected card %d, got %d", card.ID, selected[0].ID)
+			}
+		})
+	}
+
+	_, err = store.SelectCards(CardSelection{RealmId: testRealmId(t, 0x01), Scheme: 0xFFFF})
+	if err == nil {
+		t.Fatal("expected error for unknown Scheme")
+	}
+}
+
+func TestMemClientCredStore_SelectCards_InvalidRealmId(t *testing.T) {
+	store := NewMemClientCredStore()
+
+	_, err := store.SelectCards(CardSelection{})
+	if err == nil {
+		t.Fatal("expected error for missing RealmId")
+	}
+}
+
+func TestMemClientCredStore_SetCardLastUsed_UnknownCard(t *testing.T) {
+	store := NewMemClientCredStore()
+
+	err := store.SetCardLastUsed(999, 100)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+// ============================================================================
+// SearchInfo
+
+// seedSearchCards creates 6 labeled cards in 2 realms & returns their IDs.
+// Realm 0x01 is "Zeta" with cards labeled "Work", "home" & no label,
+// realm 0x02 is "alpha" with cards labeled "Bank", "work phone" & no label.
+func seedSearchCards(t *testing.T, store *MemClientCredStore) []int {
+	t.Helper()
+	labels := []string{"Work", "home", "", "Bank", "work phone", ""}
+	ids := make([]int, len(labels))
+	for i, lbl := range labels {
+		realmSeed, appName := byte(0x01), "Zeta"
+		if i >= 3 {
+			realmSeed, appName = 0x02, "alpha"
+		}
+		card := testCard(t, realmSeed, 0x10+byte(i), appName)
+		if err := store.CreateCard(card); err != nil {
+			t.Fatalf("CreateCard[%d]: %v", i, err)
+		}
+		if "" != lbl {
+			if err := store.SetCardLabel(card.ID, lbl); err != nil {
+				t.Fatalf("SetCardLabel[%d]: %v", i, err)
+			}
+		}
+		ids[i] = card.ID
+	}
+	for i, ts := range map[int]int64{1: 300, 4: 200, 3: 100} {
+		if err := store.SetCardLastUsed(ids[i], ts); err != nil {
+			t.Fatalf("SetCardLastUsed[%d]: %v", i, err)
+		}
+	}
+	return ids
+}
+
+// searchAll follows the qry pages & returns the IDs of all the CardInfo.
+func searchAll(t *testing.T, store ClientCredStore, qry CardSearch) []int {
+	t.Helper()
+	var ids []int
+	for {
+		page, err := store.SearchInfo(qry)
+		if err != nil {
+			t.Fatalf("SearchInfo: %v", err)
+		}
+		if qry.Limit > 0 && len(page.Infos) > qry.Limit {
+			t.Fatalf("page has %d items, expected at most %d", len(page.Infos), qry.Limit)
+		}
+		for _, info := range page.Infos {
+			ids = append(ids, info.ID)
+		}
+		if "" == page.Next {
+			return ids
+		}
+		qry.Cursor = page.Next
+	}
+}
+
+func TestMemClientCredStore_SearchInfo_SortPages(t *testing.T) {
+	store := NewMemClientCredStore()
+	ids := seedSearchCards(t, store)
+
+	tests := []struct {
+		name     string
+		sort     CardSort
+		expected []int
+	}{
+		{"ById", SortById, []int{0, 1, 2, 3, 4, 5}},
+		{"ByLabel", SortByLabel, []int{2, 5, 3, 1, 0, 4}},
+		{"ByAppName", SortByAppName, []int{3, 4, 5, 0, 1, 2}},
+		{"ByLastUsed", SortByLastUsed, []int{1, 4, 3, 0, 2, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := make([]int, len(tt.expected))
+			for i, pos := range tt.expected {
+				expected[i] = ids[pos]
+			}
+			for _, limit := range []int{0, 1, 4} {
+				got := searchAll(t, store, CardSearch{Sort: tt.sort, Limit: limit})
+				if !slices.Equal(got, expected) {
+					t.Errorf("Limit %d: expected %v, got %v", limit, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMemClientCredStore_SearchInfo_Total(t *testing.T) {
+	store := NewMemClientCredStore()
+	seedSearchCards(t, store)
+
+	page, err := store.SearchInfo(CardSearch{Limit: 4})
+	if err != nil {
+		t.Fatalf("SearchInfo: %v", err)
+	}
+	if page.Total != 6 || len(page.Infos) != 4 || "" == page.Next {
+		t.Fatalf("unexpected first page, Total=%d len=%d Next=%q", page.Total, len(page.Infos), page.Next)
+	}
+	page, err = store.SearchInfo(CardSearch{Limit: 4, Cursor: page.Next})
+	if err != nil {
+		t.Fatalf("SearchInfo: %v", err)
+	}
+	if page.Total != 6 || len(page.Infos) != 2 || "" != page.Next {
+		t.Fatalf("unexpected last page, Total=%d len=%d Next=%q", page.Total, len(page.Infos), page.Next)
+	}
+}
+
+func TestMemClientCredStore_SearchInfo_Text(t *testing.T) {
+	store := NewMemClientCredStore()
+	ids := seedSearchCards(t, store)
+
+	tests := []struct {
+		text     string
+		realm    byte
+		expected []int
+	}{
+		{"work", 0, []int{ids[0], ids[4]}},
+		{"ALPHA", 0, []int{ids[3], ids[4], ids[5]}},
+		{"e", 0x01, []int{ids[0], ids[1], ids[2]}},
+		{"work", 0x02, []int{ids[4]}},
+		{"missing", 0, nil},
+	}
+	for _, tt := range tests {
+		qry := CardSearch{Text: tt.text}
+		if tt.realm > 0 {
+			qry.RealmId = testRealmId(t, tt.realm)
+		}
+		page, err := store.SearchInfo(qry)
+		if err != nil {
+			t.Fatalf("SearchInfo(%q): %v", tt.text, err)
+		}
+		got := make([]int, 0, len(page.Infos))
+		for _, info := range page.Infos {
+			got = append(got, info.ID)
+		}
+		if !slices.Equal(got, tt.expected) {
+			t.Errorf("SearchInfo(%q): expected %v, got %v", tt.text, tt.expected, got)
+		}
+		if page.Total != len(tt.expected) {
+			t.Errorf("SearchInfo(%q): expected Total %d, got %d", tt.text, len(tt.expected), page.Total)
+		}
+	}
+}
+
+func TestMemClientCredStore_SearchInfo_InvalidCursor(t *testing.T) {
+	store := NewMemClientCredStore()
+	seedSearchCards(t, store)
+
+	page, err := store.SearchInfo(CardSearch{Sort: SortByLabel, Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchInfo: %v", err)
+	}
+
+	// cursor of a different Sort
+	_, err = store.SearchInfo(CardSearch{Sort: SortById, Limit: 2, Cursor: page.Next})
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("expected ErrValidation, got %v", err)
+	}
+
+	_, err = store.SearchInfo(CardSearch{Cursor: "not a cursor"})
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("expected ErrValidation, got %v", err)
+	}
+
+	_, err = store.SearchInfo(CardSearch{Sort: SortByLastUsed + 1})
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("expected ErrValidation, got %v", err)
+	}
+}
+
 // ============================================================================
 // helpers
 
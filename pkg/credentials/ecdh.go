@@ -56,6 +56,10 @@ func (self *PublicKeyHandle) UnmarshalBinary(data []byte) error {
 }
 
 func (self *PublicKeyHandle) UnmarshalJSON(data []byte) error {
+	if "null" == string(data) {
+		// json convention, null is a no-op
+		return nil
+	}
 	pkb := []byte{}
 	err := json.Unmarshal(data, &pkb)
 	if nil != err {
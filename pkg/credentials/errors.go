@@ -13,6 +13,7 @@ const (
 	ErrCardMutation = errorFlag("credentials: Card RealmId & IdToken can not change")
 	ErrValidation   = errorFlag("credentials: Failed validation")
 	ErrNotFound     = errorFlag("credentials: Not found")
+	ErrSuspended    = errorFlag("credentials: Card is suspended")
 	noError         = errorFlag("")
 )
 
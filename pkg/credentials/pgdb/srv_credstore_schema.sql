@@ -78,6 +78,21 @@ begin;
 
   );
 
+  -- card state was added after the initial schema
+  alter table card add column if not exists state int not null default 0;
+
+  -- card label was added after the initial schema
+  alter table card add column if not exists label text not null default '';
+
+  -- card usage statistics were added after the initial schema
+  alter table card add column if not exists last_used timestamptz;
+  alter table card add column if not exists use_count bigint not null default 0;
+
+  -- card listing indexes
+  create index if not exists card_created_idx on card(created_at, cid);
+  create index if not exists card_realm_created_idx on card(realm_id, created_at, cid);
+  create index if not exists card_active_idx on card((coalesce(last_used, created_at)));
+
   -- Add trigger that update the changed_at column each time a row is modified
   do $$
     declare
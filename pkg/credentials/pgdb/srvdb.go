@@ -5,12 +5,15 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"code.kerpass.org/golang/internal/observability"
 	"code.kerpass.org/golang/pkg/credentials"
 )
 
@@ -67,6 +70,7 @@ func NewServerCredStore(ctx context.Context, dsn string) (*ServerCredStore, erro
 // ListRealm lists the Realm in the ServerCredStore.
 // It errors if the ServerCredStore is not reachable.
 func (self *ServerCredStore) ListRealm(ctx context.Context) ([]credentials.Realm, error) {
+	defer observeLatency(ctx, "ListRealm")()
 	rows, err := self.DB.Query(
 		ctx,
 		// columns are renamed to match credentials.Realm struct
@@ -89,6 +93,7 @@ func (self *ServerCredStore) ListRealm(ctx context.Context) ([]credentials.Realm
 // LoadRealm loads realm data for realmId into dst.
 // It errors if realm data were not successfully loaded.
 func (self *ServerCredStore) LoadRealm(ctx context.Context, realmId credentials.RealmId, dst *credentials.Realm) error {
+	defer observeLatency(ctx, "LoadRealm")()
 	rows, err := self.DB.Query(
 		ctx,
 		`SELECT
@@ -121,6 +126,7 @@ func (self *ServerCredStore) LoadRealm(ctx context.Context, realmId credentials.
 // SaveRealm saves realm into the ServerCredStore.
 // It errors if realm could not be saved.
 func (self *ServerCredStore) SaveRealm(ctx context.Context, realm *credentials.Realm) error {
+	defer observeLatency(ctx, "SaveRealm")()
 	err := realm.Check()
 	if nil != err {
 		return wrapError(err, "invalid realm")
@@ -144,6 +150,7 @@ func (self *ServerCredStore) SaveRealm(ctx context.Context, realm *credentials.R
 // RemoveRealm removes the Realm with realmId identifier from the ServerCredStore.
 // It errors if the ServerCredStore is not reachable or if realmId does not exists.
 func (self *ServerCredStore) RemoveRealm(ctx context.Context, realmId credentials.RealmId) error {
+	defer observeLatency(ctx, "RemoveRealm")()
 	var deleted int
 	row := self.DB.QueryRow(
 		ctx,
@@ -165,6 +172,7 @@ func (self *ServerCredStore) RemoveRealm(ctx context.Context, realmId credential
 // PopEnrollAuthorization loads authorization data in ea and remove it from the ServerCredStore.
 // It returns an error if the authorization could not be loaded and removed.
 func (self *ServerCredStore) PopEnrollAuthorization(ctx context.Context, etk credentials.EnrollAccess, dst *credentials.EnrollAuthorization) error {
+	defer observeLatency(ctx, "PopEnrollAuthorization")()
 
 	// derive AccessKeys from etk
 	aks := credentials.AccessKeys{}
@@ -202,6 +210,7 @@ func (self *ServerCredStore) PopEnrollAuthorization(ctx context.Context, etk cre
 // SaveEnrollAuthorization saves ea in the ServerCredStore.
 // It errors if the authorization could not be saved.
 func (self *ServerCredStore) SaveEnrollAuthorization(ctx context.Context, etk credentials.EnrollAccess, ea *credentials.EnrollAuthorization) error {
+	defer observeLatency(ctx, "SaveEnrollAuthorization")()
 
 	// derive AccessKeys from etk
 	aks := credentials.AccessKeys{}
@@ -251,6 +260,7 @@ func (self *ServerCredStore) SaveEnrollAuthorization(ctx context.Context, etk cr
 
 // AuthorizationCount returns the number of EnrollAuthorization in the ServerCredStore.
 func (self *ServerCredStore) AuthorizationCount(ctx context.Context) (int, error) {
+	defer observeLatency(ctx, "AuthorizationCount")()
 	var rv int
 	row := self.DB.QueryRow(
 		ctx,
@@ -267,6 +277,7 @@ func (self *ServerCredStore) AuthorizationCount(ctx context.Context) (int, error
 // LoadCard loads stored card data in dst.
 // It returns true if card data were successfully loaded.
 func (self *ServerCredStore) LoadCard(ctx context.Context, cardId credentials.ServerCardAccess, dst *credentials.ServerCard) error {
+	defer observeLatency(ctx, "LoadCard")()
 
 	// derive AccessKeys from cardId
 	aks := credentials.AccessKeys{}
@@ -279,14 +290,14 @@ func (self *ServerCredStore) LoadCard(ctx context.Context, cardId credentials.Se
 	var sc credentials.SrvStoreCard
 	row := self.DB.QueryRow(
 		ctx,
-		`SELECT c.cid, r.rid, c.seal_type, c.key_data
+		`SELECT c.cid, r.rid, c.seal_type, c.key_data, c.state, c.label
 		 FROM card c
 		 INNER JOIN realm r
 		   ON (c.realm_id = r.id)
 		 WHERE cid = $1`,
 		aks.IdKey[:],
 	)
-	err = row.Scan(&sc.ID, &sc.RealmId, &sc.SealType, &sc.KeyData)
+	err = row.Scan(&sc.ID, &sc.RealmId, &sc.SealType, &sc.KeyData, &sc.State, &sc.Label)
 	if nil != err {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return wrapError(credentials.ErrNotFound, "failed loading card")
@@ -303,9 +314,76 @@ func (self *ServerCredStore) LoadCard(ctx context.Context, cardId credentials.Se
 	return nil
 }
 
+// LoadCards loads stored card data for each cardIds element in the dst element at the same position.
+// Cards are fetched with a single query. It returns per card errors, errs[i] is nil if dst[i]
+// was successfully loaded. It errors if dst and cardIds lengths differ or if the query fails.
+func (self *ServerCredStore) LoadCards(ctx context.Context, cardIds []credentials.ServerCardAccess, dst []credentials.ServerCard) ([]error, error) {
+	defer observeLatency(ctx, "LoadCards")()
+	if len(cardIds) != len(dst) {
+		return nil, newError("cardIds length %d != dst length %d", len(cardIds), len(dst))
+	}
+
+	// derive AccessKeys from cardIds
+	errs := make([]error, len(cardIds))
+	akss := make([]credentials.AccessKeys, len(cardIds))
+	cids := make([][]byte, 0, len(cardIds))
+	for pos, cardId := range cardIds {
+		err := self.cardAdapter.GetCardAccess(cardId, &akss[pos])
+		if nil != err {
+			errs[pos] = wrapError(err, "failed AccessKeys derivation")
+			continue
+		}
+		cids = append(cids, akss[pos].IdKey[:])
+	}
+	if 0 == len(cids) {
+		return errs, nil
+	}
+
+	// load related SrvStoreCards
+	rows, err := self.DB.Query(
+		ctx,
+		`SELECT c.cid, r.rid, c.seal_type, c.key_data, c.state, c.label
+		 FROM card c
+		 INNER JOIN realm r
+		   ON (c.realm_id = r.id)
+		 WHERE cid = ANY($1)`,
+		cids,
+	)
+	if nil != err {
+		return nil, wrapError(err, "failed DB.Query")
+	}
+	scs := make(map[[32]byte]credentials.SrvStoreCard, len(cids))
+	var sc credentials.SrvStoreCard
+	_, err = pgx.ForEachRow(rows, []any{&sc.ID, &sc.RealmId, &sc.SealType, &sc.KeyData, &sc.State, &sc.Label}, func() error {
+		if len(sc.ID) == 32 {
+			scs[[32]byte(sc.ID)] = sc
+		}
+		return nil
+	})
+	if nil != err {
+		return nil, wrapError(err, "failed loading cards")
+	}
+
+	// adapt retrieved SrvStoreCards to ServerCards
+	for pos := range cardIds {
+		if nil != errs[pos] {
+			continue
+		}
+		sc, found := scs[akss[pos].IdKey]
+		if !found {
+			errs[pos] = wrapError(credentials.ErrNotFound, "failed loading card")
+			continue
+		}
+		errs[pos] = wrapError(self.cardAdapter.FromCardStorage(&akss[pos], &sc, &dst[pos]), "failed card adaptation")
+	}
+
+	return errs, nil
+}
+
 // SaveCard saves card in the ServerCredStore.
 // It errors if the card could not be saved.
 func (self *ServerCredStore) SaveCard(ctx context.Context, cardId credentials.ServerCardAccess, card *credentials.ServerCard) error {
+	defer observeLatency(ctx, "SaveCard")()
 
 	// derive AccessKeys from cardId
 	aks := credentials.AccessKeys{}
@@ -331,16 +409,18 @@ func (self *ServerCredStore) SaveCard(ctx context.Context, cardId credentials.Se
 	var saved int
 	row := self.DB.QueryRow(
 		ctx,
-		`WITH saved AS (INSERT INTO card(realm_id, cid, seal_type, key_data)
+		`WITH saved AS (INSERT INTO card(realm_id, cid, seal_type, key_data, state, label)
 		 SELECT 
-		   r.id, v.cid, v.seal_type, v.key_data
+		   r.id, v.cid, v.seal_type, v.key_data, v.state, v.label
 		 FROM 
-		   (VALUES ($1::bytea, $2::bytea, $3::int, $4::bytea)) v(rid, cid, seal_type, key_data)
+		   (VALUES ($1::bytea, $2::bytea, $3::int, $4::bytea, $5::int, $6::text)) v(rid, cid, seal_type, key_data, state, label)
 		   INNER JOIN realm r
 		     ON (v.rid = r.rid)
 		 ON CONFLICT (cid) DO UPDATE SET
 		   seal_type = excluded.seal_type,
-		   key_data = excluded.key_data
+		   key_data = excluded.key_data,
+		   state = excluded.state,
+		   label = excluded.label
 		 RETURNING 1)
 		 SELECT count(*) FROM saved
 		`,
@@ -348,6 +428,8 @@ func (self *ServerCredStore) SaveCard(ctx context.Context, cardId credentials.Se
 		sc.ID,
 		sc.SealType,
 		sc.KeyData,
+		sc.State,
+		sc.Label,
 	)
 	err = row.Scan(&saved)
 	if nil != err {
@@ -363,6 +445,7 @@ func (self *ServerCredStore) SaveCard(ctx context.Context, cardId credentials.Se
 // RemoveCard removes the ServerCard with cardId identifier from the ServerCredStore.
 // It returns true if the ServerCard was effectively removed.
 func (self *ServerCredStore) RemoveCard(ctx context.Context, cardId credentials.ServerCardKey) bool {
+	defer observeLatency(ctx, "RemoveCard")()
 	var deleted int
 	row := self.DB.QueryRow(
 		ctx,
@@ -380,6 +463,7 @@ func (self *ServerCredStore) RemoveCard(ctx context.Context, cardId credentials.
 
 // CountCard returns the number of ServerCard in the ServerCredStore.
 func (self *ServerCredStore) CardCount(ctx context.Context) (int, error) {
+	defer observeLatency(ctx, "CardCount")()
 	var rv int
 	row := self.DB.QueryRow(
 		ctx,
@@ -393,4 +477,232 @@ func (self *ServerCredStore) CardCount(ctx context.Context) (int, error) {
 	return rv, nil
 }
 
+// ListCards returns the ServerCardPage of ServerCardInfo that matches qry, oldest cards first.
+func (self *ServerCredStore) ListCards(ctx context.Context, qry credentials.ServerCardQuery) (credentials.ServerCardPage, error) {
+	defer observeLatency(ctx, "ListCards")()
+	err := qry.Check()
+	if nil != err {
+		return credentials.ServerCardPage{}, wrapError(err, "invalid ServerCardQuery")
+	}
+	pos, _ := qry.Position() // checked by qry.Check
+
+	// NULL parameters disable the related filter
+	var realmId, posCardId []byte
+	var createdAfter, createdBefore, unusedSince, posCreatedAt *time.Time
+	if len(qry.RealmId) > 0 {
+		realmId = qry.RealmId
+	}
+	if !qry.CreatedAfter.IsZero() {
+		createdAfter = &qry.CreatedAfter
+	}
+	if !qry.CreatedBefore.IsZero() {
+		createdBefore = &qry.CreatedBefore
+	}
+	if !qry.UnusedSince.IsZero() {
+		unusedSince = &qry.UnusedSince
+	}
+	if nil != pos {
+		posCreatedAt = &pos.CreatedAt
+		posCardId = pos.CardId
+	}
+	states := make([]int32, 0, len(qry.States))
+	for _, state := range qry.States {
+		states = append(states, int32(state))
+	}
+	limit := qry.PageLimit()
+
+	// 1 more row is loaded to know if there is a next page
+	rows, err := self.DB.Query(
+		ctx,
+		`SELECT c.cid, r.rid, c.state, c.created_at, c.label, c.last_used, c.use_count
+		 FROM card c
+		 INNER JOIN realm r
+		   ON (c.realm_id = r.id)
+		 WHERE ($1::bytea IS NULL OR r.rid = $1)
+		   AND ($2::timestamptz IS NULL OR c.created_at >= $2)
+		   AND ($3::timestamptz IS NULL OR c.created_at < $3)
+		   AND (cardinality($4::int[]) = 0 OR c.state = ANY($4))
+		   AND ($5::timestamptz IS NULL OR (c.created_at, c.cid) > ($5, $6::bytea))
+		   AND ($7::timestamptz IS NULL OR coalesce(c.last_used, c.created_at) < $7)
+		 ORDER BY c.created_at, c.cid
+		 LIMIT $8`,
+		realmId,
+		createdAfter,
+		createdBefore,
+		states,
+		posCreatedAt,
+		posCardId,
+		unusedSince,
+		limit+1,
+	)
+	if nil != err {
+		return credentials.ServerCardPage{}, wrapError(err, "failed DB.Query")
+	}
+	infos, err := collectCardInfos(rows)
+	if nil != err {
+		return credentials.ServerCardPage{}, err
+	}
+
+	page := credentials.ServerCardPage{Cards: infos}
+	if len(infos) > limit {
+		page.Cards = infos[:limit]
+		page.Next = credentials.NewServerCardCursor(&page.Cards[limit-1])
+	}
+
+	return page, nil
+}
+
+// ListUserCards returns the ServerCardInfo of the cards which IdToken derives from userId.
+func (self *ServerCredStore) ListUserCards(ctx context.Context, userId string) ([]credentials.ServerCardInfo, error) {
+	defer observeLatency(ctx, "ListUserCards")()
+	if "" == userId {
+		return nil, wrapError(credentials.ErrValidation, "empty userId")
+	}
+	realms, err := self.ListRealm(ctx)
+	if nil != err {
+		return nil, wrapError(err, "failed ListRealm")
+	}
+
+	// derive the user card identifier in each realm
+	cids := make([][]byte, 0, len(realms))
+	for _, realm := range realms {
+		aks := credentials.AccessKeys{}
+		err = self.cardAdapter.GetCardAccess(credentials.OtpId{Realm: realm.RealmId, Username: userId}, &aks)
+		if nil != err {
+			return nil, wrapError(err, "failed AccessKeys derivation")
+		}
+		cids = append(cids, aks.IdKey[:])
+	}
+	if 0 == len(cids) {
+		return nil, nil
+	}
+
+	rows, err := self.DB.Query(
+		ctx,
+		`SELECT c.cid, r.rid, c.state, c.created_at, c.label, c.last_used, c.use_count
+		 FROM card c
+		 INNER JOIN realm r
+		   ON (c.realm_id = r.id)
+		 WHERE cid = ANY($1)
+		 ORDER BY c.created_at, c.cid`,
+		cids,
+	)
+	if nil != err {
+		return nil, wrapError(err, "failed DB.Query")
+	}
+
+	return collectCardInfos(rows)
+}
+
+// SetCardState changes the State of the ServerCard with cardId identifier.
+// It errors wrapping ErrNotFound if the card does not exist.
+func (self *ServerCredStore) SetCardState(ctx context.Context, cardId credentials.ServerCardKey, state credentials.CardState) error {
+	defer observeLatency(ctx, "SetCardState")()
+	err := state.Check()
+	if nil != err {
+		return wrapError(err, "invalid state")
+	}
+
+	var cid []byte
+	switch v := cardId.(type) {
+	case credentials.ServerCardIdKey:
+		cid = v
+	case credentials.ServerCardAccess:
+		aks := credentials.AccessKeys{}
+		err = self.cardAdapter.GetCardAccess(v, &aks)
+		if nil != err {
+			return wrapError(err, "failed AccessKeys derivation")
+		}
+		cid = aks.IdKey[:]
+	default:
+		return wrapError(credentials.ErrValidation, "non supported ServerCardKey")
+	}
+
+	tag, err := self.DB.Exec(
+		ctx,
+		`UPDATE card SET state = $2 WHERE cid = $1`,
+		cid,
+		int32(state),
+	)
+	if nil != err {
+		return wrapError(err, "failed UPDATE query")
+	}
+	if 0 == tag.RowsAffected() {
+		return wrapError(credentials.ErrNotFound, "unknown cardId")
+	}
+
+	return nil
+}
+
+// RecordCardUses adds uses to the usage statistics of the ServerCards.
+// The uses are applied with a single UPDATE query.
+func (self *ServerCredStore) RecordCardUses(ctx context.Context, uses []credentials.CardUse) error {
+	defer observeLatency(ctx, "RecordCardUses")()
+	if 0 == len(uses) {
+		return nil
+	}
+	cids := make([][]byte, 0, len(uses))
+	times := make([]time.Time, 0, len(uses))
+	counts := make([]int64, 0, len(uses))
+	for _, use := range uses {
+		cids = append(cids, use.CardId)
+		times = append(times, use.LastUsed)
+		counts = append(counts, use.Count)
+	}
+
+	// uses are grouped as a card row is updated once per query,
+	// greatest ignores NULL, never used cards get u.last_used
+	_, err := self.DB.Exec(
+		ctx,
+		`UPDATE card c SET
+		   last_used = greatest(c.last_used, u.last_used),
+		   use_count = c.use_count + u.count
+		 FROM (
+		   SELECT v.cid, max(v.last_used) AS last_used, sum(v.count)::bigint AS count
+		   FROM unnest($1::bytea[], $2::timestamptz[], $3::bigint[]) v(cid, last_used, count)
+		   GROUP BY v.cid
+		 ) u
+		 WHERE c.cid = u.cid`,
+		cids,
+		times,
+		counts,
+	)
+	if nil != err {
+		return wrapError(err, "failed UPDATE query")
+	}
+
+	return nil
+}
+
+// collectCardInfos reads rows of (cid, rid, state, created_at, label, last_used, use_count) into ServerCardInfo.
+func collectCardInfos(rows pgx.Rows) ([]credentials.ServerCardInfo, error) {
+	var infos []credentials.ServerCardInfo
+	var info credentials.ServerCardInfo
+	var lastUsed *time.Time // NULL if the card was never used
+	scans := []any{&info.CardId, &info.RealmId, &info.State, &info.CreatedAt, &info.Label, &lastUsed, &info.UseCount}
+	_, err := pgx.ForEachRow(rows, scans, func() error {
+		info.LastUsed = time.Time{}
+		if nil != lastUsed {
+			info.LastUsed = *lastUsed
+		}
+		infos = append(infos, info)
+		return nil
+	})
+	if nil != err {
+		return nil, wrapError(err, "failed loading cards")
+	}
+
+	return infos, nil
+}
+
 var _ credentials.ServerCredStore = &ServerCredStore{}
+
+// observeLatency returns a function that records the duration of ServerCredStore operation op.
+// It is used as defer observeLatency(ctx, op)().
+func observeLatency(ctx context.Context, op string) func() {
+	return observability.GetObservability(ctx).Timer(
+		observability.MetricStoreLatency,
+		slog.String("store", "pgdb"),
+		slog.String("op", op),
+	)
+}
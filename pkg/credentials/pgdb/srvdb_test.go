@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"errors"
 	"testing"
+	"time"
 
 	"code.kerpass.org/golang/pkg/credentials"
 
@@ -555,6 +556,52 @@ func TestServerCredStore_LoadCard_Fail(t *testing.T) {
 	}
 }
 
+func TestServerCredStore_LoadCards(t *testing.T) {
+	ctx := context.Background()
+	store := newServerCredStore(ctx, t)
+
+	// Save 2 random cards in testRealm
+	cards := make([]credentials.ServerCard, 2)
+	cardIds := make([]credentials.ServerCardAccess, 0, 3)
+	for pos := range cards {
+		idtkn, err := initCard(&cards[pos])
+		if nil != err {
+			t.Fatalf("Failed to generate random card: %v", err)
+		}
+		cards[pos].RealmId = testRealmId
+		err = store.SaveCard(ctx, idtkn, &cards[pos])
+		if nil != err {
+			t.Fatalf("Failed to save card: %v", err)
+		}
+		cardIds = append(cardIds, idtkn)
+	}
+	cardIds = append(cardIds, credentials.IdToken(newID(0x99)))
+
+	// Load the cards using LoadCards
+	dst := make([]credentials.ServerCard, len(cardIds))
+	errs, err := store.LoadCards(ctx, cardIds, dst)
+	if nil != err {
+		t.Fatalf("LoadCards failed, got error %v", err)
+	}
+	for pos, card := range cards {
+		if nil != errs[pos] {
+			t.Fatalf("LoadCards failed loading card #%d, got error %v", pos, errs[pos])
+		}
+		if !bytes.Equal(dst[pos].CardId, card.CardId) || !bytes.Equal(dst[pos].Psk, card.Psk) {
+			t.Errorf("Retrieved card #%d doesn't match original", pos)
+		}
+	}
+	if !errors.Is(errs[2], credentials.ErrNotFound) {
+		t.Errorf("LoadCards returned non expected error %v", errs[2])
+	}
+
+	// Check that LoadCards errors on length mismatch
+	_, err = store.LoadCards(ctx, cardIds, dst[:1])
+	if nil == err {
+		t.Error("LoadCards returned nil error for length mismatch")
+	}
+}
+
 func TestServerCredStore_RemoveCard_Success(t *testing.T) {
 	ctx := context.Background()
 	store := newServerCredStore(ctx, t)
@@ -670,6 +717,200 @@ func TestServerCredStore_CardCount(t *testing.T) {
 	}
 }
 
+func TestServerCredStore_ListCards(t *testing.T) {
+	ctx := context.Background()
+	store := newServerCredStore(ctx, t)
+
+	// Generate & save 5 random cards
+	cardIds := make(map[string]bool)
+	for i := range 5 {
+		var card credentials.ServerCard
+		idToken, err := initCard(&card)
+		if err != nil {
+			t.Fatalf("Failed to generate card %d: %v", i+1, err)
+		}
+		card.RealmId = testRealmId
+		err = store.SaveCard(ctx, idToken, &card)
+		if err != nil {
+			t.Fatalf("Failed to save card %d: %v", i+1, err)
+		}
+		cardIds[string(card.CardId)] = true
+	}
+
+	// Page through the cards, 2 per page
+	qry := credentials.ServerCardQuery{RealmId: testRealmId, Limit: 2}
+	var listed []credentials.ServerCardInfo
+	for {
+		page, err := store.ListCards(ctx, qry)
+		if nil != err {
+			t.Fatalf("Failed ListCards, got error %v", err)
+		}
+		if len(page.Cards) > 2 {
+			t.Fatalf("Expected at most 2 cards per page, got %d", len(page.Cards))
+		}
+		listed = append(listed, page.Cards...)
+		if "" == page.Next {
+			break
+		}
+		qry.Cursor = page.Next
+	}
+	if len(listed) != 5 {
+		t.Fatalf("Expected 5 listed cards, got %d", len(listed))
+	}
+	for i := range listed {
+		if !cardIds[string(listed[i].CardId)] {
+			t.Errorf("Listed card #%d is unknown", i)
+		}
+		if i > 0 && credentials.CompareServerCardInfo(&listed[i-1], &listed[i]) >= 0 {
+			t.Errorf("Listed card #%d is out of order", i)
+		}
+	}
+
+	// Suspend 1 card & filter on State
+	err := store.SetCardState(ctx, listed[2].CardId, credentials.CardSuspended)
+	if nil != err {
+		t.Fatalf("Failed SetCardState, got error %v", err)
+	}
+	page, err := store.ListCards(ctx, credentials.ServerCardQuery{States: []credentials.CardState{credentials.CardSuspended}})
+	if nil != err {
+		t.Fatalf("Failed ListCards, got error %v", err)
+	}
+	if len(page.Cards) != 1 || !bytes.Equal(page.Cards[0].CardId, listed[2].CardId) {
+		t.Errorf("Expected the suspended card only, got %d cards", len(page.Cards))
+	}
+
+	// Filter on creation date
+	page, err = store.ListCards(ctx, credentials.ServerCardQuery{CreatedBefore: listed[0].CreatedAt})
+	if nil != err {
+		t.Fatalf("Failed ListCards, got error %v", err)
+	}
+	if len(page.Cards) != 0 {
+		t.Errorf("Expected no card created before the first card, got %d", len(page.Cards))
+	}
+}
+
+func TestServerCredStore_ListUserCards(t *testing.T) {
+	ctx := context.Background()
+	store := newServerCredStore(ctx, t)
+
+	// Save a card derived from the "alice" username
+	var card credentials.ServerCard
+	_, err := initCard(&card)
+	if err != nil {
+		t.Fatalf("Failed to generate random card: %v", err)
+	}
+	card.RealmId = testRealmId
+	card.Label = "alice phone"
+	err = store.SaveCard(ctx, credentials.OtpId{Realm: testRealmId, Username: "alice"}, &card)
+	if err != nil {
+		t.Fatalf("Failed to save card: %v", err)
+	}
+
+	infos, err := store.ListUserCards(ctx, "alice")
+	if nil != err {
+		t.Fatalf("Failed ListUserCards, got error %v", err)
+	}
+	if len(infos) != 1 || !bytes.Equal(infos[0].CardId, card.CardId) {
+		t.Fatalf("Expected the alice card, got %d cards", len(infos))
+	}
+	if infos[0].Label != card.Label {
+		t.Errorf("Label mismatch: got %q, want %q", infos[0].Label, card.Label)
+	}
+
+	infos, err = store.ListUserCards(ctx, "bob")
+	if nil != err {
+		t.Fatalf("Failed ListUserCards, got error %v", err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("Expected no card for bob, got %d", len(infos))
+	}
+}
+
+func TestServerCredStore_SetCardState(t *testing.T) {
+	ctx := context.Background()
+	store := newServerCredStore(ctx, t)
+
+	var card credentials.ServerCard
+	idToken, err := initCard(&card)
+	if err != nil {
+		t.Fatalf("Failed to generate random card: %v", err)
+	}
+	card.RealmId = testRealmId
+	err = store.SaveCard(ctx, idToken, &card)
+	if err != nil {
+		t.Fatalf("Failed to save card: %v", err)
+	}
+
+	err = store.SetCardState(ctx, idToken, credentials.CardSuspended)
+	if nil != err {
+		t.Fatalf("Failed SetCardState, got error %v", err)
+	}
+	var loaded credentials.ServerCard
+	err = store.LoadCard(ctx, idToken, &loaded)
+	if nil != err {
+		t.Fatalf("Failed LoadCard, got error %v", err)
+	}
+	if loaded.State != credentials.CardSuspended {
+		t.Errorf("Expected suspended card, got State %d", loaded.State)
+	}
+
+	err = store.SetCardState(ctx, credentials.ServerCardIdKey(newID(0x01)), credentials.CardActive)
+	if !errors.Is(err, credentials.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for unknown card, got %v", err)
+	}
+}
+
+func TestServerCredStore_RecordCardUses(t *testing.T) {
+	ctx := context.Background()
+	store := newServerCredStore(ctx, t)
+
+	cards := make([]credentials.ServerCard, 2)
+	for i := range cards {
+		idToken, err := initCard(&cards[i])
+		if err != nil {
+			t.Fatalf("Failed to generate random card: %v", err)
+		}
+		cards[i].RealmId = testRealmId
+		err = store.SaveCard(ctx, idToken, &cards[i])
+		if err != nil {
+			t.Fatalf("Failed to save card: %v", err)
+		}
+	}
+
+	// cards[0] is used, LastUsed only moves forward, unknown cards are ignored
+	t0 := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	err := store.RecordCardUses(ctx, []credentials.CardUse{
+		{CardId: cards[0].CardId, LastUsed: t0, Count: 2},
+		{CardId: cards[0].CardId, LastUsed: t0.Add(-time.Minute), Count: 1},
+		{CardId: credentials.ServerCardIdKey(newID(0x01)), LastUsed: t0, Count: 1},
+	})
+	if nil != err {
+		t.Fatalf("Failed RecordCardUses, got error %v", err)
+	}
+	page, err := store.ListCards(ctx, credentials.ServerCardQuery{})
+	if nil != err {
+		t.Fatalf("Failed ListCards, got error %v", err)
+	}
+	for _, info := range page.Cards {
+		used := bytes.Equal(info.CardId, cards[0].CardId)
+		switch {
+		case used && (!info.LastUsed.Equal(t0) || info.UseCount != 3):
+			t.Errorf("Used card mismatch: got LastUsed %v & UseCount %d", info.LastUsed, info.UseCount)
+		case !used && (!info.LastUsed.IsZero() || info.UseCount != 0):
+			t.Errorf("Unused card mismatch: got LastUsed %v & UseCount %d", info.LastUsed, info.UseCount)
+		}
+	}
+
+	// cards[1] is dormant since its creation
+	page, err = store.ListCards(ctx, credentials.ServerCardQuery{UnusedSince: t0.Add(-time.Minute)})
+	if nil != err {
+		t.Fatalf("Failed ListCards, got error %v", err)
+	}
+	if len(page.Cards) != 1 || !bytes.Equal(page.Cards[0].CardId, cards[1].CardId) {
+		t.Errorf("Expected the dormant card, got %d cards", len(page.Cards))
+	}
+}
+
 func newConn(ctx context.Context, t *testing.T) *pgx.Conn {
 	if nil != dbInitError {
 		// dbInitError is set by init block below
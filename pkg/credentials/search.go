@@ -0,0 +1,246 @@
+package credentials
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// CardSort selects the ordering of ClientCredStore SearchInfo results.
+type CardSort int
+
+const (
+	// SortById orders cards by ID.
+	SortById CardSort = iota
+
+	// SortByLabel orders cards by case folded Label, then by ID.
+	SortByLabel
+
+	// SortByAppName orders cards by case folded AppName, then by RealmID & ID.
+	SortByAppName
+
+	// SortByLastUsed orders cards most recently used first, then by ID.
+	SortByLastUsed
+)
+
+// Check returns an error if the CardSort is unknown.
+func (self CardSort) Check() error {
+	if self < SortById || self > SortByLastUsed {
+		return wrapError(ErrValidation, "unknown CardSort %d", self)
+	}
+
+	return nil
+}
+
+// Compare returns -1, 0 or +1 depending on whether i0 comes before, is at the same position or
+// comes after i1 in the CardSort ordering.
+func (self CardSort) Compare(i0, i1 *CardInfo) int {
+	idOrder := cmp.Compare(i0.ID, i1.ID)
+	switch self {
+	case SortByLabel:
+		return cmp.Or(strings.Compare(FoldText(i0.Label), FoldText(i1.Label)), idOrder)
+	case SortByAppName:
+		return cmp.Or(
+			strings.Compare(FoldText(i0.AppName), FoldText(i1.AppName)),
+			cmp.Compare(i0.RealmID, i1.RealmID),
+			idOrder,
+		)
+	case SortByLastUsed:
+		return cmp.Or(cmp.Compare(i1.LastUsed, i0.LastUsed), idOrder)
+	default:
+		return idOrder
+	}
+}
+
+// FoldText returns the case folded form of s used by CardSearch matching & ordering.
+func FoldText(s string) string {
+	return strings.ToLower(s)
+}
+
+// CardSearch parametrizes ClientCredStore SearchInfo.
+type CardSearch struct {
+	RealmId []byte
+
+	// Text selects cards which AppName or Label contains it, ignoring case.
+	// Empty Text selects all cards.
+	Text string
+
+	Sort CardSort
+
+	// Cursor is the Next token of the previous CardPage, empty for the first page.
+	Cursor string
+
+	Limit int // maximum number of items in the CardPage, 0 for no limit
+}
+
+// Check returns an error if the CardSearch is invalid.
+func (self *CardSearch) Check() error {
+	if len(self.RealmId) > 0 {
+		realmId := RealmId(self.RealmId)
+		if err := realmId.Check(); nil != err {
+			return wrapError(err, "invalid RealmId")
+		}
+	}
+	if err := self.Sort.Check(); nil != err {
+		return wrapError(err, "invalid Sort")
+	}
+	if self.Limit < 0 {
+		return wrapError(ErrValidation, "invalid Limit, %d < 0", self.Limit)
+	}
+	_, err := self.position()
+
+	return err
+}
+
+// Match returns true if info AppName or Label contains the CardSearch Text.
+func (self *CardSearch) Match(info *CardInfo) bool {
+	if "" == self.Text {
+		return true
+	}
+	text := FoldText(self.Text)
+
+	return strings.Contains(FoldText(info.AppName), text) || strings.Contains(FoldText(info.Label), text)
+}
+
+// position returns the last CardInfo of the previous page, nil if the CardSearch has no Cursor.
+func (self *CardSearch) position() (*CardInfo, error) {
+	if "" == self.Cursor {
+		return nil, nil
+	}
+	srzcursor, err := base64.RawURLEncoding.DecodeString(self.Cursor)
+	if nil != err {
+		return nil, wrapError(ErrValidation, "invalid Cursor encoding")
+	}
+	var cursor cardCursor
+	err = json.Unmarshal(srzcursor, &cursor)
+	if nil != err {
+		return nil, wrapError(ErrValidation, "invalid Cursor content")
+	}
+	if cursor.Sort != self.Sort {
+		return nil, wrapError(ErrValidation, "Cursor Sort %d != %d", cursor.Sort, self.Sort)
+	}
+
+	return &CardInfo{
+		ID:       cursor.ID,
+		RealmID:  cursor.RealmID,
+		AppName:  cursor.AppName,
+		Label:    cursor.Label,
+		LastUsed: cursor.LastUsed,
+	}, nil
+}
+
+// cardCursor holds the CardSearch position encoded in the CardPage Next token.
+type cardCursor struct {
+	Sort     CardSort `json:"s"`
+	ID       int      `json:"id"`
+	RealmID  int      `json:"rid,omitempty"`
+	AppName  string   `json:"app,omitempty"`
+	Label    string   `json:"lbl,omitempty"`
+	LastUsed int64    `json:"lu,omitempty"`
+}
+
+// newCursor returns the token that resumes a search with sort ordering after info.
+func newCursor(sort CardSort, info *CardInfo) string {
+	cursor := cardCursor{Sort: sort, ID: info.ID}
+	switch sort {
+	case SortByLabel:
+		cursor.Label = info.Label
+	case SortByAppName:
+		cursor.AppName = info.AppName
+		cursor.RealmID = info.RealmID
+	case SortByLastUsed:
+		cursor.LastUsed = info.LastUsed
+	}
+	srzcursor, _ := json.Marshal(cursor) // can not fail
+
+	return base64.RawURLEncoding.EncodeToString(srzcursor)
+}
+
+// CardPage holds a page of ClientCredStore SearchInfo results.
+type CardPage struct {
+	Infos []CardInfo `json:"infos"`
+
+	// Total number of cards that match the CardSearch, in all pages
+	// Counting Total visits all the cards selected by the CardSearch RealmId, whatever the Limit
+	Total int `json:"total"`
+
+	// Next is the Cursor of the next page, empty if this page is the last
+	Next string `json:"next,omitempty"`
+}
+
+// CardPager builds a CardPage out of the cards that are selected by a CardSearch RealmId.
+// ClientCredStore implementations use it to share CardSearch semantics.
+type CardPager struct {
+	qry  CardSearch
+	pos  *CardInfo
+	page CardPage
+	more bool
+}
+
+// NewCardPager returns a CardPager for qry.
+// It errors if qry is invalid.
+func NewCardPager(qry *CardSearch) (*CardPager, error) {
+	err := qry.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid CardSearch")
+	}
+	pos, err := qry.position()
+	if nil != err {
+		return nil, wrapError(err, "invalid CardSearch")
+	}
+
+	return &CardPager{qry: *qry, pos: pos}, nil
+}
+
+// Add counts info in the CardPage Total & appends it to the CardPage, see Count & Append.
+// Add must be called with infos ordered by the CardSearch Sort.
+func (self *CardPager) Add(info *CardInfo) {
+	self.Count(info)
+	self.Append(info)
+}
+
+// Count counts info in the CardPage Total if it matches the CardSearch.
+// Count must be called once per card, in any order.
+func (self *CardPager) Count(info *CardInfo) {
+	if self.qry.Match(info) {
+		self.page.Total += 1
+	}
+}
+
+// Append adds info to the CardPage if it matches the CardSearch & follows its Cursor.
+// Append must be called with infos ordered by the CardSearch Sort. It allows ClientCredStore
+// implementations to seek their sort index to the Cursor Position, counting Total separately.
+func (self *CardPager) Append(info *CardInfo) {
+	if !self.qry.Match(info) {
+		return
+	}
+	if nil != self.pos && self.qry.Sort.Compare(info, self.pos) <= 0 {
+		return
+	}
+	if self.qry.Limit > 0 && len(self.page.Infos) >= self.qry.Limit {
+		self.more = true
+		return
+	}
+	self.page.Infos = append(self.page.Infos, *info)
+}
+
+// Full returns true if the CardPage is complete and has a next page.
+func (self *CardPager) Full() bool {
+	return self.more
+}
+
+// Position returns the last CardInfo of the previous page, nil if the CardSearch has no Cursor.
+func (self *CardPager) Position() *CardInfo {
+	return self.pos
+}
+
+// Page returns the CardPage.
+func (self *CardPager) Page() CardPage {
+	page := self.page
+	if self.more {
+		page.Next = newCursor(self.qry.Sort, &page.Infos[len(page.Infos)-1])
+	}
+
+	return page
+}
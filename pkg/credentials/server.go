@@ -1,10 +1,15 @@
 package credentials
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 // KeyStore allows loading KerPass service "static" Keypair.
@@ -77,6 +82,11 @@ type ServerCredStore interface {
 	// It errors if card data were not successfully loaded.
 	LoadCard(ctx context.Context, cardId ServerCardAccess, dst *ServerCard) error
 
+	// LoadCards loads stored card data for each cardIds element in the dst element at the same position.
+	// It returns per card errors, errs[i] is nil if dst[i] was successfully loaded.
+	// It errors if dst and cardIds lengths differ or if the ServerCredStore is not reachable.
+	LoadCards(ctx context.Context, cardIds []ServerCardAccess, dst []ServerCard) (errs []error, err error)
+
 	// SaveCard saves card in the ServerCredStore.
 	// SaveCard may modify card before/after saving it, eg to record actual storage key.
 	// It errors if the card could not be saved.
@@ -88,6 +98,23 @@ type ServerCredStore interface {
 
 	// CountCard returns the number of ServerCard in the ServerCredStore.
 	CardCount(ctx context.Context) (int, error)
+
+	// ListCards returns the ServerCardPage of ServerCardInfo that matches qry, oldest cards first.
+	// Following pages are obtained by setting qry.Cursor to the ServerCardPage Next token.
+	ListCards(ctx context.Context, qry ServerCardQuery) (ServerCardPage, error)
+
+	// ListUserCards returns the ServerCardInfo of the cards which IdToken derives from userId.
+	// There is at most 1 such card per Realm.
+	ListUserCards(ctx context.Context, userId string) ([]ServerCardInfo, error)
+
+	// SetCardState changes the State of the ServerCard with cardId identifier.
+	// It errors wrapping ErrNotFound if the card does not exist.
+	SetCardState(ctx context.Context, cardId ServerCardKey, state CardState) error
+
+	// RecordCardUses adds uses to the usage statistics of the ServerCards.
+	// A ServerCard LastUsed is only moved forward, uses of unknown cards are ignored.
+	// It errors if the ServerCredStore is not reachable.
+	RecordCardUses(ctx context.Context, uses []CardUse) error
 }
 
 // A Realm is a trusted domain managed by a single authority,
@@ -148,6 +175,8 @@ type ServerCard struct {
 	RealmId RealmId         `json:"rid" cbor:"2,keyasint"`
 	Kh      PublicKeyHandle `json:"pubkey" cbor:"3,keyasint"` // uses Kh.PublicKey to obtain the ecdh.PublicKey
 	Psk     []byte          `json:"psk" cbor:"4,keyasint"`
+	State   CardState       `json:"state,omitempty" cbor:"5,keyasint,omitempty"`
+	Label   string          `json:"label,omitempty" cbor:"6,keyasint,omitempty"` // user facing card name
 }
 
 // Check returns an error if the ServerCard is invalid.
@@ -168,10 +197,191 @@ func (self *ServerCard) Check() error {
 	if len(self.Psk) < 32 {
 		return newError("Invalid Psk, length < 32")
 	}
+	if err = self.State.Check(); err != nil {
+		return wrapError(err, "failed State validation")
+	}
+
+	return nil
+}
+
+// CheckActive returns an error wrapping ErrSuspended if the ServerCard can not authenticate.
+func (self *ServerCard) CheckActive() error {
+	if CardActive != self.State {
+		return wrapError(ErrSuspended, "card State is %d", self.State)
+	}
+
+	return nil
+}
+
+// CardState is the lifecycle state of a ServerCard.
+type CardState int
+
+const (
+	// CardActive cards can authenticate.
+	CardActive CardState = iota
+
+	// CardSuspended cards are kept in the ServerCredStore but can not authenticate.
+	CardSuspended
+)
+
+// Check returns an error if the CardState is unknown.
+func (self CardState) Check() error {
+	if self < CardActive || self > CardSuspended {
+		return wrapError(ErrValidation, "unknown CardState %d", self)
+	}
 
 	return nil
 }
 
+// ServerCardInfo holds ServerCard informations useful for administration.
+// It holds no key material.
+type ServerCardInfo struct {
+	CardId    ServerCardIdKey `json:"cid" cbor:"1,keyasint"`
+	RealmId   RealmId         `json:"rid" cbor:"2,keyasint"`
+	State     CardState       `json:"state" cbor:"3,keyasint"`
+	CreatedAt time.Time       `json:"created_at" cbor:"4,keyasint"`
+	Label     string          `json:"label,omitempty" cbor:"5,keyasint,omitempty"`
+	LastUsed  time.Time       `json:"last_used,omitzero" cbor:"6,keyasint,omitzero"` // zero if never used
+	UseCount  int64           `json:"use_count" cbor:"7,keyasint"`
+}
+
+// LastActive returns the time of the ServerCard last use, or its creation time if it was never used.
+func (self *ServerCardInfo) LastActive() time.Time {
+	if self.LastUsed.IsZero() {
+		return self.CreatedAt
+	}
+
+	return self.LastUsed
+}
+
+const (
+	// DefaultCardListLimit is the ServerCardPage size used when ServerCardQuery Limit is 0.
+	DefaultCardListLimit = 100
+
+	// MaxCardListLimit is the maximum ServerCardQuery Limit.
+	MaxCardListLimit = 1000
+)
+
+// ServerCardQuery parametrizes ServerCredStore ListCards.
+type ServerCardQuery struct {
+	RealmId RealmId // empty selects cards of all Realms
+
+	CreatedAfter  time.Time // selects cards created at or after CreatedAfter if not zero
+	CreatedBefore time.Time // selects cards created before CreatedBefore if not zero
+
+	States []CardState // empty selects cards in any State
+
+	// UnusedSince selects dormant cards, which LastActive is before UnusedSince, if not zero
+	UnusedSince time.Time
+
+	// Cursor is the Next token of the previous ServerCardPage, empty for the first page.
+	Cursor string
+
+	Limit int // maximum number of items in the ServerCardPage, 0 for DefaultCardListLimit
+}
+
+// Check returns an error if the ServerCardQuery is invalid.
+func (self *ServerCardQuery) Check() error {
+	if len(self.RealmId) > 0 {
+		if err := self.RealmId.Check(); nil != err {
+			return wrapError(err, "invalid RealmId")
+		}
+	}
+	for _, state := range self.States {
+		if err := state.Check(); nil != err {
+			return wrapError(err, "invalid States")
+		}
+	}
+	if self.Limit < 0 || self.Limit > MaxCardListLimit {
+		return wrapError(ErrValidation, "invalid Limit %d, not in [0..%d]", self.Limit, MaxCardListLimit)
+	}
+	_, err := self.Position()
+
+	return err
+}
+
+// PageLimit returns the maximum number of items in the ServerCardPage.
+func (self *ServerCardQuery) PageLimit() int {
+	if 0 == self.Limit {
+		return DefaultCardListLimit
+	}
+
+	return self.Limit
+}
+
+// Position returns the last ServerCardInfo of the previous page, nil if the ServerCardQuery has no Cursor.
+// Only the CreatedAt & CardId fields of the returned ServerCardInfo are set.
+func (self *ServerCardQuery) Position() (*ServerCardInfo, error) {
+	if "" == self.Cursor {
+		return nil, nil
+	}
+	srzcursor, err := base64.RawURLEncoding.DecodeString(self.Cursor)
+	if nil != err {
+		return nil, wrapError(ErrValidation, "invalid Cursor encoding")
+	}
+	var cursor srvCardCursor
+	err = json.Unmarshal(srzcursor, &cursor)
+	if nil != err {
+		return nil, wrapError(ErrValidation, "invalid Cursor content")
+	}
+	cardId := ServerCardIdKey(cursor.CardId)
+	if err = cardId.Check(); nil != err {
+		return nil, wrapError(ErrValidation, "invalid Cursor CardId")
+	}
+
+	return &ServerCardInfo{CardId: cardId, CreatedAt: time.UnixMicro(cursor.CreatedAt)}, nil
+}
+
+// Match returns true if info matches the ServerCardQuery filters.
+// Match does not check the ServerCardQuery Cursor.
+func (self *ServerCardQuery) Match(info *ServerCardInfo) bool {
+	if len(self.RealmId) > 0 && !bytes.Equal(self.RealmId, info.RealmId) {
+		return false
+	}
+	if !self.CreatedAfter.IsZero() && info.CreatedAt.Before(self.CreatedAfter) {
+		return false
+	}
+	if !self.CreatedBefore.IsZero() && !info.CreatedAt.Before(self.CreatedBefore) {
+		return false
+	}
+	if len(self.States) > 0 && !slices.Contains(self.States, info.State) {
+		return false
+	}
+	if !self.UnusedSince.IsZero() && !info.LastActive().Before(self.UnusedSince) {
+		return false
+	}
+
+	return true
+}
+
+// CompareServerCardInfo orders ServerCardInfo by CreatedAt, then by CardId.
+// It is the ordering of ServerCredStore ListCards results.
+func CompareServerCardInfo(i0, i1 *ServerCardInfo) int {
+	return cmp.Or(i0.CreatedAt.Compare(i1.CreatedAt), bytes.Compare(i0.CardId, i1.CardId))
+}
+
+// srvCardCursor holds the ListCards position encoded in the ServerCardPage Next token.
+type srvCardCursor struct {
+	CreatedAt int64  `json:"t"` // Unix time in microseconds
+	CardId    []byte `json:"cid"`
+}
+
+// NewServerCardCursor returns the token that resumes a ListCards search after info.
+func NewServerCardCursor(info *ServerCardInfo) string {
+	cursor := srvCardCursor{CreatedAt: info.CreatedAt.UnixMicro(), CardId: info.CardId}
+	srzcursor, _ := json.Marshal(cursor) // can not fail
+
+	return base64.RawURLEncoding.EncodeToString(srzcursor)
+}
+
+// ServerCardPage holds a page of ServerCredStore ListCards results.
+type ServerCardPage struct {
+	Cards []ServerCardInfo `json:"cards"`
+
+	// Next is the Cursor of the next page, empty if this page is the last
+	Next string `json:"next,omitempty"`
+}
+
 // MemKeyStore provides "in memory" implementation of KeyStore.
 type MemKeyStore struct {
 	mut  sync.Mutex
@@ -235,6 +445,8 @@ type MemServerCredStore struct {
 	realms         map[[32]byte]Realm
 	authorizations map[[32]byte]EnrollAuthorization
 	cards          map[[32]byte]ServerCard
+	created        map[[32]byte]time.Time
+	usage          map[[32]byte]CardUse
 }
 
 func NewMemServerCredStore() (*MemServerCredStore, error) {
@@ -247,6 +459,8 @@ func NewMemServerCredStore() (*MemServerCredStore, error) {
 		realms:         make(map[[32]byte]Realm),
 		authorizations: make(map[[32]byte]EnrollAuthorization),
 		cards:          make(map[[32]byte]ServerCard),
+		created:        make(map[[32]byte]time.Time),
+		usage:          make(map[[32]byte]CardUse),
 	}
 
 	return &rv, nil
@@ -401,6 +615,41 @@ func (self *MemServerCredStore) LoadCard(_ context.Context, cardId ServerCardAcc
 	return err
 }
 
+// LoadCards loads stored card data for each cardIds element in the dst element at the same position.
+// It returns per card errors, errs[i] is nil if dst[i] was successfully loaded.
+// It errors if dst and cardIds lengths differ.
+func (self *MemServerCredStore) LoadCards(_ context.Context, cardIds []ServerCardAccess, dst []ServerCard) ([]error, error) {
+	if len(cardIds) != len(dst) {
+		return nil, newError("cardIds length %d != dst length %d", len(cardIds), len(dst))
+	}
+
+	// derive AccessKeys outside of the lock
+	errs := make([]error, len(cardIds))
+	keys := make([][32]byte, len(cardIds))
+	for pos, cardId := range cardIds {
+		aks := AccessKeys{}
+		errs[pos] = wrapError(self.idh.DeriveFromCardAccess(cardId, &aks), "failed AccessKeys derivation")
+		keys[pos] = aks.IdKey
+	}
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	for pos, key := range keys {
+		if nil != errs[pos] {
+			continue
+		}
+		card, found := self.cards[key]
+		if found {
+			dst[pos] = card
+		} else {
+			errs[pos] = wrapError(ErrNotFound, "unknown cardId")
+		}
+	}
+
+	return errs, nil
+}
+
 // SaveCard saves card in the MemServerCredStore.
 // It errors if the card could not be saved.
 func (self *MemServerCredStore) SaveCard(_ context.Context, cardId ServerCardAccess, card *ServerCard) error {
@@ -422,6 +671,10 @@ func (self *MemServerCredStore) SaveCard(_ context.Context, cardId ServerCardAcc
 	defer self.mut.Unlock()
 
 	self.cards[aks.IdKey] = *card
+	if _, found := self.created[aks.IdKey]; !found {
+		// microsecond precision, as ServerCardPage cursors
+		self.created[aks.IdKey] = time.Now().Truncate(time.Microsecond)
+	}
 
 	return nil
 }
@@ -429,39 +682,182 @@ func (self *MemServerCredStore) SaveCard(_ context.Context, cardId ServerCardAcc
 // RemoveCard removes the ServerCard with cardId identifier from the MemServerCredStore.
 // It returns true if the ServerCard was effectively removed.
 func (self *MemServerCredStore) RemoveCard(_ context.Context, cardId ServerCardKey) bool {
+	ck, err := self.cardKey(cardId)
+	if nil != err {
+		return false
+	}
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	_, found := self.cards[ck]
+	if found {
+		delete(self.cards, ck)
+		delete(self.created, ck)
+		delete(self.usage, ck)
+	}
+
+	return found
+}
+
+// cardKey returns the cards map key of cardId.
+func (self *MemServerCredStore) cardKey(cardId ServerCardKey) ([32]byte, error) {
 	var ck [32]byte
 	switch v := cardId.(type) {
 	case ServerCardIdKey:
+		if err := v.Check(); nil != err {
+			return ck, wrapError(err, "invalid ServerCardIdKey")
+		}
 		ck = [32]byte(v)
-	case IdToken:
+	case ServerCardAccess:
 		aks := AccessKeys{}
 		err := self.idh.DeriveFromCardAccess(v, &aks)
 		if nil != err {
-			return false
+			return ck, wrapError(err, "failed AccessKeys derivation")
 		}
 		ck = aks.IdKey
 	default:
-		// cardId type is not supported
-		return false
+		return ck, wrapError(ErrValidation, "non supported ServerCardKey")
 	}
 
+	return ck, nil
+}
+
+// CardCount returns the number of ServerCard in the MemServerCredStore.
+func (self *MemServerCredStore) CardCount(_ context.Context) (int, error) {
 	self.mut.Lock()
 	defer self.mut.Unlock()
 
-	_, found := self.cards[ck]
-	if found {
-		delete(self.cards, ck)
+	return len(self.cards), nil
+}
+
+// ListCards returns the ServerCardPage of ServerCardInfo that matches qry, oldest cards first.
+func (self *MemServerCredStore) ListCards(_ context.Context, qry ServerCardQuery) (ServerCardPage, error) {
+	err := qry.Check()
+	if nil != err {
+		return ServerCardPage{}, wrapError(err, "invalid ServerCardQuery")
 	}
+	pos, _ := qry.Position() // checked by qry.Check
 
-	return found
+	self.mut.Lock()
+	infos := make([]ServerCardInfo, 0, len(self.cards))
+	for ck, card := range self.cards {
+		info := ServerCardInfo{
+			CardId:    ServerCardIdKey(ck[:]),
+			RealmId:   card.RealmId,
+			State:     card.State,
+			CreatedAt: self.created[ck],
+			Label:     card.Label,
+			LastUsed:  self.usage[ck].LastUsed,
+			UseCount:  self.usage[ck].Count,
+		}
+		if !qry.Match(&info) {
+			continue
+		}
+		if nil != pos && CompareServerCardInfo(&info, pos) <= 0 {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	self.mut.Unlock()
+
+	slices.SortFunc(infos, func(i0, i1 ServerCardInfo) int {
+		return CompareServerCardInfo(&i0, &i1)
+	})
+	page := ServerCardPage{Cards: infos}
+	if limit := qry.PageLimit(); len(infos) > limit {
+		page.Cards = infos[:limit]
+		page.Next = NewServerCardCursor(&page.Cards[limit-1])
+	}
+
+	return page, nil
 }
 
-// CardCount returns the number of ServerCard in the MemServerCredStore.
-func (self *MemServerCredStore) CardCount(_ context.Context) (int, error) {
+// ListUserCards returns the ServerCardInfo of the cards which IdToken derives from userId.
+func (self *MemServerCredStore) ListUserCards(_ context.Context, userId string) ([]ServerCardInfo, error) {
+	if "" == userId {
+		return nil, wrapError(ErrValidation, "empty userId")
+	}
+
 	self.mut.Lock()
 	defer self.mut.Unlock()
 
-	return len(self.cards), nil
+	var infos []ServerCardInfo
+	for rk := range self.realms {
+		aks := AccessKeys{}
+		err := self.idh.DeriveFromCardAccess(OtpId{Realm: rk[:], Username: userId}, &aks)
+		if nil != err {
+			return nil, wrapError(err, "failed AccessKeys derivation")
+		}
+		card, found := self.cards[aks.IdKey]
+		if !found {
+			continue
+		}
+		infos = append(infos, ServerCardInfo{
+			CardId:    ServerCardIdKey(aks.IdKey[:]),
+			RealmId:   card.RealmId,
+			State:     card.State,
+			CreatedAt: self.created[aks.IdKey],
+			Label:     card.Label,
+			LastUsed:  self.usage[aks.IdKey].LastUsed,
+			UseCount:  self.usage[aks.IdKey].Count,
+		})
+	}
+	slices.SortFunc(infos, func(i0, i1 ServerCardInfo) int {
+		return CompareServerCardInfo(&i0, &i1)
+	})
+
+	return infos, nil
+}
+
+// SetCardState changes the State of the ServerCard with cardId identifier.
+// It errors wrapping ErrNotFound if the card does not exist.
+func (self *MemServerCredStore) SetCardState(_ context.Context, cardId ServerCardKey, state CardState) error {
+	err := state.Check()
+	if nil != err {
+		return wrapError(err, "invalid state")
+	}
+	ck, err := self.cardKey(cardId)
+	if nil != err {
+		return wrapError(err, "invalid cardId")
+	}
+
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	card, found := self.cards[ck]
+	if !found {
+		return wrapError(ErrNotFound, "unknown cardId")
+	}
+	card.State = state
+	self.cards[ck] = card
+
+	return nil
+}
+
+// RecordCardUses adds uses to the usage statistics of the ServerCards.
+func (self *MemServerCredStore) RecordCardUses(_ context.Context, uses []CardUse) error {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	for _, use := range uses {
+		if 32 != len(use.CardId) {
+			continue
+		}
+		ck := [32]byte(use.CardId)
+		if _, found := self.cards[ck]; !found {
+			continue
+		}
+		cur := self.usage[ck]
+		cur.Count += use.Count
+		if use.LastUsed.After(cur.LastUsed) {
+			// microsecond precision, as the pgdb ServerCredStore
+			cur.LastUsed = use.LastUsed.Truncate(time.Microsecond)
+		}
+		self.usage[ck] = cur
+	}
+
+	return nil
 }
 
 var _ ServerCredStore = &MemServerCredStore{}
@@ -1,11 +1,14 @@
 package credentials
 
 import (
+	"context"
 	"crypto/ecdh"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/fxamacker/cbor/v2"
 )
@@ -175,3 +178,271 @@ func TestServerCardCBOR(t *testing.T) {
 	}
 
 }
+
+func TestMemServerCredStoreListCards(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMemServerCredStore()
+	if nil != err {
+		t.Fatalf("failed NewMemServerCredStore, got error %v", err)
+	}
+
+	// save 5 cards in realm r0 & 2 cards in realm r1
+	realms := [2]RealmId{make([]byte, 32), make([]byte, 32)}
+	for _, realmId := range realms {
+		rand.Read(realmId)
+	}
+	cardIds := make(map[string]RealmId)
+	for i := range 7 {
+		card := newServerCard(t, realms[min(i/5, 1)])
+		idToken := IdToken(make([]byte, 32))
+		rand.Read(idToken)
+		err = store.SaveCard(ctx, idToken, &card)
+		if nil != err {
+			t.Fatalf("failed SaveCard #%d, got error %v", i, err)
+		}
+		cardIds[string(card.CardId)] = card.RealmId
+	}
+
+	// page through realm r0 cards
+	qry := ServerCardQuery{RealmId: realms[0], Limit: 2}
+	seen := make(map[string]bool)
+	var last *ServerCardInfo
+	for npage := 0; ; npage++ {
+		page, err := store.ListCards(ctx, qry)
+		if nil != err {
+			t.Fatalf("failed ListCards, got error %v", err)
+		}
+		if len(page.Cards) > 2 {
+			t.Fatalf("failed page #%d Limit control, got %d cards", npage, len(page.Cards))
+		}
+		for i := range page.Cards {
+			info := &page.Cards[i]
+			if nil != last && CompareServerCardInfo(last, info) >= 0 {
+				t.Errorf("failed ordering control on page #%d", npage)
+			}
+			if !reflect.DeepEqual(realms[0], cardIds[string(info.CardId)]) {
+				t.Errorf("failed RealmId control on page #%d", npage)
+			}
+			seen[string(info.CardId)] = true
+			last = info
+		}
+		if "" == page.Next {
+			break
+		}
+		qry.Cursor = page.Next
+	}
+	if 5 != len(seen) {
+		t.Errorf("failed ListCards, got %d cards != 5", len(seen))
+	}
+
+	// suspend 1 card & filter on state
+	suspended := ServerCardIdKey(last.CardId)
+	err = store.SetCardState(ctx, suspended, CardSuspended)
+	if nil != err {
+		t.Fatalf("failed SetCardState, got error %v", err)
+	}
+	page, err := store.ListCards(ctx, ServerCardQuery{States: []CardState{CardSuspended}})
+	if nil != err {
+		t.Fatalf("failed ListCards, got error %v", err)
+	}
+	if 1 != len(page.Cards) || !reflect.DeepEqual(suspended, page.Cards[0].CardId) {
+		t.Errorf("failed States filter, got %d cards", len(page.Cards))
+	}
+
+	// creation date filter
+	page, err = store.ListCards(ctx, ServerCardQuery{CreatedBefore: time.Now().Add(-time.Hour)})
+	if nil != err {
+		t.Fatalf("failed ListCards, got error %v", err)
+	}
+	if 0 != len(page.Cards) {
+		t.Errorf("failed CreatedBefore filter, got %d cards", len(page.Cards))
+	}
+	page, err = store.ListCards(ctx, ServerCardQuery{CreatedAfter: time.Now().Add(-time.Hour)})
+	if nil != err {
+		t.Fatalf("failed ListCards, got error %v", err)
+	}
+	if 7 != len(page.Cards) {
+		t.Errorf("failed CreatedAfter filter, got %d cards", len(page.Cards))
+	}
+
+	// invalid queries
+	for _, qry := range []ServerCardQuery{
+		{Limit: MaxCardListLimit + 1},
+		{States: []CardState{CardSuspended + 1}},
+		{Cursor: "not a cursor"},
+		{RealmId: make([]byte, 8)},
+	} {
+		_, err = store.ListCards(ctx, qry)
+		if !errors.Is(err, ErrValidation) {
+			t.Errorf("failed ListCards(%+v) validation, got error %v", qry, err)
+		}
+	}
+}
+
+func TestMemServerCredStoreListUserCards(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMemServerCredStore()
+	if nil != err {
+		t.Fatalf("failed NewMemServerCredStore, got error %v", err)
+	}
+
+	// user has a card in 2 of 3 realms
+	realms := make([]Realm, 3)
+	for i := range realms {
+		realms[i] = Realm{RealmId: make([]byte, 32), AppName: "App"}
+		rand.Read(realms[i].RealmId)
+		err = store.SaveRealm(ctx, &realms[i])
+		if nil != err {
+			t.Fatalf("failed SaveRealm, got error %v", err)
+		}
+	}
+	for _, realm := range realms[:2] {
+		card := newServerCard(t, realm.RealmId)
+		card.Label = "alice phone"
+		err = store.SaveCard(ctx, OtpId{Realm: realm.RealmId, Username: "alice"}, &card)
+		if nil != err {
+			t.Fatalf("failed SaveCard, got error %v", err)
+		}
+	}
+	card := newServerCard(t, realms[2].RealmId)
+	err = store.SaveCard(ctx, OtpId{Realm: realms[2].RealmId, Username: "bob"}, &card)
+	if nil != err {
+		t.Fatalf("failed SaveCard, got error %v", err)
+	}
+
+	infos, err := store.ListUserCards(ctx, "alice")
+	if nil != err {
+		t.Fatalf("failed ListUserCards, got error %v", err)
+	}
+	if 2 != len(infos) {
+		t.Fatalf("failed ListUserCards, got %d cards != 2", len(infos))
+	}
+	for _, info := range infos {
+		if reflect.DeepEqual(info.RealmId, realms[2].RealmId) {
+			t.Error("failed ListUserCards, got card of an other user")
+		}
+		if "alice phone" != info.Label {
+			t.Errorf("failed ListUserCards, got Label %q", info.Label)
+		}
+	}
+
+	infos, err = store.ListUserCards(ctx, "carol")
+	if nil != err {
+		t.Fatalf("failed ListUserCards, got error %v", err)
+	}
+	if 0 != len(infos) {
+		t.Errorf("failed ListUserCards, got %d cards for unknown user", len(infos))
+	}
+}
+
+func TestMemServerCredStoreSetCardState(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMemServerCredStore()
+	if nil != err {
+		t.Fatalf("failed NewMemServerCredStore, got error %v", err)
+	}
+	realmId := make([]byte, 32)
+	rand.Read(realmId)
+	card := newServerCard(t, realmId)
+	idToken := IdToken(make([]byte, 32))
+	rand.Read(idToken)
+	err = store.SaveCard(ctx, idToken, &card)
+	if nil != err {
+		t.Fatalf("failed SaveCard, got error %v", err)
+	}
+
+	err = store.SetCardState(ctx, idToken, CardSuspended)
+	if nil != err {
+		t.Fatalf("failed SetCardState, got error %v", err)
+	}
+	var loaded ServerCard
+	err = store.LoadCard(ctx, idToken, &loaded)
+	if nil != err {
+		t.Fatalf("failed LoadCard, got error %v", err)
+	}
+	if !errors.Is(loaded.CheckActive(), ErrSuspended) {
+		t.Errorf("failed CheckActive, got error %v", loaded.CheckActive())
+	}
+
+	unknown := ServerCardIdKey(make([]byte, 32))
+	err = store.SetCardState(ctx, unknown, CardActive)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed SetCardState of unknown card, got error %v", err)
+	}
+	err = store.SetCardState(ctx, idToken, CardSuspended+1)
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("failed SetCardState with invalid state, got error %v", err)
+	}
+}
+
+func TestMemServerCredStoreRecordCardUses(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewMemServerCredStore()
+	if nil != err {
+		t.Fatalf("failed NewMemServerCredStore, got error %v", err)
+	}
+	realmId := make([]byte, 32)
+	rand.Read(realmId)
+	cards := make([]ServerCard, 2)
+	for i := range cards {
+		cards[i] = newServerCard(t, realmId)
+		idToken := IdToken(make([]byte, 32))
+		rand.Read(idToken)
+		err = store.SaveCard(ctx, idToken, &cards[i])
+		if nil != err {
+			t.Fatalf("failed SaveCard, got error %v", err)
+		}
+	}
+
+	// cards[0] is used, LastUsed only moves forward, unknown cards are ignored
+	t0 := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	err = store.RecordCardUses(ctx, []CardUse{
+		{CardId: cards[0].CardId, LastUsed: t0, Count: 2},
+		{CardId: ServerCardIdKey(make([]byte, 32)), LastUsed: t0, Count: 1},
+	})
+	if nil != err {
+		t.Fatalf("failed RecordCardUses, got error %v", err)
+	}
+	err = store.RecordCardUses(ctx, []CardUse{{CardId: cards[0].CardId, LastUsed: t0.Add(-time.Minute), Count: 1}})
+	if nil != err {
+		t.Fatalf("failed RecordCardUses, got error %v", err)
+	}
+	page, err := store.ListCards(ctx, ServerCardQuery{})
+	if nil != err {
+		t.Fatalf("failed ListCards, got error %v", err)
+	}
+	for _, info := range page.Cards {
+		used := reflect.DeepEqual(info.CardId, cards[0].CardId)
+		switch {
+		case used && (!info.LastUsed.Equal(t0) || 3 != info.UseCount):
+			t.Errorf("failed used card control, got LastUsed %v & UseCount %d", info.LastUsed, info.UseCount)
+		case !used && (!info.LastUsed.IsZero() || 0 != info.UseCount):
+			t.Errorf("failed unused card control, got LastUsed %v & UseCount %d", info.LastUsed, info.UseCount)
+		}
+	}
+
+	// cards[1] is dormant since its creation
+	page, err = store.ListCards(ctx, ServerCardQuery{UnusedSince: t0.Add(-time.Minute)})
+	if nil != err {
+		t.Fatalf("failed ListCards, got error %v", err)
+	}
+	if 1 != len(page.Cards) || !reflect.DeepEqual(page.Cards[0].CardId, cards[1].CardId) {
+		t.Errorf("failed dormant cards control, got %d cards", len(page.Cards))
+	}
+}
+
+// newServerCard returns a ServerCard in realmId with random keys.
+func newServerCard(t *testing.T, realmId RealmId) ServerCard {
+	keypair, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating keypair, got error %v", err)
+	}
+	psk := make([]byte, 32)
+	rand.Read(psk)
+
+	return ServerCard{
+		RealmId: realmId,
+		Kh:      PublicKeyHandle{PublicKey: keypair.PublicKey()},
+		Psk:     psk,
+	}
+}
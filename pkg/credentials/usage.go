@@ -0,0 +1,182 @@
+package credentials
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"code.kerpass.org/golang/internal/observability"
+)
+
+const (
+	// DefaultCardUseFlushInterval is the CardUseRecorder flush period used when its interval is 0.
+	DefaultCardUseFlushInterval = 10 * time.Second
+
+	// DefaultCardUseBatchSize is the CardUseRecorder batch size used when its batchSize is 0.
+	DefaultCardUseBatchSize = 500
+
+	// cardUseFinalFlushTimeout bounds the CardUseRecorder Run last flush.
+	cardUseFinalFlushTimeout = 10 * time.Second
+)
+
+// CardUse aggregates successful authentications of the ServerCard with CardId identifier.
+type CardUse struct {
+	CardId   ServerCardIdKey
+	LastUsed time.Time // time of the most recent authentication
+	Count    int64     // number of authentications
+}
+
+// CardUseRecorder records ServerCard usage out of the authentication path.
+//
+// Record aggregates uses in memory, they are written to the ServerCredStore by RecordCardUses
+// batches when the flush interval elapses or when batchSize cards are pending.
+// Batches that fail to be written are kept for the next flush.
+type CardUseRecorder struct {
+	store     ServerCredStore
+	idh       *IdHasher
+	interval  time.Duration
+	batchSize int
+	full      chan struct{}
+
+	mut     sync.Mutex
+	pending map[[32]byte]CardUse
+}
+
+// NewCardUseRecorder returns a CardUseRecorder that writes to store.
+// idh derives the ServerCardIdKey of recorded ServerCardAccess, it shall use the same seed as store.
+// If interval or batchSize are 0, DefaultCardUseFlushInterval & DefaultCardUseBatchSize are used.
+// It errors if the parameters are invalid.
+func NewCardUseRecorder(store ServerCredStore, idh *IdHasher, interval time.Duration, batchSize int) (*CardUseRecorder, error) {
+	if nil == store {
+		return nil, wrapError(ErrValidation, "nil store")
+	}
+	if nil == idh {
+		return nil, wrapError(ErrValidation, "nil idh")
+	}
+	if interval < 0 || batchSize < 0 {
+		return nil, wrapError(ErrValidation, "negative interval or batchSize")
+	}
+	if 0 == interval {
+		interval = DefaultCardUseFlushInterval
+	}
+	if 0 == batchSize {
+		batchSize = DefaultCardUseBatchSize
+	}
+
+	return &CardUseRecorder{
+		store:     store,
+		idh:       idh,
+		interval:  interval,
+		batchSize: batchSize,
+		full:      make(chan struct{}, 1),
+		pending:   make(map[[32]byte]CardUse),
+	}, nil
+}
+
+// Record registers that the ServerCard with cardId identifier authenticated at t.
+// It does not access the ServerCredStore.
+// It errors if cardId is invalid.
+func (self *CardUseRecorder) Record(cardId ServerCardKey, t time.Time) error {
+	var ck [32]byte
+	switch v := cardId.(type) {
+	case ServerCardIdKey:
+		if err := v.Check(); nil != err {
+			return wrapError(err, "invalid ServerCardIdKey")
+		}
+		ck = [32]byte(v)
+	case ServerCardAccess:
+		aks := AccessKeys{}
+		err := self.idh.DeriveFromCardAccess(v, &aks)
+		if nil != err {
+			return wrapError(err, "failed AccessKeys derivation")
+		}
+		ck = aks.IdKey
+	default:
+		return wrapError(ErrValidation, "non supported ServerCardKey")
+	}
+
+	self.mut.Lock()
+	self.add(ck, CardUse{LastUsed: t, Count: 1})
+	full := len(self.pending) >= self.batchSize
+	self.mut.Unlock()
+
+	if full {
+		select {
+		case self.full <- struct{}{}:
+		default: // a flush is already requested
+		}
+	}
+
+	return nil
+}
+
+// add merges use in the pending uses of ck, self.mut must be held.
+func (self *CardUseRecorder) add(ck [32]byte, use CardUse) {
+	cur, found := self.pending[ck]
+	if found {
+		use.Count += cur.Count
+		if cur.LastUsed.After(use.LastUsed) {
+			use.LastUsed = cur.LastUsed
+		}
+	}
+	use.CardId = ServerCardIdKey(ck[:])
+	self.pending[ck] = use
+}
+
+// Flush writes the pending uses to the ServerCredStore, with one RecordCardUses call per batchSize uses.
+// It errors if a ServerCredStore RecordCardUses failed, the uses not yet written are then kept pending.
+func (self *CardUseRecorder) Flush(ctx context.Context) error {
+	self.mut.Lock()
+	pending := self.pending
+	self.pending = make(map[[32]byte]CardUse, len(pending))
+	self.mut.Unlock()
+
+	if 0 == len(pending) {
+		return nil
+	}
+	uses := make([]CardUse, 0, len(pending))
+	for _, use := range pending {
+		uses = append(uses, use)
+	}
+	for start := 0; start < len(uses); start += self.batchSize {
+		end := min(start+self.batchSize, len(uses))
+		err := self.store.RecordCardUses(ctx, uses[start:end])
+		if nil != err {
+			self.mut.Lock()
+			for _, use := range uses[start:] {
+				self.add([32]byte(use.CardId), use)
+			}
+			self.mut.Unlock()
+			return wrapError(err, "failed RecordCardUses")
+		}
+	}
+
+	return nil
+}
+
+// Run flushes the pending uses periodically or when a batch is full, until ctx is done.
+// It makes a last flush bounded by a timeout before returning.
+func (self *CardUseRecorder) Run(ctx context.Context) {
+	log := observability.GetObservability(ctx).Log().With("service", "card-use-recorder")
+	ticker := time.NewTicker(self.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cardUseFinalFlushTimeout)
+			err := self.Flush(fctx)
+			cancel()
+			if nil != err {
+				log.Error("failed final flush", "error", err)
+			}
+			return
+		case <-ticker.C:
+		case <-self.full:
+		}
+		err := self.Flush(ctx)
+		if nil != err {
+			log.Error("failed flush", "error", err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package credentials
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCardUseRecorder(t *testing.T) {
+	ctx := context.Background()
+	store, idToken := newUsageStore(t)
+	rec, err := NewCardUseRecorder(store, store.idh, time.Hour, 0)
+	if nil != err {
+		t.Fatalf("failed NewCardUseRecorder, got error %v", err)
+	}
+
+	// uses are aggregated until Flush
+	t0 := time.Now().Truncate(time.Microsecond)
+	for _, t := range []time.Time{t0, t0.Add(-time.Second), t0.Add(-time.Minute)} {
+		err = rec.Record(idToken, t)
+		if nil != err {
+			break
+		}
+	}
+	if nil != err {
+		t.Fatalf("failed Record, got error %v", err)
+	}
+	if info := usageInfo(t, store); 0 != info.UseCount {
+		t.Fatalf("failed pending uses control, got UseCount %d", info.UseCount)
+	}
+	err = rec.Flush(ctx)
+	if nil != err {
+		t.Fatalf("failed Flush, got error %v", err)
+	}
+	if info := usageInfo(t, store); 3 != info.UseCount || !info.LastUsed.Equal(t0) {
+		t.Errorf("failed flushed uses control, got LastUsed %v & UseCount %d", info.LastUsed, info.UseCount)
+	}
+
+	err = rec.Record(IdToken(make([]byte, 8)), t0)
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("failed Record of invalid card, got error %v", err)
+	}
+}
+
+func TestCardUseRecorderFailedFlush(t *testing.T) {
+	ctx := context.Background()
+	store, idToken := newUsageStore(t)
+	failing := &failingUsageStore{MemServerCredStore: store}
+	rec, err := NewCardUseRecorder(failing, store.idh, time.Hour, 0)
+	if nil != err {
+		t.Fatalf("failed NewCardUseRecorder, got error %v", err)
+	}
+	err = rec.Record(idToken, time.Now())
+	if nil != err {
+		t.Fatalf("failed Record, got error %v", err)
+	}
+
+	// failed uses are kept for the next flush
+	failing.fail = true
+	err = rec.Flush(ctx)
+	if nil == err {
+		t.Fatal("failed Flush control, got no error")
+	}
+	err = rec.Record(idToken, time.Now())
+	if nil != err {
+		t.Fatalf("failed Record, got error %v", err)
+	}
+	failing.fail = false
+	err = rec.Flush(ctx)
+	if nil != err {
+		t.Fatalf("failed Flush, got error %v", err)
+	}
+	if info := usageInfo(t, store); 2 != info.UseCount {
+		t.Errorf("failed flushed uses control, got UseCount %d", info.UseCount)
+	}
+}
+
+func TestCardUseRecorderRun(t *testing.T) {
+	store, idToken := newUsageStore(t)
+	rec, err := NewCardUseRecorder(store, store.idh, time.Hour, 1)
+	if nil != err {
+		t.Fatalf("failed NewCardUseRecorder, got error %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		rec.Run(ctx)
+		close(done)
+	}()
+
+	// a full batch is flushed without waiting for the interval
+	err = rec.Record(idToken, time.Now())
+	if nil != err {
+		t.Fatalf("failed Record, got error %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for 1 != usageInfo(t, store).UseCount {
+		if time.Now().After(deadline) {
+			t.Fatal("failed batch flush, timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// pending uses are flushed when Run returns
+	err = rec.Record(idToken, time.Now())
+	if nil != err {
+		t.Fatalf("failed Record, got error %v", err)
+	}
+	cancel()
+	<-done
+	if info := usageInfo(t, store); 2 != info.UseCount {
+		t.Errorf("failed final flush, got UseCount %d", info.UseCount)
+	}
+}
+
+func TestCardUseRecorderFlushBatches(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newUsageStore(t)
+	counting := &countingUsageStore{MemServerCredStore: store}
+	rec, err := NewCardUseRecorder(counting, store.idh, time.Hour, 2)
+	if nil != err {
+		t.Fatalf("failed NewCardUseRecorder, got error %v", err)
+	}
+	recordUses := func(n int) {
+		for range n {
+			cardId := make([]byte, 32)
+			rand.Read(cardId)
+			err := rec.Record(ServerCardIdKey(cardId), time.Now())
+			if nil != err {
+				t.Fatalf("failed Record, got error %v", err)
+			}
+		}
+	}
+
+	// pending uses are written by batchSize chunks
+	recordUses(5)
+	err = rec.Flush(ctx)
+	if nil != err {
+		t.Fatalf("failed Flush, got error %v", err)
+	}
+	if !slices.Equal([]int{2, 2, 1}, counting.sizes) {
+		t.Fatalf("failed batches control, got sizes %v", counting.sizes)
+	}
+
+	// uses of the failed chunk & of the following chunks are kept pending
+	counting.sizes, counting.failAt = nil, 2
+	recordUses(5)
+	err = rec.Flush(ctx)
+	if nil == err {
+		t.Fatal("failed Flush control, got no error")
+	}
+	counting.sizes, counting.failAt = nil, 0
+	err = rec.Flush(ctx)
+	if nil != err {
+		t.Fatalf("failed Flush, got error %v", err)
+	}
+	if !slices.Equal([]int{2, 1}, counting.sizes) {
+		t.Errorf("failed requeued batches control, got sizes %v", counting.sizes)
+	}
+}
+
+func TestCardUseRecorderRunFinalFlushTimeout(t *testing.T) {
+	store, idToken := newUsageStore(t)
+	counting := &countingUsageStore{MemServerCredStore: store}
+	rec, err := NewCardUseRecorder(counting, store.idh, time.Hour, 0)
+	if nil != err {
+		t.Fatalf("failed NewCardUseRecorder, got error %v", err)
+	}
+	err = rec.Record(idToken, time.Now())
+	if nil != err {
+		t.Fatalf("failed Record, got error %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec.Run(ctx)
+
+	if 1 != len(counting.sizes) {
+		t.Fatalf("failed final flush, got %d RecordCardUses calls", len(counting.sizes))
+	}
+	if !counting.deadline {
+		t.Error("failed final flush control, ctx has no deadline")
+	}
+	if nil != counting.err {
+		t.Errorf("failed final flush control, ctx is done with error %v", counting.err)
+	}
+}
+
+// countingUsageStore is a MemServerCredStore which records the RecordCardUses calls without writing the uses.
+// Its RecordCardUses call number failAt fails.
+type countingUsageStore struct {
+	*MemServerCredStore
+	failAt   int
+	sizes    []int
+	deadline bool
+	err      error
+}
+
+func (self *countingUsageStore) RecordCardUses(ctx context.Context, uses []CardUse) error {
+	self.sizes = append(self.sizes, len(uses))
+	_, self.deadline = ctx.Deadline()
+	self.err = ctx.Err()
+	if len(self.sizes) == self.failAt {
+		return newError("RecordCardUses failure")
+	}
+	return nil
+}
+
+// failingUsageStore is a MemServerCredStore which RecordCardUses fails if fail is true.
+type failingUsageStore struct {
+	*MemServerCredStore
+	fail bool
+}
+
+func (self *failingUsageStore) RecordCardUses(ctx context.Context, uses []CardUse) error {
+	if self.fail {
+		return newError("RecordCardUses failure")
+	}
+	return self.MemServerCredStore.RecordCardUses(ctx, uses)
+}
+
+// newUsageStore returns a MemServerCredStore holding a single card & the card IdToken.
+func newUsageStore(t *testing.T) (*MemServerCredStore, IdToken) {
+	store, err := NewMemServerCredStore()
+	if nil != err {
+		t.Fatalf("failed NewMemServerCredStore, got error %v", err)
+	}
+	realmId := make([]byte, 32)
+	rand.Read(realmId)
+	card := newServerCard(t, realmId)
+	idToken := IdToken(make([]byte, 32))
+	rand.Read(idToken)
+	err = store.SaveCard(context.Background(), idToken, &card)
+	if nil != err {
+		t.Fatalf("failed SaveCard, got error %v", err)
+	}
+	return store, idToken
+}
+
+// usageInfo returns the ServerCardInfo of the newUsageStore card.
+func usageInfo(t *testing.T, store *MemServerCredStore) ServerCardInfo {
+	page, err := store.ListCards(context.Background(), ServerCardQuery{})
+	if nil != err || 1 != len(page.Cards) {
+		t.Fatalf("failed ListCards, got %d cards & error %v", len(page.Cards), err)
+	}
+	return page.Cards[0]
+}
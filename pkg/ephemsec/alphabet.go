@@ -14,6 +14,18 @@ const (
 	NullAlphabet    = Alphabet("")
 )
 
+// foldRunes maps characters that users confuse with Alphabet characters.
+// Folding only applies to characters that are not in the Alphabet, and only if the folded
+// character is in the Alphabet, eg B32Alphabet (Crockford) folds O to 0 and I, L to 1.
+var foldRunes = map[rune]rune{
+	'O': '0',
+	'o': '0',
+	'I': '1',
+	'i': '1',
+	'L': '1',
+	'l': '1',
+}
+
 // Alphabet defines a mapping in between unicode characters and bytes.
 // Alphabet are used to convert OTP to text.
 type Alphabet string
@@ -60,11 +72,14 @@ func (self Alphabet) Format(digits []byte, group int, sep rune) (string, error)
 // is not sufficient to hold decoded digits.
 //
 // Decode ignores sep and ' ' characters present in otp string. When Decode encounters a
-// a character not present in the Alphabet, it retries decoding it toggling its case.
+// a character not present in the Alphabet, it retries decoding it toggling its case, then
+// folding it to the Alphabet character it is commonly confused with.
+//
+// Decode errors wrap ErrMalformedCode.
 func (self Alphabet) Decode(otp string, sep rune, size int, dst []byte) ([]byte, error) {
 	if len(otp) > maxOtpBytes {
 		// this check mitigates DOS attacks where attackers would submit very large otp...
-		return nil, newError("otp is too large")
+		return nil, wrapError(ErrMalformedCode, "otp is too large")
 	}
 
 	alphabet := string(self)
@@ -81,8 +96,14 @@ func (self Alphabet) Decode(otp string, sep rune, size int, dst []byte) ([]byte,
 			if -1 == pos {
 				// try toggling the case
 				pos = strings.IndexRune(alphabet, toggleCase(char))
+			}
+			if -1 == pos {
+				// try folding confusable character
+				if folded, found := foldRunes[char]; found {
+					pos = strings.IndexRune(alphabet, folded)
+				}
 				if -1 == pos {
-					return nil, newError("otp has invalid character")
+					return nil, wrapError(ErrMalformedCode, "otp has invalid character")
 				}
 			}
 			dst = append(dst, byte(pos))
@@ -91,16 +112,83 @@ func (self Alphabet) Decode(otp string, sep rune, size int, dst []byte) ([]byte,
 	}
 
 	if digitcount < size {
-		return nil, newError("otp is too small")
+		return nil, wrapError(ErrMalformedCode, "otp is too small")
 	}
 
 	return dst, nil
 }
 
+// CheckDigit returns the Luhn mod N check digit of digits, N being the Alphabet size.
+// The check digit detects all single digit errors and most adjacent transpositions.
+// It errors if the Alphabet size is odd or if digits contains values not compatible with
+// the Alphabet size.
+func (self Alphabet) CheckDigit(digits []byte) (byte, error) {
+	n := self.Size()
+	if 0 != n%2 {
+		return 0, newError("invalid alphabet, Luhn mod N requires an even size")
+	}
+	sum, err := luhnSum(digits, n, 2)
+	if nil != err {
+		return 0, err
+	}
+
+	return byte((n - sum) % n), nil
+}
+
+// FormatCheck transforms digits into text, appending the digits CheckDigit.
+// group & sep are used as in Format, the check digit counts as a regular character.
+func (self Alphabet) FormatCheck(digits []byte, group int, sep rune) (string, error) {
+	check, err := self.CheckDigit(digits)
+	if nil != err {
+		return "", wrapError(err, "failed CheckDigit calculation")
+	}
+	var buf [maxOtpBytes + 1]byte
+	checked := append(append(buf[:0], digits...), check)
+
+	return self.Format(checked, group, sep)
+}
+
+// DecodeCheck decodes otp as Decode does, expecting size digits followed by their CheckDigit.
+// It appends the size digits to dst, the check digit is dropped.
+// It errors wrapping ErrMalformedCode if otp can not be decoded or if its check digit is invalid.
+func (self Alphabet) DecodeCheck(otp string, sep rune, size int, dst []byte) ([]byte, error) {
+	n := self.Size()
+	if 0 != n%2 {
+		return nil, newError("invalid alphabet, Luhn mod N requires an even size")
+	}
+	start := len(dst)
+	dst, err := self.Decode(otp, sep, size+1, dst)
+	if nil != err {
+		return nil, err
+	}
+	sum, err := luhnSum(dst[start:], n, 1)
+	if nil != err || 0 != sum {
+		return nil, wrapError(ErrMalformedCode, "otp has invalid check digit")
+	}
+
+	return dst[:len(dst)-1], nil
+}
+
 func (self Alphabet) Size() int {
 	return len([]rune(self))
 }
 
+// luhnSum returns the Luhn mod n sum of digits, factor is applied to the rightmost digit.
+func luhnSum(digits []byte, n int, factor int) (int, error) {
+	var sum int
+	for pos := len(digits) - 1; pos >= 0; pos-- {
+		digit := int(digits[pos])
+		if digit >= n {
+			return 0, newError("invalid digit index at position %d", pos)
+		}
+		addend := factor * digit
+		sum += addend/n + addend%n
+		factor = 3 - factor // alternates 2 & 1
+	}
+
+	return sum % n, nil
+}
+
 func toggleCase(r rune) rune {
 	switch {
 	case unicode.IsUpper(r):
@@ -1,6 +1,7 @@
 package ephemsec
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -191,3 +192,83 @@ func TestAlphabetDecode(t *testing.T) {
 		})
 	}
 }
+
+func TestAlphabetDecodeFolding(t *testing.T) {
+	testcases := []struct {
+		alphabet Alphabet
+		otp      string
+		expect   []byte
+		fail     bool
+	}{
+		{alphabet: B32Alphabet, otp: "O1IL-oil0", expect: []byte{0, 1, 1, 1, 0, 1, 1, 0}},
+		{alphabet: B10Alphabet, otp: "1O2I3l45", expect: []byte{1, 0, 2, 1, 3, 1, 4, 5}},
+		{alphabet: B32Alphabet, otp: "0123-456U", fail: true}, // U is not folded
+		{alphabet: Alphabet("OIL0"), otp: "OIL0-oil0", expect: []byte{0, 1, 2, 3, 0, 1, 2, 3}},
+	}
+	for pos, tc := range testcases {
+		digits, err := tc.alphabet.Decode(tc.otp, '-', 8, nil)
+		if tc.fail {
+			if !errors.Is(err, ErrMalformedCode) {
+				t.Errorf("case#%d: failed Decode error control, got error %v", pos, err)
+			}
+			continue
+		}
+		if nil != err {
+			t.Errorf("case#%d: failed Decode, got error %v", pos, err)
+			continue
+		}
+		if !reflect.DeepEqual(digits, tc.expect) {
+			t.Errorf("case#%d: failed digits control, got %v", pos, digits)
+		}
+	}
+}
+
+func TestAlphabetCheckDigit(t *testing.T) {
+	for _, alphabet := range []Alphabet{B10Alphabet, B16Alphabet, B32Alphabet} {
+		t.Run(fmt.Sprintf("B%d", alphabet.Size()), func(t *testing.T) {
+			n := alphabet.Size()
+			digits := make([]byte, 8)
+			for pos := range digits {
+				digits[pos] = byte((7*pos + 3) % n)
+			}
+			otp, err := alphabet.FormatCheck(digits, 3, '-')
+			if nil != err {
+				t.Fatalf("failed FormatCheck, got error %v", err)
+			}
+			decoded, err := alphabet.DecodeCheck(otp, '-', len(digits), nil)
+			if nil != err {
+				t.Fatalf("failed DecodeCheck, got error %v", err)
+			}
+			if !reflect.DeepEqual(digits, decoded) {
+				t.Fatalf("failed digits control, got %v", decoded)
+			}
+
+			// all single digit substitutions are detected
+			check, _ := alphabet.CheckDigit(digits)
+			checked := append(append([]byte{}, digits...), check)
+			for pos := range checked {
+				for delta := 1; delta < n; delta++ {
+					altered := append([]byte{}, checked...)
+					altered[pos] = byte((int(altered[pos]) + delta) % n)
+					code, _ := alphabet.Format(altered, 0, '-')
+					_, err = alphabet.DecodeCheck(code, '-', len(digits), nil)
+					if !errors.Is(err, ErrMalformedCode) {
+						t.Fatalf("undetected substitution at position %d, got error %v", pos, err)
+					}
+				}
+			}
+
+			// missing check digit
+			code, _ := alphabet.Format(digits, 0, '-')
+			_, err = alphabet.DecodeCheck(code, '-', len(digits), nil)
+			if !errors.Is(err, ErrMalformedCode) {
+				t.Fatalf("failed missing check digit control, got error %v", err)
+			}
+		})
+	}
+
+	_, err := Alphabet("abc").CheckDigit([]byte{0, 1})
+	if nil == err {
+		t.Fatal("failed odd alphabet control, got nil error")
+	}
+}
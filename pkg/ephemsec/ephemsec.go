@@ -67,15 +67,15 @@ func (self *State) EPHEMSEC(scheme *Scheme, role role, dst []byte) ([]byte, erro
 }
 
 // runDH run the scheme Diffie-Hellmann key exchanges using state keys and save the resulting
-// secrets into the state. It appends the state Psk to such secrets.
+// secrets into the state. It appends the scheme KEM shared secret and the state Psk to such secrets.
 func (self *State) runDH(sch Scheme, role role) error {
 
 	var keyexch string
 	switch role {
 	case Initiator:
-		keyexch = "I" + sch.kx
+		keyexch = "I" + sch.DHPattern()
 	case Responder:
-		keyexch = "R" + sch.kx
+		keyexch = "R" + sch.DHPattern()
 	}
 
 	// alias the DH exchange keys
@@ -150,6 +150,14 @@ func (self *State) runDH(sch Scheme, role role) error {
 		return newError("scheme has invalid K %s", sch.kx)
 	}
 
+	if nil != sch.kem {
+		err = self.runKem(sch, role)
+		if nil != err {
+			return wrapError(err, "failed runKem")
+		}
+		ikm = append(ikm, self.KemSecret...)
+	}
+
 	psz := len(self.Psk)
 	if psz < minPSK || psz > maxPSK {
 		return newError("Psk length %d not in %d..%d range", psz, minPSK, maxPSK)
@@ -164,3 +172,36 @@ func (self *State) runDH(sch Scheme, role role) error {
 
 	return nil
 }
+
+// runKem sets the state KemSecret. The Initiator encapsulates a new KemSecret to the Responder
+// RemoteKemKey if KemSecret is empty, the Responder decapsulates KemCiphertext.
+func (self *State) runKem(sch Scheme, role role) error {
+	kem := sch.kem
+	var err error
+	switch role {
+	case Initiator:
+		if 0 != len(self.KemSecret) {
+			return nil
+		}
+		if len(self.RemoteKemKey) != kem.PublicKeyLen() {
+			return newError("invalid RemoteKemKey")
+		}
+		self.KemSecret, self.KemCiphertext, err = kem.Encapsulate(self.RemoteKemKey)
+		if nil != err {
+			return wrapError(err, "failed Kem encapsulation")
+		}
+	case Responder:
+		if nil == self.KemKey {
+			return newError("missing KemKey")
+		}
+		if len(self.KemCiphertext) != kem.CiphertextLen() {
+			return newError("invalid KemCiphertext")
+		}
+		self.KemSecret, err = self.KemKey.Decapsulate(self.KemCiphertext)
+		if nil != err {
+			return wrapError(err, "failed Kem decapsulation")
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package ephemsec
 
 import (
 	"crypto/ecdh"
+	"crypto/rand"
 	"fmt"
 	"reflect"
 	"testing"
@@ -33,6 +34,80 @@ func TestEphemSecVect02(t *testing.T) {
 	}
 }
 
+func TestEphemSecVect03(t *testing.T) {
+	vectors, err := LoadTestVectors("testdata/ephemsec-kem-vectors.json")
+	if nil != err {
+		t.Fatalf("Failed loading ephemsec-kem-vectors.json, got error %v", err)
+	}
+	for tn, vec := range vectors {
+		t.Run(fmt.Sprintf("[%d]%s", tn, vec.SchemeName), func(t *testing.T) {
+			testVector(t, vec)
+		})
+	}
+}
+
+func TestEphemSecKem(t *testing.T) {
+	scheme, err := NewScheme("Kerpass_BLAKE2s_X25519+MLKEM768_E1S1K1_T600B32P9")
+	if nil != err {
+		t.Fatalf("Failed NewScheme, got error %v", err)
+	}
+	curve := scheme.Curve()
+	kemKey, err := scheme.Kem().GenerateKey()
+	if nil != err {
+		t.Fatalf("Failed generating KemKey, got error %v", err)
+	}
+	e, _ := curve.GenerateKey(rand.Reader)
+	s, _ := curve.GenerateKey(rand.Reader)
+	psk := make([]byte, 32)
+	nonce := make([]byte, 32)
+	ts := int64(1700000000)
+	_, sh := scheme.Time(ts)
+
+	// Initiator generates KemCiphertext
+	istate := State{
+		Nonce:           nonce,
+		Time:            ts,
+		SynchroHint:     sh,
+		EphemKey:        e,
+		RemoteStaticKey: s.PublicKey(),
+		RemoteKemKey:    kemKey.PublicKey(),
+		Psk:             psk,
+	}
+	nokem := istate
+	_, err = nokem.EPHEMSEC(scheme, Responder, nil)
+	if nil == err {
+		t.Fatal("Responder EPHEMSEC succeeded without KemKey")
+	}
+	isec, err := istate.EPHEMSEC(scheme, Initiator, nil)
+	if nil != err {
+		t.Fatalf("Failed Initiator EPHEMSEC, got error %v", err)
+	}
+	if scheme.Kem().CiphertextLen() != len(istate.KemCiphertext) {
+		t.Fatal("Failed KemCiphertext size control")
+	}
+
+	// Responder decapsulates KemCiphertext
+	rstate := State{
+		Nonce:          nonce,
+		Time:           ts,
+		StaticKey:      s,
+		RemoteEphemKey: e.PublicKey(),
+		KemKey:         kemKey,
+		KemCiphertext:  istate.KemCiphertext,
+		Psk:            psk,
+	}
+	rsec, err := rstate.EPHEMSEC(scheme, Responder, nil)
+	if nil != err {
+		t.Fatalf("Failed Responder EPHEMSEC, got error %v", err)
+	}
+	if !reflect.DeepEqual(istate.KemSecret, rstate.KemSecret) {
+		t.Fatal("Failed KemSecret match")
+	}
+	if !reflect.DeepEqual(isec, rsec) {
+		t.Fatal("Failed initiator/responder secret match")
+	}
+}
+
 func testVector(t *testing.T, vec TestVector) {
 	scheme, err := NewScheme(vec.SchemeName)
 	if nil != err {
@@ -52,6 +127,9 @@ func testVector(t *testing.T, vec TestVector) {
 		RemoteEphemKey:  mustLoadPubKey(t, curve, vec.InitiatorRemoteEphemKey, "initiator remote ephem key"),
 		RemoteStaticKey: mustLoadPubKey(t, curve, vec.InitiatorRemoteStaticKey, "initiator remote static key"),
 		Psk:             []byte(vec.Psk),
+		RemoteKemKey:    []byte(vec.InitiatorRemoteKemKey),
+		KemCiphertext:   []byte(vec.KemCiphertext),
+		KemSecret:       []byte(vec.KemSecret),
 	}
 	isec, err := istate.EPHEMSEC(scheme, Initiator, nil)
 	if nil != err {
@@ -71,6 +149,13 @@ func testVector(t *testing.T, vec TestVector) {
 		RemoteEphemKey:  mustLoadPubKey(t, curve, vec.ResponderRemoteEphemKey, "responder remote ephem key"),
 		RemoteStaticKey: mustLoadPubKey(t, curve, vec.ResponderRemoteStaticKey, "responder remote static key"),
 		Psk:             []byte(vec.Psk),
+		KemCiphertext:   []byte(vec.KemCiphertext),
+	}
+	if len(vec.ResponderKemKey) > 0 {
+		rstate.KemKey, err = scheme.Kem().NewKey([]byte(vec.ResponderKemKey))
+		if nil != err {
+			t.Fatalf("Failed loading responder KemKey, got error %v", err)
+		}
 	}
 	rsec, err := rstate.EPHEMSEC(scheme, Responder, nil)
 	if nil != err {
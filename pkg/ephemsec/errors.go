@@ -9,8 +9,9 @@ type errorFlag string
 
 const (
 	// All package errors are wrapping Error
-	Error   = errorFlag("ephemsec: error")
-	noError = errorFlag("")
+	Error            = errorFlag("ephemsec: error")
+	ErrMalformedCode = errorFlag("ephemsec: Malformed code")
+	noError          = errorFlag("")
 )
 
 // Error implements the error interface.
@@ -53,6 +53,10 @@ const (
 	SHA512_256_X25519_E2S2_T1024B256P33 = uint16(0x3321)
 	BLAKE2S_X25519_E2S2_T1024B256P33    = uint16(0x3331)
 	BLAKE2B_X25519_E2S2_T1024B256P33    = uint16(0x3341)
+
+	// hybrid post quantum schemes have no short code yet, the airgap & SLP messages do not carry
+	// the Card KEM public key nor the KEM ciphertext. Their short codes will use the K1 patterns
+	// (4, 5, 6) and the X25519+MLKEM768 curve (2). Meanwhile, they are usable through NewScheme.
 )
 
 // GetScheme returns the EPHEMSEC scheme that corresponds to code.
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"slices"
 	"strconv"
+	"strings"
 
 	"code.kerpass.org/golang/internal/algos"
 )
@@ -20,7 +21,7 @@ const (
 
 var (
 	schemeRe = regexp.MustCompile(
-		`Kerpass_([A-Za-z0-9/]+)_([A-Za-z0-9/]+)_(E[1-2]S[1-2])_T([0-9]+)B([0-9]+)P([0-9]+)`,
+		`Kerpass_([A-Za-z0-9/]+)_([A-Za-z0-9/+]+)_(E[1-2]S[1-2](?:K1)?)_T([0-9]+)B([0-9]+)P([0-9]+)`,
 	)
 )
 
@@ -47,11 +48,16 @@ type Scheme struct {
 	// dhn Diffie-Hellman Key Exchange function name
 	dhn string
 
+	// kemn Key Encapsulation Mechanism name
+	// kemn is empty if the Scheme does not use a KEM
+	kemn string
+
 	// kx Diffie-Hellman Key Exchange requirements
 	// kx defines the number of Ephemeral & Static keys used to derive the shared secret
 	// kx is a string of form E1S2
 	//   E prefix is followed by the number (1 or 2) of ephemeral keys used in the exchange
 	//   S prefix is followed by the number (1 or 2) of static keys used in the exchange
+	//   optional K1 suffix indicates that a KEM shared secret is mixed with the DH shared secrets
 	kx string
 
 	// tw timeWindow size in seconds
@@ -77,6 +83,10 @@ type Scheme struct {
 	// loaded from registry using dhn as name
 	curve algos.Curve
 
+	// Kem implementation
+	// loaded from registry using kemn as name, nil if kemn is empty
+	kem algos.Kem
+
 	// pre calculated OTP step
 	step float64
 
@@ -92,9 +102,11 @@ type Scheme struct {
 //
 //	Kerpass_SHA512/256_X25519_E1S2_T400B32P8
 //	  1st subgroup (eg SHA512/256) is the name of the Scheme Hash function
-//	  2nd subgroup (eg X25519) is the name of the Scheme Diffie-Hellmann function
+//	  2nd subgroup (eg X25519) is the name of the Scheme Diffie-Hellmann function,
+//	    hybrid post quantum Scheme append the KEM name (eg X25519+MLKEM768)
 //	  3rd subgroup (eg E1S2) details Diffie-Hellmann key exchange requirements,
-//	    E is the number of ephemeral keys and S the number of static keys
+//	    E is the number of ephemeral keys and S the number of static keys,
+//	    hybrid post quantum Scheme add a K1 suffix (eg E1S2K1)
 //	  4th subgroup (eg T400) is the size of the OTP/OTK validation time window in seconds
 //	  5th subgroup (eg B32) is the OTP encoding alphabet
 //	  6th subgroup (eg P8) is the number of digits of the generated OTP/OTK
@@ -112,8 +124,8 @@ func NewScheme(name string) (*Scheme, error) {
 	// hn
 	rv.hn = parts[schH]
 
-	// dhn & curve
-	rv.dhn = parts[schD]
+	// dhn & kemn
+	rv.dhn, rv.kemn, _ = strings.Cut(parts[schD], "+")
 
 	// kx
 	rv.kx = parts[schK]
@@ -172,6 +184,17 @@ func (self *Scheme) init() error {
 	}
 	self.curve = curve
 
+	// kem reload
+	if "" != self.kemn {
+		kem, err := algos.GetKem(self.kemn)
+		if nil != err {
+			return wrapError(err, "error loading Kem %s", self.kemn)
+		}
+		self.kem = kem
+	} else {
+		self.kem = nil
+	}
+
 	// name validation
 	if self.name == "" || len(self.name) > maxSchemeName {
 		return newError("invalid name, empty or longer than %d bytes", maxSchemeName)
@@ -180,7 +203,13 @@ func (self *Scheme) init() error {
 	// kx validation
 	switch self.kx {
 	case "E1S1", "E1S2", "E2S2":
-		// ok
+		if nil != self.kem {
+			return newError("kx %s does not use Kem %s", self.kx, self.kemn)
+		}
+	case "E1S1K1", "E1S2K1", "E2S2K1":
+		if nil == self.kem {
+			return newError("kx %s requires a Kem", self.kx)
+		}
 	default:
 		return newError("non supported kx %s", self.kx)
 	}
@@ -232,11 +261,17 @@ func (self Scheme) Name() string {
 }
 
 // KeyExchangePattern returns the Scheme Key Exchange pattern.
-// Possible values are E1S1, E1S2 & E2S2.
+// Possible values are E1S1, E1S2, E2S2 and their hybrid post quantum variants E1S1K1, E1S2K1 & E2S2K1.
 func (self Scheme) KeyExchangePattern() string {
 	return self.kx
 }
 
+// DHPattern returns the Diffie-Hellmann part of the Scheme Key Exchange pattern.
+// Possible values are E1S1, E1S2 & E2S2.
+func (self Scheme) DHPattern() string {
+	return strings.TrimSuffix(self.kx, "K1")
+}
+
 // T returns the Scheme Time Window size in seconds.
 func (self Scheme) T() float64 {
 	return self.tw
@@ -247,6 +282,21 @@ func (self Scheme) B() int {
 	return self.eb
 }
 
+// Alphabet returns the Alphabet used to display the Scheme OTP.
+// It returns NullAlphabet for OTK Scheme which code is binary.
+func (self Scheme) Alphabet() Alphabet {
+	switch self.eb {
+	case 10:
+		return B10Alphabet
+	case 16:
+		return B16Alphabet
+	case 32:
+		return B32Alphabet
+	default:
+		return NullAlphabet
+	}
+}
+
 // P returns the Scheme code size.
 func (self Scheme) P() int {
 	return self.nd
@@ -257,6 +307,11 @@ func (self Scheme) Curve() algos.Curve {
 	return self.curve
 }
 
+// Kem returns the Scheme Kem, it returns nil if the Scheme does not use a Kem.
+func (self Scheme) Kem() algos.Kem {
+	return self.kem
+}
+
 // Hash returns the Scheme hash.
 func (self Scheme) Hash() crypto.Hash {
 	return self.hash
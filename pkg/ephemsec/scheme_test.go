@@ -29,6 +29,28 @@ func TestNewScheme(t *testing.T) {
 				tw: 600, eb: 10, nd: 8,
 			},
 		},
+		{
+			name: "Kerpass_SHA512_X25519+MLKEM768_E1S1K1_T600B32P9",
+			expect: Scheme{
+				hn: "SHA512", dhn: "X25519", kemn: "MLKEM768", kx: "E1S1K1",
+				tw: 600, eb: 32, nd: 9,
+			},
+		},
+		{
+			// fail due to K1 pattern without KEM
+			name: "Kerpass_SHA512_X25519_E1S1K1_T600B32P9",
+			fail: true,
+		},
+		{
+			// fail due to KEM without K1 pattern
+			name: "Kerpass_SHA512_X25519+MLKEM768_E1S1_T600B32P9",
+			fail: true,
+		},
+		{
+			// fail due to unknown KEM
+			name: "Kerpass_SHA512_X25519+unknown_E1S1K1_T600B32P9",
+			fail: true,
+		},
 		{
 			// fail due to missing Kerpass prefix
 			name: "Nopass_SHA256_X25519_E1S1_T400B10P8",
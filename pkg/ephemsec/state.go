@@ -4,6 +4,8 @@ import (
 	"crypto/ecdh"
 	"encoding/binary"
 	"time"
+
+	"code.kerpass.org/golang/internal/algos"
 )
 
 var (
@@ -44,7 +46,23 @@ type State struct {
 	// psk credential
 	Psk []byte
 
-	// ikm provides storage for 2 DH shared secrets and 1 PSK
+	// local static KEM key
+	// used by the Responder of hybrid Scheme to decapsulate KemCiphertext
+	KemKey algos.KemKey
+
+	// remote static KEM public key
+	// used by the Initiator of hybrid Scheme to generate KemSecret & KemCiphertext
+	RemoteKemKey []byte
+
+	// KEM ciphertext
+	// generated by the Initiator and forwarded to the Responder
+	KemCiphertext []byte
+
+	// KEM shared secret
+	// generated by the Initiator if empty, recovered by the Responder from KemCiphertext
+	KemSecret []byte
+
+	// ikm provides storage for 2 DH shared secrets, 1 KEM shared secret and 1 PSK
 	// maximum DH shared secret size is assumed to be 66 bytes (P-521 case)
 	// ikm is used as 'secret' input for HKDF output derivation
 	ikm [maxIKM]byte
@@ -84,6 +102,10 @@ func (self *State) Reset() {
 	self.RemoteEphemKey = nil
 	self.RemoteStaticKey = nil
 	self.Psk = nil
+	self.KemKey = nil
+	self.RemoteKemKey = nil
+	self.KemCiphertext = nil
+	self.KemSecret = nil
 	self.Nonce = nil
 	self.SynchroHint = missing
 	self.Message = nil
@@ -29,6 +29,12 @@ type TestVector struct {
 	HkdfSalt                 utils.HexBinary `json:"hkdf_salt"`
 	HkdfInfo                 utils.HexBinary `json:"hkdf_info"`
 	HkdfSecret               utils.HexBinary `json:"hkdf_secret"`
+
+	// hybrid Scheme fields, the responder KemKey is encoded using its seed
+	ResponderKemKey       utils.HexBinary `json:"resp_kem_key,omitempty"`
+	InitiatorRemoteKemKey utils.HexBinary `json:"init_remote_kem_key,omitempty"`
+	KemCiphertext         utils.HexBinary `json:"kem_ciphertext,omitempty"`
+	KemSecret             utils.HexBinary `json:"kem_secret,omitempty"`
 }
 
 // LoadTestVector loads test vectors from json file at srcpath.
@@ -0,0 +1,172 @@
+package ephemsec
+
+import (
+	"crypto/ecdh"
+	"crypto/subtle"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Verifier checks OTP/OTK generated by a Card application acting as EPHEMSEC Responder.
+//
+// Verifier runs EPHEMSEC as Initiator and does not depend on KerPass authentication sessions,
+// this allows applications such as VPN or SSH PAM modules to embed KerPass code verification.
+type Verifier struct {
+	// Scheme used to generate the verified codes
+	Scheme *Scheme
+
+	// Separator is ignored when decoding user typed codes, as is ' '
+	Separator rune
+
+	// CheckDigit is true if user typed codes end with an Alphabet CheckDigit
+	CheckDigit bool
+}
+
+// VerifierParams holds the Initiator inputs of a Verifier check.
+type VerifierParams struct {
+	// Context is application defined
+	Context []byte
+
+	// Nonce transmitted to the Responder
+	Nonce []byte
+
+	// Unix timestamp
+	// if zero, system Unix time is used
+	Time int64
+
+	// local ephemeral key
+	EphemKey *ecdh.PrivateKey
+
+	// local static key
+	// required by E1S2 & E2S2 Scheme
+	StaticKey *ecdh.PrivateKey
+
+	// Card ephemeral key
+	// required by E2S2 Scheme
+	RemoteEphemKey *ecdh.PublicKey
+
+	// Card static key
+	RemoteStaticKey *ecdh.PublicKey
+
+	// Card psk
+	Psk []byte
+
+	// KEM shared secret encapsulated to the Card KEM key
+	// required by hybrid Scheme
+	KemSecret []byte
+}
+
+// VerifierResult holds the outcome of a Verifier check.
+type VerifierResult struct {
+	// Match is true if the verified code is valid
+	Match bool
+
+	// PTime is the pseudo time derived from the code synchronization hint
+	PTime int64
+
+	// Time is the Unix timestamp that corresponds to PTime
+	Time int64
+}
+
+// Check returns an error if the Verifier is invalid.
+func (self *Verifier) Check() error {
+	if nil == self {
+		return newError("nil Verifier")
+	}
+	if nil == self.Scheme || !self.Scheme.initialized {
+		return newError("invalid Scheme")
+	}
+
+	return nil
+}
+
+// Verify checks the user typed code against the code derived from params.
+//
+// code is decoded using the Scheme Alphabet, Separator & ' ' characters are ignored
+// and characters not found in the Alphabet are retried with toggled case & folding.
+// It errors wrapping ErrMalformedCode if code can not be decoded or if its check digit is invalid,
+// this allows distinguishing typing mistakes from wrong codes.
+// It also errors if code derivation fails.
+func (self *Verifier) Verify(params *VerifierParams, code string) (VerifierResult, error) {
+	err := self.Check()
+	if nil != err {
+		return VerifierResult{}, wrapError(err, "failed Verifier validation")
+	}
+	alphabet := self.Scheme.Alphabet()
+	if NullAlphabet == alphabet {
+		return VerifierResult{}, newError("Scheme %s code is binary", self.Scheme.name)
+	}
+
+	// reject codes with trailing characters that Decode would ignore
+	code = strings.Map(func(r rune) rune {
+		if ' ' == r || self.Separator == r {
+			return -1
+		}
+		return r
+	}, code)
+	size := self.Scheme.nd
+	if self.CheckDigit {
+		size += 1
+	}
+	if utf8.RuneCountInString(code) != size {
+		return VerifierResult{}, wrapError(ErrMalformedCode, "invalid code length")
+	}
+
+	var buf [maxOtpBytes]byte
+	var digits []byte
+	if self.CheckDigit {
+		digits, err = alphabet.DecodeCheck(code, self.Separator, self.Scheme.nd, buf[:0])
+	} else {
+		digits, err = alphabet.Decode(code, self.Separator, self.Scheme.nd, buf[:0])
+	}
+	if nil != err {
+		return VerifierResult{}, wrapError(err, "failed decoding code")
+	}
+
+	return self.VerifyDigits(params, digits)
+}
+
+// VerifyDigits checks the code digits against the code derived from params.
+// The last digit of the code is the Responder synchronization hint.
+// It errors if digits has invalid length or if code derivation fails.
+func (self *Verifier) VerifyDigits(params *VerifierParams, digits []byte) (VerifierResult, error) {
+	var rv VerifierResult
+	err := self.Check()
+	if nil != err {
+		return rv, wrapError(err, "failed Verifier validation")
+	}
+	if nil == params {
+		return rv, newError("nil VerifierParams")
+	}
+	sch := self.Scheme
+	if len(digits) != sch.nd {
+		return rv, newError("invalid digits length %d != %d", len(digits), sch.nd)
+	}
+	if nil != sch.kem && 0 == len(params.KemSecret) {
+		return rv, newError("missing KemSecret")
+	}
+
+	state := State{
+		Context:         params.Context,
+		Nonce:           params.Nonce,
+		Time:            params.Time,
+		SynchroHint:     int(digits[sch.nd-1]),
+		EphemKey:        params.EphemKey,
+		StaticKey:       params.StaticKey,
+		RemoteEphemKey:  params.RemoteEphemKey,
+		RemoteStaticKey: params.RemoteStaticKey,
+		Psk:             params.Psk,
+		KemSecret:       params.KemSecret,
+	}
+	var buf [otkMaxBytes]byte
+	expected, err := state.EPHEMSEC(sch, Initiator, buf[:0])
+	if nil != err {
+		return rv, wrapError(err, "failed code derivation")
+	}
+	rv.Match = 1 == subtle.ConstantTimeCompare(expected, digits)
+	rv.PTime = state.ptime
+	rv.Time = int64(math.Round(float64(state.ptime) * sch.step))
+
+	return rv, nil
+}
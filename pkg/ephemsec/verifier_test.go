@@ -0,0 +1,138 @@
+package ephemsec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVerifierVect(t *testing.T) {
+	for _, path := range []string{"testdata/ephemsec-vectors.json", "testdata/ephemsec-kem-vectors.json"} {
+		vectors, err := LoadTestVectors(path)
+		if nil != err {
+			t.Fatalf("Failed loading %s, got error %v", path, err)
+		}
+		for tn, vec := range vectors {
+			t.Run(fmt.Sprintf("[%d]%s", tn, vec.SchemeName), func(t *testing.T) {
+				testVerifierVector(t, vec)
+			})
+		}
+	}
+}
+
+func TestVerifierInvalid(t *testing.T) {
+	vectors, err := LoadTestVectors("testdata/ephemsec-vectors.json")
+	if nil != err {
+		t.Fatalf("Failed loading ephemsec-vectors.json, got error %v", err)
+	}
+	vec := vectors[0]
+	scheme, err := NewScheme(vec.SchemeName)
+	if nil != err {
+		t.Fatalf("Failed scheme parsing, got error %v", err)
+	}
+	params := verifierParams(t, scheme, vec)
+	vrf := Verifier{Scheme: scheme, Separator: '-'}
+
+	testcases := []string{
+		"",
+		vec.Otp[1:],
+		vec.Otp + "0",
+		"#" + vec.Otp[1:],
+	}
+	for pos, code := range testcases {
+		_, err = vrf.Verify(params, code)
+		if !errors.Is(err, ErrMalformedCode) {
+			t.Errorf("case#%d: failed Verify error control with invalid code %q, got error %v", pos, code, err)
+		}
+	}
+
+	// check digit
+	vrf.CheckDigit = true
+	digits, err := scheme.Alphabet().Decode(vec.Otp, '-', scheme.P(), nil)
+	if nil != err {
+		t.Fatalf("Failed decoding vector otp, got error %v", err)
+	}
+	code, err := scheme.Alphabet().FormatCheck(digits, 4, '-')
+	if nil != err {
+		t.Fatalf("Failed FormatCheck, got error %v", err)
+	}
+	res, err := vrf.Verify(params, code)
+	if nil != err || !res.Match {
+		t.Fatalf("Failed Verify with check digit, got error %v", err)
+	}
+	_, err = vrf.Verify(params, vec.Otp)
+	if !errors.Is(err, ErrMalformedCode) {
+		t.Errorf("Failed missing check digit control, got error %v", err)
+	}
+
+	_, err = (&Verifier{}).Verify(params, vec.Otp)
+	if nil == err {
+		t.Error("Verify succeeded with nil Scheme")
+	}
+}
+
+func testVerifierVector(t *testing.T, vec TestVector) {
+	scheme, err := NewScheme(vec.SchemeName)
+	if nil != err {
+		t.Fatalf("Failed scheme parsing, got error %v", err)
+	}
+	params := verifierParams(t, scheme, vec)
+	vrf := Verifier{Scheme: scheme, Separator: '-'}
+
+	var res VerifierResult
+	if 256 == scheme.B() {
+		_, err = vrf.Verify(params, vec.Otp)
+		if nil == err {
+			t.Fatal("Verify succeeded for binary code Scheme")
+		}
+		res, err = vrf.VerifyDigits(params, []byte(vec.SharedSecret))
+	} else {
+		// user typed codes may be grouped and have toggled case
+		code := strings.ToLower(vec.Otp[:3]) + "- " + vec.Otp[3:]
+		res, err = vrf.Verify(params, code)
+	}
+	if nil != err {
+		t.Fatalf("Failed Verify, got error %v", err)
+	}
+	if !res.Match {
+		t.Fatal("Failed Verify, code does not match")
+	}
+	_, sh := scheme.Time(vec.ResponderTime)
+	pt, err := scheme.SyncTime(vec.InitiatorTime, sh)
+	if nil != err {
+		t.Fatalf("Failed SyncTime, got error %v", err)
+	}
+	if pt != res.PTime {
+		t.Errorf("Failed PTime control, %d != %d", pt, res.PTime)
+	}
+	if d := res.Time - vec.ResponderTime; d > int64(scheme.T()) || d < -int64(scheme.T()) {
+		t.Errorf("Failed Time control, %d too far from %d", res.Time, vec.ResponderTime)
+	}
+
+	// altered code does not match
+	digits := []byte(vec.SharedSecret)
+	digits[0] = byte((int(digits[0]) + 1) % scheme.B())
+	res, err = vrf.VerifyDigits(params, digits)
+	if nil != err {
+		t.Fatalf("Failed VerifyDigits, got error %v", err)
+	}
+	if res.Match {
+		t.Fatal("Failed VerifyDigits, altered code matches")
+	}
+}
+
+func verifierParams(t *testing.T, scheme *Scheme, vec TestVector) *VerifierParams {
+	curve := scheme.Curve()
+	return &VerifierParams{
+		Context:         []byte(vec.Context),
+		Nonce:           []byte(vec.InitiatorNonce),
+		Time:            vec.InitiatorTime,
+		EphemKey:        mustLoadPrivKey(t, curve, vec.InitiatorEphemKey, "initiator ephem key"),
+		StaticKey:       mustLoadPrivKey(t, curve, vec.InitiatorStaticKey, "initiator static key"),
+		RemoteEphemKey:  mustLoadPubKey(t, curve, vec.InitiatorRemoteEphemKey, "initiator remote ephem key"),
+		RemoteStaticKey: mustLoadPubKey(t, curve, vec.InitiatorRemoteStaticKey, "initiator remote static key"),
+		Psk:             []byte(vec.Psk),
+		KemSecret:       []byte(vec.KemSecret),
+	}
+}
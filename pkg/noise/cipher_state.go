@@ -161,6 +161,19 @@ func (self *CipherState) EncryptWithAd(ad, plaintext []byte) ([]byte, error) {
 		// possible during noise Handshake
 		return plaintext, nil
 	}
+	return self.AppendEncryptWithAd(nil, ad, plaintext)
+}
+
+// AppendEncryptWithAd appends to dst the authenticated encryption of plaintext if the CipherState has a key
+// otherwise it appends plaintext inchanged. It returns the extended buffer.
+//
+// AppendEncryptWithAd does not allocate if dst has sufficient capacity, ie len(plaintext) + 16.
+// To reuse plaintext storage for the ciphertext, use plaintext[:0] as dst.
+func (self *CipherState) AppendEncryptWithAd(dst, ad, plaintext []byte) ([]byte, error) {
+	if !self.HasKey() {
+		// possible during noise Handshake
+		return append(dst, plaintext...), nil
+	}
 	if CIPHER_MAX_NONCE == self.n {
 		return nil, newError("Cipher key over use")
 	}
@@ -170,9 +183,9 @@ func (self *CipherState) EncryptWithAd(ad, plaintext []byte) ([]byte, error) {
 	}
 	nonce := self.nonceb[:]
 	self.aead.FillNonce(nonce, self.n)
-	ciphertext := self.aead.Seal(nil, nonce, plaintext, ad)
+	dst = self.aead.Seal(dst, nonce, plaintext, ad)
 	self.n += 1
-	return ciphertext, nil
+	return dst, nil
 }
 
 // DecryptWithAd performs authenticated decryption of ciphertext if the CipherState has a key otherwise
@@ -186,6 +199,19 @@ func (self *CipherState) DecryptWithAd(ad, ciphertext []byte) ([]byte, error) {
 		// possible during noise Handshake
 		return ciphertext, nil
 	}
+	return self.AppendDecryptWithAd(nil, ad, ciphertext)
+}
+
+// AppendDecryptWithAd appends to dst the authenticated decryption of ciphertext if the CipherState has a key
+// otherwise it appends ciphertext inchanged. It returns the extended buffer.
+//
+// AppendDecryptWithAd does not allocate if dst has sufficient capacity, ie len(ciphertext).
+// To reuse ciphertext storage for the plaintext, use ciphertext[:0] as dst.
+func (self *CipherState) AppendDecryptWithAd(dst, ad, ciphertext []byte) ([]byte, error) {
+	if !self.HasKey() {
+		// possible during noise Handshake
+		return append(dst, ciphertext...), nil
+	}
 	if CIPHER_MAX_NONCE == self.n {
 		return nil, newError("Cipher key over use")
 	}
@@ -195,12 +221,12 @@ func (self *CipherState) DecryptWithAd(ad, ciphertext []byte) ([]byte, error) {
 	}
 	nonce := self.nonceb[:]
 	self.aead.FillNonce(nonce, self.n)
-	plaintext, err := self.aead.Open(nil, nonce, ciphertext, ad)
+	dst, err := self.aead.Open(dst, nonce, ciphertext, ad)
 	if nil != err {
 		return nil, wrapError(err, "failed aead.Open")
 	}
 	self.n += 1 // spec says not to increment if Decrypt fails
-	return plaintext, nil
+	return dst, nil
 }
 
 // Rekey changes the CipherState internal key. It errors if the CipherState does not have a key.
@@ -1,6 +1,7 @@
 package noise
 
 import (
+	"bytes"
 	"errors"
 	"reflect"
 	"testing"
@@ -169,3 +170,71 @@ func TestCipherSizeLimit(t *testing.T) {
 	}
 
 }
+
+func TestCipherStateAppendNoAlloc(t *testing.T) {
+	for _, ciphername := range []string{CIPHER_AES256_GCM, CIPHER_CHACHA20_POLY1305} {
+		t.Run(ciphername, func(t *testing.T) {
+			cipherfactory, err := GetAEADFactory(ciphername)
+			if nil != err {
+				t.Fatalf("Failed loading AEAD factory %s, got error %v", ciphername, err)
+			}
+			var ecs, dcs CipherState
+			for _, cs := range []*CipherState{&ecs, &dcs} {
+				err = cs.Init(cipherfactory)
+				if nil != err {
+					t.Fatalf("Failed cipher.Init, got error %v", err)
+				}
+				err = cs.InitializeKey([]byte(testKey))
+				if nil != err {
+					t.Fatalf("Failed cipher.InitializeKey, got error %v", err)
+				}
+			}
+			plaintext := []byte("a test payload...")
+			ad := []byte(ad1)
+			cbuf := make([]byte, 0, len(plaintext)+cipherTagSize)
+			pbuf := make([]byte, 0, len(plaintext)+cipherTagSize)
+			allocs := testing.AllocsPerRun(100, func() {
+				ciphertext, err := ecs.AppendEncryptWithAd(cbuf[:0], ad, plaintext)
+				if nil != err {
+					t.Fatalf("Failed AppendEncryptWithAd, got error %v", err)
+				}
+				result, err := dcs.AppendDecryptWithAd(pbuf[:0], ad, ciphertext)
+				if nil != err {
+					t.Fatalf("Failed AppendDecryptWithAd, got error %v", err)
+				}
+				if !bytes.Equal(plaintext, result) {
+					t.Fatal("Failed plaintext control")
+				}
+			})
+			if 0 != allocs {
+				t.Fatalf("Failed allocs control, got %v allocs per run", allocs)
+			}
+		})
+	}
+}
+
+func BenchmarkCipherStateAppendEncryptWithAd(b *testing.B) {
+	cipherfactory, err := GetAEADFactory(CIPHER_CHACHA20_POLY1305)
+	if nil != err {
+		b.Fatalf("Failed loading AEAD factory, got error %v", err)
+	}
+	cs := CipherState{}
+	err = cs.Init(cipherfactory)
+	if nil != err {
+		b.Fatalf("Failed cipher.Init, got error %v", err)
+	}
+	err = cs.InitializeKey([]byte(testKey))
+	if nil != err {
+		b.Fatalf("Failed cipher.InitializeKey, got error %v", err)
+	}
+	plaintext := make([]byte, 1024)
+	buf := make([]byte, 0, len(plaintext)+cipherTagSize)
+	b.SetBytes(int64(len(plaintext)))
+	b.ReportAllocs()
+	for b.Loop() {
+		buf, err = cs.AppendEncryptWithAd(buf[:0], nil, plaintext)
+		if nil != err {
+			b.Fatalf("Failed AppendEncryptWithAd, got error %v", err)
+		}
+	}
+}
@@ -9,7 +9,7 @@ import (
 
 var (
 	protoRe = regexp.MustCompile(
-		`Noise_([A-Z0-9]+)([a-z][a-z0-9+]*)?_([A-Za-z0-9/]+)_([A-Za-z0-9/]+)_([A-Za-z0-9/]+)`,
+		`Noise_([A-Z0-9]+)([a-z][a-z0-9+]*)?_([A-Za-z0-9/+]+)_([A-Za-z0-9/]+)_([A-Za-z0-9/]+)`,
 	)
 )
 
@@ -30,11 +30,15 @@ type Config struct {
 
 	// handshake ECDH curve
 	CurveAlgo algos.Curve
+
+	// handshake Key Encapsulation Mechanism, nil if the HandshakePattern does not use KEM tokens.
+	KemAlgo Kem
 }
 
 // Load parse protoname and loads the algorithms it references into the Config.
 //
 // Valid protoname looks like "Noise_XX_25519_AESGCM_SHA256".
+// Hybrid post quantum protoname appends the Kem name to the curve name, eg "Noise_XXhfs_25519+MLKEM768_AESGCM_SHA256".
 // Refers to noise protocol specs section 8, for details on how valid names are formed.
 func (self *Config) Load(protoname string) error {
 	var proto NoiseProto
@@ -75,11 +79,23 @@ func (self *Config) Load(protoname string) error {
 		return wrapError(err, "failed retrieving ECDH curve")
 	}
 
+	var kemAlgo Kem
+	if "" != proto.KemAlgo {
+		kemAlgo, err = GetKem(proto.KemAlgo)
+		if nil != err {
+			return wrapError(err, "failed retrieving Kem algorithm")
+		}
+	}
+	if handshakePattern.UsesKem() != (nil != kemAlgo) {
+		return newError("HandshakePattern KEM tokens do not match protocol Kem algorithm")
+	}
+
 	self.ProtoName = proto.Name
 	self.HandshakePattern = handshakePattern
 	self.CipherFactory = cipherFactory
 	self.HashAlgo = hashAlgo
 	self.CurveAlgo = curveAlgo
+	self.KemAlgo = kemAlgo
 
 	return nil
 }
@@ -91,6 +107,7 @@ type NoiseProto struct {
 	HandshakePattern          string
 	HandshakePatternModifiers []string
 	CurveAlgo                 string
+	KemAlgo                   string
 	CipherAlgo                string
 	HashAlgo                  string
 }
@@ -113,7 +130,7 @@ func ParseProtocol(protoname string, proto *NoiseProto) error {
 		proto.HandshakePatternModifiers = strings.Split(parts[2], "+")
 	}
 	proto.Name = parts[0]
-	proto.CurveAlgo = parts[3]
+	proto.CurveAlgo, proto.KemAlgo, _ = strings.Cut(parts[3], "+")
 	proto.CipherAlgo = parts[4]
 	proto.HashAlgo = parts[5]
 
@@ -36,6 +36,18 @@ func TestParseProtocol(t *testing.T) {
 				HashAlgo:                  "SHA512/256",
 			},
 		},
+		{
+			pn: "Noise_XXhfs_25519+MLKEM768_ChaChaPoly_BLAKE2s",
+			expect: NoiseProto{
+				Name:                      "Noise_XXhfs_25519+MLKEM768_ChaChaPoly_BLAKE2s",
+				HandshakePattern:          "XX",
+				HandshakePatternModifiers: []string{"hfs"},
+				CurveAlgo:                 "25519",
+				KemAlgo:                   "MLKEM768",
+				CipherAlgo:                "ChaChaPoly",
+				HashAlgo:                  "BLAKE2s",
+			},
+		},
 	}
 
 	var err error
@@ -5,10 +5,14 @@ import (
 )
 
 // RMQ:
-// Credentials extraction & verification was integrated to HandshakeState.ReadMessage
+// Credentials extraction & verification is integrated to HandshakeState.ReadMessage
 // While this brings benefits (decrease number of protocol roundtrips and fail early in case of DOS attacks)
 // It adds a new dimension to noise protocols that requires peer reviews.
-// Hence it has been removed.
+// Hence it is opt-in, verifiers are only invoked when HandshakeParams.Verifiers is set.
+//
+// ReadMessage passes a received remote static key to the static key verifier as soon as it is decrypted.
+// After payload decryption, the static key verifier (once it verified the key) then the extension verifier
+// consume leading payload data, for as long as their ReadSize is positive.
 
 // CredentialVerifier is used to track verification state of a certain credential
 // transmitted in an handshake message.
@@ -0,0 +1,229 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestHandshakeStateVerifiers01(t *testing.T) {
+	testVectorsWithVerifiers(t, "testdata/snow.txt")
+}
+
+func TestHandshakeStateVerifiers02(t *testing.T) {
+	testVectorsWithVerifiers(t, "testdata/cacophony.txt")
+}
+
+func TestHandshakeStateMissingKeyVerifier(t *testing.T) {
+	var cfg Config
+	err := cfg.Load("Noise_XX_25519_ChaChaPoly_BLAKE2s")
+	if nil != err {
+		t.Fatalf("failed loading config, got error %v", err)
+	}
+	s, err := cfg.CurveAlgo.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating s, got error %v", err)
+	}
+	hs := HandshakeState{}
+	err = hs.Initialize(HandshakeParams{Cfg: cfg, StaticKeypair: s, Verifiers: &VerifierProvider{}})
+	if !errors.Is(err, errNoStaticKeyVerifier) {
+		t.Fatalf("failed Initialize error control, got error %v", err)
+	}
+}
+
+func TestHandshakeStateRejectKey(t *testing.T) {
+	var cfg Config
+	err := cfg.Load("Noise_XX_25519_ChaChaPoly_BLAKE2s")
+	if nil != err {
+		t.Fatalf("failed loading config, got error %v", err)
+	}
+	var hss [2]HandshakeState
+	for i := range 2 {
+		s, err := cfg.CurveAlgo.GenerateKey(rand.Reader)
+		if nil != err {
+			t.Fatalf("failed generating s, got error %v", err)
+		}
+		vp := &VerifierProvider{}
+		vp.SetVerifier("rs", NewAcceptOrRejectAnyKey())
+		err = hss[i].Initialize(HandshakeParams{Cfg: cfg, Initiator: 0 == i, StaticKeypair: s, Verifiers: vp})
+		if nil != err {
+			t.Fatalf("failed hss[%d] Initialize, got error %v", i, err)
+		}
+	}
+
+	// <- e, ee, s, es fails early as the initiator rejects the responder static key
+	var msg bytes.Buffer
+	_, err = hss[0].WriteMessage(nil, &msg)
+	if nil != err {
+		t.Fatalf("failed WriteMessage, got error %v", err)
+	}
+	_, err = hss[1].ReadMessage(msg.Bytes(), new(bytes.Buffer))
+	if nil != err {
+		t.Fatalf("failed ReadMessage, got error %v", err)
+	}
+	msg.Reset()
+	_, err = hss[1].WriteMessage(nil, &msg)
+	if nil != err {
+		t.Fatalf("failed WriteMessage, got error %v", err)
+	}
+	_, err = hss[0].ReadMessage(msg.Bytes(), new(bytes.Buffer))
+	if !errors.Is(err, errNoStaticKeyVerifier) {
+		t.Fatalf("failed ReadMessage error control, got error %v", err)
+	}
+}
+
+func TestHandshakeStateVerifierLoadsPsk(t *testing.T) {
+	var cfg Config
+	err := cfg.Load("Noise_XXpsk3_25519_ChaChaPoly_BLAKE2s")
+	if nil != err {
+		t.Fatalf("failed loading config, got error %v", err)
+	}
+	psk := make([]byte, pskKeySize)
+	rand.Read(psk)
+	var keys [2]*Keypair
+	for i := range 2 {
+		keys[i], err = cfg.CurveAlgo.GenerateKey(rand.Reader)
+		if nil != err {
+			t.Fatalf("failed generating s, got error %v", err)
+		}
+	}
+
+	// initiator knows the psk
+	var hss [2]HandshakeState
+	ivp := &VerifierProvider{}
+	ivp.SetVerifier("rs", &testVerifier{sizes: []int{cfg.CurveAlgo.PublicKeyLen()}})
+	err = hss[0].Initialize(HandshakeParams{
+		Cfg:           cfg,
+		Initiator:     true,
+		StaticKeypair: keys[0],
+		Psks:          [][]byte{psk},
+		Verifiers:     ivp,
+	})
+	if nil != err {
+		t.Fatalf("failed initiator Initialize, got error %v", err)
+	}
+
+	// responder reads the initiator user id, and loads the psk when verifying its static key
+	rkv := &testVerifier{sizes: []int{cfg.CurveAlgo.PublicKeyLen()}, psk: psk}
+	rev := &testVerifier{sizes: []int{4}}
+	rvp := &VerifierProvider{}
+	rvp.SetVerifier("rs", rkv)
+	rvp.SetVerifier("id", rev)
+	rvp.SetLoaders("psk")
+	err = hss[1].Initialize(HandshakeParams{
+		Cfg:           cfg,
+		Initiator:     false,
+		StaticKeypair: keys[1],
+		Verifiers:     rvp,
+	})
+	if nil != err {
+		t.Fatalf("failed responder Initialize, got error %v", err)
+	}
+
+	payloads := []string{"usr1hello", "world", "done"}
+	expects := []string{"hello", "world", "done"}
+	var msg, payload bytes.Buffer
+	for pos := range payloads {
+		msg.Reset()
+		payload.Reset()
+		_, err = hss[pos%2].WriteMessage([]byte(payloads[pos]), &msg)
+		if nil != err {
+			t.Fatalf("msg[%d]: failed WriteMessage, got error %v", pos, err)
+		}
+		_, err = hss[(pos+1)%2].ReadMessage(msg.Bytes(), &payload)
+		if nil != err {
+			t.Fatalf("msg[%d]: failed ReadMessage, got error %v", pos, err)
+		}
+		if expects[pos] != payload.String() {
+			t.Fatalf("msg[%d]: failed payload control, got %q", pos, payload.String())
+		}
+	}
+	if !bytes.Equal(hss[0].GetHandshakeHash(), hss[1].GetHandshakeHash()) {
+		t.Fatal("failed HandshakeHash control")
+	}
+	if 1 != len(rev.data) || "usr1" != string(rev.data[0]) {
+		t.Fatalf("failed id verifier control, got %q", rev.data)
+	}
+	if 1 != len(rkv.data) || !bytes.Equal(keys[0].PublicKey().Bytes(), rkv.data[0]) {
+		t.Fatal("failed static key verifier control")
+	}
+}
+
+func testVectorsWithVerifiers(t *testing.T, path string) {
+	vectors, err := LoadTestVectors(path)
+	if nil != err {
+		t.Fatalf("Unable to load vectors from %s, got error %v", path, err)
+	}
+	for tn, vec := range vectors {
+		t.Run(fmt.Sprintf("vectors[%d]%s", tn, vec.ProtocolName), func(t *testing.T) {
+			var cfg Config
+			err := cfg.Load(vec.ProtocolName)
+			if nil != err {
+				t.Fatalf("Failed loading configuration for protocol %s, got error %v", vec.ProtocolName, err)
+			}
+			var vps [2]*VerifierProvider
+			var cvs [2]*testVerifier
+			for i := range 2 {
+				cvs[i] = &testVerifier{sizes: []int{cfg.CurveAlgo.PublicKeyLen()}}
+				vps[i] = &VerifierProvider{}
+				vps[i].SetVerifier("rs", cvs[i])
+			}
+			testVectorVerifiers(t, vec, cfg, vps)
+
+			// static keys are verified when transmitted
+			peerKeys := [2][]byte{vec.ResponderStaticKey, vec.InitiatorStaticKey}
+			for i, cv := range cvs {
+				transmitted := false
+				for spec := range cfg.HandshakePattern.listInitSpecs(0 == i) {
+					transmitted = transmitted || "verifiers" == spec.token
+				}
+				switch {
+				case !transmitted && 0 != len(cv.data):
+					t.Fatalf("cvs[%d] verified untransmitted key", i)
+				case transmitted && 1 != len(cv.data):
+					t.Fatalf("cvs[%d] verified %d keys", i, len(cv.data))
+				case transmitted:
+					key, err := cfg.CurveAlgo.NewPrivateKey(peerKeys[i])
+					if nil != err {
+						t.Fatalf("failed loading peer static key, got error %v", err)
+					}
+					if !bytes.Equal(key.PublicKey().Bytes(), cv.data[0]) {
+						t.Fatalf("cvs[%d] verified invalid key", i)
+					}
+				}
+			}
+		})
+	}
+}
+
+// testVerifier is a CredentialVerifier that records the data it verifies.
+// It consumes data of the successive sizes, and loads psk if set.
+type testVerifier struct {
+	sizes []int
+	data  [][]byte
+	psk   []byte
+}
+
+func (self *testVerifier) ReadSize(_ *HandshakeState) int {
+	if len(self.data) < len(self.sizes) {
+		return self.sizes[len(self.data)]
+	}
+	return 0
+}
+
+func (self *testVerifier) Verify(hs *HandshakeState, data []byte) (int, error) {
+	self.data = append(self.data, bytes.Clone(data))
+	if nil != self.psk {
+		err := hs.SetPsks(self.psk)
+		if nil != err {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (self *testVerifier) Reset() {
+	self.data = nil
+}
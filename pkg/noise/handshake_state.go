@@ -1,12 +1,18 @@
 package noise
 
 import (
+	"bytes"
 	"crypto/rand"
 	"io"
+	"slices"
+	"sync"
 
 	"code.kerpass.org/golang/internal/algos"
 )
 
+// msgBufPool holds the message buffers used by WriteMessage & ReadMessage.
+var msgBufPool = sync.Pool{New: func() any { return new([]byte) }}
+
 // HandshakeState holds noise protocol handshake execution state.
 //
 // HandshakeState appears in section 5.3 of the noise protocol specs.
@@ -14,6 +20,7 @@ type HandshakeState struct {
 	SymetricState
 	verifiers *VerifierProvider
 	initiator bool
+	alice     bool
 	msgPtrns  []msgPtrn
 	msgcursor int
 	curve     algos.Curve
@@ -23,6 +30,17 @@ type HandshakeState struct {
 	re        *PublicKey
 	psks      [][]byte
 	pskcursor int
+	pskMode   bool
+	verified  bool
+	kem       Kem
+	kemS      KemKey
+	kemE      KemKey
+	kemRs     []byte
+	kemRe     []byte
+	sKem      bool
+	eKem      bool
+	rsKem     bool
+	reKem     bool
 }
 
 // HandshakeParams holds HandshakeState.Initialize parameters.
@@ -35,6 +53,17 @@ type HandshakeParams struct {
 	RemoteStaticKey    *PublicKey
 	RemoteEphemeralKey *PublicKey
 	Psks               [][]byte
+
+	// Verifiers optionally holds the CredentialVerifiers invoked by ReadMessage.
+	// When set, a static key verifier is required if the peer transmits its static key.
+	// Psks may be left empty if the verifiers load them.
+	Verifiers *VerifierProvider
+
+	// KEM keys, only used with HandshakePattern containing ekem or skem tokens.
+	StaticKemKey          KemKey
+	EphemeralKemKey       KemKey
+	RemoteStaticKemKey    []byte
+	RemoteEphemeralKemKey []byte
 }
 
 // Initialize set handshake initial state. It errors if provided parameters are not compatible with provided cfg.
@@ -52,6 +81,22 @@ func (self *HandshakeState) Initialize(params HandshakeParams) error {
 	self.curve = cfg.CurveAlgo
 
 	self.initiator = params.Initiator
+	if 0 == len(cfg.HandshakePattern.msgs) {
+		return newError("invalid HandshakePattern, no msgs")
+	}
+	if cfg.HandshakePattern.UsesKem() != (nil != cfg.KemAlgo) {
+		return newError("invalid Config, HandshakePattern KEM tokens do not match KemAlgo")
+	}
+	self.kem = cfg.KemAlgo
+	localKems, remoteKems := cfg.HandshakePattern.listKemKeys(self.initiator)
+	self.sKem = slices.Contains(localKems, "s")
+	self.eKem = slices.Contains(localKems, "e")
+	self.rsKem = slices.Contains(remoteKems, "s")
+	self.reKem = slices.Contains(remoteKems, "e")
+
+	// DH tokens refer to Alice (left) & Bob (right) keys, in Bob-initiated patterns
+	// (eg fallback patterns) the initiator is Bob. spec 7.1
+	self.alice = self.initiator == (left == cfg.HandshakePattern.msgs[0].sender)
 
 	// reuse msgPtrns allocated memory if not empty
 	mps := self.msgPtrns
@@ -65,9 +110,23 @@ func (self *HandshakeState) Initialize(params HandshakeParams) error {
 	self.e = params.EphemeralKeypair
 	self.rs = params.RemoteStaticKey
 	self.re = params.RemoteEphemeralKey
+	self.kemS = params.StaticKemKey
+	self.kemE = params.EphemeralKemKey
+	self.kemRs = params.RemoteStaticKemKey
+	self.kemRe = params.RemoteEphemeralKemKey
 
 	self.MixHash(params.Prologue)
 
+	self.verifiers = params.Verifiers
+	self.verifiers.Reset()
+	self.verified = false
+
+	// psks may be loaded by a CredentialVerifier during the handshake
+	deferPsks := 0 == len(params.Psks) && self.verifiers.ShouldLoad("psk")
+	self.pskMode = len(params.Psks) > 0 || deferPsks
+	self.psks = nil
+	self.pskcursor = 0
+
 	var failIfUnusedPsks, usePsks bool
 	for spec := range cfg.HandshakePattern.listInitSpecs(self.initiator) {
 		switch spec.token {
@@ -84,7 +143,7 @@ func (self *HandshakeState) Initialize(params HandshakeParams) error {
 			}
 			if spec.hash {
 				self.MixHash(self.e.PublicKey().Bytes())
-				if len(params.Psks) > 0 {
+				if self.pskMode {
 					err = self.MixKey(self.e.PublicKey().Bytes())
 					if nil != err {
 						return wrapError(err, "failed mixing e PublicKey")
@@ -106,7 +165,7 @@ func (self *HandshakeState) Initialize(params HandshakeParams) error {
 			}
 			if spec.hash {
 				self.MixHash(self.re.Bytes())
-				if len(params.Psks) > 0 {
+				if self.pskMode {
 					err = self.MixKey(self.re.Bytes())
 					if nil != err {
 						return wrapError(err, "failed mixing re")
@@ -114,8 +173,33 @@ func (self *HandshakeState) Initialize(params HandshakeParams) error {
 					failIfUnusedPsks = true
 				}
 			}
+		case "kems":
+			if nil == self.kemS {
+				return newError("nil StaticKemKey not allowed with configured HandshakePattern")
+			}
+			if spec.hash {
+				self.MixHash(self.kemS.PublicKey())
+			}
+		case "keme":
+			if nil == self.kemE {
+				return newError("nil EphemeralKemKey not allowed with configured HandshakePattern")
+			}
+			self.MixHash(self.kemE.PublicKey())
+		case "kemrs":
+			if len(self.kemRs) != self.kem.PublicKeyLen() {
+				return newError("invalid RemoteStaticKemKey for configured HandshakePattern")
+			}
+			self.MixHash(self.kemRs)
+		case "kemre":
+			if len(self.kemRe) != self.kem.PublicKeyLen() {
+				return newError("invalid RemoteEphemeralKemKey for configured HandshakePattern")
+			}
+			self.MixHash(self.kemRe)
 		case "psk":
 			usePsks = true
+			if deferPsks {
+				continue
+			}
 
 			// pskcursor used by SetPsks to verify that psks is correctly sized.
 			// SetPsks set pskcursor to 0 after loading the psks...
@@ -125,6 +209,10 @@ func (self *HandshakeState) Initialize(params HandshakeParams) error {
 			if nil != err {
 				return wrapError(err, "failed loading psks")
 			}
+		case "verifiers":
+			if nil != self.verifiers && nil == self.verifiers.Get("rs") {
+				return wrapError(errNoStaticKeyVerifier, "configured HandshakePattern transmits remote s")
+			}
 		default:
 			continue
 		}
@@ -140,6 +228,26 @@ func (self *HandshakeState) Initialize(params HandshakeParams) error {
 //
 // WriteMessage appears in section 5.3 of the noise protocol specs.
 func (self *HandshakeState) WriteMessage(payload []byte, message io.Writer) (bool, error) {
+	bufp := msgBufPool.Get().(*[]byte)
+	defer msgBufPool.Put(bufp)
+
+	buf, completed, err := self.AppendWriteMessage((*bufp)[:0], payload)
+	if nil != err {
+		return completed, err
+	}
+	*bufp = buf
+	_, err = message.Write(buf)
+	if nil != err {
+		return completed, wrapError(err, "failed adding message to the message buffer")
+	}
+	return completed, nil
+}
+
+// AppendWriteMessage is the append form of WriteMessage, it appends the new handshake message to dst
+// and returns the extended buffer.
+//
+// AppendWriteMessage does not allocate buffers if dst has sufficient capacity.
+func (self *HandshakeState) AppendWriteMessage(dst, payload []byte) ([]byte, bool, error) {
 
 	initiator := self.initiator
 	cursor := self.msgcursor
@@ -152,7 +260,7 @@ func (self *HandshakeState) WriteMessage(payload []byte, message io.Writer) (boo
 	}
 	completed := false
 	if cursor >= len(self.msgPtrns) || (cursor%2) != parity {
-		return completed, newError("handshake error, state does not allow calling WriteMessage")
+		return nil, completed, newError("handshake error, state does not allow calling WriteMessage")
 	}
 	self.msgcursor += 1
 	if self.msgcursor >= len(self.msgPtrns) {
@@ -160,8 +268,8 @@ func (self *HandshakeState) WriteMessage(payload []byte, message io.Writer) (boo
 	}
 
 	var err error
-	var ikm []byte
-	var msglen int
+	var ikm, ckm []byte
+	start := len(dst)
 	var keypair *Keypair
 	var pubkey *PublicKey
 	for tkn := range self.msgPtrns[cursor].Tokens() {
@@ -170,44 +278,57 @@ func (self *HandshakeState) WriteMessage(payload []byte, message io.Writer) (boo
 			if nil == self.e {
 				keypair, err = self.curve.GenerateKey(rand.Reader)
 				if nil != err {
-					return completed, wrapError(err, "failed generating e Keypair")
+					return nil, completed, wrapError(err, "failed generating e Keypair")
 				}
 				self.e = keypair
 			}
 			ikm = self.e.PublicKey().Bytes()
 			self.MixHash(ikm)
-			if len(self.psks) > 0 {
+			if self.pskMode {
 				err = self.MixKey(ikm)
 				if nil != err {
-					return completed, wrapError(err, "failed mixing e PublicKey")
+					return nil, completed, wrapError(err, "failed mixing e PublicKey")
 				}
 			}
-			_, err = message.Write(ikm)
-			if nil != err {
-				return completed, wrapError(err, "failed adding e PublicKey to the message buffer")
+			dst = append(dst, ikm...)
+			if self.eKem {
+				if nil == self.kemE {
+					self.kemE, err = self.kem.GenerateKey()
+					if nil != err {
+						return nil, completed, wrapError(err, "failed generating e KemKey")
+					}
+				}
+				dst, err = self.AppendEncryptAndHash(dst, self.kemE.PublicKey())
+				if nil != err {
+					return nil, completed, wrapError(err, "failed encrypting e KEM PublicKey")
+				}
 			}
-			msglen += len(ikm)
 		case "s":
 			if nil == self.s {
 				// initialization will detect this
-				return completed, newError("missing s Keypair")
+				return nil, completed, newError("missing s Keypair")
 			}
-			ikm, err = self.EncryptAndHash(self.s.PublicKey().Bytes())
+			dst, err = self.AppendEncryptAndHash(dst, self.s.PublicKey().Bytes())
 			if nil != err {
-				return completed, wrapError(err, "failed encrypting s PublicKey")
+				return nil, completed, wrapError(err, "failed encrypting s PublicKey")
 			}
-			_, err = message.Write(ikm)
-			if nil != err {
-				return completed, wrapError(err, "failed adding s PublicKey to the message buffer")
+			if self.sKem {
+				if nil == self.kemS {
+					// initialization will detect this
+					return nil, completed, newError("missing s KemKey")
+				}
+				dst, err = self.AppendEncryptAndHash(dst, self.kemS.PublicKey())
+				if nil != err {
+					return nil, completed, wrapError(err, "failed encrypting s KEM PublicKey")
+				}
 			}
-			msglen += len(ikm)
 		case "ee":
 			err = self.dhmix(self.e, self.re)
 			if nil != err {
-				return completed, wrapError(err, "failed ee DH mix")
+				return nil, completed, wrapError(err, "failed ee DH mix")
 			}
 		case "es":
-			if initiator {
+			if self.alice {
 				keypair = self.e
 				pubkey = self.rs
 			} else {
@@ -216,10 +337,10 @@ func (self *HandshakeState) WriteMessage(payload []byte, message io.Writer) (boo
 			}
 			err = self.dhmix(keypair, pubkey)
 			if nil != err {
-				return completed, wrapError(err, "failed es DH mix")
+				return nil, completed, wrapError(err, "failed es DH mix")
 			}
 		case "se":
-			if initiator {
+			if self.alice {
 				keypair = self.s
 				pubkey = self.re
 			} else {
@@ -228,39 +349,54 @@ func (self *HandshakeState) WriteMessage(payload []byte, message io.Writer) (boo
 			}
 			err = self.dhmix(keypair, pubkey)
 			if nil != err {
-				return completed, wrapError(err, "failed se DH mix")
+				return nil, completed, wrapError(err, "failed se DH mix")
 			}
 		case "ss":
 			err = self.dhmix(self.s, self.rs)
 			if nil != err {
-				return completed, wrapError(err, "failed ss DH mix")
+				return nil, completed, wrapError(err, "failed ss DH mix")
+			}
+		case "ekem", "skem":
+			if "ekem" == tkn {
+				ikm = self.kemRe
+			} else {
+				ikm = self.kemRs
+			}
+			ikm, ckm, err = self.kem.Encapsulate(ikm)
+			if nil != err {
+				return nil, completed, wrapError(err, "failed %s encapsulation", tkn)
+			}
+			dst, err = self.AppendEncryptAndHash(dst, ckm)
+			if nil != err {
+				return nil, completed, wrapError(err, "failed encrypting %s ciphertext", tkn)
+			}
+			err = self.MixKey(ikm)
+			if nil != err {
+				return nil, completed, wrapError(err, "failed %s KEM mix", tkn)
 			}
 		case "psk":
-			// note that len(psks) has been validated in Initialize to match HandshakePattern requirements
+			// note that len(psks) has been validated in Initialize or SetPsks to match HandshakePattern requirements
+			if self.pskcursor >= len(self.psks) {
+				return nil, completed, newError("missing psk")
+			}
 			err = self.MixKeyAndHash(self.psks[self.pskcursor])
 			if nil != err {
-				return completed, wrapError(err, "failed mixing psk")
+				return nil, completed, wrapError(err, "failed mixing psk")
 			}
 			self.pskcursor += 1
 		default:
 			// unreachable, as long as the handshake was properly initialized
-			return completed, newError("unsupported token %s", tkn)
+			return nil, completed, newError("unsupported token %s", tkn)
 		}
 	}
-	ikm, err = self.EncryptAndHash(payload)
+	dst, err = self.AppendEncryptAndHash(dst, payload)
 	if nil != err {
-		return completed, wrapError(err, "failed payload encryption")
+		return nil, completed, wrapError(err, "failed payload encryption")
 	}
-	_, err = message.Write(ikm)
-	if nil != err {
-		return completed, wrapError(err, "failed adding payload to the message buffer")
+	if len(dst)-start > msgMaxSize {
+		return nil, completed, wrapError(errSizeLimit, "generated message larger than %d bytes (noise protocol limit)", msgMaxSize)
 	}
-	msglen += len(ikm)
-	if msglen > msgMaxSize {
-		return completed, wrapError(errSizeLimit, "generated message larger than %d bytes (noise protocol limit)", msgMaxSize)
-	}
-	return completed, nil
-
+	return dst, completed, nil
 }
 
 // ReadMessage processes incoming handshake message taking into account inner state.
@@ -268,6 +404,26 @@ func (self *HandshakeState) WriteMessage(payload []byte, message io.Writer) (boo
 //
 // ReadMessage appears in section 5.3 of the noise protocol specs.
 func (self *HandshakeState) ReadMessage(message []byte, payload io.Writer) (bool, error) {
+	bufp := msgBufPool.Get().(*[]byte)
+	defer msgBufPool.Put(bufp)
+
+	buf, completed, err := self.AppendReadMessage((*bufp)[:0], message)
+	if nil != err {
+		return completed, err
+	}
+	*bufp = buf
+	_, err = payload.Write(buf)
+	if nil != err {
+		return completed, wrapError(err, "failed transferring data to the payload buffer")
+	}
+	return completed, nil
+}
+
+// AppendReadMessage is the append form of ReadMessage, it appends the received payload to dst
+// and returns the extended buffer. dst memory shall not overlap message.
+//
+// AppendReadMessage does not allocate buffers if dst has sufficient capacity, ie len(message).
+func (self *HandshakeState) AppendReadMessage(dst, message []byte) ([]byte, bool, error) {
 	initiator := self.initiator
 	cursor := self.msgcursor
 	pubkeysize := self.curve.PublicKeyLen()
@@ -281,10 +437,10 @@ func (self *HandshakeState) ReadMessage(message []byte, payload io.Writer) (bool
 	}
 	completed := false
 	if cursor >= len(self.msgPtrns) || (cursor%2) != parity {
-		return completed, newError("handshake error, state does not allow calling ReadMessage")
+		return nil, completed, newError("handshake error, state does not allow calling ReadMessage")
 	}
 	if msgsize > msgMaxSize {
-		return completed, wrapError(errSizeLimit, "received message larger than %d bytes (noise protocol limit)", msgMaxSize)
+		return nil, completed, wrapError(errSizeLimit, "received message larger than %d bytes (noise protocol limit)", msgMaxSize)
 	}
 	self.msgcursor += 1
 	if self.msgcursor >= len(self.msgPtrns) {
@@ -300,21 +456,28 @@ func (self *HandshakeState) ReadMessage(message []byte, payload io.Writer) (bool
 		switch tkn {
 		case "e":
 			if (msgsize - rb) < pubkeysize {
-				return completed, newError("message too small for e PublicKey")
+				return nil, completed, newError("message too small for e PublicKey")
 			}
 			ikm = message[rb : rb+pubkeysize]
 			pubkey, err = self.curve.NewPublicKey(ikm)
 			if nil != err {
-				return completed, wrapError(err, "received invalid e PublicKey")
+				return nil, completed, wrapError(err, "received invalid e PublicKey")
 			}
 			rb += pubkeysize
 			self.re = pubkey
 			self.MixHash(ikm)
-			if len(self.psks) > 0 {
+			if self.pskMode {
 				err = self.MixKey(ikm)
 				if nil != err {
-					return completed, wrapError(err, "failed mixing e PublicKey")
+					return nil, completed, wrapError(err, "failed mixing e PublicKey")
+				}
+			}
+			if self.reKem {
+				ikm, rb, err = self.readKemBytes(dst[len(dst):], message, rb, self.kem.PublicKeyLen())
+				if nil != err {
+					return nil, completed, wrapError(err, "failed reading e KEM PublicKey")
 				}
+				self.kemRe = bytes.Clone(ikm)
 			}
 		case "s":
 			want = pubkeysize
@@ -322,26 +485,37 @@ func (self *HandshakeState) ReadMessage(message []byte, payload io.Writer) (bool
 				want += cipherTagSize
 			}
 			if (msgsize - rb) < want {
-				return completed, newError("message too small for s PublicKey credential")
+				return nil, completed, newError("message too small for s PublicKey credential")
 			}
 			ckm = message[rb : rb+want]
-			ikm, err = self.DecryptAndHash(ckm)
+			ikm, err = self.AppendDecryptAndHash(dst[len(dst):], ckm)
 			if nil != err {
-				return completed, wrapError(err, "failed decrypting s PublicKey credential")
+				return nil, completed, wrapError(err, "failed decrypting s PublicKey credential")
 			}
 			pubkey, err = self.curve.NewPublicKey(ikm)
 			if nil != err {
-				return completed, wrapError(err, "received s PublicKey appears invalid")
+				return nil, completed, wrapError(err, "received s PublicKey appears invalid")
 			}
 			self.rs = pubkey
 			rb += want
+			err = self.verifyStaticKey(ikm)
+			if nil != err {
+				return nil, completed, wrapError(err, "failed s PublicKey verification")
+			}
+			if self.rsKem {
+				ikm, rb, err = self.readKemBytes(dst[len(dst):], message, rb, self.kem.PublicKeyLen())
+				if nil != err {
+					return nil, completed, wrapError(err, "failed reading s KEM PublicKey")
+				}
+				self.kemRs = bytes.Clone(ikm)
+			}
 		case "ee":
 			err = self.dhmix(self.e, self.re)
 			if nil != err {
-				return completed, wrapError(err, "failed ee DH mix")
+				return nil, completed, wrapError(err, "failed ee DH mix")
 			}
 		case "es":
-			if initiator {
+			if self.alice {
 				keypair = self.e
 				pubkey = self.rs
 			} else {
@@ -350,10 +524,10 @@ func (self *HandshakeState) ReadMessage(message []byte, payload io.Writer) (bool
 			}
 			err = self.dhmix(keypair, pubkey)
 			if nil != err {
-				return completed, wrapError(err, "failed es DH mix")
+				return nil, completed, wrapError(err, "failed es DH mix")
 			}
 		case "se":
-			if initiator {
+			if self.alice {
 				keypair = self.s
 				pubkey = self.re
 			} else {
@@ -362,34 +536,56 @@ func (self *HandshakeState) ReadMessage(message []byte, payload io.Writer) (bool
 			}
 			err = self.dhmix(keypair, pubkey)
 			if nil != err {
-				return completed, wrapError(err, "failed se DH mix")
+				return nil, completed, wrapError(err, "failed se DH mix")
 			}
 		case "ss":
 			err = self.dhmix(self.s, self.rs)
 			if nil != err {
-				return completed, wrapError(err, "failed ss DH mix")
+				return nil, completed, wrapError(err, "failed ss DH mix")
+			}
+		case "ekem", "skem":
+			ckm, rb, err = self.readKemBytes(dst[len(dst):], message, rb, self.kem.CiphertextLen())
+			if nil != err {
+				return nil, completed, wrapError(err, "failed reading %s ciphertext", tkn)
+			}
+			if "ekem" == tkn {
+				ikm, err = self.kemE.Decapsulate(ckm)
+			} else {
+				ikm, err = self.kemS.Decapsulate(ckm)
+			}
+			if nil != err {
+				return nil, completed, wrapError(err, "failed %s decapsulation", tkn)
+			}
+			err = self.MixKey(ikm)
+			if nil != err {
+				return nil, completed, wrapError(err, "failed %s KEM mix", tkn)
 			}
 		case "psk":
-			// note that len(psks) has been validated in Initialize to match HandshakePattern requirements
+			// note that len(psks) has been validated in Initialize or SetPsks to match HandshakePattern requirements
+			if self.pskcursor >= len(self.psks) {
+				return nil, completed, newError("missing psk")
+			}
 			err = self.MixKeyAndHash(self.psks[self.pskcursor])
 			if nil != err {
-				return completed, wrapError(err, "failed mixing psk")
+				return nil, completed, wrapError(err, "failed mixing psk")
 			}
 			self.pskcursor += 1
 		default:
 			// unreachable, as long as the handshake was properly initialized
-			return completed, newError("unsupported token %s", tkn)
+			return nil, completed, newError("unsupported token %s", tkn)
 		}
 	}
-	ikm, err = self.DecryptAndHash(message[rb:])
+	start := len(dst)
+	dst, err = self.AppendDecryptAndHash(dst, message[rb:])
 	if nil != err {
-		return completed, wrapError(err, "failed message decryption")
+		return nil, completed, wrapError(err, "failed message decryption")
 	}
-	_, err = payload.Write(ikm)
+	ikm, err = self.verifyPayload(dst[start:])
 	if nil != err {
-		return completed, wrapError(err, "failed transferring data to the payload buffer")
+		return nil, completed, wrapError(err, "failed payload verification")
 	}
-	return completed, nil
+	dst = append(dst[:start], ikm...)
+	return dst, completed, nil
 
 }
 
@@ -472,6 +668,78 @@ func (self *HandshakeState) Split(dst *TransportCipherPair) error {
 	return nil
 }
 
+// verifyStaticKey passes the received remote static key to the static key CredentialVerifier if any.
+// It errors if the verifier does not expect a static key or rejects it.
+func (self *HandshakeState) verifyStaticKey(key []byte) error {
+	cv := self.verifiers.Get("rs")
+	if nil == cv {
+		return nil
+	}
+	if cv.ReadSize(self) != len(key) {
+		return newError("static key verifier does not expect a %d bytes key", len(key))
+	}
+	_, err := cv.Verify(self, key)
+	self.verified = true
+
+	return err
+}
+
+// verifyPayload passes the leading data of the received payload to the static key and extension
+// CredentialVerifiers, for as long as they expect data. It returns the remaining payload.
+//
+// The static key verifier receives payload data, eg a certificate, only after it verified the static key.
+func (self *HandshakeState) verifyPayload(payload []byte) ([]byte, error) {
+	if nil == self.verifiers {
+		return payload, nil
+	}
+	var cvs []CredentialVerifier
+	if self.verified {
+		cvs = append(cvs, self.verifiers.staticKeyVerifier)
+	}
+	cvs = append(cvs, self.verifiers.extVerifier)
+	for _, cv := range cvs {
+		if nil == cv {
+			continue
+		}
+		for size := cv.ReadSize(self); size > 0; size = cv.ReadSize(self) {
+			if size > len(payload) {
+				return nil, newError("payload too small for %d bytes credential", size)
+			}
+			n, err := cv.Verify(self, payload[:size])
+			if nil != err {
+				return nil, err
+			}
+			if n < 0 || n > size {
+				return nil, newError("invalid Verify result %d", n)
+			}
+			payload = payload[n:]
+			if 0 == n {
+				break
+			}
+		}
+	}
+
+	return payload, nil
+}
+
+// readKemBytes decrypts the size bytes KEM item that starts at position rb of message, appending it to dst.
+// It returns the decrypted item and the position of the next message item.
+func (self *HandshakeState) readKemBytes(dst, message []byte, rb int, size int) ([]byte, int, error) {
+	want := size
+	if self.HasKey() {
+		want += cipherTagSize
+	}
+	if (len(message) - rb) < want {
+		return nil, rb, newError("message too small for KEM item")
+	}
+	ikm, err := self.AppendDecryptAndHash(dst, message[rb:rb+want])
+	if nil != err {
+		return nil, rb, wrapError(err, "failed decrypting KEM item")
+	}
+
+	return ikm, rb + want, nil
+}
+
 // dhmix executes Diffie-Hellmann key exchange in between keypair and pubkey.
 // It mixes the resulting shared secret into the HandshakeState.
 func (self *HandshakeState) dhmix(keypair *Keypair, pubkey *PublicKey) error {
@@ -481,3 +749,28 @@ func (self *HandshakeState) dhmix(keypair *Keypair, pubkey *PublicKey) error {
 	}
 	return self.MixKey(ikm)
 }
+
+// handshakePool holds the HandshakeState returned by AcquireHandshakeState.
+var handshakePool = sync.Pool{New: func() any { return new(HandshakeState) }}
+
+// AcquireHandshakeState returns a HandshakeState from a package pool, it shall be initialized before use.
+// Reusing HandshakeState decreases allocations for servers that run many concurrent handshakes.
+func AcquireHandshakeState() *HandshakeState {
+	return handshakePool.Get().(*HandshakeState)
+}
+
+// ReleaseHandshakeState resets hs and returns it to the package pool. hs shall not be used after this call.
+func ReleaseHandshakeState(hs *HandshakeState) {
+	if nil == hs {
+		return
+	}
+	hs.Reset()
+	handshakePool.Put(hs)
+}
+
+// Reset clears the HandshakeState keys & secrets, it keeps allocated memory for reuse by Initialize.
+func (self *HandshakeState) Reset() {
+	msgPtrns := self.msgPtrns[:0]
+	self.SymetricState.Reset()
+	*self = HandshakeState{SymetricState: self.SymetricState, msgPtrns: msgPtrns}
+}
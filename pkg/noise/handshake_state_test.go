@@ -2,6 +2,7 @@ package noise
 
 import (
 	"bytes"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"reflect"
@@ -69,17 +70,27 @@ func (self cipherPair) DecryptWithAd(ad, ciphertext []byte) ([]byte, error) {
 }
 
 func testVector(t *testing.T, vec TestVector) {
-	var err error
 	var cfg Config
+	err := cfg.Load(vec.ProtocolName)
+	if nil != err {
+		t.Fatalf("Failed loading configuration for protocol %s, got error %v", vec.ProtocolName, err)
+	}
+	testVectorCfg(t, vec, cfg)
+}
+
+// testVectorCfg runs vec using cfg, this allows replacing Config algorithms.
+func testVectorCfg(t *testing.T, vec TestVector, cfg Config) {
+	testVectorVerifiers(t, vec, cfg, [2]*VerifierProvider{})
+}
+
+// testVectorVerifiers runs vec using cfg, initiator & responder use vps verifiers.
+func testVectorVerifiers(t *testing.T, vec TestVector, cfg Config, vps [2]*VerifierProvider) {
+	var err error
 	var prologue []byte
 	var s, e *Keypair
 	var rs, re *PublicKey
 	var psks, rpsks [][]byte
 	hss := [2]HandshakeState{}
-	err = cfg.Load(vec.ProtocolName)
-	if nil != err {
-		t.Fatalf("Failed loading configuration for protocol %s, got error %v", vec.ProtocolName, err)
-	}
 	if len(vec.InitiatorPrologue) > 0 {
 		prologue = []byte(vec.InitiatorPrologue)
 	} else {
@@ -134,6 +145,13 @@ func testVector(t *testing.T, vec TestVector) {
 		RemoteStaticKey:    rs,
 		RemoteEphemeralKey: re,
 		Psks:               psks,
+		Verifiers:          vps[0],
+	}
+	if nil != cfg.KemAlgo {
+		params.StaticKemKey = loadKemKey(t, cfg.KemAlgo, vec.InitiatorStaticKemKey)
+		params.EphemeralKemKey = loadKemKey(t, cfg.KemAlgo, vec.InitiatorEphemeralKemKey)
+		params.RemoteStaticKemKey = vec.InitiatorRemoteStaticKemKey
+		params.RemoteEphemeralKemKey = vec.InitiatorRemoteEphemeralKemKey
 	}
 	err = hss[0].Initialize(params)
 	if nil != err {
@@ -194,6 +212,13 @@ func testVector(t *testing.T, vec TestVector) {
 		RemoteStaticKey:    rs,
 		RemoteEphemeralKey: re,
 		Psks:               rpsks,
+		Verifiers:          vps[1],
+	}
+	if nil != cfg.KemAlgo {
+		params.StaticKemKey = loadKemKey(t, cfg.KemAlgo, vec.ResponderStaticKemKey)
+		params.EphemeralKemKey = loadKemKey(t, cfg.KemAlgo, vec.ResponderEphemeralKemKey)
+		params.RemoteStaticKemKey = vec.ResponderRemoteStaticKemKey
+		params.RemoteEphemeralKemKey = vec.ResponderRemoteEphemeralKemKey
 	}
 	err = hss[1].Initialize(params)
 	if nil != err {
@@ -289,6 +314,18 @@ func testVector(t *testing.T, vec TestVector) {
 
 }
 
+// loadKemKey returns the KemKey derived from seed, or nil if seed is empty.
+func loadKemKey(t *testing.T, kem Kem, seed []byte) KemKey {
+	if 0 == len(seed) {
+		return nil
+	}
+	key, err := kem.NewKey(seed)
+	if nil != err {
+		t.Fatalf("Can not load KemKey, got error %v", err)
+	}
+	return key
+}
+
 func testSizeLimit(t *testing.T, vec TestVector) {
 	// this test checks that first WriteMessage, ReadMessage
 	//  * succeed when message size is msgMaxSize
@@ -478,3 +515,166 @@ func testSizeLimit(t *testing.T, vec TestVector) {
 		}
 	}
 }
+
+func TestHandshakeStateAppend(t *testing.T) {
+	vectors, err := LoadTestVectors("testdata/snow.txt")
+	if nil != err {
+		t.Fatalf("Unable to load vectors from snow.txt, got error %v", err)
+	}
+	for tn, vec := range vectors {
+		if len(vec.InitiatorPsks) > 0 || 0 == len(vec.InitiatorEphemeralKey) || 0 == len(vec.ResponderEphemeralKey) {
+			continue
+		}
+		t.Run(fmt.Sprintf("vectors[%d]%s", tn, vec.ProtocolName), func(t *testing.T) {
+			var cfg Config
+			err := cfg.Load(vec.ProtocolName)
+			if nil != err {
+				t.Fatalf("Failed loading configuration for protocol %s, got error %v", vec.ProtocolName, err)
+			}
+			var hss [2]*HandshakeState
+			for i, keys := range [][4][]byte{
+				{vec.InitiatorStaticKey, vec.InitiatorEphemeralKey, vec.InitiatorRemoteStaticKey, vec.InitiatorRemoteEphemeralKey},
+				{vec.ResponderStaticKey, vec.ResponderEphemeralKey, vec.ResponderRemoteStaticKey, vec.ResponderRemoteEphemeralKey},
+			} {
+				params := HandshakeParams{Cfg: cfg, Initiator: 0 == i, Prologue: vec.InitiatorPrologue}
+				params.StaticKeypair = loadPrivKey(t, cfg, keys[0])
+				params.EphemeralKeypair = loadPrivKey(t, cfg, keys[1])
+				params.RemoteStaticKey = loadPubKey(t, cfg, keys[2])
+				params.RemoteEphemeralKey = loadPubKey(t, cfg, keys[3])
+				hss[i] = AcquireHandshakeState()
+				defer ReleaseHandshakeState(hss[i])
+				err = hss[i].Initialize(params)
+				if nil != err {
+					t.Fatalf("Failed hss[%d] initialization, got error %v", i, err)
+				}
+			}
+
+			// messages are appended after existing content
+			prefix := []byte("prefix")
+			var completed bool
+			for pos, msg := range vec.Messages {
+				w, r := hss[pos%2], hss[(pos+1)%2]
+				if cfg.HandshakePattern.OneWay() {
+					w, r = hss[0], hss[1]
+				}
+				ciphertext, _, err := w.AppendWriteMessage(bytes.Clone(prefix), msg.Payload)
+				if nil != err {
+					t.Fatalf("msg[%d]: Failed AppendWriteMessage, got error %v", pos, err)
+				}
+				if !bytes.Equal(prefix, ciphertext[:len(prefix)]) || !bytes.Equal(msg.CipherText, ciphertext[len(prefix):]) {
+					t.Fatalf("msg[%d]: Failed ciphertext check", pos)
+				}
+				payload := make([]byte, 0, len(prefix)+len(msg.CipherText))
+				payload, completed, err = r.AppendReadMessage(append(payload, prefix...), ciphertext[len(prefix):])
+				if nil != err {
+					t.Fatalf("msg[%d]: Failed AppendReadMessage, got error %v", pos, err)
+				}
+				if !bytes.Equal(prefix, payload[:len(prefix)]) || !bytes.Equal(msg.Payload, payload[len(prefix):]) {
+					t.Fatalf("msg[%d]: Failed payload check", pos)
+				}
+				if completed {
+					break
+				}
+			}
+			expect := []byte(vec.HandshakeHash)
+			if 0 == len(expect) {
+				expect = hss[1].GetHandshakeHash()
+			}
+			if !bytes.Equal(hss[0].AppendHandshakeHash(nil), expect) {
+				t.Fatal("Failed HandshakeHash control")
+			}
+		})
+	}
+}
+
+func TestHandshakeStateReset(t *testing.T) {
+	var cfg Config
+	err := cfg.Load("Noise_NN_25519_ChaChaPoly_BLAKE2s")
+	if nil != err {
+		t.Fatalf("failed loading config, got error %v", err)
+	}
+	hs := AcquireHandshakeState()
+	err = hs.Initialize(HandshakeParams{Cfg: cfg, Initiator: true})
+	if nil != err {
+		t.Fatalf("failed Initialize, got error %v", err)
+	}
+	_, _, err = hs.AppendWriteMessage(nil, nil)
+	if nil != err {
+		t.Fatalf("failed AppendWriteMessage, got error %v", err)
+	}
+	hs.Reset()
+	if nil != hs.e || hs.HasKey() || !bytes.Equal(make([]byte, hashMaxSize), hs.ckb[:]) {
+		t.Fatal("failed Reset control")
+	}
+	_, _, err = hs.AppendWriteMessage(nil, nil)
+	if nil == err {
+		t.Fatal("AppendWriteMessage succeeded after Reset")
+	}
+	ReleaseHandshakeState(hs)
+}
+
+func BenchmarkHandshakeXX(b *testing.B) {
+	var cfg Config
+	err := cfg.Load("Noise_XX_25519_ChaChaPoly_BLAKE2s")
+	if nil != err {
+		b.Fatalf("failed loading config, got error %v", err)
+	}
+	var keys [2]*Keypair
+	for i := range 2 {
+		keys[i], err = cfg.CurveAlgo.GenerateKey(rand.Reader)
+		if nil != err {
+			b.Fatalf("failed generating static key, got error %v", err)
+		}
+	}
+	msg := make([]byte, 0, 256)
+	payload := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for b.Loop() {
+		var hss [2]*HandshakeState
+		for i := range 2 {
+			hss[i] = AcquireHandshakeState()
+			err = hss[i].Initialize(HandshakeParams{Cfg: cfg, Initiator: 0 == i, StaticKeypair: keys[i]})
+			if nil != err {
+				b.Fatalf("failed Initialize, got error %v", err)
+			}
+		}
+		completed := false
+		for pos := 0; !completed; pos++ {
+			msg, _, err = hss[pos%2].AppendWriteMessage(msg[:0], nil)
+			if nil != err {
+				b.Fatalf("failed AppendWriteMessage, got error %v", err)
+			}
+			payload, completed, err = hss[(pos+1)%2].AppendReadMessage(payload[:0], msg)
+			if nil != err {
+				b.Fatalf("failed AppendReadMessage, got error %v", err)
+			}
+		}
+		for i := range 2 {
+			ReleaseHandshakeState(hss[i])
+		}
+	}
+}
+
+// loadPrivKey returns the Keypair loaded from key, or nil if key is empty.
+func loadPrivKey(t *testing.T, cfg Config, key []byte) *Keypair {
+	if 0 == len(key) {
+		return nil
+	}
+	rv, err := cfg.CurveAlgo.NewPrivateKey(key)
+	if nil != err {
+		t.Fatalf("Can not load private key, got error %v", err)
+	}
+	return rv
+}
+
+// loadPubKey returns the PublicKey loaded from key, or nil if key is empty.
+func loadPubKey(t *testing.T, cfg Config, key []byte) *PublicKey {
+	if 0 == len(key) {
+		return nil
+	}
+	rv, err := cfg.CurveAlgo.NewPublicKey(key)
+	if nil != err {
+		t.Fatalf("Can not load public key, got error %v", err)
+	}
+	return rv
+}
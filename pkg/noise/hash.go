@@ -2,6 +2,8 @@ package noise
 
 import (
 	"crypto"
+	"hash"
+	"sync"
 
 	_ "crypto/sha512"
 	_ "golang.org/x/crypto/blake2b"
@@ -24,6 +26,26 @@ var hashRegistry *utils.Registry[string, Hash]
 // Hash embeds the crypto.Hash type and adds methods usefull for noise protocol implementation.
 type Hash struct {
 	crypto.Hash
+
+	// pool holds reusable hash.Hash, it is nil for Hash not obtained from the registry.
+	pool *sync.Pool
+}
+
+// acquire returns a reset hash.Hash that shall be returned using release.
+func (self Hash) acquire() hash.Hash {
+	if nil == self.pool {
+		return self.New()
+	}
+	hd := self.pool.Get().(hash.Hash)
+	hd.Reset()
+	return hd
+}
+
+// release returns hd to the Hash pool.
+func (self Hash) release(hd hash.Hash) {
+	if nil != self.pool {
+		self.pool.Put(hd)
+	}
 }
 
 // Kdf executes HKDF with ikm as secret, ck as salt and nil info.
@@ -58,8 +80,9 @@ func MustRegisterHash(name string, hash crypto.Hash) {
 
 // RegisterHash adds hash to the Hash registry. It errors if name is already in use or hash is invalid.
 func RegisterHash(name string, hash crypto.Hash) error {
+	pool := &sync.Pool{New: func() any { return hash.New() }}
 	return wrapError(
-		utils.RegistrySet(hashRegistry, name, Hash{Hash: hash}),
+		utils.RegistrySet(hashRegistry, name, Hash{Hash: hash, pool: pool}),
 		"failed registering Hash algorithm, %s",
 		name,
 	)
@@ -0,0 +1,31 @@
+package noise
+
+import (
+	"code.kerpass.org/golang/internal/algos"
+)
+
+const (
+	KEM_MLKEM768  = algos.KEM_MLKEM768
+	KEM_MLKEM1024 = algos.KEM_MLKEM1024
+)
+
+// MustRegisterKem adds kem to the Kem registry. It panics if kem name is already in use.
+func MustRegisterKem(kem Kem) {
+	err := RegisterKem(kem)
+	if nil != err {
+		panic(err)
+	}
+}
+
+// RegisterKem adds kem to the Kem registry. It errors if kem name is already in use or kem is nil.
+//
+// The Kem registry is shared with the other KerPass packages that support hybrid key exchanges.
+func RegisterKem(kem Kem) error {
+	return wrapError(algos.RegisterKem(kem), "failed registering Kem")
+}
+
+// GetKem loads Kem implementation from the registry. It errors if no Kem was registered with name.
+func GetKem(name string) (Kem, error) {
+	kem, err := algos.GetKem(name)
+	return kem, wrapError(err, "failed loading Kem")
+}
@@ -0,0 +1,302 @@
+//go:build go1.26
+
+package noise
+
+import (
+	"bytes"
+	"crypto/mlkem"
+	"crypto/mlkem/mlkemtest"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"code.kerpass.org/golang/internal/utils"
+)
+
+// The KEM snapshot is generated by this package, it is a regression snapshot and not
+// an independent conformance test: it only detects changes of the hybrid handshake output.
+// Run go test -run KemSnapshot -update-kem-snapshot to regenerate it.
+var updateKemSnapshot = flag.Bool("update-kem-snapshot", false, "regenerate testdata/kem_snapshot.txt")
+
+const kemSnapshotPath = "testdata/kem_snapshot.txt"
+
+var kemVectorProtocols = []string{
+	"Noise_NNhfs_25519+MLKEM768_ChaChaPoly_BLAKE2s",
+	"Noise_NKhfs_25519+MLKEM768_AESGCM_SHA256",
+	"Noise_XXhfs_25519+MLKEM768_ChaChaPoly_SHA256",
+	"Noise_IKhfs_25519+MLKEM768_AESGCM_BLAKE2b",
+	"Noise_KKhfs+psk2_25519+MLKEM768_ChaChaPoly_SHA512",
+	"Noise_XXfallback+hfs_25519+MLKEM768_AESGCM_BLAKE2s",
+}
+
+var kemVectorPayloads = []string{
+	"Ludwig von Mises",
+	"Murray Rothbard",
+	"F. A. Hayek",
+	"Carl Menger",
+	"Jean-Baptiste Say",
+}
+
+func TestHandshakeStateKemSnapshot(t *testing.T) {
+	if *updateKemSnapshot {
+		genKemSnapshot(t)
+	}
+	vectors, err := LoadTestVectors(kemSnapshotPath)
+	if nil != err {
+		t.Fatalf("Unable to load vectors from %s, got error %v", kemSnapshotPath, err)
+	}
+	if 0 == len(vectors) {
+		t.Fatal("no KEM vectors")
+	}
+	for tn, vec := range vectors {
+		t.Run(fmt.Sprintf("vectors[%d]%s", tn, vec.ProtocolName), func(t *testing.T) {
+			var cfg Config
+			err := cfg.Load(vec.ProtocolName)
+			if nil != err {
+				t.Fatalf("Failed loading configuration for protocol %s, got error %v", vec.ProtocolName, err)
+			}
+			kem := &detKem{Kem: cfg.KemAlgo}
+			for _, random := range vec.KemRandomness {
+				kem.random = append(kem.random, []byte(random))
+			}
+			cfg.KemAlgo = kem
+			testVectorCfg(t, vec, cfg)
+			if kem.used != len(kem.random) {
+				t.Fatalf("Failed KemRandomness control, used %d of %d", kem.used, len(kem.random))
+			}
+		})
+	}
+}
+
+// detKem is a deterministic ML-KEM-768 Kem that takes encapsulation randomness from a list.
+type detKem struct {
+	Kem
+	random [][]byte
+	used   int
+}
+
+func (self *detKem) Encapsulate(pubkey []byte) ([]byte, []byte, error) {
+	if self.used >= len(self.random) {
+		return nil, nil, newError("no more randomness")
+	}
+	ek, err := mlkem.NewEncapsulationKey768(pubkey)
+	if nil != err {
+		return nil, nil, wrapError(err, "invalid ML-KEM-768 encapsulation key")
+	}
+	random := self.random[self.used]
+	self.used += 1
+
+	return mlkemtest.Encapsulate768(ek, random)
+}
+
+func genKemSnapshot(t *testing.T) {
+	vectors := make([]TestVector, 0, len(kemVectorProtocols))
+	for _, protoname := range kemVectorProtocols {
+		vectors = append(vectors, genKemVector(t, protoname))
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(struct {
+		Vectors []TestVector `json:"vectors"`
+	}{Vectors: vectors})
+	if nil != err {
+		t.Fatalf("Failed encoding KEM vectors, got error %v", err)
+	}
+	err = os.WriteFile(kemSnapshotPath, buf.Bytes(), 0644)
+	if nil != err {
+		t.Fatalf("Failed writing %s, got error %v", kemSnapshotPath, err)
+	}
+}
+
+func genKemVector(t *testing.T, protoname string) TestVector {
+	var cfg Config
+	err := cfg.Load(protoname)
+	if nil != err {
+		t.Fatalf("Failed loading configuration for protocol %s, got error %v", protoname, err)
+	}
+	kem := &detKem{Kem: cfg.KemAlgo}
+	for range 4 {
+		kem.random = append(kem.random, randBytes(t, 32))
+	}
+	cfg.KemAlgo = kem
+
+	// generate both peers keys
+	var ss, es [2]*Keypair
+	var kss, kes [2]KemKey
+	for i := range 2 {
+		ss[i], err = cfg.CurveAlgo.GenerateKey(rand.Reader)
+		if nil != err {
+			t.Fatalf("Failed generating s, got error %v", err)
+		}
+		es[i], err = cfg.CurveAlgo.GenerateKey(rand.Reader)
+		if nil != err {
+			t.Fatalf("Failed generating e, got error %v", err)
+		}
+		kss[i], err = cfg.KemAlgo.GenerateKey()
+		if nil != err {
+			t.Fatalf("Failed generating s KemKey, got error %v", err)
+		}
+		kes[i], err = cfg.KemAlgo.GenerateKey()
+		if nil != err {
+			t.Fatalf("Failed generating e KemKey, got error %v", err)
+		}
+	}
+	prologue := []byte("John Galt")
+	psk := randBytes(t, pskKeySize)
+
+	// select the keys required by the HandshakePattern
+	var params [2]HandshakeParams
+	for i := range 2 {
+		peer := (i + 1) % 2
+		p := HandshakeParams{
+			Cfg:              cfg,
+			Initiator:        0 == i,
+			Prologue:         prologue,
+			EphemeralKeypair: es[i],
+		}
+		local, _ := cfg.HandshakePattern.listKemKeys(p.Initiator)
+		if slices.Contains(local, "e") {
+			p.EphemeralKemKey = kes[i]
+		}
+		for spec := range cfg.HandshakePattern.listInitSpecs(p.Initiator) {
+			switch spec.token {
+			case "s":
+				p.StaticKeypair = ss[i]
+			case "rs":
+				p.RemoteStaticKey = ss[peer].PublicKey()
+			case "re":
+				p.RemoteEphemeralKey = es[peer].PublicKey()
+			case "kems":
+				p.StaticKemKey = kss[i]
+			case "kemrs":
+				p.RemoteStaticKemKey = kss[peer].PublicKey()
+			case "kemre":
+				p.RemoteEphemeralKemKey = kes[peer].PublicKey()
+			case "psk":
+				p.Psks = [][]byte{psk}
+			}
+		}
+		params[i] = p
+	}
+
+	// run the handshake
+	hss := [2]HandshakeState{}
+	for i := range 2 {
+		err = hss[i].Initialize(params[i])
+		if nil != err {
+			t.Fatalf("Failed hss[%d] initialization, got error %v", i, err)
+		}
+	}
+	var msgs []TestMessage
+	var completed bool
+	var buf bytes.Buffer
+	for pos := 0; !completed; pos++ {
+		payload := []byte(kemVectorPayloads[pos%len(kemVectorPayloads)])
+		buf.Reset()
+		completed, err = hss[pos%2].WriteMessage(payload, &buf)
+		if nil != err {
+			t.Fatalf("msg[%d]: Failed WriteMessage, got error %v", pos, err)
+		}
+		_, err = hss[(pos+1)%2].ReadMessage(buf.Bytes(), new(bytes.Buffer))
+		if nil != err {
+			t.Fatalf("msg[%d]: Failed ReadMessage, got error %v", pos, err)
+		}
+		msgs = append(msgs, TestMessage{Payload: payload, CipherText: bytes.Clone(buf.Bytes())})
+	}
+
+	// add transport messages
+	var tcs [2]TransportCipherPair
+	for i := range 2 {
+		err = hss[i].Split(&tcs[i])
+		if nil != err {
+			t.Fatalf("Failed hss[%d].Split, got error %v", i, err)
+		}
+	}
+	for range 2 {
+		pos := len(msgs)
+		sender := pos % 2
+		if cfg.HandshakePattern.OneWay() {
+			sender = 0
+		}
+		payload := []byte(kemVectorPayloads[pos%len(kemVectorPayloads)])
+		ct, err := tcs[sender].Encryptor().EncryptWithAd(nil, payload)
+		if nil != err {
+			t.Fatalf("transport msg[%d]: Failed EncryptWithAd, got error %v", pos, err)
+		}
+		msgs = append(msgs, TestMessage{Payload: payload, CipherText: ct})
+	}
+
+	vec := TestVector{
+		ProtocolName:      protoname,
+		InitiatorPrologue: prologue,
+		ResponderPrologue: prologue,
+		HandshakeHash:     hss[0].GetHandshakeHash(),
+		Messages:          msgs,
+	}
+	for i, p := range params {
+		var s, e, kemS, kemE utils.HexBinary
+		var rs, re utils.HexBinary
+		var psks []utils.HexBinary
+		if nil != p.StaticKeypair {
+			s = p.StaticKeypair.Bytes()
+		}
+		if nil != p.EphemeralKeypair {
+			e = p.EphemeralKeypair.Bytes()
+		}
+		if nil != p.RemoteStaticKey {
+			rs = p.RemoteStaticKey.Bytes()
+		}
+		if nil != p.RemoteEphemeralKey {
+			re = p.RemoteEphemeralKey.Bytes()
+		}
+		if nil != p.StaticKemKey {
+			kemS = p.StaticKemKey.Bytes()
+		}
+		if nil != p.EphemeralKemKey {
+			kemE = p.EphemeralKemKey.Bytes()
+		}
+		for _, psk := range p.Psks {
+			psks = append(psks, psk)
+		}
+		if 0 == i {
+			vec.InitiatorStaticKey = s
+			vec.InitiatorEphemeralKey = e
+			vec.InitiatorRemoteStaticKey = rs
+			vec.InitiatorRemoteEphemeralKey = re
+			vec.InitiatorPsks = psks
+			vec.InitiatorStaticKemKey = kemS
+			vec.InitiatorEphemeralKemKey = kemE
+			vec.InitiatorRemoteStaticKemKey = p.RemoteStaticKemKey
+			vec.InitiatorRemoteEphemeralKemKey = p.RemoteEphemeralKemKey
+		} else {
+			vec.ResponderStaticKey = s
+			vec.ResponderEphemeralKey = e
+			vec.ResponderRemoteStaticKey = rs
+			vec.ResponderRemoteEphemeralKey = re
+			vec.ResponderPsks = psks
+			vec.ResponderStaticKemKey = kemS
+			vec.ResponderEphemeralKemKey = kemE
+			vec.ResponderRemoteStaticKemKey = p.RemoteStaticKemKey
+			vec.ResponderRemoteEphemeralKemKey = p.RemoteEphemeralKemKey
+		}
+	}
+	for _, random := range kem.random[:kem.used] {
+		vec.KemRandomness = append(vec.KemRandomness, random)
+	}
+
+	return vec
+}
+
+func randBytes(t *testing.T, size int) []byte {
+	rv := make([]byte, size)
+	_, err := rand.Read(rv)
+	if nil != err {
+		t.Fatalf("Failed rand.Read, got error %v", err)
+	}
+	return rv
+}
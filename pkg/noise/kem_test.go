@@ -0,0 +1,151 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestKemConfigMismatch(t *testing.T) {
+	for _, protoname := range []string{
+		"Noise_XX_25519+MLKEM768_ChaChaPoly_BLAKE2s",
+		"Noise_XXhfs_25519_ChaChaPoly_BLAKE2s",
+		"Noise_XXhfs_25519+unknown_ChaChaPoly_BLAKE2s",
+	} {
+		var cfg Config
+		err := cfg.Load(protoname)
+		if nil == err {
+			t.Errorf("Load succeeded with %s", protoname)
+		}
+	}
+}
+
+func TestKemHandshake(t *testing.T) {
+	var cfg Config
+	err := cfg.Load("Noise_IKhfs_25519+MLKEM768_ChaChaPoly_BLAKE2s")
+	if nil != err {
+		t.Fatalf("failed loading config, got error %v", err)
+	}
+	// both static keys are used for encapsulation
+	ptrn, err := NewPattern(`
+	<- s
+	...
+	-> e, es, skem, s, ss
+	<- e, ee, ekem, se, skem
+	`)
+	if nil != err {
+		t.Fatalf("failed NewPattern, got error %v", err)
+	}
+	cfg.HandshakePattern = *ptrn
+
+	var keys [2]*Keypair
+	var kemKeys [2]KemKey
+	for i := range 2 {
+		keys[i], err = cfg.CurveAlgo.GenerateKey(rand.Reader)
+		if nil != err {
+			t.Fatalf("failed generating static Keypair, got error %v", err)
+		}
+		kemKeys[i], err = cfg.KemAlgo.GenerateKey()
+		if nil != err {
+			t.Fatalf("failed generating static KemKey, got error %v", err)
+		}
+	}
+
+	cli := HandshakeState{}
+	err = cli.Initialize(HandshakeParams{
+		Cfg:                cfg,
+		Initiator:          true,
+		StaticKeypair:      keys[0],
+		StaticKemKey:       kemKeys[0],
+		RemoteStaticKey:    keys[1].PublicKey(),
+		RemoteStaticKemKey: kemKeys[1].PublicKey(),
+	})
+	if nil != err {
+		t.Fatalf("failed initiator Initialize, got error %v", err)
+	}
+	srv := HandshakeState{}
+	err = srv.Initialize(HandshakeParams{
+		Cfg:           cfg,
+		Initiator:     false,
+		StaticKeypair: keys[1],
+	})
+	if nil == err {
+		t.Fatal("responder Initialize succeeded without StaticKemKey")
+	}
+	err = srv.Initialize(HandshakeParams{
+		Cfg:           cfg,
+		Initiator:     false,
+		StaticKeypair: keys[1],
+		StaticKemKey:  kemKeys[1],
+	})
+	if nil != err {
+		t.Fatalf("failed responder Initialize, got error %v", err)
+	}
+
+	var msg, payload bytes.Buffer
+	for pos, hss := range [][2]*HandshakeState{{&cli, &srv}, {&srv, &cli}} {
+		msg.Reset()
+		payload.Reset()
+		_, err = hss[0].WriteMessage([]byte("payload"), &msg)
+		if nil != err {
+			t.Fatalf("msg[%d]: failed WriteMessage, got error %v", pos, err)
+		}
+		_, err = hss[1].ReadMessage(msg.Bytes(), &payload)
+		if nil != err {
+			t.Fatalf("msg[%d]: failed ReadMessage, got error %v", pos, err)
+		}
+		if "payload" != payload.String() {
+			t.Fatalf("msg[%d]: failed payload control", pos)
+		}
+	}
+	if !bytes.Equal(cli.GetHandshakeHash(), srv.GetHandshakeHash()) {
+		t.Fatal("failed HandshakeHash control")
+	}
+	if !bytes.Equal(srv.kemRs, kemKeys[0].PublicKey()) {
+		t.Fatal("failed responder remote static KEM key control")
+	}
+}
+
+// renamedKem registers an existing Kem under another name.
+type renamedKem struct {
+	Kem
+	name string
+}
+
+func (self renamedKem) Name() string {
+	return self.name
+}
+
+func TestRegisterKem(t *testing.T) {
+	base, err := GetKem(KEM_MLKEM768)
+	if nil != err {
+		t.Fatalf("failed GetKem, got error %v", err)
+	}
+	err = RegisterKem(base)
+	if nil == err {
+		t.Fatal("RegisterKem succeeded with a registered name")
+	}
+	err = RegisterKem(nil)
+	if nil == err {
+		t.Fatal("RegisterKem succeeded with nil kem")
+	}
+
+	if _, err = GetKem("TESTKEM"); nil != err { // registry is global, test may run more than once
+		MustRegisterKem(renamedKem{Kem: base, name: "TESTKEM"})
+	}
+	kem, err := GetKem("TESTKEM")
+	if nil != err {
+		t.Fatalf("failed GetKem, got error %v", err)
+	}
+	if "TESTKEM" != kem.Name() {
+		t.Fatalf("failed Name control, got %s", kem.Name())
+	}
+	var cfg Config
+	err = cfg.Load("Noise_XXhfs_25519+TESTKEM_ChaChaPoly_BLAKE2s")
+	if nil != err {
+		t.Fatalf("failed loading config, got error %v", err)
+	}
+	if "TESTKEM" != cfg.KemAlgo.Name() {
+		t.Fatalf("failed KemAlgo control, got %s", cfg.KemAlgo.Name())
+	}
+}
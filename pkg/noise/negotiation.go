@@ -0,0 +1,149 @@
+package noise
+
+import (
+	"encoding/binary"
+	"slices"
+)
+
+// negotiationPrologue prefixes the prologue derived from NegotiationData, as in NoiseSocket.
+const negotiationPrologue = "NoiseSocketInit1"
+
+// InitialMessage is a NoiseSocket like initiator first message.
+//
+// It transmits in clear NegotiationData that allows the responder to select keys & handshake
+// pattern before processing NoiseMessage. Both peers shall use Prologue as handshake prologue,
+// this authenticates NegotiationData.
+//
+// Wire format is negotiation_data_len (uint16) || negotiation_data || noise_message_len (uint16) || noise_message.
+type InitialMessage struct {
+	NegotiationData []byte
+	NoiseMessage    []byte
+}
+
+// Prologue returns the handshake prologue that authenticates NegotiationData.
+func (self *InitialMessage) Prologue() []byte {
+	rv := make([]byte, 0, len(negotiationPrologue)+2+len(self.NegotiationData))
+	rv = append(rv, negotiationPrologue...)
+	rv = binary.BigEndian.AppendUint16(rv, uint16(len(self.NegotiationData)))
+	return append(rv, self.NegotiationData...)
+}
+
+// AppendBinary appends the InitialMessage wire encoding to dst.
+// It errors if the encoded message is larger than the noise protocol message limit.
+func (self *InitialMessage) AppendBinary(dst []byte) ([]byte, error) {
+	if 4+len(self.NegotiationData)+len(self.NoiseMessage) > msgMaxSize {
+		return nil, newError("InitialMessage size exceeds %d", msgMaxSize)
+	}
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(self.NegotiationData)))
+	dst = append(dst, self.NegotiationData...)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(self.NoiseMessage)))
+	return append(dst, self.NoiseMessage...), nil
+}
+
+// UnmarshalBinary loads the InitialMessage from its wire encoding.
+// The InitialMessage fields reference msg memory.
+func (self *InitialMessage) UnmarshalBinary(msg []byte) error {
+	data, rest, err := readUint16Prefixed(msg)
+	if nil != err {
+		return wrapError(err, "failed reading negotiation_data")
+	}
+	nmsg, rest, err := readUint16Prefixed(rest)
+	if nil != err {
+		return wrapError(err, "failed reading noise_message")
+	}
+	if len(rest) > 0 {
+		return newError("invalid InitialMessage, %d trailing bytes", len(rest))
+	}
+	self.NegotiationData = data
+	self.NoiseMessage = nmsg
+
+	return nil
+}
+
+// PayloadExtension is a typed extension transmitted after a handshake payload body.
+type PayloadExtension struct {
+	Type uint16
+	Data []byte
+}
+
+// Payload is a handshake payload made of a body followed by typed, length delimited extensions.
+//
+// Wire format is body_len (uint16) || body || extensions, where each extension is
+// type (uint16) || data_len (uint16) || data. Extension types shall be unique.
+type Payload struct {
+	Body       []byte
+	Extensions []PayloadExtension
+}
+
+// Extension returns the Data of the extension with type typ.
+func (self *Payload) Extension(typ uint16) ([]byte, bool) {
+	idx := slices.IndexFunc(self.Extensions, func(ext PayloadExtension) bool { return typ == ext.Type })
+	if idx < 0 {
+		return nil, false
+	}
+	return self.Extensions[idx].Data, true
+}
+
+// AppendBinary appends the Payload wire encoding to dst.
+// It errors if extension types are not unique or if an element is too large.
+func (self *Payload) AppendBinary(dst []byte) ([]byte, error) {
+	if len(self.Body) > msgMaxSize {
+		return nil, newError("Body size exceeds %d", msgMaxSize)
+	}
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(self.Body)))
+	dst = append(dst, self.Body...)
+	for pos, ext := range self.Extensions {
+		if slices.ContainsFunc(self.Extensions[:pos], func(prev PayloadExtension) bool { return ext.Type == prev.Type }) {
+			return nil, newError("duplicate extension type %d", ext.Type)
+		}
+		if len(ext.Data) > msgMaxSize {
+			return nil, newError("extension %d Data size exceeds %d", ext.Type, msgMaxSize)
+		}
+		dst = binary.BigEndian.AppendUint16(dst, ext.Type)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(len(ext.Data)))
+		dst = append(dst, ext.Data...)
+	}
+
+	return dst, nil
+}
+
+// UnmarshalBinary loads the Payload from its wire encoding.
+// The Payload fields reference data memory.
+func (self *Payload) UnmarshalBinary(data []byte) error {
+	body, rest, err := readUint16Prefixed(data)
+	if nil != err {
+		return wrapError(err, "failed reading body")
+	}
+	var exts []PayloadExtension
+	for len(rest) > 0 {
+		if len(rest) < 2 {
+			return newError("invalid extension, missing type")
+		}
+		ext := PayloadExtension{Type: binary.BigEndian.Uint16(rest)}
+		ext.Data, rest, err = readUint16Prefixed(rest[2:])
+		if nil != err {
+			return wrapError(err, "failed reading extension %d", ext.Type)
+		}
+		if slices.ContainsFunc(exts, func(prev PayloadExtension) bool { return ext.Type == prev.Type }) {
+			return newError("duplicate extension type %d", ext.Type)
+		}
+		exts = append(exts, ext)
+	}
+	self.Body = body
+	self.Extensions = exts
+
+	return nil
+}
+
+// readUint16Prefixed splits data into a uint16 length prefixed field and the remaining bytes.
+func readUint16Prefixed(data []byte) (field, rest []byte, err error) {
+	if len(data) < 2 {
+		return nil, nil, newError("missing length prefix")
+	}
+	size := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < size {
+		return nil, nil, newError("invalid length %d, only %d bytes available", size, len(data))
+	}
+	return data[:size], data[size:], nil
+}
@@ -0,0 +1,181 @@
+package noise
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestInitialMessageRoundTrip(t *testing.T) {
+	testcases := []InitialMessage{
+		{NegotiationData: []byte("negotiation"), NoiseMessage: []byte("noise")},
+		{NegotiationData: []byte{}, NoiseMessage: []byte("noise")},
+		{NegotiationData: []byte("negotiation"), NoiseMessage: []byte{}},
+	}
+	for pos, tc := range testcases {
+		srz, err := tc.AppendBinary(nil)
+		if nil != err {
+			t.Fatalf("case#%d: failed AppendBinary, got error %v", pos, err)
+		}
+		var msg InitialMessage
+		err = msg.UnmarshalBinary(srz)
+		if nil != err {
+			t.Fatalf("case#%d: failed UnmarshalBinary, got error %v", pos, err)
+		}
+		if !reflect.DeepEqual(tc, msg) {
+			t.Fatalf("case#%d: failed InitialMessage control, got %+v", pos, msg)
+		}
+	}
+}
+
+func TestInitialMessageInvalid(t *testing.T) {
+	testcases := [][]byte{
+		nil,
+		{0x00},
+		{0x00, 0x02, 'a'},
+		{0x00, 0x01, 'a'},
+		{0x00, 0x01, 'a', 0x00, 0x01},
+		{0x00, 0x01, 'a', 0x00, 0x01, 'b', 'c'},
+	}
+	for pos, tc := range testcases {
+		var msg InitialMessage
+		err := msg.UnmarshalBinary(tc)
+		if nil == err {
+			t.Errorf("case#%d: UnmarshalBinary succeeded", pos)
+		}
+	}
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+	testcases := []Payload{
+		{Body: []byte("body")},
+		{Body: []byte{}, Extensions: []PayloadExtension{{Type: 1, Data: []byte{}}}},
+		{Body: []byte("body"), Extensions: []PayloadExtension{{Type: 1, Data: []byte("one")}, {Type: 2, Data: []byte("two")}}},
+	}
+	for pos, tc := range testcases {
+		srz, err := tc.AppendBinary(nil)
+		if nil != err {
+			t.Fatalf("case#%d: failed AppendBinary, got error %v", pos, err)
+		}
+		var payload Payload
+		err = payload.UnmarshalBinary(srz)
+		if nil != err {
+			t.Fatalf("case#%d: failed UnmarshalBinary, got error %v", pos, err)
+		}
+		if !reflect.DeepEqual(tc, payload) {
+			t.Fatalf("case#%d: failed Payload control, got %+v", pos, payload)
+		}
+		for _, ext := range tc.Extensions {
+			data, found := payload.Extension(ext.Type)
+			if !found || !bytes.Equal(ext.Data, data) {
+				t.Fatalf("case#%d: failed Extension(%d) control", pos, ext.Type)
+			}
+		}
+		_, found := payload.Extension(0xFFFF)
+		if found {
+			t.Fatalf("case#%d: found unexpected extension", pos)
+		}
+	}
+}
+
+func TestPayloadInvalid(t *testing.T) {
+	dup := Payload{Extensions: []PayloadExtension{{Type: 1}, {Type: 1}}}
+	_, err := dup.AppendBinary(nil)
+	if nil == err {
+		t.Fatal("AppendBinary succeeded with duplicate extension types")
+	}
+
+	testcases := [][]byte{
+		nil,
+		{0x00, 0x01},
+		{0x00, 0x00, 0x00},
+		{0x00, 0x00, 0x00, 0x01, 0x00, 0x02, 'a'},
+		{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00},
+	}
+	for pos, tc := range testcases {
+		var payload Payload
+		err = payload.UnmarshalBinary(tc)
+		if nil == err {
+			t.Errorf("case#%d: UnmarshalBinary succeeded", pos)
+		}
+	}
+}
+
+func TestInitialMessagePrologue(t *testing.T) {
+	var cfg Config
+	err := cfg.Load("Noise_NN_25519_ChaChaPoly_BLAKE2s")
+	if nil != err {
+		t.Fatalf("failed loading config, got error %v", err)
+	}
+
+	// initiator sends NegotiationData with its first message
+	cli := HandshakeState{}
+	sent := InitialMessage{NegotiationData: []byte("realm=kerpass")}
+	err = cli.Initialize(HandshakeParams{Cfg: cfg, Initiator: true, Prologue: sent.Prologue()})
+	if nil != err {
+		t.Fatalf("failed initiator Initialize, got error %v", err)
+	}
+	var buf bytes.Buffer
+	_, err = cli.WriteMessage(nil, &buf)
+	if nil != err {
+		t.Fatalf("failed WriteMessage, got error %v", err)
+	}
+	sent.NoiseMessage = buf.Bytes()
+	srz, err := sent.AppendBinary(nil)
+	if nil != err {
+		t.Fatalf("failed AppendBinary, got error %v", err)
+	}
+
+	for _, tampered := range []bool{false, true} {
+		rcvd := InitialMessage{}
+		err = rcvd.UnmarshalBinary(bytes.Clone(srz))
+		if nil != err {
+			t.Fatalf("failed UnmarshalBinary, got error %v", err)
+		}
+		if tampered {
+			rcvd.NegotiationData[0] ^= 1
+		}
+
+		// responder answers using a Payload with extension
+		srv := HandshakeState{}
+		err = srv.Initialize(HandshakeParams{Cfg: cfg, Initiator: false, Prologue: rcvd.Prologue()})
+		if nil != err {
+			t.Fatalf("failed responder Initialize, got error %v", err)
+		}
+		_, err = srv.ReadMessage(rcvd.NoiseMessage, new(bytes.Buffer))
+		if nil != err {
+			t.Fatalf("failed ReadMessage, got error %v", err)
+		}
+		payload := Payload{Body: []byte("body"), Extensions: []PayloadExtension{{Type: 1, Data: []byte{1}}}}
+		srzpayload, err := payload.AppendBinary(nil)
+		if nil != err {
+			t.Fatalf("failed Payload AppendBinary, got error %v", err)
+		}
+		buf.Reset()
+		_, err = srv.WriteMessage(srzpayload, &buf)
+		if nil != err {
+			t.Fatalf("failed WriteMessage, got error %v", err)
+		}
+
+		initiator := cli
+		var plaintext bytes.Buffer
+		_, err = initiator.ReadMessage(buf.Bytes(), &plaintext)
+		if tampered {
+			if nil == err {
+				t.Fatal("initiator accepted handshake with tampered NegotiationData")
+			}
+			continue
+		}
+		if nil != err {
+			t.Fatalf("failed ReadMessage, got error %v", err)
+		}
+		rpayload := Payload{}
+		err = rpayload.UnmarshalBinary(plaintext.Bytes())
+		if nil != err {
+			t.Fatalf("failed Payload UnmarshalBinary, got error %v", err)
+		}
+		if !reflect.DeepEqual(payload, rpayload) {
+			t.Fatalf("failed Payload control, got %+v", rpayload)
+		}
+	}
+}
@@ -14,7 +14,7 @@ const (
 	bob   = "<-"
 	right = "<-"
 
-	valid_tokens  = "e s ee es se ss psk"
+	valid_tokens  = "e s ee es se ss psk ekem skem"
 	valid_senders = "-> <-"
 )
 
@@ -24,6 +24,7 @@ type HandshakePattern struct {
 	msgs      []msgPtrn
 	oneway    bool
 	initspecs [2][]initSpec
+	kemkeys   [2][]string
 }
 
 // NewPattern parses dsl that contains a noise protocol handshake description and constructs
@@ -79,6 +80,8 @@ func NewPattern(dsl string) (*HandshakePattern, error) {
 				preAllow = false // DH operation can not be inside pre message
 			case "psk":
 				preAllow = false // psk can not be inside pre message
+			case "ekem", "skem":
+				preAllow = false // KEM operation can not be inside pre message
 			default:
 				return nil, newError("invalid token %s", token)
 			}
@@ -131,6 +134,12 @@ func (self HandshakePattern) OneWay() bool {
 	return self.oneway
 }
 
+// UsesKem returns true if the HandshakePattern contains ekem or skem tokens.
+// Such patterns require a Config with a KemAlgo.
+func (self HandshakePattern) UsesKem() bool {
+	return len(self.kemkeys[0]) > 0 || len(self.kemkeys[1]) > 0
+}
+
 // Dsl returns a string that encodes the HandshakePattern using noise protocol specs pattern definition
 // language.
 //
@@ -165,6 +174,14 @@ func (self *HandshakePattern) listInitSpecs(initiator bool) iter.Seq[initSpec] {
 	return slices.Values(self.initspecs[roleIdx])
 }
 
+// listKemKeys returns the local & remote keys ("e" or "s") that carry a KEM encapsulation key.
+func (self *HandshakePattern) listKemKeys(initiator bool) (local []string, remote []string) {
+	if initiator {
+		return self.kemkeys[0], self.kemkeys[1]
+	}
+	return self.kemkeys[1], self.kemkeys[0]
+}
+
 // msgPtrns copies the HandshakePattern messages into the dst slice.
 func (self HandshakePattern) msgPtrns(dst []msgPtrn) []msgPtrn {
 	dst = append(dst, self.msgs...)
@@ -242,8 +259,9 @@ func (self *HandshakePattern) init() error {
 	}
 
 	// check the msgs
-	var pskCount int
+	var pskCount, peerIdx int
 	lrSTransmits := [2]bool{}
+	kemkeys := [2][]string{}
 	prevSender = ""
 	for _, msg := range self.msgs {
 		sender = msg.sender
@@ -283,6 +301,14 @@ func (self *HandshakePattern) init() error {
 				lrTokens[senderIdx] = append(lrTokens[senderIdx], token)
 			case "psk":
 				pskCount += 1
+			case "ekem", "skem":
+				// error if peer key used for encapsulation was not previously forwarded
+				peerIdx = (senderIdx + 1) % 2
+				if !slices.Contains(lrTokens[peerIdx], token[:1]) {
+					return newError("invalid pattern, missing peer %s for %s", token[:1], token)
+				}
+				kemkeys[peerIdx] = append(kemkeys[peerIdx], token[:1])
+				lrTokens[senderIdx] = append(lrTokens[senderIdx], token)
 			default:
 				return newError("invalid pattern, invalid token %s appears in msgs", token)
 			}
@@ -323,6 +349,20 @@ func (self *HandshakePattern) init() error {
 				specs = append(specs, initSpec{token: "s", size: 1})
 			}
 		}
+
+		// KEM encapsulation keys follow the DH keys, keeping initiator keys first
+		for pos, pfx := range pfxs {
+			for _, tkn := range kemkeys[pos] {
+				pfxtkn = pfx + tkn
+				switch {
+				case slices.Contains(premsgs[pos].tokens, tkn):
+					specs = append(specs, initSpec{token: "kem" + pfxtkn, hash: true, size: 1})
+				case "s" == pfxtkn:
+					specs = append(specs, initSpec{token: "kems", size: 1})
+				}
+			}
+		}
+
 		if pskCount > 0 {
 			specs = append(specs, initSpec{token: "psk", size: pskCount})
 		}
@@ -344,6 +384,7 @@ func (self *HandshakePattern) init() error {
 	self.initspecs = initspecs
 	self.premsgs = premsgs
 	self.oneway = oneway
+	self.kemkeys = kemkeys
 
 	return nil
 }
@@ -1,6 +1,7 @@
 package noise
 
 import (
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -26,6 +27,8 @@ func GetModifier(name string) (PatternModifier, error) {
 		return pskModifier{pos: uint(num)}, nil
 	case name == "fallback":
 		return fallbackModifier{}, nil
+	case name == "hfs":
+		return hfsModifier{}, nil
 	default:
 		return nil, newError("invalid modifier %s", name)
 	}
@@ -102,3 +105,37 @@ func (_ fallbackModifier) Modify(ptrn HandshakePattern) (HandshakePattern, error
 	err := ptrn.init()
 	return ptrn, err
 }
+
+// hfsModifier is a PatternModifier that adds hybrid forward secrecy to a handshake.
+//
+// It inserts an ekem token right after the ee token, the ephemeral KEM shared secret is then mixed
+// in the handshake alongside the ee DH shared secret.
+type hfsModifier struct{}
+
+// Modify returns a modified HandshakePattern.
+func (_ hfsModifier) Modify(ptrn HandshakePattern) (HandshakePattern, error) {
+	msgs := make([]msgPtrn, len(ptrn.msgs))
+	copy(msgs, ptrn.msgs)
+
+	var found bool
+	for pos, msg := range msgs {
+		eeIdx := slices.Index(msg.tokens, "ee")
+		if eeIdx < 0 {
+			continue
+		}
+		tokens := make([]string, 0, 1+len(msg.tokens))
+		tokens = append(tokens, msg.tokens[:eeIdx+1]...)
+		tokens = append(tokens, "ekem")
+		tokens = append(tokens, msg.tokens[eeIdx+1:]...)
+		msgs[pos].tokens = tokens
+		found = true
+		break
+	}
+	if !found {
+		return ptrn, newError("can not apply hfs modifier, no ee token")
+	}
+	ptrn.msgs = msgs
+
+	err := ptrn.init()
+	return ptrn, err
+}
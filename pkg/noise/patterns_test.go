@@ -190,6 +190,56 @@ func TestNewPattern(t *testing.T) {
 				oneway: true,
 			},
 		},
+		{
+			// dsl is a hybrid IK with KEM tokens
+			dsl: `
+			<- s
+			...
+			-> e, es, skem, s, ss
+			<- e, ee, ekem, se, skem
+			`,
+			expect: HandshakePattern{
+				initspecs: [2][]initSpec{
+					[]initSpec{
+						{token: "rs", hash: true, size: 1},
+						{token: "s", size: 1},
+						{token: "kems", size: 1},
+						{token: "kemrs", hash: true, size: 1},
+					},
+					[]initSpec{
+						{token: "s", hash: true, size: 1},
+						{token: "kems", hash: true, size: 1},
+						{token: "verifiers", size: 1},
+					},
+				},
+				premsgs: [2]msgPtrn{
+					{sender: "->", tokens: nil},
+					{sender: "<-", tokens: []string{"s"}},
+				},
+				msgs: []msgPtrn{
+					{sender: "->", tokens: []string{"e", "es", "skem", "s", "ss"}},
+					{sender: "<-", tokens: []string{"e", "ee", "ekem", "se", "skem"}},
+				},
+				kemkeys: [2][]string{{"e", "s"}, {"s"}},
+			},
+		},
+		{
+			// fail as ekem miss peer ephemeral key
+			dsl: `
+			-> e, ekem
+			<- e, ee
+			`,
+			fail: true,
+		},
+		{
+			// fail as skem can not appear in premsgs
+			dsl: `
+			<- s, skem
+			...
+			-> e, es
+			`,
+			fail: true,
+		},
 		{
 			// fail as first ee pattern miss right ephemeral key
 			dsl: `
@@ -0,0 +1,352 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/rand"
+
+	"code.kerpass.org/golang/internal/transport"
+)
+
+// PipeMode identifies the handshake that established a Noise Pipe.
+type PipeMode byte
+
+const (
+	// PipeFull is a full XX handshake, used when the initiator has no cached responder static key.
+	PipeFull PipeMode = iota
+
+	// PipeResumed is a zero round trip IK handshake, using the cached responder static key.
+	PipeResumed
+
+	// PipeFallback is an XXfallback handshake, used when the responder failed decrypting the IK
+	// initial message, for example because the cached responder static key is stale.
+	PipeFallback
+)
+
+// String returns the PipeMode handshake pattern name.
+func (self PipeMode) String() string {
+	switch self {
+	case PipeFull:
+		return "XX"
+	case PipeResumed:
+		return "IK"
+	case PipeFallback:
+		return "XXfallback"
+	default:
+		return "invalid"
+	}
+}
+
+// PipeCfg holds Noise Pipes configuration.
+//
+// Noise Pipes appear in section 10.4 of the noise protocol specs. Each peer first handshake message
+// is prefixed by a PipeMode byte, this allows the initiator to detect that the responder switched
+// to XXfallback.
+type PipeCfg struct {
+	// Algos is the protocol name suffix that selects the DH, cipher & hash algorithms,
+	// eg "25519_ChaChaPoly_BLAKE2s".
+	Algos string
+
+	// Prologue is mixed in the handshake hash, both peers shall use the same Prologue.
+	Prologue []byte
+
+	// StaticKeypair is the local static Keypair, it is required by both peers.
+	StaticKeypair *Keypair
+
+	// RemoteStaticKey is the responder static key cached by the initiator.
+	// When nil, the initiator runs a full XX handshake. It is ignored by the responder.
+	RemoteStaticKey *PublicKey
+}
+
+// PipeResult holds the outcome of a Noise Pipes handshake.
+type PipeResult struct {
+	Ciphers TransportCipherPair
+
+	// RemoteStaticKey is the peer static key, the initiator should cache it for next handshake.
+	RemoteStaticKey *PublicKey
+
+	Mode PipeMode
+}
+
+// Initiate runs the initiator side of a Noise Pipes handshake over tr.
+// It tries IK if RemoteStaticKey is set, and transparently continues with XXfallback if the
+// responder could not process the IK initial message.
+func (self *PipeCfg) Initiate(tr transport.Transport, dst *PipeResult) error {
+	if nil == dst {
+		return newError("invalid dst, can not be nil")
+	}
+	if nil == self.StaticKeypair {
+		return newError("nil StaticKeypair")
+	}
+	if nil == self.RemoteStaticKey {
+		return self.initiateFull(tr, dst)
+	}
+
+	cfg, err := self.config(PipeResumed)
+	if nil != err {
+		return err
+	}
+	e, err := cfg.CurveAlgo.GenerateKey(rand.Reader)
+	if nil != err {
+		return wrapError(err, "failed generating e Keypair")
+	}
+	hs := HandshakeState{}
+	err = hs.Initialize(HandshakeParams{
+		Cfg:              cfg,
+		Initiator:        true,
+		Prologue:         self.Prologue,
+		StaticKeypair:    self.StaticKeypair,
+		EphemeralKeypair: e,
+		RemoteStaticKey:  self.RemoteStaticKey,
+	})
+	if nil != err {
+		return wrapError(err, "failed IK handshake initialization")
+	}
+
+	// -> e, es, s, ss
+	err = pipeWrite(tr, &hs, []byte{byte(PipeResumed)})
+	if nil != err {
+		return err
+	}
+
+	// <- e, ee, se or XXfallback <- e, ee, s, es
+	msg, err := tr.ReadBytes()
+	if nil != err {
+		return wrapError(err, "failed reading responder message")
+	}
+	if 0 == len(msg) {
+		return newError("empty responder message")
+	}
+	switch PipeMode(msg[0]) {
+	case PipeResumed:
+		_, err = hs.ReadMessage(msg[1:], new(bytes.Buffer))
+		if nil != err {
+			return wrapError(err, "failed reading IK responder message")
+		}
+		return pipeSplit(&hs, PipeResumed, dst)
+	case PipeFallback:
+		// initiator becomes the XXfallback responder, reusing its IK e Keypair
+		cfg, err = self.config(PipeFallback)
+		if nil != err {
+			return err
+		}
+		hs = HandshakeState{}
+		err = hs.Initialize(HandshakeParams{
+			Cfg:              cfg,
+			Initiator:        false,
+			Prologue:         self.Prologue,
+			StaticKeypair:    self.StaticKeypair,
+			EphemeralKeypair: e,
+		})
+		if nil != err {
+			return wrapError(err, "failed XXfallback handshake initialization")
+		}
+		_, err = hs.ReadMessage(msg[1:], new(bytes.Buffer))
+		if nil != err {
+			return wrapError(err, "failed reading XXfallback responder message")
+		}
+		// -> s, se
+		err = pipeWrite(tr, &hs, nil)
+		if nil != err {
+			return err
+		}
+		return pipeSplit(&hs, PipeFallback, dst)
+	default:
+		return newError("invalid responder PipeMode %d", msg[0])
+	}
+}
+
+// Respond runs the responder side of a Noise Pipes handshake over tr.
+// It switches to XXfallback if it fails processing an IK initial message.
+func (self *PipeCfg) Respond(tr transport.Transport, dst *PipeResult) error {
+	if nil == dst {
+		return newError("invalid dst, can not be nil")
+	}
+	if nil == self.StaticKeypair {
+		return newError("nil StaticKeypair")
+	}
+
+	msg, err := tr.ReadBytes()
+	if nil != err {
+		return wrapError(err, "failed reading initiator message")
+	}
+	if 0 == len(msg) {
+		return newError("empty initiator message")
+	}
+	mode := PipeMode(msg[0])
+	msg = msg[1:]
+	switch mode {
+	case PipeFull, PipeResumed:
+	default:
+		return newError("invalid initiator PipeMode %d", mode)
+	}
+
+	cfg, err := self.config(mode)
+	if nil != err {
+		return err
+	}
+	hs := HandshakeState{}
+	err = hs.Initialize(HandshakeParams{
+		Cfg:           cfg,
+		Initiator:     false,
+		Prologue:      self.Prologue,
+		StaticKeypair: self.StaticKeypair,
+	})
+	if nil != err {
+		return wrapError(err, "failed %s handshake initialization", mode)
+	}
+	_, err = hs.ReadMessage(msg, new(bytes.Buffer))
+	if nil != err && PipeResumed == mode {
+		return self.respondFallback(tr, msg, dst)
+	}
+	if nil != err {
+		return wrapError(err, "failed reading XX initiator message")
+	}
+
+	// XX <- e, ee, s, es or IK <- e, ee, se
+	err = pipeWrite(tr, &hs, []byte{byte(mode)})
+	if nil != err {
+		return err
+	}
+	if PipeFull == mode {
+		// -> s, se
+		err = pipeRead(tr, &hs)
+		if nil != err {
+			return err
+		}
+	}
+
+	return pipeSplit(&hs, mode, dst)
+}
+
+// initiateFull runs the initiator side of an XX handshake.
+func (self *PipeCfg) initiateFull(tr transport.Transport, dst *PipeResult) error {
+	cfg, err := self.config(PipeFull)
+	if nil != err {
+		return err
+	}
+	hs := HandshakeState{}
+	err = hs.Initialize(HandshakeParams{
+		Cfg:           cfg,
+		Initiator:     true,
+		Prologue:      self.Prologue,
+		StaticKeypair: self.StaticKeypair,
+	})
+	if nil != err {
+		return wrapError(err, "failed XX handshake initialization")
+	}
+
+	// -> e
+	err = pipeWrite(tr, &hs, []byte{byte(PipeFull)})
+	if nil != err {
+		return err
+	}
+
+	// <- e, ee, s, es
+	msg, err := tr.ReadBytes()
+	if nil != err {
+		return wrapError(err, "failed reading responder message")
+	}
+	if 0 == len(msg) || PipeFull != PipeMode(msg[0]) {
+		return newError("invalid responder message, expecting XX")
+	}
+	_, err = hs.ReadMessage(msg[1:], new(bytes.Buffer))
+	if nil != err {
+		return wrapError(err, "failed reading XX responder message")
+	}
+
+	// -> s, se
+	err = pipeWrite(tr, &hs, nil)
+	if nil != err {
+		return err
+	}
+
+	return pipeSplit(&hs, PipeFull, dst)
+}
+
+// respondFallback runs the XXfallback handshake after failing to process IK initial message msg.
+func (self *PipeCfg) respondFallback(tr transport.Transport, msg []byte, dst *PipeResult) error {
+	cfg, err := self.config(PipeFallback)
+	if nil != err {
+		return err
+	}
+
+	// recover initiator e PublicKey, it is transmitted in clear at the start of msg
+	pubkeysize := cfg.CurveAlgo.PublicKeyLen()
+	if len(msg) < pubkeysize {
+		return newError("IK initiator message too small for e PublicKey")
+	}
+	re, err := cfg.CurveAlgo.NewPublicKey(msg[:pubkeysize])
+	if nil != err {
+		return wrapError(err, "received invalid e PublicKey")
+	}
+
+	// responder becomes the XXfallback initiator
+	hs := HandshakeState{}
+	err = hs.Initialize(HandshakeParams{
+		Cfg:                cfg,
+		Initiator:          true,
+		Prologue:           self.Prologue,
+		StaticKeypair:      self.StaticKeypair,
+		RemoteEphemeralKey: re,
+	})
+	if nil != err {
+		return wrapError(err, "failed XXfallback handshake initialization")
+	}
+
+	// <- e, ee, s, es
+	err = pipeWrite(tr, &hs, []byte{byte(PipeFallback)})
+	if nil != err {
+		return err
+	}
+
+	// -> s, se
+	err = pipeRead(tr, &hs)
+	if nil != err {
+		return err
+	}
+
+	return pipeSplit(&hs, PipeFallback, dst)
+}
+
+// config loads the Config of the mode handshake.
+func (self *PipeCfg) config(mode PipeMode) (Config, error) {
+	var cfg Config
+	err := cfg.Load("Noise_" + mode.String() + "_" + self.Algos)
+
+	return cfg, wrapError(err, "failed loading %s Config", mode)
+}
+
+// pipeWrite writes next hs message prefixed by tag to tr.
+func pipeWrite(tr transport.Transport, hs *HandshakeState, tag []byte) error {
+	var buf bytes.Buffer
+	buf.Write(tag)
+	_, err := hs.WriteMessage(nil, &buf)
+	if nil != err {
+		return wrapError(err, "failed generating handshake message")
+	}
+
+	return wrapError(tr.WriteBytes(buf.Bytes()), "failed writing handshake message")
+}
+
+// pipeRead reads next hs message from tr.
+func pipeRead(tr transport.Transport, hs *HandshakeState) error {
+	msg, err := tr.ReadBytes()
+	if nil != err {
+		return wrapError(err, "failed reading handshake message")
+	}
+	_, err = hs.ReadMessage(msg, new(bytes.Buffer))
+
+	return wrapError(err, "failed processing handshake message")
+}
+
+// pipeSplit sets dst using completed handshake hs.
+func pipeSplit(hs *HandshakeState, mode PipeMode, dst *PipeResult) error {
+	err := hs.Split(&dst.Ciphers)
+	if nil != err {
+		return wrapError(err, "failed Split")
+	}
+	dst.RemoteStaticKey = hs.RemoteStaticKey()
+	dst.Mode = mode
+
+	return nil
+}
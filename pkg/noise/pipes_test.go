@@ -0,0 +1,118 @@
+package noise
+
+import (
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"code.kerpass.org/golang/internal/transport"
+)
+
+func TestPipes(t *testing.T) {
+	const algos = "25519_ChaChaPoly_BLAKE2s"
+	var cfg Config
+	err := cfg.Load("Noise_XX_" + algos)
+	if nil != err {
+		t.Fatalf("failed loading config, got error %v", err)
+	}
+	newKey := func() *Keypair {
+		kp, err := cfg.CurveAlgo.GenerateKey(rand.Reader)
+		if nil != err {
+			t.Fatalf("failed generating static key, got error %v", err)
+		}
+		return kp
+	}
+	srvKey := newKey()
+	cliCfg := PipeCfg{Algos: algos, Prologue: []byte("pipes"), StaticKeypair: newKey()}
+	srvCfg := PipeCfg{Algos: algos, Prologue: []byte("pipes"), StaticKeypair: srvKey}
+
+	// first contact, client learns server static key
+	cli, srv := runPipe(t, cliCfg, srvCfg)
+	checkPipe(t, cli, srv, PipeFull)
+	if !cli.RemoteStaticKey.Equal(srvKey.PublicKey()) {
+		t.Fatal("failed client RemoteStaticKey control")
+	}
+	if !srv.RemoteStaticKey.Equal(cliCfg.StaticKeypair.PublicKey()) {
+		t.Fatal("failed server RemoteStaticKey control")
+	}
+
+	// returning client resumes with cached key
+	cliCfg.RemoteStaticKey = cli.RemoteStaticKey
+	cli, srv = runPipe(t, cliCfg, srvCfg)
+	checkPipe(t, cli, srv, PipeResumed)
+
+	// server rotated its static key, client falls back to XX
+	srvCfg.StaticKeypair = newKey()
+	cli, srv = runPipe(t, cliCfg, srvCfg)
+	checkPipe(t, cli, srv, PipeFallback)
+	if !cli.RemoteStaticKey.Equal(srvCfg.StaticKeypair.PublicKey()) {
+		t.Fatal("failed fallback client RemoteStaticKey control")
+	}
+}
+
+func TestPipesInvalidMode(t *testing.T) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	deadline := time.Now().Add(500 * time.Millisecond)
+	c.SetDeadline(deadline)
+	s.SetDeadline(deadline)
+
+	go transport.RWTransport{R: c, W: c}.WriteBytes([]byte{0xFF, 1, 2, 3})
+	var cfg Config
+	cfg.Load("Noise_XX_25519_AESGCM_SHA256")
+	kp, _ := cfg.CurveAlgo.GenerateKey(rand.Reader)
+	srvCfg := PipeCfg{Algos: "25519_AESGCM_SHA256", StaticKeypair: kp}
+	err := srvCfg.Respond(transport.RWTransport{R: s, W: s}, &PipeResult{})
+	if nil == err {
+		t.Fatal("Respond succeeded with invalid PipeMode")
+	}
+}
+
+// runPipe runs a Noise Pipes handshake over a net.Pipe.
+func runPipe(t *testing.T, cliCfg, srvCfg PipeCfg) (*PipeResult, *PipeResult) {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	deadline := time.Now().Add(time.Second)
+	c.SetDeadline(deadline)
+	s.SetDeadline(deadline)
+
+	srv := &PipeResult{}
+	srvErr := make(chan error, 1)
+	go func() {
+		srvErr <- srvCfg.Respond(transport.RWTransport{R: s, W: s}, srv)
+	}()
+	cli := &PipeResult{}
+	err := cliCfg.Initiate(transport.RWTransport{R: c, W: c}, cli)
+	if nil != err {
+		t.Fatalf("failed Initiate, got error %v", err)
+	}
+	err = <-srvErr
+	if nil != err {
+		t.Fatalf("failed Respond, got error %v", err)
+	}
+
+	return cli, srv
+}
+
+// checkPipe verifies that cli & srv established the same ciphers using mode.
+func checkPipe(t *testing.T, cli, srv *PipeResult, mode PipeMode) {
+	if mode != cli.Mode || mode != srv.Mode {
+		t.Fatalf("failed mode control, got cli %s & srv %s, expected %s", cli.Mode, srv.Mode, mode)
+	}
+	for i, pair := range [][2]*TransportCipher{
+		{cli.Ciphers.Encryptor(), srv.Ciphers.Decryptor()},
+		{srv.Ciphers.Encryptor(), cli.Ciphers.Decryptor()},
+	} {
+		ct, err := pair[0].EncryptWithAd(nil, []byte("message"))
+		if nil != err {
+			t.Fatalf("#%d: failed EncryptWithAd, got error %v", i, err)
+		}
+		pt, err := pair[1].DecryptWithAd(nil, ct)
+		if nil != err || "message" != string(pt) {
+			t.Fatalf("#%d: failed DecryptWithAd, got error %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package noise
+
+import (
+	"sync"
+
+	"code.kerpass.org/golang/internal/transport"
+)
+
+// SecureTransportCfg holds SecureTransport configuration.
+type SecureTransportCfg struct {
+	// RekeyInterval is the number of messages after which a TransportCipher is rekeyed.
+	// 0 disables periodic rekeying. Both peers shall use the same RekeyInterval.
+	RekeyInterval uint64
+
+	// Ad is the associated data used by ReadBytes & WriteBytes. It maybe nil.
+	// Both peers shall use the same Ad.
+	Ad []byte
+}
+
+// SecureTransport is a transport.Transport that encrypts the messages it exchanges over an inner
+// transport.Transport using the TransportCipherPair obtained at the end of a noise handshake.
+//
+// SecureTransport expects the inner Transport to deliver messages reliably and in order, as TransportCipher
+// nonces are not transmitted. When a TransportCipher nonce reaches its limit, the cipher is rekeyed and its
+// nonce reset, as both peers do this at the same message, the exchange can continue.
+type SecureTransport struct {
+	inner         transport.Transport
+	ciphers       TransportCipherPair
+	rekeyInterval uint64
+	ad            []byte
+	rmut          sync.Mutex
+	wmut          sync.Mutex
+	rcount        uint64
+	wcount        uint64
+}
+
+// NewSecureTransport returns a SecureTransport that protects messages exchanged over inner using
+// the ciphers in pair. SecureTransport takes ownership of the pair ciphers, pair shall not be used after
+// this call.
+//
+// NewSecureTransport errors if inner is nil or if pair ciphers do not have a key.
+func NewSecureTransport(inner transport.Transport, pair *TransportCipherPair, cfg SecureTransportCfg) (*SecureTransport, error) {
+	if nil == inner {
+		return nil, newError("nil inner Transport")
+	}
+	if nil == pair || !pair.Encryptor().HasKey() || !pair.Decryptor().HasKey() {
+		return nil, newError("invalid TransportCipherPair, missing cipher key")
+	}
+
+	rv := &SecureTransport{
+		inner:         inner,
+		ciphers:       *pair,
+		rekeyInterval: cfg.RekeyInterval,
+		ad:            cfg.Ad,
+	}
+	*pair = TransportCipherPair{}
+
+	return rv, nil
+}
+
+// ReadBytes reads next message from the inner Transport and decrypts it using the configured Ad.
+func (self *SecureTransport) ReadBytes() ([]byte, error) {
+	return self.ReadBytesWithAd(self.ad)
+}
+
+// ReadBytesWithAd reads next message from the inner Transport and decrypts it using ad.
+// It errors if the message was not produced by the peer SecureTransport using ad.
+func (self *SecureTransport) ReadBytesWithAd(ad []byte) ([]byte, error) {
+	self.rmut.Lock()
+	defer self.rmut.Unlock()
+
+	ciphertext, err := self.inner.ReadBytes()
+	if nil != err {
+		return nil, wrapError(err, "failed reading inner Transport")
+	}
+	dcrypt := self.ciphers.Decryptor()
+	plaintext, err := dcrypt.DecryptWithAd(ad, ciphertext)
+	if nil != err {
+		return nil, wrapError(err, "failed message decryption")
+	}
+	self.rcount += 1
+	err = rekeyIfNeeded(dcrypt, self.rcount, self.rekeyInterval)
+	if nil != err {
+		return nil, wrapError(err, "failed decryptor rekey")
+	}
+
+	return plaintext, nil
+}
+
+// WriteBytes encrypts data using the configured Ad and writes the result to the inner Transport.
+func (self *SecureTransport) WriteBytes(data []byte) error {
+	return self.WriteBytesWithAd(self.ad, data)
+}
+
+// WriteBytesWithAd encrypts data using ad and writes the result to the inner Transport.
+// It errors if data is larger than the noise protocol transport message limit.
+func (self *SecureTransport) WriteBytesWithAd(ad, data []byte) error {
+	self.wmut.Lock()
+	defer self.wmut.Unlock()
+
+	ecrypt := self.ciphers.Encryptor()
+	ciphertext, err := ecrypt.EncryptWithAd(ad, data)
+	if nil != err {
+		return wrapError(err, "failed message encryption")
+	}
+	self.wcount += 1
+	err = rekeyIfNeeded(ecrypt, self.wcount, self.rekeyInterval)
+	if nil != err {
+		return wrapError(err, "failed encryptor rekey")
+	}
+
+	return wrapError(self.inner.WriteBytes(ciphertext), "failed writing inner Transport")
+}
+
+// Close closes the inner Transport.
+func (self *SecureTransport) Close() error {
+	return self.inner.Close()
+}
+
+var _ transport.Transport = &SecureTransport{}
+
+// rekeyIfNeeded rekeys cipher if count, the number of processed messages, is a multiple of interval
+// or if cipher nonce is exhausted. In this later case, cipher nonce is reset.
+func rekeyIfNeeded(cipher *TransportCipher, count uint64, interval uint64) error {
+	if CIPHER_MAX_NONCE == cipher.n {
+		err := cipher.Rekey()
+		if nil != err {
+			return wrapError(err, "failed Rekey on nonce exhaustion")
+		}
+		cipher.SetNonce(0)
+		return nil
+	}
+	if interval > 0 && count > 0 && 0 == (count%interval) {
+		return wrapError(cipher.Rekey(), "failed periodic Rekey")
+	}
+
+	return nil
+}
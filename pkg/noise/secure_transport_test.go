@@ -0,0 +1,228 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"code.kerpass.org/golang/internal/transport"
+)
+
+func TestSecureTransportExchange(t *testing.T) {
+	for _, protoname := range []string{"Noise_NN_25519_AESGCM_SHA256", "Noise_XX_25519_ChaChaPoly_BLAKE2s"} {
+		t.Run(protoname, func(t *testing.T) {
+			pairs := handshakeTestPairs(t, protoname)
+			cli, srv, wire := secureTestTransports(t, pairs, SecureTransportCfg{Ad: []byte(ad1)})
+
+			for i, msg := range [][]byte{[]byte("first message"), {}, []byte("third message")} {
+				err := cli.WriteBytes(msg)
+				if nil != err {
+					t.Fatalf("#%d: failed cli.WriteBytes, got error %v", i, err)
+				}
+				if bytes.Contains(wire.Bytes(), msg) && len(msg) > 0 {
+					t.Fatalf("#%d: plaintext visible on the wire", i)
+				}
+				rmsg, err := srv.ReadBytes()
+				if nil != err {
+					t.Fatalf("#%d: failed srv.ReadBytes, got error %v", i, err)
+				}
+				if !slices.Equal(rmsg, msg) {
+					t.Fatalf("#%d: failed srv message control", i)
+				}
+
+				// server replies
+				err = srv.WriteBytes(msg)
+				if nil != err {
+					t.Fatalf("#%d: failed srv.WriteBytes, got error %v", i, err)
+				}
+				rmsg, err = cli.ReadBytes()
+				if nil != err {
+					t.Fatalf("#%d: failed cli.ReadBytes, got error %v", i, err)
+				}
+				if !slices.Equal(rmsg, msg) {
+					t.Fatalf("#%d: failed cli message control", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSecureTransportAd(t *testing.T) {
+	pairs := handshakeTestPairs(t, "Noise_NN_25519_AESGCM_SHA256")
+	cli, srv, _ := secureTestTransports(t, pairs, SecureTransportCfg{})
+
+	err := cli.WriteBytesWithAd([]byte("ad"), []byte("message"))
+	if nil != err {
+		t.Fatalf("failed WriteBytesWithAd, got error %v", err)
+	}
+	_, err = srv.ReadBytesWithAd([]byte("another ad"))
+	if nil == err {
+		t.Fatal("ReadBytesWithAd succeeded with mismatched ad")
+	}
+}
+
+func TestSecureTransportRekey(t *testing.T) {
+	pairs := handshakeTestPairs(t, "Noise_NN_25519_ChaChaPoly_SHA512")
+
+	// force nonce exhaustion after 2 messages
+	pairs[0].Encryptor().SetNonce(CIPHER_MAX_NONCE - 2)
+	pairs[1].Decryptor().SetNonce(CIPHER_MAX_NONCE - 2)
+	cli, srv, wire := secureTestTransports(t, pairs, SecureTransportCfg{RekeyInterval: 3})
+
+	var prev []byte
+	for i := range 10 {
+		wire.Reset()
+		err := cli.WriteBytes([]byte("same message"))
+		if nil != err {
+			t.Fatalf("#%d: failed WriteBytes, got error %v", i, err)
+		}
+		if bytes.Equal(prev, wire.Bytes()) {
+			t.Fatalf("#%d: ciphertext repeated", i)
+		}
+		prev = slices.Clone(wire.Bytes())
+		msg, err := srv.ReadBytes()
+		if nil != err {
+			t.Fatalf("#%d: failed ReadBytes, got error %v", i, err)
+		}
+		if "same message" != string(msg) {
+			t.Fatalf("#%d: failed message control", i)
+		}
+	}
+	if n := cli.ciphers.Encryptor().n; n != 8 {
+		t.Errorf("encryptor nonce was not reset, got %d", n)
+	}
+
+	// peers that do not agree on RekeyInterval can not communicate
+	pairs = handshakeTestPairs(t, "Noise_NN_25519_ChaChaPoly_SHA512")
+	cli, _, _ = secureTestTransports(t, pairs, SecureTransportCfg{RekeyInterval: 1})
+	srv, err := NewSecureTransport(cli.inner, &pairs[1], SecureTransportCfg{})
+	if nil != err {
+		t.Fatalf("failed NewSecureTransport, got error %v", err)
+	}
+	for i := range 2 {
+		cli.WriteBytes([]byte("message"))
+		_, err = srv.ReadBytes()
+		if 1 == i && nil == err {
+			t.Fatal("ReadBytes succeeded in spite of RekeyInterval mismatch")
+		}
+	}
+}
+
+func TestSecureTransportOverPipe(t *testing.T) {
+	pairs := handshakeTestPairs(t, "Noise_XX_25519_AESGCM_SHA256")
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	c, s := net.Pipe()
+	c.SetDeadline(deadline)
+	s.SetDeadline(deadline)
+	cli, err := NewSecureTransport(transport.RWTransport{R: c, W: c, C: c}, &pairs[0], SecureTransportCfg{})
+	if nil != err {
+		t.Fatalf("failed cli NewSecureTransport, got error %v", err)
+	}
+	defer cli.Close()
+	srv, err := NewSecureTransport(transport.RWTransport{R: s, W: s, C: s}, &pairs[1], SecureTransportCfg{})
+	if nil != err {
+		t.Fatalf("failed srv NewSecureTransport, got error %v", err)
+	}
+	defer srv.Close()
+
+	go func() {
+		msg, err := srv.ReadBytes()
+		if nil == err {
+			srv.WriteBytes(msg)
+		}
+	}()
+	err = cli.WriteBytes([]byte("ping"))
+	if nil != err {
+		t.Fatalf("failed WriteBytes, got error %v", err)
+	}
+	msg, err := cli.ReadBytes()
+	if nil != err {
+		t.Fatalf("failed ReadBytes, got error %v", err)
+	}
+	if "ping" != string(msg) {
+		t.Fatalf("failed message control, got %q", msg)
+	}
+}
+
+func TestSecureTransportInvalidPair(t *testing.T) {
+	buf := new(bytes.Buffer)
+	_, err := NewSecureTransport(transport.RWTransport{R: buf, W: buf}, &TransportCipherPair{}, SecureTransportCfg{})
+	if nil == err {
+		t.Fatal("NewSecureTransport succeeded with keyless TransportCipherPair")
+	}
+	pairs := handshakeTestPairs(t, "Noise_NN_25519_AESGCM_SHA256")
+	_, err = NewSecureTransport(nil, &pairs[0], SecureTransportCfg{})
+	if nil == err {
+		t.Fatal("NewSecureTransport succeeded with nil inner Transport")
+	}
+}
+
+// handshakeTestPairs runs protoname handshake in memory and returns the initiator & responder TransportCipherPair.
+func handshakeTestPairs(t *testing.T, protoname string) [2]TransportCipherPair {
+	var cfg Config
+	err := cfg.Load(protoname)
+	if nil != err {
+		t.Fatalf("failed loading config %s, got error %v", protoname, err)
+	}
+	hss := [2]HandshakeState{}
+	for i := range 2 {
+		params := HandshakeParams{Cfg: cfg, Initiator: 0 == i}
+		for spec := range cfg.HandshakePattern.listInitSpecs(params.Initiator) {
+			if "s" == spec.token {
+				params.StaticKeypair, err = cfg.CurveAlgo.GenerateKey(rand.Reader)
+				if nil != err {
+					t.Fatalf("failed generating static key, got error %v", err)
+				}
+			}
+		}
+		err = hss[i].Initialize(params)
+		if nil != err {
+			t.Fatalf("failed Initialize #%d, got error %v", i, err)
+		}
+	}
+
+	var completed bool
+	var buf bytes.Buffer
+	for pos := 0; !completed; pos++ {
+		buf.Reset()
+		_, err = hss[pos%2].WriteMessage(nil, &buf)
+		if nil != err {
+			t.Fatalf("msg[%d]: failed WriteMessage, got error %v", pos, err)
+		}
+		completed, err = hss[(pos+1)%2].ReadMessage(buf.Bytes(), new(bytes.Buffer))
+		if nil != err {
+			t.Fatalf("msg[%d]: failed ReadMessage, got error %v", pos, err)
+		}
+	}
+
+	pairs := [2]TransportCipherPair{}
+	for i := range 2 {
+		err = hss[i].Split(&pairs[i])
+		if nil != err {
+			t.Fatalf("failed Split #%d, got error %v", i, err)
+		}
+	}
+
+	return pairs
+}
+
+// secureTestTransports returns initiator & responder SecureTransport connected by 2 in memory buffers.
+// The returned buffer receives initiator messages.
+func secureTestTransports(t *testing.T, pairs [2]TransportCipherPair, cfg SecureTransportCfg) (*SecureTransport, *SecureTransport, *bytes.Buffer) {
+	c2s := new(bytes.Buffer)
+	s2c := new(bytes.Buffer)
+	cli, err := NewSecureTransport(transport.RWTransport{R: s2c, W: c2s}, &pairs[0], cfg)
+	if nil != err {
+		t.Fatalf("failed cli NewSecureTransport, got error %v", err)
+	}
+	srv, err := NewSecureTransport(transport.RWTransport{R: c2s, W: s2c}, &pairs[1], cfg)
+	if nil != err {
+		t.Fatalf("failed srv NewSecureTransport, got error %v", err)
+	}
+
+	return cli, srv, c2s
+}
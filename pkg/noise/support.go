@@ -24,6 +24,17 @@ type TestVector struct {
 	ResponderPsks               []utils.HexBinary `json:"resp_psks"`
 	HandshakeHash               utils.HexBinary   `json:"handshake_hash"`
 	Messages                    []TestMessage     `json:"messages"`
+
+	// KEM fields, KemKey are encoded using their seed.
+	InitiatorEphemeralKemKey       utils.HexBinary   `json:"init_ephemeral_kem,omitempty"`
+	InitiatorStaticKemKey          utils.HexBinary   `json:"init_static_kem,omitempty"`
+	InitiatorRemoteEphemeralKemKey utils.HexBinary   `json:"init_remote_ephemeral_kem,omitempty"`
+	InitiatorRemoteStaticKemKey    utils.HexBinary   `json:"init_remote_static_kem,omitempty"`
+	ResponderEphemeralKemKey       utils.HexBinary   `json:"resp_ephemeral_kem,omitempty"`
+	ResponderStaticKemKey          utils.HexBinary   `json:"resp_static_kem,omitempty"`
+	ResponderRemoteEphemeralKemKey utils.HexBinary   `json:"resp_remote_ephemeral_kem,omitempty"`
+	ResponderRemoteStaticKemKey    utils.HexBinary   `json:"resp_remote_static_kem,omitempty"`
+	KemRandomness                  []utils.HexBinary `json:"kem_randomness,omitempty"`
 }
 
 // TestMessage holds noise protocol test vector message fields.
@@ -65,11 +65,11 @@ func (self *SymetricState) MixKey(ikm []byte) error {
 // MixHash appears in noise protocol specs section 5.2.
 func (self *SymetricState) MixHash(data []byte) {
 	hsz := self.hash.Size()
-	h := self.hb[:hsz]
-	hd := self.hash.New()
-	hd.Write(h)
+	hd := self.hash.acquire()
+	hd.Write(self.hb[:hsz])
 	hd.Write(data)
-	h = hd.Sum(self.hb[:0])
+	hd.Sum(self.hb[:0])
+	self.hash.release(hd)
 }
 
 // MixKeyAndHash mixes ikm into the SymetricState state.
@@ -97,10 +97,12 @@ func (self *SymetricState) GetHandshakeHash() []byte {
 	// TODO:
 	// Spec section 5.2 says that this function shall be called after Split
 	// Split() could take care of this ?
-	hsz := self.hash.Size()
-	rt := make([]byte, hsz)
-	copy(rt, self.hb[:hsz])
-	return rt
+	return self.AppendHandshakeHash(nil)
+}
+
+// AppendHandshakeHash appends SymetricState h state to dst and returns the extended buffer.
+func (self *SymetricState) AppendHandshakeHash(dst []byte) []byte {
+	return append(dst, self.hb[:self.hash.Size()]...)
 }
 
 // EncryptAndHash returns ciphertext encrypted using inner CipherState. The ciphertext
@@ -112,14 +114,25 @@ func (self *SymetricState) GetHandshakeHash() []byte {
 //
 // EncryptAndHash appears in noise protocol specs section 5.2.
 func (self *SymetricState) EncryptAndHash(plaintext []byte) ([]byte, error) {
+	if !self.HasKey() {
+		self.MixHash(plaintext)
+		return plaintext, nil
+	}
+	return self.AppendEncryptAndHash(nil, plaintext)
+}
+
+// AppendEncryptAndHash is the append form of EncryptAndHash, it appends the ciphertext to dst
+// and returns the extended buffer.
+func (self *SymetricState) AppendEncryptAndHash(dst, plaintext []byte) ([]byte, error) {
 	hsz := self.hash.Size()
 	h := self.hb[:hsz]
-	ciphertext, err := self.EncryptWithAd(h, plaintext)
+	start := len(dst)
+	dst, err := self.AppendEncryptWithAd(dst, h, plaintext)
 	if nil != err {
 		return nil, wrapError(err, "failed EncryptWithAd")
 	}
-	self.MixHash(ciphertext)
-	return ciphertext, nil
+	self.MixHash(dst[start:])
+	return dst, nil
 }
 
 // DecryptAndHash returns plaintext decrypted using inner CipherState. After plaintext
@@ -131,14 +144,34 @@ func (self *SymetricState) EncryptAndHash(plaintext []byte) ([]byte, error) {
 //
 // DecryptAndHash appears in noise protocol specs section 5.2.
 func (self *SymetricState) DecryptAndHash(ciphertext []byte) ([]byte, error) {
+	if !self.HasKey() {
+		self.MixHash(ciphertext)
+		return ciphertext, nil
+	}
+	return self.AppendDecryptAndHash(nil, ciphertext)
+}
+
+// AppendDecryptAndHash is the append form of DecryptAndHash, it appends the plaintext to dst
+// and returns the extended buffer. dst memory shall not overlap ciphertext, as ciphertext is
+// mixed into the SymetricState after decryption.
+func (self *SymetricState) AppendDecryptAndHash(dst, ciphertext []byte) ([]byte, error) {
 	hsz := self.hash.Size()
 	h := self.hb[:hsz]
-	plaintext, err := self.DecryptWithAd(h, ciphertext)
+	dst, err := self.AppendDecryptWithAd(dst, h, ciphertext)
 	if nil != err {
 		return nil, wrapError(err, "failed DecryptWithAd")
 	}
 	self.MixHash(ciphertext)
-	return plaintext, nil
+	return dst, nil
+}
+
+// Reset zeroes the SymetricState secrets and key.
+func (self *SymetricState) Reset() {
+	clear(self.hb[:])
+	clear(self.ckb[:])
+	clear(self.tkb[:])
+	clear(self.thb[:])
+	self.InitializeKey(nil)
 }
 
 // TODO: move Split to HandshakeState, this will simplify ensuring it is used at the right time.
@@ -152,9 +185,10 @@ func (self *SymetricState) initCK(protoname string) {
 		copy(h, zeros)
 		copy(h, psb)
 	} else {
-		hd := self.hash.New()
+		hd := self.hash.acquire()
 		hd.Write(psb)
 		h = hd.Sum(self.hb[:0])
+		self.hash.release(hd)
 	}
 	copy(ck, h)
 }
@@ -37,6 +37,24 @@ func (self *TransportCipher) DecryptWithAd(ad, ciphertext []byte) ([]byte, error
 	return self.CipherState.DecryptWithAd(ad, ciphertext)
 }
 
+// AppendEncryptWithAd appends to dst the authenticated encryption of plaintext if the TransportCipher has a key
+// otherwise it errors. It does not allocate if dst has sufficient capacity, ie len(plaintext) + 16.
+func (self *TransportCipher) AppendEncryptWithAd(dst, ad, plaintext []byte) ([]byte, error) {
+	if !self.HasKey() {
+		return nil, newError("missing cipher key")
+	}
+	return self.CipherState.AppendEncryptWithAd(dst, ad, plaintext)
+}
+
+// AppendDecryptWithAd appends to dst the authenticated decryption of ciphertext if the TransportCipher has a key
+// otherwise it errors. It does not allocate if dst has sufficient capacity, ie len(ciphertext).
+func (self *TransportCipher) AppendDecryptWithAd(dst, ad, ciphertext []byte) ([]byte, error) {
+	if !self.HasKey() {
+		return nil, newError("missing cipher key")
+	}
+	return self.CipherState.AppendDecryptWithAd(dst, ad, ciphertext)
+}
+
 // TransportCipherPair holds TransportCipher used for transport encryption/decryption.
 type TransportCipherPair struct {
 	ciphers [2]TransportCipher
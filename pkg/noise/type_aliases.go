@@ -2,9 +2,13 @@ package noise
 
 import (
 	"crypto/ecdh"
+
+	"code.kerpass.org/golang/internal/algos"
 )
 
 type (
 	Keypair   = ecdh.PrivateKey
 	PublicKey = ecdh.PublicKey
+	Kem       = algos.Kem
+	KemKey    = algos.KemKey
 )
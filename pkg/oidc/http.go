@@ -0,0 +1,431 @@
+package oidc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"code.kerpass.org/golang/internal/observability"
+	"code.kerpass.org/golang/internal/session"
+	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/slp"
+)
+
+const maxLoginRequestSize = 512
+
+// Discovery holds the OpenID Provider metadata.
+type Discovery struct {
+	Issuer                  string   `json:"issuer"`
+	AuthorizationEndpoint   string   `json:"authorization_endpoint"`
+	TokenEndpoint           string   `json:"token_endpoint"`
+	UserInfoEndpoint        string   `json:"userinfo_endpoint"`
+	JwksUri                 string   `json:"jwks_uri"`
+	ResponseTypes           []string `json:"response_types_supported"`
+	GrantTypes              []string `json:"grant_types_supported"`
+	SubjectTypes            []string `json:"subject_types_supported"`
+	IdTokenSigningAlgs      []string `json:"id_token_signing_alg_values_supported"`
+	Scopes                  []string `json:"scopes_supported"`
+	TokenEndpointAuthMethod []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethods    []string `json:"code_challenge_methods_supported"`
+	Claims                  []string `json:"claims_supported"`
+}
+
+// LoginResult is returned by the Provider login endpoint.
+// RedirectTo is the Client redirection url, it is set if the OTP/OTK is valid.
+// Malformed is set if the OTP/OTK is not compatible with the session scheme.
+type LoginResult struct {
+	Valid      bool   `json:"valid"`
+	Malformed  bool   `json:"malformed,omitempty"`
+	RedirectTo string `json:"redirect_to,omitempty"`
+}
+
+// TokenResponse is returned by the Provider token endpoint.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IdToken     string `json:"id_token"`
+}
+
+// serveDiscovery returns the Provider metadata.
+func (self *Provider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	iss := self.cfg.Issuer
+	writeJSON(w, http.StatusOK, Discovery{
+		Issuer:                  iss,
+		AuthorizationEndpoint:   iss + PathAuthorize,
+		TokenEndpoint:           iss + PathToken,
+		UserInfoEndpoint:        iss + PathUserInfo,
+		JwksUri:                 iss + PathJwks,
+		ResponseTypes:           []string{"code"},
+		GrantTypes:              []string{"authorization_code"},
+		SubjectTypes:            []string{"public"},
+		IdTokenSigningAlgs:      []string{jwtAlg},
+		Scopes:                  []string{"openid"},
+		TokenEndpointAuthMethod: []string{"client_secret_basic", "client_secret_post"},
+		CodeChallengeMethods:    []string{"S256"},
+		Claims:                  []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr"},
+	})
+}
+
+// serveJwks returns the Provider signing key.
+func (self *Provider) serveJwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, JWKS{Keys: []JWK{self.sgn.jwk}})
+}
+
+// serveAuthorize validates the authorization request, binds it to the browser using a cookie
+// and serves the login page that starts Card authentication.
+// If r accepts application/json, it returns the JSON slp.AppAuthRequest instead of the login page.
+func (self *Provider) serveAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	// errors are not redirected if the Client or its redirect_uri is invalid
+	client := self.client(q.Get("client_id"))
+	redirectUri := q.Get("redirect_uri")
+	if nil == client || !slices.Contains(client.RedirectUris, redirectUri) {
+		http.Error(w, "invalid client_id or redirect_uri", http.StatusBadRequest)
+		return
+	}
+	state := q.Get("state")
+	if "code" != q.Get("response_type") {
+		redirectError(w, r, redirectUri, state, "unsupported_response_type")
+		return
+	}
+	if !slices.Contains(strings.Fields(q.Get("scope")), "openid") {
+		redirectError(w, r, redirectUri, state, "invalid_scope")
+		return
+	}
+	codeChallenge := q.Get("code_challenge")
+	if "" != codeChallenge && "S256" != q.Get("code_challenge_method") {
+		redirectError(w, r, redirectUri, state, "invalid_request")
+		return
+	}
+
+	now := time.Now()
+	loginId := rand.Text()
+	self.mut.Lock()
+	self.sweep(now)
+	self.logins[loginId] = &login{
+		authRequest: authRequest{
+			clientId:      client.Id,
+			redirectUri:   redirectUri,
+			state:         state,
+			nonce:         q.Get("nonce"),
+			codeChallenge: codeChallenge,
+		},
+		expiry: now.Add(loginLifetime),
+	}
+	self.mut.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    loginId,
+		Path:     self.basePth + PathLogin,
+		MaxAge:   int(loginLifetime.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	aar := slp.AppAuthRequest{
+		RealmId:              self.cfg.RealmId[:],
+		AuthServerGetChalUrl: self.cfg.AuthServerGetChalUrl,
+		AllowedMethods:       self.cfg.Methods,
+	}
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, http.StatusOK, aar)
+		return
+	}
+	srzaar, err := json.Marshal(aar)
+	if nil != err {
+		http.Error(w, "failed to encode AppAuthRequest", http.StatusInternalServerError)
+		return
+	}
+	var page bytes.Buffer
+	err = authorizePage.Execute(&page, struct {
+		AuthRequest string
+		LoginUrl    string
+	}{AuthRequest: string(srzaar), LoginUrl: self.cfg.Issuer + PathLogin})
+	if nil != err {
+		http.Error(w, "failed to render login page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(page.Bytes())
+}
+
+// serveLogin validates the CBOR encoded slp.DirectLoginRequest submitted by the CardAgent,
+// and returns the Client redirection url holding the authorization code if it is valid.
+func (self *Provider) serveLogin(w http.ResponseWriter, r *http.Request) {
+	obs := observability.GetObservability(r.Context())
+	log := obs.Log().With("handler", "oidc-login")
+
+	cookie, err := r.Cookie(loginCookie)
+	if nil != err {
+		http.Error(w, "missing login cookie", http.StatusBadRequest)
+		return
+	}
+	loginId := cookie.Value
+	now := time.Now()
+	self.mut.Lock()
+	lgn, found := self.logins[loginId]
+	if found && now.After(lgn.expiry) {
+		delete(self.logins, loginId)
+		found = false
+	}
+	self.mut.Unlock()
+	if !found {
+		http.Error(w, "unknown or expired login", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxLoginRequestSize)
+	body, err := io.ReadAll(r.Body)
+	if nil != err {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	var dlr slp.DirectLoginRequest
+	err = ctapSrz.Unmarshal(body, &dlr)
+	if nil != err {
+		http.Error(w, "failed to decode cbor request", http.StatusBadRequest)
+		return
+	}
+	var sid session.Sid
+	if len(sid) != len(dlr.SessionId) {
+		http.Error(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+	copy(sid[:], dlr.SessionId)
+
+	// derive the expected OTP/OTK
+	digits, err := dlr.OtpDigits(self.cfg.Factory)
+	var otp []byte
+	cr := slp.CardChalResponse{SessionId: dlr.SessionId, CardId: dlr.CardId, E: dlr.E}
+	if nil == err {
+		cr.SyncHint = digits[len(digits)-1] // len(digits) > 0 enforced by dlr.Check & OtpDigits
+		otp, err = self.cfg.Factory.GetServerOtp(r.Context(), &cr, nil)
+	}
+	if errors.Is(err, slp.ErrMalformedOtp) || (nil == err && len(otp) != len(digits)) {
+		// malformed OTP/OTK are typing mistakes, they do not count as login attempts
+		obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "malformed"))
+		writeJSON(w, http.StatusBadRequest, LoginResult{Malformed: true})
+		return
+	}
+	var sca credentials.ServerCardAccess
+	var subject string
+	if nil == err {
+		sca, err = self.cfg.Factory.CardAccess(&cr)
+	}
+	if nil == err {
+		subject, err = self.subject(sca)
+	}
+	if nil != err {
+		log.Info("failed login", "error", err)
+		obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "error"))
+		http.Error(w, "failed otp calculation", http.StatusBadRequest)
+		return
+	}
+	self.mut.Lock()
+	locked := self.cardLocked(subject, now)
+	self.mut.Unlock()
+	if locked {
+		log.Info("rejected login of locked card", "sub", subject)
+		obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "locked"))
+		writeJSON(w, http.StatusTooManyRequests, LoginResult{})
+		return
+	}
+	if 1 != subtle.ConstantTimeCompare(otp, digits) {
+		obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "invalid"))
+		self.mut.Lock()
+		lgn.attempts += 1
+		if lgn.attempts >= maxLoginAttempts {
+			delete(self.logins, loginId)
+		}
+		self.cardFailed(subject, now)
+		self.mut.Unlock()
+		writeJSON(w, http.StatusUnauthorized, LoginResult{})
+		return
+	}
+
+	// SLP sessions are stateless, the sessions of a Card are consumed once and in creation order
+	self.mut.Lock()
+	last, seen := self.sessions[subject]
+	replayed := seen && sid.C() <= last
+	if !replayed {
+		self.sessions[subject] = sid.C()
+	}
+	self.mut.Unlock()
+	if replayed {
+		log.Info("rejected replayed login", "sub", subject)
+		obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "replayed"))
+		writeJSON(w, http.StatusUnauthorized, LoginResult{})
+		return
+	}
+	obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "valid"))
+	slp.RecordCardUse(r.Context(), self.cfg.Factory, &cr)
+
+	// the login is consumed by its 1st success
+	self.mut.Lock()
+	delete(self.failures, subject)
+	_, found = self.logins[loginId]
+	delete(self.logins, loginId)
+	code := rand.Text()
+	if found {
+		self.codes[code] = &grant{
+			authRequest: lgn.authRequest,
+			subject:     subject,
+			authTime:    now,
+			expiry:      now.Add(codeLifetime),
+		}
+	}
+	self.mut.Unlock()
+	if !found {
+		http.Error(w, "unknown or expired login", http.StatusBadRequest)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: self.basePth + PathLogin, MaxAge: -1})
+	writeJSON(w, http.StatusOK, LoginResult{
+		Valid:      true,
+		RedirectTo: redirectUrl(lgn.redirectUri, url.Values{"code": {code}, "state": {lgn.state}}),
+	})
+}
+
+// serveToken exchanges an authorization code for an access token & ID Token.
+func (self *Provider) serveToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	// authenticate the Client
+	clientId, secret, basic := r.BasicAuth()
+	if !basic {
+		clientId, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	client := self.client(clientId)
+	if nil == client || 1 != subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) {
+		writeJSON(w, http.StatusUnauthorized, tokenError("invalid_client"))
+		return
+	}
+	if "authorization_code" != r.PostFormValue("grant_type") {
+		writeJSON(w, http.StatusBadRequest, tokenError("unsupported_grant_type"))
+		return
+	}
+
+	// codes are single use
+	now := time.Now()
+	code := r.PostFormValue("code")
+	self.mut.Lock()
+	grt, found := self.codes[code]
+	delete(self.codes, code)
+	self.mut.Unlock()
+	if !found || now.After(grt.expiry) || client.Id != grt.clientId || r.PostFormValue("redirect_uri") != grt.redirectUri {
+		writeJSON(w, http.StatusBadRequest, tokenError("invalid_grant"))
+		return
+	}
+	if "" != grt.codeChallenge {
+		digest := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		challenge := base64.RawURLEncoding.EncodeToString(digest[:])
+		if 1 != subtle.ConstantTimeCompare([]byte(challenge), []byte(grt.codeChallenge)) {
+			writeJSON(w, http.StatusBadRequest, tokenError("invalid_grant"))
+			return
+		}
+	}
+
+	idToken, err := self.sgn.Sign(IdTokenClaims{
+		Issuer:   self.cfg.Issuer,
+		Subject:  grt.subject,
+		Audience: grt.clientId,
+		Expiry:   now.Add(tokenLifetime).Unix(),
+		IssuedAt: now.Unix(),
+		AuthTime: grt.authTime.Unix(),
+		Nonce:    grt.nonce,
+		Amr:      []string{"otp"},
+	})
+	if nil != err {
+		writeJSON(w, http.StatusInternalServerError, tokenError("server_error"))
+		return
+	}
+	accessToken := rand.Text()
+	self.mut.Lock()
+	self.sweep(now)
+	self.tokens[accessToken] = &grant{
+		authRequest: grt.authRequest,
+		subject:     grt.subject,
+		authTime:    grt.authTime,
+		expiry:      now.Add(tokenLifetime),
+	}
+	self.mut.Unlock()
+
+	writeJSON(w, http.StatusOK, TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(tokenLifetime.Seconds()),
+		IdToken:     idToken,
+	})
+}
+
+// serveUserInfo returns the claims of the access token subject.
+func (self *Provider) serveUserInfo(w http.ResponseWriter, r *http.Request) {
+	if http.MethodGet != r.Method && http.MethodPost != r.Method {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	self.mut.Lock()
+	grt, found := self.tokens[token]
+	self.mut.Unlock()
+	if !strings.EqualFold("Bearer", scheme) || !found || time.Now().After(grt.expiry) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"sub": grt.subject})
+}
+
+// tokenError returns an OAuth2 error response body.
+func tokenError(code string) map[string]string {
+	return map[string]string{"error": code}
+}
+
+// redirectError redirects the browser to the Client redirectUri with an OAuth2 error.
+func redirectError(w http.ResponseWriter, r *http.Request, redirectUri string, state string, code string) {
+	params := url.Values{"error": {code}}
+	if "" != state {
+		params.Set("state", state)
+	}
+	http.Redirect(w, r, redirectUrl(redirectUri, params), http.StatusFound)
+}
+
+// redirectUrl adds params to the query of the redirectUri.
+func redirectUrl(redirectUri string, params url.Values) string {
+	u, _ := url.Parse(redirectUri) // redirectUri was validated by Client.Check
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if nil != err {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+)
+
+const (
+	jwtAlg   = "ES256"
+	scalarSz = 32
+)
+
+var b64 = base64.RawURLEncoding
+
+// IdTokenClaims holds the claims of the ID Tokens issued by the Provider.
+type IdTokenClaims struct {
+	Issuer   string   `json:"iss"`
+	Subject  string   `json:"sub"`
+	Audience string   `json:"aud"`
+	Expiry   int64    `json:"exp"`
+	IssuedAt int64    `json:"iat"`
+	AuthTime int64    `json:"auth_time"`
+	Nonce    string   `json:"nonce,omitempty"`
+	Amr      []string `json:"amr,omitempty"`
+}
+
+// JWK is an EC P-256 JSON Web Key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// PublicKey returns the JWK ecdsa.PublicKey.
+// It errors if the JWK is not a valid P-256 key.
+func (self *JWK) PublicKey() (*ecdsa.PublicKey, error) {
+	if "EC" != self.Kty || "P-256" != self.Crv {
+		return nil, wrapError(ErrValidation, "unsupported key type %s/%s", self.Kty, self.Crv)
+	}
+	x, err := b64.DecodeString(self.X)
+	if nil != err || scalarSz != len(x) {
+		return nil, wrapError(ErrValidation, "invalid x coordinate")
+	}
+	y, err := b64.DecodeString(self.Y)
+	if nil != err || scalarSz != len(y) {
+		return nil, wrapError(ErrValidation, "invalid y coordinate")
+	}
+	pubkey, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+
+	return pubkey, wrapError(err, "failed loading PublicKey")
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwtHeader is the JOSE header of the Provider JWT.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// signer issues ES256 JWT.
+type signer struct {
+	key *ecdsa.PrivateKey
+	jwk JWK
+}
+
+// newSigner returns a signer that uses key, key shall be a P-256 key.
+func newSigner(key *ecdsa.PrivateKey) (*signer, error) {
+	if nil == key || elliptic.P256() != key.Curve {
+		return nil, wrapError(ErrValidation, "invalid SigningKey, not a P-256 key")
+	}
+	pubkey, err := key.PublicKey.Bytes()
+	if nil != err {
+		return nil, wrapError(err, "failed PublicKey encoding")
+	}
+	kid := sha256.Sum256(pubkey)
+	rv := signer{
+		key: key,
+		jwk: JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   b64.EncodeToString(pubkey[1 : 1+scalarSz]),
+			Y:   b64.EncodeToString(pubkey[1+scalarSz:]),
+			Use: "sig",
+			Alg: jwtAlg,
+			Kid: b64.EncodeToString(kid[:12]),
+		},
+	}
+
+	return &rv, nil
+}
+
+// Sign returns the compact serialization of a JWT holding claims.
+func (self *signer) Sign(claims any) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: jwtAlg, Typ: "JWT", Kid: self.jwk.Kid})
+	if nil != err {
+		return "", wrapError(err, "failed header encoding")
+	}
+	payload, err := json.Marshal(claims)
+	if nil != err {
+		return "", wrapError(err, "failed claims encoding")
+	}
+	var sb strings.Builder
+	sb.WriteString(b64.EncodeToString(header))
+	sb.WriteByte('.')
+	sb.WriteString(b64.EncodeToString(payload))
+	digest := sha256.Sum256([]byte(sb.String()))
+	r, s, err := ecdsa.Sign(rand.Reader, self.key, digest[:])
+	if nil != err {
+		return "", wrapError(err, "failed signing JWT")
+	}
+	var sig [2 * scalarSz]byte
+	r.FillBytes(sig[:scalarSz])
+	s.FillBytes(sig[scalarSz:])
+	sb.WriteByte('.')
+	sb.WriteString(b64.EncodeToString(sig[:]))
+
+	return sb.String(), nil
+}
+
+// VerifyJWT checks the ES256 signature of the compact serialized JWT token and loads its claims.
+// It errors if token is malformed or if its signature is invalid.
+func VerifyJWT(token string, pubkey *ecdsa.PublicKey, claims any) error {
+	parts := strings.Split(token, ".")
+	if 3 != len(parts) {
+		return wrapError(ErrInvalidToken, "invalid JWT serialization")
+	}
+	var header jwtHeader
+	srzheader, err := b64.DecodeString(parts[0])
+	if nil != err {
+		return wrapError(ErrInvalidToken, "invalid JWT header encoding")
+	}
+	err = json.Unmarshal(srzheader, &header)
+	if nil != err || jwtAlg != header.Alg {
+		return wrapError(ErrInvalidToken, "unsupported JWT header")
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if nil != err || 2*scalarSz != len(sig) {
+		return wrapError(ErrInvalidToken, "invalid JWT signature encoding")
+	}
+	digest := sha256.Sum256([]byte(token[:len(parts[0])+1+len(parts[1])]))
+	r := new(big.Int).SetBytes(sig[:scalarSz])
+	s := new(big.Int).SetBytes(sig[scalarSz:])
+	if nil == pubkey || !ecdsa.Verify(pubkey, digest[:], r, s) {
+		return wrapError(ErrInvalidToken, "invalid JWT signature")
+	}
+	payload, err := b64.DecodeString(parts[1])
+	if nil != err {
+		return wrapError(ErrInvalidToken, "invalid JWT payload encoding")
+	}
+
+	return wrapError(json.Unmarshal(payload, claims), "failed claims decoding")
+}
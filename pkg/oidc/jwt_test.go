@@ -0,0 +1,57 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJWTSignVerify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating key, got error %v", err)
+	}
+	sgn, err := newSigner(key)
+	if nil != err {
+		t.Fatalf("failed newSigner, got error %v", err)
+	}
+	pubkey, err := sgn.jwk.PublicKey()
+	if nil != err {
+		t.Fatalf("failed loading JWK PublicKey, got error %v", err)
+	}
+
+	claims := IdTokenClaims{Issuer: "https://idp.kerpass.org", Subject: "alice", Audience: "demo", Amr: []string{"otp"}}
+	token, err := sgn.Sign(claims)
+	if nil != err {
+		t.Fatalf("failed Sign, got error %v", err)
+	}
+	var loaded IdTokenClaims
+	err = VerifyJWT(token, pubkey, &loaded)
+	if nil != err {
+		t.Fatalf("failed VerifyJWT, got error %v", err)
+	}
+	if claims.Subject != loaded.Subject || claims.Audience != loaded.Audience || 1 != len(loaded.Amr) {
+		t.Fatalf("failed claims control, got %+v", loaded)
+	}
+
+	// tampered payload
+	parts := strings.Split(token, ".")
+	forged, err := sgn.Sign(IdTokenClaims{Subject: "bob"})
+	if nil != err {
+		t.Fatalf("failed Sign, got error %v", err)
+	}
+	parts[1] = strings.Split(forged, ".")[1]
+	err = VerifyJWT(strings.Join(parts, "."), pubkey, &loaded)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("failed tampered token control, got error %v", err)
+	}
+
+	// invalid key
+	_, err = newSigner(nil)
+	if nil == err {
+		t.Fatal("failed nil key control, got nil error")
+	}
+}
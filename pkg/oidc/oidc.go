@@ -0,0 +1,316 @@
+// Package oidc implements an OpenID Connect provider facade over KerPass SLP authentication.
+//
+// The Provider supports the authorization code flow. Its authorization endpoint binds the pending
+// authorization to the browser using a cookie and serves a login page that forwards the
+// slp.AppAuthRequest to the CardAgent; the slp.AppAuthRequest is returned as JSON if the request
+// accepts application/json. The CardAgent obtains a CardChallenge and the login page submits the
+// resulting slp.DirectLoginRequest to the Provider login endpoint. Once the OTP/OTK is validated,
+// the browser is redirected to the Client with an authorization code.
+//
+// The login page expects the CardAgent to register a window.KerPassAgent object which
+// directLogin(appAuthRequest) method resolves to the CTAP2-CBOR encoded slp.DirectLoginRequest.
+//
+// Invalid OTP/OTK are limited per login, and per Card across logins: after 10 failures in
+// 15 minutes, the Card logins are rejected until the 15 minutes window ends.
+//
+// SLP sessions are stateless, a captured slp.DirectLoginRequest remains valid until its session
+// expires. The Provider records the last SLP session consumed by each Card and rejects the logins
+// that use this session or an older one, hence the sessions of a Card shall be consumed in creation
+// order. This requires the Factory sessions to be session.Sid, as made by slp.ChallengeFactoryImpl.
+//
+// Only the slp.SlpDirect method is supported, the PAKE methods (slp.SlpCpace, slp.SlpNXpsk2) that
+// protect the OTP/OTK from phishing are not.
+//
+// The sub claim is the base64url encoded IdKey of the authenticated Card. It is derived from the
+// Card UserId or IdToken and is the same whatever the authentication method.
+//
+// Provider state is held in memory, a Provider shall not be shared by several servers.
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"embed"
+	"encoding/base64"
+	"html/template"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"code.kerpass.org/golang/internal/transport"
+	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/slp"
+)
+
+const (
+	// Provider endpoints paths, relative to the Issuer url
+	PathDiscovery = "/.well-known/openid-configuration"
+	PathJwks      = "/jwks"
+	PathAuthorize = "/authorize"
+	PathLogin     = "/login"
+	PathToken     = "/token"
+	PathUserInfo  = "/userinfo"
+
+	loginCookie      = "kerpass_login"
+	loginLifetime    = 5 * time.Minute
+	codeLifetime     = time.Minute
+	tokenLifetime    = time.Hour
+	maxLoginAttempts = 3
+
+	maxCardFailures    = 10
+	cardFailuresWindow = 15 * time.Minute
+)
+
+var ctapSrz = transport.WrapInSafeSerializer(transport.NewCTAP2Serializer())
+
+//go:embed static
+var static embed.FS
+
+var authorizePage = template.Must(template.ParseFS(static, "static/authorize.html"))
+
+// Factory is a slp.ChallengeFactory that resolves the Card referenced by a CardChalResponse.
+// It is implemented by slp.ChallengeFactoryImpl.
+type Factory interface {
+	slp.ChallengeFactory
+
+	// CardAccess returns the key that allows loading the Card referenced in cc.
+	CardAccess(cc *slp.CardChalResponse) (credentials.ServerCardAccess, error)
+}
+
+// Client is a registered OIDC Client (aka Relying Party).
+type Client struct {
+	Id           string
+	Secret       string
+	RedirectUris []string
+}
+
+// Check returns an error if the Client is invalid.
+func (self *Client) Check() error {
+	if nil == self {
+		return wrapError(ErrValidation, "nil Client")
+	}
+	if 0 == len(self.Id) {
+		return wrapError(ErrValidation, "empty Id")
+	}
+	if len(self.Secret) < 16 {
+		return wrapError(ErrValidation, "Secret shorter than 16 characters")
+	}
+	if 0 == len(self.RedirectUris) {
+		return wrapError(ErrValidation, "empty RedirectUris")
+	}
+	for pos, uri := range self.RedirectUris {
+		u, err := url.Parse(uri)
+		if nil != err || !u.IsAbs() || "" != u.Fragment {
+			return wrapError(ErrValidation, "invalid RedirectUris[%d]", pos)
+		}
+	}
+
+	return nil
+}
+
+// Config holds the Provider configuration.
+type Config struct {
+	// Issuer is the https url that identifies the Provider
+	Issuer string
+
+	// Realm of the Cards that authenticate with the Provider
+	RealmId [32]byte
+
+	// SLP get-card-chal url, forwarded to the CardAgent in slp.AppAuthRequest
+	AuthServerGetChalUrl string
+
+	// SLP authentication methods allowed for login, only slp.SlpDirect is supported
+	Methods []slp.AuthMethod
+
+	Clients []Client
+
+	// SigningKey is a P-256 key that signs the ID Tokens
+	SigningKey *ecdsa.PrivateKey
+
+	// Idh derives the Card IdKey, it shall use the ServerCredStore seed
+	Idh *credentials.IdHasher
+
+	// Factory validates the OTP/OTK, it shall be dedicated to RealmId and use session.Sid
+	Factory Factory
+}
+
+// Check returns an error if the Config is invalid.
+func (self *Config) Check() error {
+	if nil == self {
+		return wrapError(ErrValidation, "nil Config")
+	}
+	u, err := url.Parse(self.Issuer)
+	if nil != err || "https" != u.Scheme || "" != u.RawQuery || "" != u.Fragment {
+		return wrapError(ErrValidation, "invalid Issuer")
+	}
+	if _, err = url.Parse(self.AuthServerGetChalUrl); nil != err || 0 == len(self.AuthServerGetChalUrl) {
+		return wrapError(ErrValidation, "invalid AuthServerGetChalUrl")
+	}
+	if 0 == len(self.Methods) {
+		return wrapError(ErrValidation, "empty Methods")
+	}
+	for pos, mtd := range self.Methods {
+		err = mtd.Check()
+		if nil != err {
+			return wrapError(err, "invalid Methods[%d]", pos)
+		}
+		if slp.SlpDirect != mtd.Protocol {
+			return wrapError(ErrValidation, "unsupported Methods[%d] protocol", pos)
+		}
+	}
+	if 0 == len(self.Clients) {
+		return wrapError(ErrValidation, "empty Clients")
+	}
+	for pos, client := range self.Clients {
+		err = client.Check()
+		if nil != err {
+			return wrapError(err, "invalid Clients[%d]", pos)
+		}
+		if slices.ContainsFunc(self.Clients[:pos], func(c Client) bool { return c.Id == client.Id }) {
+			return wrapError(ErrValidation, "duplicate Clients[%d] Id", pos)
+		}
+	}
+	if nil == self.Idh {
+		return wrapError(ErrValidation, "nil IdHasher")
+	}
+	if nil == self.Factory {
+		return wrapError(ErrValidation, "nil Factory")
+	}
+
+	return nil
+}
+
+// authRequest holds the validated parameters of an authorization request.
+type authRequest struct {
+	clientId      string
+	redirectUri   string
+	state         string
+	nonce         string
+	codeChallenge string
+}
+
+// login tracks an authorization request pending Card authentication.
+type login struct {
+	authRequest
+	attempts int
+	expiry   time.Time
+}
+
+// cardFailures counts the invalid OTP/OTK submitted for a Card since start.
+type cardFailures struct {
+	count  int
+	expiry time.Time
+}
+
+// grant holds an authenticated authorization request, it is referenced by codes & access tokens.
+type grant struct {
+	authRequest
+	subject  string
+	authTime time.Time
+	expiry   time.Time
+}
+
+// Provider is an OpenID Connect provider that authenticates users with their KerPass Card.
+// It implements http.Handler.
+type Provider struct {
+	cfg     Config
+	sgn     *signer
+	basePth string
+	mux     *http.ServeMux
+
+	mut      sync.Mutex
+	logins   map[string]*login
+	codes    map[string]*grant
+	tokens   map[string]*grant
+	failures map[string]*cardFailures // indexed by Card subject
+	sessions map[string]uint64        // counter of the last consumed SLP session, indexed by Card subject
+}
+
+// NewProvider returns a Provider configured with cfg.
+// It errors if cfg is invalid.
+func NewProvider(cfg Config) (*Provider, error) {
+	err := cfg.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid Config")
+	}
+	sgn, err := newSigner(cfg.SigningKey)
+	if nil != err {
+		return nil, wrapError(err, "failed signer creation")
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	u, _ := url.Parse(cfg.Issuer) // cfg.Check validated Issuer
+
+	rv := &Provider{
+		cfg:      cfg,
+		sgn:      sgn,
+		basePth:  u.Path,
+		logins:   make(map[string]*login),
+		codes:    make(map[string]*grant),
+		tokens:   make(map[string]*grant),
+		failures: make(map[string]*cardFailures),
+		sessions: make(map[string]uint64),
+	}
+	rv.mux = http.NewServeMux()
+	rv.mux.HandleFunc("GET "+rv.basePth+PathDiscovery, rv.serveDiscovery)
+	rv.mux.HandleFunc("GET "+rv.basePth+PathJwks, rv.serveJwks)
+	rv.mux.HandleFunc("GET "+rv.basePth+PathAuthorize, rv.serveAuthorize)
+	rv.mux.HandleFunc("POST "+rv.basePth+PathLogin, rv.serveLogin)
+	rv.mux.HandleFunc("POST "+rv.basePth+PathToken, rv.serveToken)
+	rv.mux.HandleFunc(rv.basePth+PathUserInfo, rv.serveUserInfo)
+
+	return rv, nil
+}
+
+// ServeHTTP dispatches r to the Provider endpoints.
+func (self *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.mux.ServeHTTP(w, r)
+}
+
+// client returns the registered Client with identifier id.
+func (self *Provider) client(id string) *Client {
+	idx := slices.IndexFunc(self.cfg.Clients, func(c Client) bool { return c.Id == id })
+	if idx < 0 {
+		return nil
+	}
+	return &self.cfg.Clients[idx]
+}
+
+// subject returns the sub claim of the Card accessed with sca.
+func (self *Provider) subject(sca credentials.ServerCardAccess) (string, error) {
+	var aks credentials.AccessKeys
+	err := self.cfg.Idh.DeriveFromCardAccess(sca, &aks)
+	if nil != err {
+		return "", wrapError(err, "failed AccessKeys derivation")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(aks.IdKey[:]), nil
+}
+
+// sweep removes expired logins, codes, tokens & Card failures. It shall be called with mut locked.
+func (self *Provider) sweep(now time.Time) {
+	maps.DeleteFunc(self.logins, func(_ string, l *login) bool { return now.After(l.expiry) })
+	maps.DeleteFunc(self.codes, func(_ string, g *grant) bool { return now.After(g.expiry) })
+	maps.DeleteFunc(self.tokens, func(_ string, g *grant) bool { return now.After(g.expiry) })
+	maps.DeleteFunc(self.failures, func(_ string, f *cardFailures) bool { return now.After(f.expiry) })
+}
+
+// cardLocked returns true if the subject Card reached maxCardFailures. It shall be called with mut locked.
+func (self *Provider) cardLocked(subject string, now time.Time) bool {
+	f, found := self.failures[subject]
+	return found && !now.After(f.expiry) && f.count >= maxCardFailures
+}
+
+// cardFailed counts an invalid OTP/OTK of the subject Card. It shall be called with mut locked.
+func (self *Provider) cardFailed(subject string, now time.Time) {
+	f, found := self.failures[subject]
+	if !found || now.After(f.expiry) {
+		f = &cardFailures{expiry: now.Add(cardFailuresWindow)}
+		self.failures[subject] = f
+	}
+	f.count += 1
+}
+
+var _ Factory = &slp.ChallengeFactoryImpl{}
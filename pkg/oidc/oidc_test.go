@@ -0,0 +1,629 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/ephemsec"
+	"code.kerpass.org/golang/pkg/slp"
+)
+
+const (
+	testClientId    = "demo"
+	testSecret      = "demo-client-secret"
+	testRedirectUri = "https://demo.kerpass.org/callback"
+	testAppUrl      = "https://idp.kerpass.org/oidc/authorize"
+)
+
+const (
+	loginValid = iota
+	loginInvalid
+	loginMalformed
+	loginReplay // resubmits the previous DirectLoginRequest
+)
+
+var testSchemes = []uint16{ephemsec.SHA512_X25519_E1S1_T600B10P8, ephemsec.SHA512_X25519_E1S2_T1024B256P33}
+
+func TestProviderFlow(t *testing.T) {
+	st := newStage(t)
+
+	var jwks JWKS
+	st.getJSON(t, PathJwks, &jwks)
+	if 1 != len(jwks.Keys) {
+		t.Fatalf("failed jwks control, got %d keys", len(jwks.Keys))
+	}
+	pubkey, err := jwks.Keys[0].PublicKey()
+	if nil != err {
+		t.Fatalf("failed loading jwks PublicKey, got error %v", err)
+	}
+
+	var subjects []string
+	for _, schref := range testSchemes {
+		verifier := rand.Text()
+		digest := sha256.Sum256([]byte(verifier))
+		aar := st.authorize(t, url.Values{
+			"response_type":         {"code"},
+			"client_id":             {testClientId},
+			"redirect_uri":          {testRedirectUri},
+			"scope":                 {"openid"},
+			"state":                 {"xyz"},
+			"nonce":                 {"n-0S6"},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(digest[:])},
+			"code_challenge_method": {"S256"},
+		})
+
+		// 1st attempts with malformed & invalid OTP/OTK
+		res, status := st.login(t, aar, schref, loginMalformed)
+		if http.StatusBadRequest != status || !res.Malformed {
+			t.Fatalf("failed malformed login control, got status %d", status)
+		}
+		res, status = st.login(t, aar, schref, loginInvalid)
+		if http.StatusUnauthorized != status || res.Valid || res.Malformed {
+			t.Fatalf("failed invalid login control, got status %d", status)
+		}
+
+		res, status = st.login(t, aar, schref, loginValid)
+		if http.StatusOK != status || !res.Valid {
+			t.Fatalf("failed login, got status %d", status)
+		}
+		redirect, err := url.Parse(res.RedirectTo)
+		if nil != err || !strings.HasPrefix(res.RedirectTo, testRedirectUri) {
+			t.Fatalf("failed RedirectTo control, got %q", res.RedirectTo)
+		}
+		if "xyz" != redirect.Query().Get("state") {
+			t.Fatalf("failed state control, got %q", redirect.Query().Get("state"))
+		}
+		code := redirect.Query().Get("code")
+
+		// PKCE verifier mismatch consumes the code
+		tr, status := st.token(t, code, "invalid-verifier")
+		if http.StatusBadRequest != status {
+			t.Fatalf("failed PKCE control, got status %d", status)
+		}
+		_, status = st.token(t, code, verifier)
+		if http.StatusBadRequest != status {
+			t.Fatalf("failed code reuse control, got status %d", status)
+		}
+
+		// redo the flow to obtain the tokens
+		aar = st.authorize(t, url.Values{
+			"response_type":         {"code"},
+			"client_id":             {testClientId},
+			"redirect_uri":          {testRedirectUri},
+			"scope":                 {"openid profile"},
+			"nonce":                 {"n-0S6"},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(digest[:])},
+			"code_challenge_method": {"S256"},
+		})
+		res, status = st.login(t, aar, schref, loginValid)
+		if http.StatusOK != status || !res.Valid {
+			t.Fatalf("failed login, got status %d", status)
+		}
+		redirect, _ = url.Parse(res.RedirectTo)
+		tr, status = st.token(t, redirect.Query().Get("code"), verifier)
+		if http.StatusOK != status {
+			t.Fatalf("failed token exchange, got status %d", status)
+		}
+
+		var claims IdTokenClaims
+		err = VerifyJWT(tr.IdToken, pubkey, &claims)
+		if nil != err {
+			t.Fatalf("failed VerifyJWT, got error %v", err)
+		}
+		if st.provider.cfg.Issuer != claims.Issuer || testClientId != claims.Audience || "n-0S6" != claims.Nonce {
+			t.Fatalf("failed claims control, got %+v", claims)
+		}
+
+		// userinfo
+		req, _ := http.NewRequest(http.MethodGet, st.url(PathUserInfo), nil)
+		req.Header.Set("Authorization", "Bearer "+tr.AccessToken)
+		resp, err := st.client.Do(req)
+		if nil != err {
+			t.Fatalf("failed userinfo request, got error %v", err)
+		}
+		var userinfo map[string]string
+		err = json.NewDecoder(resp.Body).Decode(&userinfo)
+		resp.Body.Close()
+		if nil != err || claims.Subject != userinfo["sub"] {
+			t.Fatalf("failed userinfo control, got %v", userinfo)
+		}
+		subjects = append(subjects, claims.Subject)
+	}
+
+	// OTP & OTK logins map to the same subject
+	if subjects[0] != subjects[1] {
+		t.Fatalf("failed subject control, got %q & %q", subjects[0], subjects[1])
+	}
+}
+
+func TestProviderAuthorizeErrors(t *testing.T) {
+	st := newStage(t)
+	st.client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	testcases := []struct {
+		name     string
+		params   url.Values
+		status   int
+		expected string
+	}{
+		{
+			name:   "unknown client",
+			params: url.Values{"response_type": {"code"}, "client_id": {"bob"}, "redirect_uri": {testRedirectUri}, "scope": {"openid"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid redirect_uri",
+			params: url.Values{"response_type": {"code"}, "client_id": {testClientId}, "redirect_uri": {"https://evil.org/cb"}, "scope": {"openid"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid response_type",
+			params:   url.Values{"response_type": {"token"}, "client_id": {testClientId}, "redirect_uri": {testRedirectUri}, "scope": {"openid"}},
+			status:   http.StatusFound,
+			expected: "unsupported_response_type",
+		},
+		{
+			name:     "missing openid scope",
+			params:   url.Values{"response_type": {"code"}, "client_id": {testClientId}, "redirect_uri": {testRedirectUri}, "scope": {"profile"}},
+			status:   http.StatusFound,
+			expected: "invalid_scope",
+		},
+		{
+			name:     "plain code_challenge",
+			params:   url.Values{"response_type": {"code"}, "client_id": {testClientId}, "redirect_uri": {testRedirectUri}, "scope": {"openid"}, "code_challenge": {"abc"}},
+			status:   http.StatusFound,
+			expected: "invalid_request",
+		},
+	}
+	for _, tc := range testcases {
+		resp, err := st.client.Get(st.url(PathAuthorize) + "?" + tc.params.Encode())
+		if nil != err {
+			t.Fatalf("%s: failed authorize request, got error %v", tc.name, err)
+		}
+		resp.Body.Close()
+		if tc.status != resp.StatusCode {
+			t.Errorf("%s: failed status control, got %d", tc.name, resp.StatusCode)
+			continue
+		}
+		if "" != tc.expected {
+			loc, err := resp.Location()
+			if nil != err || tc.expected != loc.Query().Get("error") {
+				t.Errorf("%s: failed redirect control, got %v", tc.name, loc)
+			}
+		}
+	}
+}
+
+func TestProviderAuthorizePage(t *testing.T) {
+	st := newStage(t)
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {testClientId},
+		"redirect_uri":  {testRedirectUri},
+		"scope":         {"openid"},
+	}
+	resp, err := st.client.Get(st.url(PathAuthorize) + "?" + params.Encode())
+	if nil != err {
+		t.Fatalf("failed authorize request, got error %v", err)
+	}
+	defer resp.Body.Close()
+	if http.StatusOK != resp.StatusCode || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("failed login page control, got status %d & type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if nil != err {
+		t.Fatalf("failed reading login page, got error %v", err)
+	}
+	page := string(body)
+	loginUrl := st.provider.cfg.Issuer + PathLogin
+	if !strings.Contains(page, `data-login-url="`+loginUrl+`"`) {
+		t.Errorf("login page does not reference %s", loginUrl)
+	}
+	if !strings.Contains(page, `data-auth-request="{&#34;rId&#34;:`) {
+		t.Errorf("login page does not hold the escaped AppAuthRequest")
+	}
+	u, _ := url.Parse(st.url(PathLogin))
+	if 0 == len(st.client.Jar.Cookies(u)) {
+		t.Error("missing login cookie")
+	}
+}
+
+func TestProviderCardFailures(t *testing.T) {
+	st := newStage(t)
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {testClientId},
+		"redirect_uri":  {testRedirectUri},
+		"scope":         {"openid"},
+	}
+	schref := testSchemes[0]
+
+	// invalid OTP are counted across logins
+	var aar *slp.AppAuthRequest
+	for i := range maxCardFailures {
+		if 0 == i%maxLoginAttempts {
+			aar = st.authorize(t, params)
+		}
+		_, status := st.login(t, aar, schref, loginInvalid)
+		if http.StatusUnauthorized != status {
+			t.Fatalf("#%d: failed invalid login control, got status %d", i, status)
+		}
+	}
+
+	// the Card is locked, even with a valid OTP
+	aar = st.authorize(t, params)
+	res, status := st.login(t, aar, schref, loginValid)
+	if http.StatusTooManyRequests != status || res.Valid {
+		t.Fatalf("failed locked login control, got status %d", status)
+	}
+
+	// the lock ends with the failures window
+	st.provider.mut.Lock()
+	for _, f := range st.provider.failures {
+		f.expiry = time.Now().Add(-time.Second)
+	}
+	st.provider.mut.Unlock()
+	res, status = st.login(t, aar, schref, loginValid)
+	if http.StatusOK != status || !res.Valid {
+		t.Fatalf("failed login after failures window, got status %d", status)
+	}
+}
+
+func TestProviderLoginReplay(t *testing.T) {
+	st := newStage(t)
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {testClientId},
+		"redirect_uri":  {testRedirectUri},
+		"scope":         {"openid"},
+	}
+	schref := testSchemes[0]
+
+	aar := st.authorize(t, params)
+	res, status := st.login(t, aar, schref, loginValid)
+	if http.StatusOK != status || !res.Valid {
+		t.Fatalf("failed login, got status %d", status)
+	}
+
+	// a consumed DirectLoginRequest is rejected by other logins
+	aar = st.authorize(t, params)
+	res, status = st.login(t, aar, schref, loginReplay)
+	if http.StatusUnauthorized != status || res.Valid {
+		t.Fatalf("failed replayed login control, got status %d", status)
+	}
+
+	// the login remains usable with a new SLP session
+	res, status = st.login(t, aar, schref, loginValid)
+	if http.StatusOK != status || !res.Valid {
+		t.Fatalf("failed login after replay, got status %d", status)
+	}
+}
+
+func TestProviderTokenClientAuth(t *testing.T) {
+	st := newStage(t)
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {"unknown"}, "redirect_uri": {testRedirectUri}}
+	req, _ := http.NewRequest(http.MethodPost, st.url(PathToken), strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(testClientId, "invalid-client-secret")
+	resp, err := st.client.Do(req)
+	if nil != err {
+		t.Fatalf("failed token request, got error %v", err)
+	}
+	resp.Body.Close()
+	if http.StatusUnauthorized != resp.StatusCode {
+		t.Fatalf("failed client authentication control, got status %d", resp.StatusCode)
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	st := newStage(t)
+	base := st.provider.cfg
+	testcases := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{name: "http Issuer", modify: func(c *Config) { c.Issuer = "http://idp.kerpass.org" }},
+		{name: "empty Methods", modify: func(c *Config) { c.Methods = nil }},
+		{name: "unsupported protocol", modify: func(c *Config) {
+			c.Methods = []slp.AuthMethod{{Protocol: slp.SlpCpace, Scheme: testSchemes[0]}}
+		}},
+		{name: "short client Secret", modify: func(c *Config) {
+			c.Clients = []Client{{Id: "x", Secret: "short", RedirectUris: []string{testRedirectUri}}}
+		}},
+		{name: "duplicate client", modify: func(c *Config) { c.Clients = append(c.Clients, c.Clients[0]) }},
+		{name: "nil Factory", modify: func(c *Config) { c.Factory = nil }},
+	}
+	for _, tc := range testcases {
+		cfg := base
+		cfg.Clients = append([]Client(nil), base.Clients...)
+		tc.modify(&cfg)
+		if nil == cfg.Check() {
+			t.Errorf("%s: failed Check control, got nil error", tc.name)
+		}
+	}
+}
+
+type stage struct {
+	realmId  [32]byte
+	card     *credentials.Card
+	provider *Provider
+	server   *httptest.Server
+	client   *http.Client
+	lastDlr  []byte // last DirectLoginRequest submitted by login
+}
+
+func newStage(t *testing.T) *stage {
+	ctx := context.Background()
+	curve := ecdh.X25519()
+
+	// register Realm, Realm static keys & Card
+	scs, err := credentials.NewMemServerCredStore()
+	if nil != err {
+		t.Fatalf("failed instantiating scs, got error %v", err)
+	}
+	realmId := [32]byte{1, 2, 3, 4}
+	err = scs.SaveRealm(ctx, &credentials.Realm{RealmId: realmId[:], AppName: "IdP"})
+	if nil != err {
+		t.Fatalf("failed saving realm, got error %v", err)
+	}
+	kst := credentials.NewMemKeyStore()
+	sk := credentials.ServerKey{RealmId: realmId[:], Certificate: []byte("TBD")}
+	sk.Kh.PrivateKey, err = curve.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating realm static key, got error %v", err)
+	}
+	idh, err := credentials.NewIdHasher(nil)
+	if nil != err {
+		t.Fatalf("failed IdHasher instantiation, got error %v", err)
+	}
+	cc := credentials.Card{RealmId: realmId[:], UserId: "alice", Psk: make([]byte, 32)}
+	rand.Read(cc.Psk)
+	cc.IdToken, err = idh.IdTokenOfUserId(realmId[:], cc.UserId, nil)
+	if nil != err {
+		t.Fatalf("failed IdToken derivation, got error %v", err)
+	}
+	cc.Kh.PrivateKey, err = curve.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating card key, got error %v", err)
+	}
+	sc := credentials.ServerCard{RealmId: realmId[:], Psk: cc.Psk}
+	sc.Kh.PublicKey = cc.Kh.PrivateKey.PublicKey()
+	err = scs.SaveCard(ctx, cc.IdToken, &sc)
+	if nil != err {
+		t.Fatalf("failed saving server card, got error %v", err)
+	}
+
+	// ChallengeFactory
+	var acs []slp.AuthContext
+	var methods []slp.AuthMethod
+	for _, schref := range testSchemes {
+		sch, err := ephemsec.GetScheme(schref)
+		if nil != err {
+			t.Fatalf("failed loading scheme, got error %v", err)
+		}
+		err = kst.SaveServerKey(ctx, sch.Name(), sk)
+		if nil != err {
+			t.Fatalf("failed saving realm static key, got error %v", err)
+		}
+		mtd := slp.AuthMethod{Protocol: slp.SlpDirect, Scheme: schref}
+		methods = append(methods, mtd)
+		acs = append(acs, slp.AuthContext{
+			RealmId:              realmId,
+			AuthMethod:           mtd,
+			AppContextUrl:        testAppUrl,
+			AuthServerGetChalUrl: "https://idp.kerpass.org/get-card-chal",
+			AuthServerLoginUrl:   "https://idp.kerpass.org/oidc/login",
+			AppStartUrl:          "https://demo.kerpass.org",
+		})
+	}
+	chf, err := slp.NewChallengeFactoryImpl(5*time.Minute, kst, scs, acs)
+	if nil != err {
+		t.Fatalf("failed ChallengeFactory creation, got error %v", err)
+	}
+
+	// Provider
+	sgk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating signing key, got error %v", err)
+	}
+	provider, err := NewProvider(Config{
+		Issuer:               "https://idp.kerpass.org/oidc/",
+		RealmId:              realmId,
+		AuthServerGetChalUrl: "https://idp.kerpass.org/get-card-chal",
+		Methods:              methods,
+		Clients:              []Client{{Id: testClientId, Secret: testSecret, RedirectUris: []string{testRedirectUri}}},
+		SigningKey:           sgk,
+		Idh:                  idh,
+		Factory:              chf,
+	})
+	if nil != err {
+		t.Fatalf("failed NewProvider, got error %v", err)
+	}
+
+	// server endpoints
+	mux := http.NewServeMux()
+	getCardChalHdlr, err := slp.NewCardChallengeEndpoint(chf)
+	if nil != err {
+		t.Fatalf("failed creating the CardChallenge endpoint, got error %v", err)
+	}
+	mux.Handle("POST /get-card-chal", getCardChalHdlr)
+	mux.Handle("/oidc/", provider)
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+
+	client := srv.Client()
+	client.Jar, err = cookiejar.New(nil)
+	if nil != err {
+		t.Fatalf("failed creating cookie jar, got error %v", err)
+	}
+
+	return &stage{realmId: realmId, card: &cc, provider: provider, server: srv, client: client}
+}
+
+// url returns the test server url of the Provider endpoint pth.
+func (self *stage) url(pth string) string {
+	return self.server.URL + "/oidc" + pth
+}
+
+func (self *stage) getJSON(t *testing.T, pth string, dst any) {
+	resp, err := self.client.Get(self.url(pth))
+	if nil != err {
+		t.Fatalf("failed GET %s, got error %v", pth, err)
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(dst)
+	if nil != err {
+		t.Fatalf("failed decoding %s response, got error %v", pth, err)
+	}
+}
+
+// authorize starts an authorization request and returns the Provider slp.AppAuthRequest.
+func (self *stage) authorize(t *testing.T, params url.Values) *slp.AppAuthRequest {
+	req, err := http.NewRequest(http.MethodGet, self.url(PathAuthorize)+"?"+params.Encode(), nil)
+	if nil != err {
+		t.Fatalf("failed creating authorize request, got error %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := self.client.Do(req)
+	if nil != err {
+		t.Fatalf("failed authorize request, got error %v", err)
+	}
+	defer resp.Body.Close()
+	var aar slp.AppAuthRequest
+	err = json.NewDecoder(resp.Body).Decode(&aar)
+	if nil != err {
+		t.Fatalf("failed decoding authorize response, got error %v", err)
+	}
+	err = aar.Check()
+	if nil != err {
+		t.Fatalf("failed AppAuthRequest Check, got error %v", err)
+	}
+	return &aar
+}
+
+// login acts as the CardAgent, it obtains a CardChallenge and submits the Card OTP/OTK.
+func (self *stage) login(t *testing.T, aar *slp.AppAuthRequest, schref uint16, mode int) (*LoginResult, int) {
+	if loginReplay == mode {
+		return self.postLogin(t, self.lastDlr)
+	}
+	ctx := context.Background()
+	sch, err := ephemsec.GetScheme(schref)
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	ccr := slp.CardChallengeRequest{
+		RealmId:        aar.RealmId,
+		SelectedMethod: slp.AuthMethod{Protocol: slp.SlpDirect, Scheme: schref},
+		AppContextUrl:  testAppUrl,
+	}
+	var cc slp.CardChallenge
+	err = slp.GetCardChallenge(ctx, self.client, self.server.URL+"/get-card-chal", &ccr, &cc)
+	if nil != err {
+		t.Fatalf("failed obtaining CardChallenge, got error %v", err)
+	}
+
+	aac := slp.AgentAuthContext{
+		SelectedProtocol:     slp.SlpDirect,
+		SessionId:            cc.SessionId,
+		StaticKeyCert:        cc.StaticKeyCert,
+		AppContextUrl:        testAppUrl,
+		AuthServerGetChalUrl: aar.AuthServerGetChalUrl,
+		AuthServerLoginUrl:   cc.AuthServerLoginUrl,
+		AppStartUrl:          cc.AppStartUrl,
+	}
+	ach, err := aac.Sum(nil)
+	if nil != err {
+		t.Fatalf("failed hashing AgentAuthContext, got error %v", err)
+	}
+	ach, err = slp.EphemSecContextHash(aar.RealmId, ach, nil)
+	if nil != err {
+		t.Fatalf("failed ephemsec context hashing, got error %v", err)
+	}
+	eps := ephemsec.State{
+		Context:         ach,
+		Nonce:           cc.INonce,
+		StaticKey:       self.card.Kh.PrivateKey,
+		RemoteEphemKey:  cc.E.PublicKey,
+		RemoteStaticKey: cc.S.PublicKey,
+		Psk:             self.card.Psk,
+	}
+	otp, err := eps.EPHEMSEC(sch, ephemsec.Responder, nil)
+	if nil != err {
+		t.Fatalf("failed client OTP calculation, got error %v", err)
+	}
+	switch mode {
+	case loginInvalid:
+		otp[0] = byte((int(otp[0]) + 1) % sch.B())
+	case loginMalformed:
+		otp = otp[1:]
+	}
+	dlr := slp.DirectLoginRequest{SessionId: cc.SessionId, Otp: otp, CardId: self.card.IdToken}
+	if 256 != sch.B() {
+		dlr.CardId = []byte(self.card.UserId)
+	}
+	srzdlr, err := ctapSrz.Marshal(&dlr)
+	if nil != err {
+		t.Fatalf("failed DirectLoginRequest encoding, got error %v", err)
+	}
+	self.lastDlr = srzdlr
+
+	return self.postLogin(t, srzdlr)
+}
+
+// postLogin submits the encoded DirectLoginRequest srzdlr to the Provider login endpoint.
+func (self *stage) postLogin(t *testing.T, srzdlr []byte) (*LoginResult, int) {
+	resp, err := self.client.Post(self.url(PathLogin), "application/cbor", bytes.NewReader(srzdlr))
+	if nil != err {
+		t.Fatalf("failed login request, got error %v", err)
+	}
+	defer resp.Body.Close()
+	var res LoginResult
+	body, _ := io.ReadAll(resp.Body)
+	err = json.Unmarshal(body, &res)
+	if nil != err {
+		t.Fatalf("failed decoding login response, got error %v [%s]", err, body)
+	}
+	return &res, resp.StatusCode
+}
+
+// token exchanges code at the Provider token endpoint.
+func (self *stage) token(t *testing.T, code string, verifier string) (*TokenResponse, int) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectUri},
+		"code_verifier": {verifier},
+		"client_id":     {testClientId},
+		"client_secret": {testSecret},
+	}
+	resp, err := self.client.PostForm(self.url(PathToken), form)
+	if nil != err {
+		t.Fatalf("failed token request, got error %v", err)
+	}
+	defer resp.Body.Close()
+	if "no-store" != resp.Header.Get("Cache-Control") {
+		t.Errorf("failed Cache-Control control, got %q", resp.Header.Get("Cache-Control"))
+	}
+	var tr TokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&tr)
+	if nil != err {
+		t.Fatalf("failed decoding token response, got error %v", err)
+	}
+	return &tr, resp.StatusCode
+}
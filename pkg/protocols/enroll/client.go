@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/ecdh"
 	"crypto/rand"
+	"unicode/utf8"
 
 	"code.kerpass.org/golang/internal/observability"
 	"code.kerpass.org/golang/pkg/credentials"
@@ -31,6 +32,9 @@ type ClientCfg struct {
 	EnrollToken credentials.EnrollToken
 	Repo        credentials.ClientCredStore
 	OnNewCard   CardUser
+
+	// Label is optional, it names the new Card on the client & server sides
+	Label string
 }
 
 func (self ClientCfg) Check() error {
@@ -43,6 +47,9 @@ func (self ClientCfg) Check() error {
 	if err := self.EnrollToken.Check(); nil != err {
 		return wrapError(err, "failed EnrollToken validation")
 	}
+	if len(self.Label) > maxLabelSize || !utf8.ValidString(self.Label) {
+		return wrapError(ErrValidation, "invalid Label")
+	}
 
 	return nil
 }
@@ -52,7 +59,9 @@ type ClientState struct {
 	EnrollToken []byte
 	Repo        credentials.ClientCredStore
 	OnNewCard   CardUser
+	Label       string
 	hs          noise.HandshakeState
+	version     uint16
 	cardId      int
 	next        ClientStateFunc
 }
@@ -68,6 +77,7 @@ func NewClientState(cfg ClientCfg) (*ClientState, error) {
 		EnrollToken: cfg.EnrollToken,
 		Repo:        cfg.Repo,
 		OnNewCard:   cfg.OnNewCard,
+		Label:       cfg.Label,
 		next:        ClientInit,
 	}
 
@@ -116,11 +126,22 @@ func ClientInit(ctx context.Context, self *ClientState, _ []byte) (sf ClientStat
 		return sf, rmsg, wrapError(err, errmsg)
 	}
 
+	// prepare EnrollReq negotiation data
+	log.Debug("preparing EnrollReq negotiation data")
+	req := EnrollReq{Protocol: noiseCfg.ProtoName, RealmId: self.RealmId, Versions: supportedVersions}
+	negotiation, err := cborSrz.Marshal(&req)
+	if nil != err {
+		errmsg = "failed CBOR marshal of EnrollReq"
+		log.Debug(errmsg, "error", err)
+		return sf, rmsg, wrapError(err, errmsg)
+	}
+	imsg := noise.InitialMessage{NegotiationData: negotiation}
+
 	// initialize noise Handshake
 	log.Debug("initializing noise handshake")
 	params := noise.HandshakeParams{
 		Cfg:           noiseCfg,
-		Prologue:      self.RealmId,
+		Prologue:      imsg.Prologue(),
 		StaticKeypair: keypair,
 		Psks:          dummyPsks,
 		Initiator:     true,
@@ -132,8 +153,7 @@ func ClientInit(ctx context.Context, self *ClientState, _ []byte) (sf ClientStat
 		return sf, rmsg, wrapError(err, errmsg)
 	}
 
-	// generate initial noise msg
-	// Client: -> e
+	// prepare Client: -> [EnrollReq], e
 	log.Debug("generating handshake message with nil payload")
 	var buf bytes.Buffer
 	_, err = self.hs.WriteMessage(nil, &buf)
@@ -143,14 +163,10 @@ func ClientInit(ctx context.Context, self *ClientState, _ []byte) (sf ClientStat
 		return sf, rmsg, wrapError(err, errmsg)
 
 	}
-
-	// prepare Client: -> [EnrollReq]
-	// It can not be send as noise payload because the server needs to know the RealmId to load its static key...
-	log.Debug("preparing EnrollReq message")
-	req := EnrollReq{RealmId: self.RealmId, Msg: buf.Bytes()}
-	rmsg, err = cborSrz.Marshal(req)
+	imsg.NoiseMessage = buf.Bytes()
+	rmsg, err = imsg.AppendBinary(nil)
 	if nil != err {
-		errmsg = "failed CBOR marshal of EnrollReq"
+		errmsg = "failed marshal of InitialMessage"
 		log.Debug(errmsg, "error", err)
 		return sf, nil, wrapError(err, errmsg)
 	}
@@ -175,16 +191,34 @@ func ClientReceiveServerKey(ctx context.Context, self *ClientState, msg []byte)
 		}
 	}()
 
-	// receive Server: <- e, ee, s, es, {Certificate}
+	// receive Server: <- e, ee, s, es, {Certificate, [Version]}
 	log.Debug("reading handshake message")
 	var buf bytes.Buffer
 	_, err = self.hs.ReadMessage(msg, &buf)
 	if nil != err {
+		countHandshakeFailure(ctx)
 		errmsg = "failed reading handshake message"
 		log.Debug(errmsg, "error", err)
 		return sf, rmsg, wrapError(err, errmsg)
 	}
-	srvcert := buf.Bytes()
+	payload := noise.Payload{}
+	err = payload.UnmarshalBinary(buf.Bytes())
+	if nil != err {
+		errmsg = "failed unmarshal of handshake message payload"
+		log.Debug(errmsg, "error", err)
+		return sf, rmsg, wrapError(err, errmsg)
+	}
+	srvcert := payload.Body
+
+	// control server selected version
+	log.Debug("controlling server selected protocol version")
+	version, err := readVersion(&payload)
+	if nil != err {
+		errmsg = "failed protocol version control"
+		log.Debug(errmsg, "error", err)
+		return sf, rmsg, wrapError(err, errmsg)
+	}
+	self.version = version
 
 	// control RemoteStaticKey()
 	log.Debug("controlling remote server static key")
@@ -198,7 +232,7 @@ func ClientReceiveServerKey(ctx context.Context, self *ClientState, msg []byte)
 
 	// prepare Client: -> s, se, {EnrollAuthorization}
 	log.Debug("generating handshake message with EnrollAuthorization payload")
-	srzmsg, err := cborSrz.Marshal(EnrollAuthorization{EnrollToken: self.EnrollToken})
+	srzmsg, err := cborSrz.Marshal(EnrollAuthorization{EnrollToken: self.EnrollToken, Label: self.Label})
 	if nil != err {
 		errmsg = "failed CBOR marshal of EnrollAuthorization"
 		log.Debug(errmsg, "error", err)
@@ -237,6 +271,7 @@ func ClientCardCreate(ctx context.Context, self *ClientState, msg []byte) (sf Cl
 	var buf bytes.Buffer
 	_, err = self.hs.ReadMessage(msg, &buf)
 	if nil != err {
+		countHandshakeFailure(ctx)
 		errmsg = "failed reading handshake message"
 		log.Debug(errmsg, "error", err)
 		return sf, rmsg, wrapError(err, errmsg)
@@ -265,6 +300,7 @@ func ClientCardCreate(ctx context.Context, self *ClientState, msg []byte) (sf Cl
 		AppName: srv.AppName,
 		AppDesc: srv.AppDesc,
 		AppLogo: srv.AppLogo,
+		Label:   self.Label,
 		Psk:     psk,
 	}
 	card.Kh.PrivateKey = self.hs.StaticKeypair()
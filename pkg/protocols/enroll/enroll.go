@@ -8,6 +8,11 @@
 // a PKI context that allows validating Application service keys...
 //
 // The Enrollment protocol is built on top of a Noise XX key exchange.
+// The client first handshake message is a noise.InitialMessage which negotiation data is an
+// EnrollReq that contains the noise protocol name, the RealmId and the client supported protocol
+// versions. The server uses it to load its static key and select the protocol version, that it
+// returns as a payload extension of its handshake message. The EnrollReq is authenticated as
+// handshake prologue. Unversioned client requests are rejected with ErrUnsupportedVersion.
 // Prior to execution of the protocol, the client generates a fresh X25519 Keypair which is used
 // as client static Keypair for the Noise XX exchange. The server will accept client public key
 // if client transmits a valid authorization identifier. If the Noise XX key exchange succeeds,
@@ -24,6 +29,17 @@ import (
 	"code.kerpass.org/golang/pkg/noise"
 )
 
+const (
+	// ProtocolVersion is the latest enroll protocol version.
+	ProtocolVersion = uint16(1)
+
+	// extVersion is the server handshake payload extension that holds the selected protocol version.
+	extVersion = uint16(1)
+)
+
+// supportedVersions lists the enroll protocol versions supported by this package.
+var supportedVersions = []uint16{ProtocolVersion}
+
 var noiseCfg noise.Config
 var dummyPsks [][]byte
 var cborSrz transport.SafeSerializer
@@ -1,15 +1,20 @@
 package enroll
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
 	"net"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"code.kerpass.org/golang/internal/observability"
 	"code.kerpass.org/golang/internal/transport"
 	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/noise"
 	"code.kerpass.org/golang/pkg/protocols"
 )
 
@@ -49,6 +54,11 @@ func TestFsmEnrollSuccess(t *testing.T) {
 		t.Errorf("failed server protocol, got error %v", se)
 	}
 
+	// check negotiated version
+	if ProtocolVersion != cli.version || ProtocolVersion != srv.version {
+		t.Errorf("failed version control, client %d, server %d", cli.version, srv.version)
+	}
+
 	// check that client Card was saved
 	count := cli.Repo.CardCount()
 	if 1 != count {
@@ -70,6 +80,21 @@ func TestFsmEnrollSuccess(t *testing.T) {
 	} else if 0 != count {
 		t.Errorf("failed server AuthorizationCount control, %d != 0", count)
 	}
+
+	// check that both Cards are labeled
+	var card credentials.ClientCard
+	err = cli.Repo.LoadCard(cli.cardId, &card)
+	if nil != err {
+		t.Fatalf("failed client LoadCard, got error %v", err)
+	}
+	var sc credentials.ServerCard
+	err = srv.Repo.LoadCard(context.Background(), credentials.IdToken(card.IdToken), &sc)
+	if nil != err {
+		t.Fatalf("failed server LoadCard, got error %v", err)
+	}
+	if cli.Label != card.Label || cli.Label != sc.Label {
+		t.Errorf("failed Label control, client %q, server %q", card.Label, sc.Label)
+	}
 }
 
 func TestFsmEnrollFailAuthorization(t *testing.T) {
@@ -266,6 +291,261 @@ func TestFsmEnrollFailWriteClientConfirmation(t *testing.T) {
 
 }
 
+func TestFsmEnrollOverTCP(t *testing.T) {
+	observability.SetTestDebugLogging(t)
+	cli, srv := makePeerState(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cfg := transport.ConnConfig{ReadTimeout: 500 * time.Millisecond, WriteTimeout: 500 * time.Millisecond}
+	ln, err := transport.Listen(ctx, "tcp", "127.0.0.1:0", cfg)
+	if nil != err {
+		t.Fatalf("failed Listen, got error %v", err)
+	}
+	defer ln.Close()
+
+	// run server protocol
+	rs := make(chan error, 1)
+	go func(result chan<- error) {
+		st, err := ln.AcceptTransport(ctx)
+		if nil != err {
+			result <- err
+			return
+		}
+		defer st.Close()
+		result <- protocols.Run(ctx, srv, st)
+	}(rs)
+
+	// run client protocol
+	ct, err := transport.Dial(ctx, "tcp", ln.Addr().String(), cfg)
+	if nil != err {
+		t.Fatalf("failed Dial, got error %v", err)
+	}
+	defer ct.Close()
+	ce := protocols.Run(ctx, cli, ct)
+	if nil != ce {
+		t.Errorf("failed client protocol, got error %v", ce)
+	}
+
+	se := <-rs
+	if nil != se {
+		t.Errorf("failed server protocol, got error %v", se)
+	}
+
+	// check that client & server Cards were saved
+	count := cli.Repo.CardCount()
+	if 1 != count {
+		t.Errorf("failed client CardCount control, %d != 1", count)
+	}
+	count, err = srv.Repo.CardCount(ctx)
+	if nil != err {
+		t.Errorf("failed Cardcount, got error %v", err)
+	} else if 1 != count {
+		t.Errorf("failed server CardCount control, %d != 1", count)
+	}
+}
+
+func TestFsmEnrollOverWebSocket(t *testing.T) {
+	observability.SetTestDebugLogging(t)
+	cli, srv := makePeerState(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cfg := transport.ConnConfig{ReadTimeout: 500 * time.Millisecond, WriteTimeout: 500 * time.Millisecond}
+
+	// starts test server
+	rs := make(chan error, 1)
+	hdlr := transport.WSHandler{
+		Cfg: cfg,
+		Serve: func(ctx context.Context, st transport.Transport) error {
+			err := protocols.Run(ctx, srv, st)
+			rs <- err
+			return err
+		},
+	}
+	hs := httptest.NewServer(observability.Middleware{}.Wrap(hdlr))
+	defer hs.Close()
+
+	// run client protocol
+	ct, err := transport.WSDial(ctx, "ws"+strings.TrimPrefix(hs.URL, "http"), cfg)
+	if nil != err {
+		t.Fatalf("failed WSDial, got error %v", err)
+	}
+	defer ct.Close()
+	ce := protocols.Run(ctx, cli, ct)
+	if nil != ce {
+		t.Errorf("failed client protocol, got error %v", ce)
+	}
+
+	se := <-rs
+	if nil != se {
+		t.Errorf("failed server protocol, got error %v", se)
+	}
+
+	// check that client & server Cards were saved
+	count := cli.Repo.CardCount()
+	if 1 != count {
+		t.Errorf("failed client CardCount control, %d != 1", count)
+	}
+	count, err = srv.Repo.CardCount(ctx)
+	if nil != err {
+		t.Errorf("failed Cardcount, got error %v", err)
+	} else if 1 != count {
+		t.Errorf("failed server CardCount control, %d != 1", count)
+	}
+}
+
+func TestServerInitNegotiation(t *testing.T) {
+	testcases := []struct {
+		name    string
+		modify  func(*EnrollReq)
+		srvFail bool
+		srvErr  error
+	}{
+		{name: "valid", modify: func(req *EnrollReq) {}},
+		{
+			// the EnrollReq is authenticated as prologue, server fails reading modified client message
+			name:    "extra_version",
+			modify:  func(req *EnrollReq) { req.Versions = []uint16{ProtocolVersion, 0xFFFF} },
+			srvFail: true,
+		},
+		{name: "unsupported_protocol", modify: func(req *EnrollReq) { req.Protocol = "Noise_XX_25519_AESGCM_SHA512" }, srvFail: true},
+		{name: "unsupported_version", modify: func(req *EnrollReq) { req.Versions = []uint16{0xFFFF} }, srvFail: true, srvErr: ErrUnsupportedVersion},
+		{name: "unknown_realm", modify: func(req *EnrollReq) { rand.Read(req.RealmId) }, srvFail: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cli, srv := makePeerState(t)
+			ctx := context.Background()
+			_, msg, err := ClientInit(ctx, cli, nil)
+			if nil != err {
+				t.Fatalf("failed ClientInit, got error %v", err)
+			}
+
+			// rewrite client EnrollReq
+			imsg := noise.InitialMessage{}
+			err = imsg.UnmarshalBinary(msg)
+			if nil != err {
+				t.Fatalf("failed InitialMessage unmarshal, got error %v", err)
+			}
+			req := EnrollReq{}
+			err = cborSrz.Unmarshal(imsg.NegotiationData, &req)
+			if nil != err {
+				t.Fatalf("failed EnrollReq unmarshal, got error %v", err)
+			}
+			tc.modify(&req)
+			imsg.NegotiationData, err = cborSrz.Marshal(&req)
+			if nil != err {
+				t.Fatalf("failed EnrollReq marshal, got error %v", err)
+			}
+			msg, err = imsg.AppendBinary(nil)
+			if nil != err {
+				t.Fatalf("failed InitialMessage marshal, got error %v", err)
+			}
+
+			_, msg, err = ServerInit(ctx, srv, msg)
+			if tc.srvFail {
+				if nil == err {
+					t.Fatal("ServerInit succeeded")
+				}
+				if nil != tc.srvErr && !errors.Is(err, tc.srvErr) {
+					t.Fatalf("failed ServerInit error control, got error %v", err)
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("failed ServerInit, got error %v", err)
+			}
+
+			_, _, err = ClientReceiveServerKey(ctx, cli, msg)
+			if nil != err {
+				t.Fatalf("failed ClientReceiveServerKey, got error %v", err)
+			}
+			if ProtocolVersion != cli.version {
+				t.Fatalf("failed client version control, got %d", cli.version)
+			}
+		})
+	}
+}
+
+func TestServerInitUnversionedRequest(t *testing.T) {
+	srz := transport.NewCBORSerializer()
+	testcases := []struct {
+		name string
+		msg  func(*ClientState, *noise.InitialMessage) ([]byte, error)
+	}{
+		{
+			// pre-versioning client first message, CBOR {1: RealmId, 2: noise message}
+			name: "legacy_message",
+			msg: func(cli *ClientState, imsg *noise.InitialMessage) ([]byte, error) {
+				return srz.Marshal(map[int]any{1: []byte(cli.RealmId), 2: imsg.NoiseMessage})
+			},
+		},
+		{
+			name: "missing_versions",
+			msg: func(cli *ClientState, imsg *noise.InitialMessage) ([]byte, error) {
+				data, err := srz.Marshal(map[int]any{1: []byte(cli.RealmId), 3: noiseCfg.ProtoName})
+				if nil != err {
+					return nil, err
+				}
+				imsg.NegotiationData = data
+				return imsg.AppendBinary(nil)
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cli, srv := makePeerState(t)
+			ctx := context.Background()
+			_, msg, err := ClientInit(ctx, cli, nil)
+			if nil != err {
+				t.Fatalf("failed ClientInit, got error %v", err)
+			}
+			imsg := noise.InitialMessage{}
+			err = imsg.UnmarshalBinary(msg)
+			if nil != err {
+				t.Fatalf("failed InitialMessage unmarshal, got error %v", err)
+			}
+			msg, err = tc.msg(cli, &imsg)
+			if nil != err {
+				t.Fatalf("failed preparing client message, got error %v", err)
+			}
+
+			_, _, err = ServerInit(ctx, srv, msg)
+			if !errors.Is(err, ErrUnsupportedVersion) {
+				t.Fatalf("failed ServerInit error control, got error %v", err)
+			}
+		})
+	}
+}
+
+func TestEnrollReqWireKeys(t *testing.T) {
+	realmId := make([]byte, 32)
+	rand.Read(realmId)
+	req := EnrollReq{RealmId: realmId, Protocol: noiseCfg.ProtoName, Versions: supportedVersions}
+	data, err := cborSrz.Marshal(&req)
+	if nil != err {
+		t.Fatalf("failed EnrollReq marshal, got error %v", err)
+	}
+	fields := map[int]any{}
+	err = transport.NewCBORSerializer().Unmarshal(data, &fields)
+	if nil != err {
+		t.Fatalf("failed EnrollReq fields unmarshal, got error %v", err)
+	}
+	if rid, ok := fields[1].([]byte); !ok || !bytes.Equal(realmId, rid) {
+		t.Errorf("failed RealmId key control, got %v", fields[1])
+	}
+	if _, found := fields[2]; found {
+		t.Error("reserved key 2 is in use")
+	}
+	if noiseCfg.ProtoName != fields[3] {
+		t.Errorf("failed Protocol key control, got %v", fields[3])
+	}
+	if _, found := fields[4]; !found {
+		t.Error("missing Versions key")
+	}
+}
+
 func makePeerState(t *testing.T) (*ClientState, *ServerState) {
 
 	// generate realmId
@@ -315,6 +595,7 @@ func makePeerState(t *testing.T) (*ClientState, *ServerState) {
 			RealmId:     realmId,
 			EnrollToken: enrollToken,
 			Repo:        clientCredStore,
+			Label:       "Work phone",
 		},
 	)
 	if nil != err {
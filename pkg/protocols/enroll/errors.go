@@ -12,6 +12,7 @@ const (
 	Error                   = errorFlag("enroll: error")
 	ErrValidation           = errorFlag("enroll: failed validation")
 	ErrInvalidAuthorization = errorFlag("enroll: invalid authorization")
+	ErrUnsupportedVersion   = errorFlag("enroll: unsupported protocol version")
 	noError                 = errorFlag("")
 )
 
@@ -1,19 +1,10 @@
 package enroll
 
 import (
-	"bytes"
 	"context"
-	"encoding/hex"
-	"errors"
-	"io"
 	"net/http"
-	"net/url"
-	"slices"
-	"sync"
 	"time"
 
-	"code.kerpass.org/golang/internal/observability"
-	"code.kerpass.org/golang/internal/session"
 	"code.kerpass.org/golang/pkg/credentials"
 	"code.kerpass.org/golang/pkg/protocols"
 )
@@ -24,176 +15,30 @@ const (
 	SessionLifetime = 5 * time.Minute
 )
 
-// HttpSession allows synchronized access to enroll ServerState.
-type HttpSession struct {
-	mut   *sync.Mutex
-	state *ServerState
-}
-
 // HttpHandler holds configuration & state necessary for executing the enroll server protocol.
+// Enroll ServerState is restored if a request fails.
 type HttpHandler struct {
-	Cfg          ServerCfg
-	SessionStore *session.MemStore[session.Sid, HttpSession]
+	Cfg ServerCfg
+	*protocols.HttpServer[*ServerState]
 }
 
 // NewHttpHandler returns a new HttpHandler that maintains enrollment session in memory.
 func NewHttpHandler(keyStore credentials.KeyStore, credStore credentials.ServerCredStore, idGen *credentials.CardIdGenerator) (*HttpHandler, error) {
-	sidFactory, err := session.NewSidFactory(SessionLifetime)
-	if nil != err {
-		return nil, wrapError(err, "failed initializing sidFactory")
-	}
-	sessionStore, err := session.NewMemStore[session.Sid, HttpSession](sidFactory)
-	if nil != err {
-		return nil, wrapError(err, "failed initializing sessionStore")
-	}
-
 	cfg := ServerCfg{KeyStore: keyStore, Repo: credStore, IdGen: idGen}
-	err = cfg.Check()
+	err := cfg.Check()
 	if nil != err {
 		return nil, wrapError(err, "failed ServerCfg Check")
 	}
 
-	hdlr := HttpHandler{
-		Cfg:          cfg,
-		SessionStore: sessionStore,
-	}
-
-	return &hdlr, nil
-}
-
-// ServeHTTP update enroll ServerState using message in incoming request.
-// ServeHTTP restore session ServerState in case of error.
-func (self *HttpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var errmsg string
-	log := observability.GetObservability(r.Context()).Log().With("handler", "enroll")
-
-	// read incoming httpMsg
-	srzmsg, err := io.ReadAll(r.Body)
-	if nil != err {
-		errmsg = "failed reading request body"
-		log.Error(errmsg, "error", err)
-		writeError(w, http.StatusBadRequest, errmsg)
-		return
-	}
-	hm := httpMsg{}
-	err = cborSrz.Unmarshal(srzmsg, &hm)
-	if nil != err {
-		errmsg = "failed deserializing CBOR"
-		log.Error(errmsg, "error", err)
-		writeError(w, http.StatusBadRequest, errmsg)
-		return
-	}
-
-	// success is true only if the handler runs until completion without error.
-	// success is read by deferred functions.
-	var success bool
-
-	// read session
-	var sessionId session.Sid
-	var s HttpSession
-	var found bool
-	if 0 == len(hm.SessionId) {
-		// starts new session
-		log.Debug("starting new HTTP session")
-		state, err := NewServerState(self.Cfg)
-		if nil != err {
-			errmsg = "invalid configuration"
-			log.Error(errmsg, "error", err)
-			writeError(w, http.StatusInternalServerError, errmsg)
-			return
-		}
-		s.mut = new(sync.Mutex)
-		s.state = state
-	} else {
-		// retrieve existing session
-		copy(sessionId[:], hm.SessionId)
-		s, found = self.SessionStore.Get(sessionId)
-		if !found {
-			errmsg = "invalid session"
-			log.Error(errmsg, "sId", hex.EncodeToString(hm.SessionId))
-			writeError(w, http.StatusBadRequest, errmsg)
-			return
-		}
-		log.Debug("reloaded HTTP session", "sId", hex.EncodeToString(hm.SessionId))
-	}
-
-	// lock the session if it exists
-	if found {
-		s.mut.Lock()
-		defer s.mut.Unlock()
+	newFsm := func() (protocols.Fsm[*ServerState], error) {
+		return NewServerState(cfg)
 	}
-
-	var bkupState ServerState
-	state, sf := s.state.State()
-	bkupState = *state
-	sf, rmsg, err := sf(r.Context(), state, hm.Msg)
-	defer func() {
-		if success {
-			s.state.SetState(sf)
-		} else {
-			s.state = &bkupState
-		}
-	}()
-	if (nil != err) && !errors.Is(err, protocols.OK) {
-		errmsg = "protocol error"
-		log.Error(errmsg, "error", err)
-		writeError(w, http.StatusBadRequest, "bad request")
-		return
-	}
-	status := http.StatusOK
-	if errors.Is(err, protocols.OK) {
-		status = http.StatusCreated
-		defer func() {
-			if success {
-				log.Debug("clearing HTTP session", "sId", hex.EncodeToString(sessionId[:]))
-				self.SessionStore.Pop(sessionId)
-			}
-		}()
-	}
-
-	if !found {
-		log.Debug("saving new HTTP session")
-		sessionId, err = self.SessionStore.Save(s)
-		if nil != err {
-			errmsg = "error saving session"
-			log.Error(errmsg, "error", err)
-			writeError(w, http.StatusInternalServerError, errmsg)
-			return
-		}
-		hm.SessionId = sessionId[:]
-		defer func() {
-			if !success {
-				// if we fail the newly created session is useless
-				// as the new sessionId was never forwarded to the client...
-				self.SessionStore.Pop(sessionId)
-			}
-		}()
-	}
-
-	hm.Msg = rmsg
-	srzmsg, err = cborSrz.Marshal(hm)
+	srv, err := protocols.NewHttpServer(newFsm, SessionLifetime)
 	if nil != err {
-		errmsg = "failed CBOR serialization"
-		log.Error(errmsg, "error", err)
-		writeError(w, http.StatusInternalServerError, errmsg)
-		return
+		return nil, wrapError(err, "failed initializing HttpServer")
 	}
 
-	w.Header().Add("Content-Type", "application/cbor")
-	w.WriteHeader(status)
-	_, err = w.Write(srzmsg)
-	if nil == err {
-		success = true
-	} else {
-		log.Error("failed meanwhile delivering the HTTP response", "error", err)
-	}
-}
-
-// writeError writes an error HTTP response to w.
-func writeError(w http.ResponseWriter, status int, msg string) {
-	w.Header().Add("Content-Type", "text/plain")
-	w.WriteHeader(status)
-	io.WriteString(w, msg)
+	return &HttpHandler{Cfg: cfg, HttpServer: srv}, nil
 }
 
 // httpClient is a private interface that simplify mocking http.Client.
@@ -201,108 +46,18 @@ type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-// httpMsg is used to transport request/response of Enroll client & server.
-type httpMsg struct {
-	SessionId []byte `cbor:"1,keyasint"`
-	Msg       []byte `cbor:"2,keyasint"`
-}
-
 // EnrollOverHTTP runs the enroll client protocol over HTTP transport.
 func EnrollOverHTTP(ctx context.Context, cli httpClient, serverUrl string, cfg ClientCfg) error {
-
-	// validate serverUrl
-	srvUrl, err := url.Parse(serverUrl)
+	hc := &protocols.HttpClient{Client: cli, Url: serverUrl}
+	err := hc.Check()
 	if nil != err {
 		return wrapError(err, "invalid serverUrl")
 	}
-	if !slices.Contains([]string{"http", "https"}, srvUrl.Scheme) {
-		return newError("invalid serverUrl scheme %s", srvUrl.Scheme)
-	}
 
-	// construct ClientState
-	var success bool
 	cs, err := NewClientState(cfg)
 	if nil != err {
 		return wrapError(err, "failed ClientState construction")
 	}
-	state, stateFunc := cs.State()
-	defer func() {
-		eh := cs.ExitHandler()
-		if nil == eh {
-			return
-		}
-		if success {
-			eh(cs, nil)
-			return
-		}
-		if nil != err {
-			eh(cs, err)
-		} else {
-			eh(cs, Error) // something went wrong as success is false
-		}
-	}()
-
-	var srzmsg, srvmsg, climsg, sessionId []byte
-	var hm httpMsg
-	var req *http.Request
-	var resp *http.Response
-	var errProto, errIO error
-	for step := range 3 {
-		stateFunc, climsg, errProto = stateFunc(ctx, state, srvmsg)
-		if nil == climsg {
-			break
-		}
-
-		hm = httpMsg{SessionId: sessionId, Msg: climsg}
-		srzmsg, err = cborSrz.Marshal(hm)
-		if nil != err {
-			errIO = wrapError(err, "[%d] failed serializing httpMsg", step)
-			break
-		}
-		req, err = http.NewRequestWithContext(ctx, http.MethodPost, serverUrl, bytes.NewReader(srzmsg))
-		if nil != err {
-			errIO = wrapError(err, "[%d] failed instantiating http Request", step)
-			break
-		}
-		req.Header.Add("Content-Type", "application/cbor")
-		resp, err = cli.Do(req)
-		if nil != err {
-			errIO = wrapError(err, "failed http POST request")
-			break
-		}
-		if resp.StatusCode >= 300 || resp.StatusCode < 200 {
-			errIO = newError("[%d] failed http POST request, got status %d", step, resp.StatusCode)
-			break
-		}
-		srzmsg, err = io.ReadAll(resp.Body)
-		if nil != err {
-			errIO = wrapError(err, "[%d] failed reading resp.Body", step)
-			break
-		}
-		hm = httpMsg{}
-		err = cborSrz.Unmarshal(srzmsg, &hm)
-		if nil != err {
-			errIO = wrapError(err, "[%d] failed deserializing resp.Body", step)
-			break
-		}
-		sessionId = hm.SessionId
-		if 0 == len(sessionId) {
-			errIO = newError("[%d] invalid server response miss sessionId", step)
-			break
-		}
-		srvmsg = hm.Msg
-	}
-
-	if nil == errProto {
-		errProto = newError("invalid protocol status")
-	}
-
-	if errors.Is(errProto, protocols.OK) && nil == errIO {
-		err = nil
-		success = true
-	} else {
-		err = errors.Join(errProto, errIO)
-	}
 
-	return err
+	return protocols.RunOverHTTP(ctx, cs, hc)
 }
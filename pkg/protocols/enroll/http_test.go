@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -110,6 +111,40 @@ func TestHttpEnrollReplaySuccess(t *testing.T) {
 	}
 }
 
+func TestHttpEnrollObservability(t *testing.T) {
+	clicfg, srvhdlr := makePeerConfig(t)
+
+	exp := &observability.MemExporter{}
+	srv := httptest.NewServer(observability.Middleware{Exporter: exp}.Wrap(srvhdlr))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+	ctx = observability.SetObservability(ctx, &observability.Observability{Exporter: exp})
+	ctx, span := observability.StartSpan(ctx, "test")
+	err := EnrollOverHTTP(ctx, http.DefaultClient, srv.URL, clicfg)
+	span.End(err)
+	if nil != err {
+		t.Fatalf("Failed EnrollOverHTTP, got error %v", err)
+	}
+
+	if n := exp.Sum(observability.MetricEnrollments, slog.String("outcome", "success")); 1 != n {
+		t.Errorf("failed enrollments counter control, %v != 1", n)
+	}
+	names := map[string]bool{}
+	for _, sd := range exp.Spans() {
+		if sd.SpanContext.TraceId != span.Context().TraceId {
+			t.Errorf("span %s is not part of the test trace", sd.Name)
+		}
+		names[sd.Name] = true
+	}
+	for _, name := range []string{"protocols.Run", "enroll.ClientInit", "enroll.ServerInit", "enroll.ServerCardSave", "HTTP POST"} {
+		if !names[name] {
+			t.Errorf("missing span %s", name)
+		}
+	}
+}
+
 // statefull httpClient implementation that submit Request multiple times.
 // this is to test that HttpSession replay protection is effective.
 type httpReplayClient struct {
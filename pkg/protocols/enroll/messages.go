@@ -1,14 +1,24 @@
 package enroll
 
 import (
+	"unicode/utf8"
+
 	"code.kerpass.org/golang/pkg/credentials"
 )
 
+// maxLabelSize is the maximum byte size of the EnrollAuthorization Label.
+const maxLabelSize = 128
+
 // EnrollReq is sent by the CardAgent client to the KerPass server.
-// It is a plaintext that starts the EnrollProtocol.
+// It is the negotiation data of the noise.InitialMessage that starts the EnrollProtocol.
+// It is sent in clear, as the server needs the RealmId to load its static key, but it is
+// authenticated as handshake prologue.
+//
+// Key 2 is reserved, it held the noise message of the unversioned EnrollReq.
 type EnrollReq struct {
-	RealmId credentials.RealmId `json:"rid" cbor:"1,keyasint"` // Determine the Static Key used by the Server
-	Msg     []byte              `json:"msg" cbor:"2,keyasint"`
+	RealmId  credentials.RealmId `json:"rid" cbor:"1,keyasint"`   // Determine the Static Key used by the Server
+	Protocol string              `json:"proto" cbor:"3,keyasint"` // Noise protocol name
+	Versions []uint16            `json:"vers" cbor:"4,keyasint"`  // Enroll protocol versions supported by the client
 }
 
 func (self *EnrollReq) Check() error {
@@ -18,17 +28,42 @@ func (self *EnrollReq) Check() error {
 	if err := self.RealmId.Check(); nil != err {
 		return wrapError(err, "failed RealmId validation")
 	}
-	msz := len(self.Msg)
-	if msz < 32 {
-		return wrapError(ErrValidation, "invalid Noise Msg size, %d < 32", msz)
+	if 0 == len(self.Versions) {
+		return wrapError(ErrUnsupportedVersion, "empty Versions")
+	}
+	if 0 == len(self.Protocol) {
+		return wrapError(ErrValidation, "empty Protocol")
+	}
+
+	return nil
+}
+
+// legacyEnrollReq is the unversioned EnrollReq, it was sent as the whole client first message.
+// It is only decoded to reject it with ErrUnsupportedVersion.
+type legacyEnrollReq struct {
+	RealmId credentials.RealmId `cbor:"1,keyasint"`
+	Msg     []byte              `cbor:"2,keyasint"`
+}
+
+func (self *legacyEnrollReq) Check() error {
+	if nil == self {
+		return wrapError(ErrValidation, "nil legacyEnrollReq")
+	}
+	if err := self.RealmId.Check(); nil != err {
+		return wrapError(err, "failed RealmId validation")
+	}
+	if len(self.Msg) < 32 {
+		return wrapError(ErrValidation, "invalid Noise Msg size, %d < 32", len(self.Msg))
 	}
 
 	return nil
 }
 
 // EnrollAuthorization is sent by the CardAgent client to the KerPass server.
+// Label is the user facing name of the new Card, it allows users to recognize their devices.
 type EnrollAuthorization struct {
 	EnrollToken credentials.EnrollToken `json:"etk" cbor:"1,keyasint"`
+	Label       string                  `json:"label,omitempty" cbor:"2,keyasint,omitempty"`
 }
 
 func (self *EnrollAuthorization) Check() error {
@@ -38,6 +73,9 @@ func (self *EnrollAuthorization) Check() error {
 	if err := self.EnrollToken.Check(); nil != err {
 		return wrapError(err, "failed EnrollToken validation")
 	}
+	if len(self.Label) > maxLabelSize || !utf8.ValidString(self.Label) {
+		return wrapError(ErrValidation, "invalid Label")
+	}
 
 	return nil
 }
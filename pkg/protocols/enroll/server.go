@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"log/slog"
 	"slices"
 
 	"code.kerpass.org/golang/internal/observability"
@@ -47,12 +48,14 @@ type ServerState struct {
 	Repo          credentials.ServerCredStore
 	IdGen         *credentials.CardIdGenerator
 	realmId       []byte
+	version       uint16
 	exitActions   srvExitAction
 	authId        credentials.EnrollToken
 	authorization credentials.EnrollAuthorization
 	cardId        credentials.IdToken
 	card          credentials.ServerCard
 	hs            noise.HandshakeState
+	obs           *observability.Observability // set by ServerInit, released by ServerExit
 	next          ServerStateFunc
 }
 
@@ -95,6 +98,19 @@ func (self *ServerState) Initiator() bool {
 
 var _ protocols.Fsm[*ServerState] = &ServerState{}
 
+// protocols.Restorer implementation
+
+func (self *ServerState) Snapshot() *ServerState {
+	rv := *self
+	return &rv
+}
+
+func (self *ServerState) Restore(snapshot *ServerState) {
+	*self = *snapshot
+}
+
+var _ protocols.Restorer[*ServerState] = &ServerState{}
+
 // State functions
 
 func ServerInit(ctx context.Context, self *ServerState, msg []byte) (sf ServerStateFunc, rmsg []byte, err error) {
@@ -102,34 +118,69 @@ func ServerInit(ctx context.Context, self *ServerState, msg []byte) (sf ServerSt
 	var errmsg string
 
 	// get logger
-	log := observability.GetObservability(ctx).Log().With("state", "ClientInit")
+	self.obs = observability.GetObservability(ctx)
+	log := self.obs.Log().With("state", "ClientInit")
 
-	// receive Client: <- [EnrollReq]
-	log.Debug("unmarshalling client EnrollReq")
+	// receive Client: <- [EnrollReq], e
+	log.Debug("unmarshalling client InitialMessage")
+	imsg := noise.InitialMessage{}
+	err = imsg.UnmarshalBinary(msg)
+	if nil != err {
+		if nil == cborSrz.Unmarshal(msg, &legacyEnrollReq{}) {
+			errmsg = "unversioned client EnrollReq"
+			err = wrapError(ErrUnsupportedVersion, errmsg)
+			log.Debug(errmsg, "error", err)
+			return sf, rmsg, err
+		}
+		errmsg = "failed unmarshalling client InitialMessage"
+		log.Debug(errmsg, "error", err)
+		return sf, rmsg, wrapError(err, errmsg)
+	}
 	req := EnrollReq{}
-	err = cborSrz.Unmarshal(msg, &req)
+	// EnrollReq is validated separately, SafeSerializer does not preserve ErrUnsupportedVersion
+	err = cborSrz.Serializer.Unmarshal(imsg.NegotiationData, &req)
+	if nil == err {
+		err = req.Check()
+	}
 	if nil != err {
 		errmsg = "failed unmarshalling client EnrollReq"
 		log.Debug(errmsg, "error", err)
 		return sf, rmsg, wrapError(err, errmsg)
 	}
 
+	// negotiate noise protocol & version
+	log.Debug("selecting noise protocol and version")
+	if req.Protocol != noiseCfg.ProtoName {
+		errmsg = "unsupported noise protocol"
+		err = wrapError(ErrValidation, errmsg+" %s", req.Protocol)
+		log.Debug(errmsg, "error", err)
+		return sf, rmsg, err
+	}
+	version, err := selectVersion(req.Versions)
+	if nil != err {
+		errmsg = "failed protocol version selection"
+		log.Debug(errmsg, "error", err)
+		return sf, rmsg, wrapError(err, errmsg)
+	}
+
 	// retrieve Realm ServerKey
 	log.Debug("loading ServerKey for EnrollReq.RealmId")
 	sk := credentials.ServerKey{}
 	found := self.KeyStore.GetServerKey(ctx, req.RealmId, SrvKeyName, &sk)
 	if !found {
 		errmsg = "failed loading ServerKey for EnrollReq.RealmId"
+		err = newError(errmsg+" %X", req.RealmId)
 		log.Debug(errmsg, "error", err)
-		return sf, rmsg, wrapError(err, errmsg+" %X", req.RealmId)
+		return sf, rmsg, err
 	}
 	self.realmId = req.RealmId
+	self.version = version
 
 	// initialize Handshake
 	log.Debug("initializing noise handshake")
 	params := noise.HandshakeParams{
 		Cfg:           noiseCfg,
-		Prologue:      req.RealmId,
+		Prologue:      imsg.Prologue(),
 		StaticKeypair: sk.Kh.PrivateKey,
 		Psks:          dummyPsks,
 		Initiator:     false,
@@ -144,17 +195,25 @@ func ServerInit(ctx context.Context, self *ServerState, msg []byte) (sf ServerSt
 	// receive Client: <- e, []
 	log.Debug("reading handshake message")
 	var buf bytes.Buffer
-	_, err = self.hs.ReadMessage(req.Msg, &buf)
+	_, err = self.hs.ReadMessage(imsg.NoiseMessage, &buf)
 	if nil != err {
+		countHandshakeFailure(ctx)
 		errmsg = "failed reading handshake message"
 		log.Debug(errmsg, "error", err)
 		return sf, rmsg, wrapError(err, errmsg)
 	}
 
-	// prepare Server: -> e, ee, s, es {Certificate}
+	// prepare Server: -> e, ee, s, es {Certificate, [Version]}
 	log.Debug("generating handshake message with static key certificate payload")
+	payload := noise.Payload{Body: sk.Certificate, Extensions: []noise.PayloadExtension{versionExtension(version)}}
+	srzpayload, err := payload.AppendBinary(nil)
+	if nil != err {
+		errmsg = "failed marshal of handshake message payload"
+		log.Debug(errmsg, "error", err)
+		return sf, rmsg, wrapError(err, errmsg)
+	}
 	buf.Reset()
-	_, err = self.hs.WriteMessage(sk.Certificate, &buf)
+	_, err = self.hs.WriteMessage(srzpayload, &buf)
 	if nil != err {
 		errmsg = "failed generating handshake message"
 		log.Debug(errmsg, "error", err)
@@ -186,6 +245,7 @@ func ServerCheckEnrollAuthorization(ctx context.Context, self *ServerState, msg
 	var buf bytes.Buffer
 	_, err = self.hs.ReadMessage(msg, &buf)
 	if nil != err {
+		countHandshakeFailure(ctx)
 		errmsg = "failed reading handshake message"
 		log.Debug(errmsg, "error", err)
 		return sf, rmsg, wrapError(err, errmsg)
@@ -265,7 +325,7 @@ func ServerCheckEnrollAuthorization(ctx context.Context, self *ServerState, msg
 		log.Debug(errmsg, "error", err)
 		return sf, rmsg, wrapError(err, errmsg)
 	}
-	sc := credentials.ServerCard{RealmId: authorization.RealmId, CardId: crf.ServerCardId[:], Psk: psk}
+	sc := credentials.ServerCard{RealmId: authorization.RealmId, CardId: crf.ServerCardId[:], Psk: psk, Label: cli.Label}
 	sc.Kh.PublicKey = self.hs.RemoteStaticKey()
 	self.cardId = crf.ClientIdToken[:]
 	self.card = sc
@@ -295,6 +355,7 @@ func ServerCardSave(ctx context.Context, self *ServerState, msg []byte) (sf Serv
 	var buf bytes.Buffer
 	_, err = self.hs.ReadMessage(msg, &buf)
 	if nil != err {
+		countHandshakeFailure(ctx)
 		errmsg = "failed reading handshake message"
 		log.Debug(errmsg, "error", err)
 		return sf, rmsg, wrapError(err, errmsg)
@@ -317,11 +378,14 @@ func ServerCardSave(ctx context.Context, self *ServerState, msg []byte) (sf Serv
 func ServerExit(self *ServerState, rs error) error {
 	defer func() {
 		self.exitActions = 0
+		self.obs = nil // release the request scoped Observability
 	}()
 
 	if nil == rs {
+		self.obs.Add(observability.MetricEnrollments, 1, slog.String("outcome", "success"))
 		return nil
 	}
+	self.obs.Add(observability.MetricEnrollments, 1, slog.String("outcome", "failure"))
 
 	var err1, err2 error
 	if srvRestoreAuthorization == (self.exitActions & srvRestoreAuthorization) {
@@ -2,10 +2,17 @@ package enroll
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha512"
+	"encoding/binary"
 	"io"
+	"log/slog"
+	"slices"
 
 	"golang.org/x/crypto/hkdf"
+
+	"code.kerpass.org/golang/internal/observability"
+	"code.kerpass.org/golang/pkg/noise"
 )
 
 const (
@@ -54,3 +61,43 @@ func derivePSK(realmId, cardId, stateHash []byte) ([]byte, error) {
 
 	return psk, nil
 }
+
+// countHandshakeFailure increments the ctx handshake failures counter.
+func countHandshakeFailure(ctx context.Context) {
+	observability.GetObservability(ctx).Add(observability.MetricHandshakeFailures, 1, slog.String("protocol", "enroll"))
+}
+
+// selectVersion returns the highest protocol version that is listed in versions and supported by this package.
+func selectVersion(versions []uint16) (uint16, error) {
+	var rv uint16
+	for _, v := range versions {
+		if v > rv && slices.Contains(supportedVersions, v) {
+			rv = v
+		}
+	}
+	if 0 == rv {
+		return 0, wrapError(ErrUnsupportedVersion, "no supported protocol version in %v", versions)
+	}
+
+	return rv, nil
+}
+
+// versionExtension returns the payload extension that transmits version.
+func versionExtension(version uint16) noise.PayloadExtension {
+	return noise.PayloadExtension{Type: extVersion, Data: binary.BigEndian.AppendUint16(nil, version)}
+}
+
+// readVersion returns the protocol version transmitted in payload extension.
+// It errors if the version is missing or not supported by this package.
+func readVersion(payload *noise.Payload) (uint16, error) {
+	data, found := payload.Extension(extVersion)
+	if !found || 2 != len(data) {
+		return 0, wrapError(ErrValidation, "missing or invalid version extension")
+	}
+	version := binary.BigEndian.Uint16(data)
+	if !slices.Contains(supportedVersions, version) {
+		return 0, wrapError(ErrUnsupportedVersion, "unsupported protocol version %d", version)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,426 @@
+package protocols
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"code.kerpass.org/golang/internal/observability"
+	"code.kerpass.org/golang/internal/session"
+	"code.kerpass.org/golang/internal/transport"
+)
+
+const (
+	// DefaultSessionLifetime is the HttpServer session lifetime used when none is configured.
+	DefaultSessionLifetime = 5 * time.Minute
+
+	// httpMaxBodySize limits the size of HttpMsg request bodies.
+	httpMaxBodySize = 1 << 17
+)
+
+var httpSrz = transport.WrapInSafeSerializer(transport.NewCBORSerializer())
+
+// HttpMsg is used to transport protocol messages in HTTP request/response bodies.
+type HttpMsg struct {
+	SessionId []byte `cbor:"1,keyasint"`
+	Msg       []byte `cbor:"2,keyasint"`
+}
+
+// Restorer is an optional interface that Fsm can implement to allow HttpServer to restore their
+// state after a failed HTTP request. When the Fsm implements Restorer, a failed request leaves the
+// HTTP session unchanged and the client may retry the request. Otherwise, a failed request terminates
+// the HTTP session.
+type Restorer[S any] interface {
+	// Snapshot returns a copy of current state.
+	Snapshot() S
+
+	// Restore changes current state to snapshot.
+	Restore(snapshot S)
+}
+
+// HttpSession allows synchronized access to a server Fsm.
+type HttpSession[S any] struct {
+	mut  sync.Mutex
+	fsm  Fsm[S]
+	done bool
+}
+
+// HttpServer is an http.Handler that executes server Fsm using the messages received in successive
+// HTTP POST requests. A new Fsm is obtained from NewFsm when a request without session identifier is
+// received, subsequent requests are routed to this Fsm using the session identifier returned in the
+// first response.
+//
+// HttpServer replies with status 200 while the protocol is ongoing and with status 201 when it has
+// completed. Fsm ExitHandler is called when the HTTP session terminates.
+type HttpServer[S any] struct {
+	NewFsm       func() (Fsm[S], error)
+	SessionStore *session.MemStore[session.Sid, *HttpSession[S]]
+}
+
+// NewHttpServer returns a new HttpServer that maintains sessions in memory.
+// Sessions expire after lifetime, DefaultSessionLifetime is used if lifetime is 0.
+func NewHttpServer[S any](newFsm func() (Fsm[S], error), lifetime time.Duration) (*HttpServer[S], error) {
+	if nil == newFsm {
+		return nil, newError("nil newFsm")
+	}
+	if 0 == lifetime {
+		lifetime = DefaultSessionLifetime
+	}
+	sidFactory, err := session.NewSidFactory(lifetime)
+	if nil != err {
+		return nil, wrapError(err, "failed initializing sidFactory")
+	}
+	sessionStore, err := session.NewMemStore[session.Sid, *HttpSession[S]](sidFactory)
+	if nil != err {
+		return nil, wrapError(err, "failed initializing sessionStore")
+	}
+
+	return &HttpServer[S]{NewFsm: newFsm, SessionStore: sessionStore}, nil
+}
+
+// ServeHTTP updates session Fsm using the message in the incoming request.
+func (self *HttpServer[S]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var errmsg string
+	log := observability.GetObservability(r.Context()).Log().With("handler", "protocols")
+
+	if http.MethodPost != r.Method {
+		writeHttpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// read incoming HttpMsg
+	srzmsg, err := io.ReadAll(http.MaxBytesReader(w, r.Body, httpMaxBodySize))
+	if nil != err {
+		errmsg = "failed reading request body"
+		log.Error(errmsg, "error", err)
+		writeHttpError(w, http.StatusBadRequest, errmsg)
+		return
+	}
+	hm := HttpMsg{}
+	err = httpSrz.Unmarshal(srzmsg, &hm)
+	if nil != err {
+		errmsg = "failed deserializing CBOR"
+		log.Error(errmsg, "error", err)
+		writeHttpError(w, http.StatusBadRequest, errmsg)
+		return
+	}
+
+	// load or create session
+	var sid session.Sid
+	var s *HttpSession[S]
+	var found bool
+	if 0 == len(hm.SessionId) {
+		log.Debug("starting new HTTP session")
+		fsm, err := self.NewFsm()
+		if nil != err {
+			errmsg = "failed creating Fsm"
+			log.Error(errmsg, "error", err)
+			writeHttpError(w, http.StatusInternalServerError, "invalid configuration")
+			return
+		}
+		s = &HttpSession[S]{fsm: fsm}
+	} else {
+		if len(hm.SessionId) == len(sid) {
+			copy(sid[:], hm.SessionId)
+			s, found = self.SessionStore.Get(sid)
+		}
+		if !found {
+			errmsg = "invalid session"
+			log.Error(errmsg, "sId", hex.EncodeToString(hm.SessionId))
+			writeHttpError(w, http.StatusBadRequest, errmsg)
+			return
+		}
+		log.Debug("reloaded HTTP session", "sId", hex.EncodeToString(hm.SessionId))
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.done {
+		// a concurrent request terminated the session
+		errmsg = "invalid session"
+		log.Error(errmsg, "sId", hex.EncodeToString(hm.SessionId))
+		writeHttpError(w, http.StatusBadRequest, errmsg)
+		return
+	}
+
+	// terminate clears the session and calls the Fsm exit handler
+	fsm := s.fsm
+	terminate := func(status error) {
+		s.done = true
+		if found {
+			log.Debug("clearing HTTP session", "sId", hex.EncodeToString(sid[:]))
+			self.SessionStore.Pop(sid)
+		}
+		exh := fsm.ExitHandler()
+		if nil != exh {
+			state, _ := fsm.State()
+			if err := exh(state, status); nil != err {
+				log.Error("failed exit handler", "error", err)
+			}
+		}
+	}
+
+	// run protocol step
+	restorer, canRestore := fsm.(Restorer[S])
+	canRestore = canRestore && found // a new session can not be retried as its sid was never forwarded
+	var snapshot S
+	if canRestore {
+		snapshot = restorer.Snapshot()
+	}
+	state, sf := fsm.State()
+	sf, rmsg, err := RunState(r.Context(), sf, state, hm.Msg)
+	if IsError(err) {
+		errmsg = "protocol error"
+		log.Error(errmsg, "error", err)
+		if canRestore {
+			restorer.Restore(snapshot)
+		} else {
+			terminate(err)
+		}
+		writeHttpError(w, http.StatusBadRequest, "bad request")
+		return
+	}
+	fsm.SetState(sf)
+	completed := nil != err
+
+	if !found {
+		log.Debug("saving new HTTP session")
+		sid, err = self.SessionStore.Save(s)
+		if nil != err {
+			errmsg = "error saving session"
+			log.Error(errmsg, "error", err)
+			terminate(err)
+			writeHttpError(w, http.StatusInternalServerError, errmsg)
+			return
+		}
+		found = true
+		hm.SessionId = sid[:]
+	}
+
+	hm.Msg = rmsg
+	srzmsg, err = httpSrz.Marshal(hm)
+	if nil == err {
+		status := http.StatusOK
+		if completed {
+			status = http.StatusCreated
+		}
+		w.Header().Add("Content-Type", "application/cbor")
+		w.WriteHeader(status)
+		_, err = w.Write(srzmsg)
+		if nil != err {
+			log.Error("failed meanwhile delivering the HTTP response", "error", err)
+		}
+	} else {
+		log.Error("failed CBOR serialization", "error", err)
+		writeHttpError(w, http.StatusInternalServerError, "failed CBOR serialization")
+	}
+
+	switch {
+	case completed:
+		terminate(err) // err is nil if the client received the response
+	case nil != err && canRestore:
+		restorer.Restore(snapshot)
+	case nil != err:
+		terminate(err)
+	}
+}
+
+// writeHttpError writes an error HTTP response to w.
+func writeHttpError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Add("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	io.WriteString(w, msg)
+}
+
+// HttpDoer is the subset of http.Client used by HttpClient.
+type HttpDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// HttpClient holds the configuration for executing client Fsm against an HttpServer.
+type HttpClient struct {
+	// Client sends the HTTP requests, http.DefaultClient is used if nil.
+	Client HttpDoer
+
+	// Url of the HttpServer, it shall use http or https scheme.
+	Url string
+
+	// MaxRetries limits the number of times a request is resent when it provably was not processed,
+	// that is when the connection to the server could not be established or when the server replied
+	// with status 500 or 503. HttpServer replies with status 500 only after restoring or terminating
+	// the session. Protocol messages are not idempotent, other failures are not retried.
+	MaxRetries int
+
+	// RetryDelay is the wait time before resending a failed request.
+	RetryDelay time.Duration
+}
+
+// Check returns an error if the HttpClient is invalid.
+func (self *HttpClient) Check() error {
+	if nil == self {
+		return newError("nil HttpClient")
+	}
+	u, err := url.Parse(self.Url)
+	if nil != err {
+		return wrapError(err, "invalid Url")
+	}
+	if !slices.Contains([]string{"http", "https"}, u.Scheme) {
+		return newError("invalid Url scheme %s", u.Scheme)
+	}
+	if self.MaxRetries < 0 || self.RetryDelay < 0 {
+		return newError("invalid retry configuration")
+	}
+
+	return nil
+}
+
+// Transport returns a transport.Transport that sends written messages to the HttpServer in POST
+// requests and reads the messages contained in the responses. The returned Transport tracks the
+// server session identifier, it shall be used for a single protocol execution.
+func (self *HttpClient) Transport(ctx context.Context) (transport.Transport, error) {
+	err := self.Check()
+	if nil != err {
+		return nil, wrapError(err, "failed HttpClient Check")
+	}
+
+	return &httpClientTransport{ctx: ctx, cfg: self}, nil
+}
+
+// RunOverHTTP executes initiator fsm against the HttpServer configured in cli until completion.
+func RunOverHTTP[S any](ctx context.Context, fsm Fsm[S], cli *HttpClient) error {
+	if !fsm.Initiator() {
+		return newError("fsm is not an initiator")
+	}
+	tr, err := cli.Transport(ctx)
+	if nil != err {
+		return wrapError(err, "failed creating HTTP Transport")
+	}
+	defer tr.Close()
+
+	return Run(ctx, fsm, tr)
+}
+
+// httpClientTransport is the Transport returned by HttpClient.Transport.
+type httpClientTransport struct {
+	ctx       context.Context
+	cfg       *HttpClient
+	sessionId []byte
+	resp      []byte
+	pending   bool
+	step      int
+}
+
+// WriteBytes sends msg to the server and keeps the response message for next ReadBytes.
+func (self *httpClientTransport) WriteBytes(msg []byte) error {
+	defer func() { self.step += 1 }()
+	if self.pending {
+		return newError("[%d] previous response was not read", self.step)
+	}
+
+	srzmsg, err := httpSrz.Marshal(HttpMsg{SessionId: self.sessionId, Msg: msg})
+	if nil != err {
+		return wrapError(err, "[%d] failed serializing HttpMsg", self.step)
+	}
+	srzmsg, err = self.post(srzmsg)
+	if nil != err {
+		return wrapError(err, "[%d] failed http POST request", self.step)
+	}
+	hm := HttpMsg{}
+	err = httpSrz.Unmarshal(srzmsg, &hm)
+	if nil != err {
+		return wrapError(err, "[%d] failed deserializing resp.Body", self.step)
+	}
+	if 0 == len(hm.SessionId) {
+		return newError("[%d] invalid server response miss sessionId", self.step)
+	}
+	self.sessionId = hm.SessionId
+	self.resp = hm.Msg
+	self.pending = true
+
+	return nil
+}
+
+// ReadBytes returns the message contained in the last server response.
+func (self *httpClientTransport) ReadBytes() ([]byte, error) {
+	if !self.pending {
+		return nil, newError("[%d] no pending server response", self.step)
+	}
+	self.pending = false
+
+	return self.resp, nil
+}
+
+// Close implements transport.Transport.
+func (self *httpClientTransport) Close() error {
+	return nil
+}
+
+// post sends body to the server and returns the response body.
+// post retries the request if it fails before reaching the server or with a retryable server error.
+func (self *httpClientTransport) post(body []byte) ([]byte, error) {
+	var cli HttpDoer = http.DefaultClient
+	if nil != self.cfg.Client {
+		cli = self.cfg.Client
+	}
+
+	var errs []error
+	for attempt := range 1 + self.cfg.MaxRetries {
+		if attempt > 0 {
+			select {
+			case <-self.ctx.Done():
+				errs = append(errs, context.Cause(self.ctx))
+				return nil, errors.Join(errs...)
+			case <-time.After(self.cfg.RetryDelay):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(self.ctx, http.MethodPost, self.cfg.Url, bytes.NewReader(body))
+		if nil != err {
+			return nil, wrapError(err, "failed instantiating http Request")
+		}
+		req.Header.Add("Content-Type", "application/cbor")
+		if sc := observability.GetObservability(self.ctx).Span().Context(); sc.IsValid() {
+			req.Header.Set(observability.TraceParentHeader, sc.TraceParent())
+		}
+		resp, err := cli.Do(req)
+		if nil != err {
+			errs = append(errs, wrapError(err, "attempt %d failed", attempt))
+			if !isDialError(err) {
+				// the server may have processed the request
+				break
+			}
+			continue
+		}
+		rbody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case http.StatusInternalServerError == resp.StatusCode || http.StatusServiceUnavailable == resp.StatusCode:
+			errs = append(errs, newError("attempt %d failed, got status %d", attempt, resp.StatusCode))
+			continue
+		case resp.StatusCode >= 300 || resp.StatusCode < 200:
+			return nil, newError("failed request, got status %d", resp.StatusCode)
+		case nil != err:
+			return nil, wrapError(err, "failed reading resp.Body")
+		}
+
+		return rbody, nil
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+var _ transport.Transport = &httpClientTransport{}
+
+// isDialError returns true if err occurred while connecting to the server, before sending the request.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && "dial" == opErr.Op
+}
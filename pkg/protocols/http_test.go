@@ -0,0 +1,305 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"code.kerpass.org/golang/internal/observability"
+)
+
+func TestHttpRunSuccess(t *testing.T) {
+	observability.SetTestDebugLogging(t)
+	srvfsms, srv := counterTestServer(t, true)
+
+	cli := newCounterFsm(true)
+	err := RunOverHTTP(counterTestCtx(t), cli, &HttpClient{Url: srv.URL})
+	if nil != err {
+		t.Fatalf("failed RunOverHTTP, got error %v", err)
+	}
+	if !cli.exited || nil != cli.exitErr {
+		t.Errorf("failed client exit control, exited %v with error %v", cli.exited, cli.exitErr)
+	}
+	srvfsm := (*srvfsms)[0]
+	if !srvfsm.exited || nil != srvfsm.exitErr {
+		t.Errorf("failed server exit control, exited %v with error %v", srvfsm.exited, srvfsm.exitErr)
+	}
+	if counterLimit != srvfsm.count {
+		t.Errorf("failed server count control, %d != %d", srvfsm.count, counterLimit)
+	}
+}
+
+func TestHttpRunReplay(t *testing.T) {
+	observability.SetTestDebugLogging(t)
+
+	for _, restorable := range []bool{true, false} {
+		srvfsms, srv := counterTestServer(t, restorable)
+		cli := newCounterFsm(true)
+		doer := &counterReplayDoer{}
+		err := RunOverHTTP(counterTestCtx(t), cli, &HttpClient{Client: doer, Url: srv.URL})
+
+		for i, status := range doer.replayStatus {
+			if status < 300 {
+				t.Errorf("restorable %v: replay #%d succeeded, got status %d", restorable, i, status)
+			}
+		}
+		srvfsm := (*srvfsms)[0]
+		if restorable {
+			// failed replays leave the session unchanged
+			if nil != err {
+				t.Fatalf("restorable: failed RunOverHTTP, got error %v", err)
+			}
+			if nil != srvfsm.exitErr {
+				t.Errorf("restorable: server exited with error %v", srvfsm.exitErr)
+			}
+		} else {
+			// a failed replay terminates the session
+			if nil == err {
+				t.Fatal("not restorable: RunOverHTTP succeeded")
+			}
+			if !srvfsm.exited || nil == srvfsm.exitErr {
+				t.Error("not restorable: server exit handler not called with error")
+			}
+		}
+	}
+}
+
+func TestHttpRunRetry(t *testing.T) {
+	observability.SetTestDebugLogging(t)
+	_, srv := counterTestServer(t, true)
+
+	cli := newCounterFsm(true)
+	doer := &counterFlakyDoer{}
+	err := RunOverHTTP(counterTestCtx(t), cli, &HttpClient{Client: doer, Url: srv.URL, MaxRetries: 1})
+	if nil != err {
+		t.Fatalf("failed RunOverHTTP, got error %v", err)
+	}
+
+	cli = newCounterFsm(true)
+	doer = &counterFlakyDoer{}
+	err = RunOverHTTP(counterTestCtx(t), cli, &HttpClient{Client: doer, Url: srv.URL})
+	if nil == err {
+		t.Fatal("RunOverHTTP succeeded without retries")
+	}
+	if !cli.exited || nil == cli.exitErr {
+		t.Error("client exit handler not called with error")
+	}
+}
+
+func TestHttpRunNoRetry(t *testing.T) {
+	testcases := []counterLossyDoer{
+		{err: errors.New("connection reset")},
+		{status: http.StatusBadGateway},
+		{status: http.StatusGatewayTimeout},
+	}
+	for i, doer := range testcases {
+		srvfsms, srv := counterTestServer(t, true)
+		cli := newCounterFsm(true)
+		err := RunOverHTTP(counterTestCtx(t), cli, &HttpClient{Client: &doer, Url: srv.URL, MaxRetries: 2})
+		if nil == err {
+			t.Fatalf("case #%d: RunOverHTTP succeeded", i)
+		}
+		// a request that may have been processed is not resent
+		if 2 != doer.count {
+			t.Errorf("case #%d: request resent, got %d requests", i, doer.count)
+		}
+		if srvfsm := (*srvfsms)[0]; 4 != srvfsm.count {
+			t.Errorf("case #%d: failed server count control, %d != 4", i, srvfsm.count)
+		}
+	}
+}
+
+func TestHttpServerInvalidSession(t *testing.T) {
+	_, srv := counterTestServer(t, true)
+
+	tr, err := (&HttpClient{Url: srv.URL}).Transport(counterTestCtx(t))
+	if nil != err {
+		t.Fatalf("failed Transport, got error %v", err)
+	}
+	ht := tr.(*httpClientTransport)
+	ht.sessionId = make([]byte, 32)
+	err = tr.WriteBytes([]byte{1})
+	if nil == err {
+		t.Fatal("WriteBytes succeeded with unknown sessionId")
+	}
+
+	err = (&HttpClient{Url: "ftp://example.com"}).Check()
+	if nil == err {
+		t.Fatal("Check succeeded with ftp Url")
+	}
+}
+
+// counter protocol, peers exchange an incrementing counter until it reaches counterLimit.
+
+const counterLimit = 6
+
+type counterFsm struct {
+	count     byte
+	initiator bool
+	next      StateFunc[*counterFsm]
+	exited    bool
+	exitErr   error
+}
+
+func newCounterFsm(initiator bool) *counterFsm {
+	return &counterFsm{initiator: initiator, next: counterStep}
+}
+
+func (self *counterFsm) State() (*counterFsm, StateFunc[*counterFsm]) {
+	return self, self.next
+}
+
+func (self *counterFsm) SetState(sf StateFunc[*counterFsm]) {
+	self.next = sf
+}
+
+func (self *counterFsm) ExitHandler() ExitFunc[*counterFsm] {
+	return func(s *counterFsm, err error) error {
+		s.exited = true
+		s.exitErr = err
+		return nil
+	}
+}
+
+func (self *counterFsm) SetExitHandler(_ ExitFunc[*counterFsm]) {
+}
+
+func (self *counterFsm) Initiator() bool {
+	return self.initiator
+}
+
+var _ Fsm[*counterFsm] = &counterFsm{}
+
+// restorableCounterFsm adds Restorer implementation to counterFsm.
+type restorableCounterFsm struct {
+	*counterFsm
+}
+
+func (self restorableCounterFsm) Snapshot() *counterFsm {
+	rv := *self.counterFsm
+	return &rv
+}
+
+func (self restorableCounterFsm) Restore(snapshot *counterFsm) {
+	*self.counterFsm = *snapshot
+}
+
+var _ Restorer[*counterFsm] = restorableCounterFsm{}
+
+func counterStep(_ context.Context, self *counterFsm, msg []byte) (StateFunc[*counterFsm], []byte, error) {
+	if self.initiator && 0 == self.count && nil == msg {
+		self.count = 1
+		return counterStep, []byte{self.count}, nil
+	}
+	if 1 != len(msg) || msg[0] != self.count+1 {
+		return counterStep, nil, newError("unexpected counter message")
+	}
+	if msg[0] >= counterLimit {
+		self.count = msg[0]
+		return nil, nil, OK
+	}
+	self.count = msg[0] + 1
+	var err error
+	if self.count >= counterLimit {
+		err = OK
+	}
+
+	return counterStep, []byte{self.count}, err
+}
+
+func counterTestServer(t *testing.T, restorable bool) (*[]*counterFsm, *httptest.Server) {
+	fsms := &[]*counterFsm{}
+	newFsm := func() (Fsm[*counterFsm], error) {
+		fsm := newCounterFsm(false)
+		*fsms = append(*fsms, fsm)
+		if restorable {
+			return restorableCounterFsm{fsm}, nil
+		}
+		return fsm, nil
+	}
+	hdlr, err := NewHttpServer(newFsm, 0)
+	if nil != err {
+		t.Fatalf("failed NewHttpServer, got error %v", err)
+	}
+	srv := httptest.NewServer(observability.Middleware{}.Wrap(hdlr))
+	t.Cleanup(srv.Close)
+
+	return fsms, srv
+}
+
+func counterTestCtx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+// counterReplayDoer replays every request following the first one.
+type counterReplayDoer struct {
+	count        int
+	replayStatus []int
+}
+
+func (self *counterReplayDoer) Do(req *http.Request) (*http.Response, error) {
+	defer func() { self.count += 1 }()
+	resp, err := http.DefaultClient.Do(req)
+	if nil != err || 0 == self.count {
+		return resp, err
+	}
+	replay := req.Clone(req.Context())
+	replay.Body, err = req.GetBody()
+	if nil != err {
+		return nil, err
+	}
+	rresp, err := http.DefaultClient.Do(replay)
+	if nil != err {
+		return nil, err
+	}
+	rresp.Body.Close()
+	self.replayStatus = append(self.replayStatus, rresp.StatusCode)
+
+	return resp, nil
+}
+
+// counterFlakyDoer fails every other request with a dial error, without forwarding it.
+type counterFlakyDoer struct {
+	count int
+}
+
+func (self *counterFlakyDoer) Do(req *http.Request) (*http.Response, error) {
+	defer func() { self.count += 1 }()
+	if 1 == self.count%2 {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+// counterLossyDoer forwards requests and replaces the second response with err or with a response
+// with status.
+type counterLossyDoer struct {
+	count  int
+	err    error
+	status int
+}
+
+func (self *counterLossyDoer) Do(req *http.Request) (*http.Response, error) {
+	defer func() { self.count += 1 }()
+	resp, err := http.DefaultClient.Do(req)
+	if nil != err || 1 != self.count {
+		return resp, err
+	}
+	resp.Body.Close()
+	if nil != self.err {
+		return nil, self.err
+	}
+	resp = &http.Response{StatusCode: self.status, Body: io.NopCloser(strings.NewReader("lost"))}
+
+	return resp, nil
+}
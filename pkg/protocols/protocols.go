@@ -3,7 +3,12 @@ package protocols
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"strings"
 
+	"code.kerpass.org/golang/internal/observability"
 	"code.kerpass.org/golang/internal/transport"
 )
 
@@ -25,10 +30,13 @@ type Fsm[S any] interface {
 }
 
 // Run reads & writes messages from/to Transport and executes protocol until completion.
+// Run traces the protocol execution in a Span that has a child Span for each executed state.
 func Run[S any](ctx context.Context, fsm Fsm[S], tr transport.Transport) error {
 	var err error
+	ctx, span := observability.StartSpan(ctx, "protocols.Run", slog.Bool("initiator", fsm.Initiator()))
 	s, sf := fsm.State()
 	defer func() {
+		span.End(err)
 		fsm.SetState(sf)
 		exh := fsm.ExitHandler()
 		if nil != exh {
@@ -48,7 +56,7 @@ func Run[S any](ctx context.Context, fsm Fsm[S], tr transport.Transport) error {
 	}
 
 	for {
-		sf, msg, errProto = sf(ctx, s, msg)
+		sf, msg, errProto = RunState(ctx, sf, s, msg)
 		if nil != msg {
 			errIO = tr.WriteBytes(msg)
 			if nil != errIO {
@@ -74,3 +82,30 @@ func Run[S any](ctx context.Context, fsm Fsm[S], tr transport.Transport) error {
 		}
 	}
 }
+
+// RunState executes sf in a Span named after sf.
+func RunState[S any](ctx context.Context, sf StateFunc[S], s S, msg []byte) (StateFunc[S], []byte, error) {
+	ctx, span := observability.StartSpan(ctx, StateName(sf))
+	nsf, rmsg, err := sf(ctx, s, msg)
+	if IsError(err) {
+		span.End(err)
+	} else {
+		span.End(nil)
+	}
+
+	return nsf, rmsg, err
+}
+
+// StateName returns sf function name qualified by its package name, eg "enroll.ServerInit".
+func StateName[S any](sf StateFunc[S]) string {
+	if nil == sf {
+		return "nil"
+	}
+	fn := runtime.FuncForPC(reflect.ValueOf(sf).Pointer())
+	if nil == fn {
+		return "unknown"
+	}
+	name := fn.Name()
+
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
@@ -0,0 +1,213 @@
+package radius
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"code.kerpass.org/golang/internal/observability"
+	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/ephemsec"
+)
+
+const (
+	maxCardFailures    = 10
+	cardFailuresWindow = 15 * time.Minute
+)
+
+// cardFailures counts the invalid OTP submitted for a Card since start.
+type cardFailures struct {
+	count  int
+	expiry time.Time
+}
+
+// OtpAuthenticator is an Authenticator that validates EPHEMSEC OTP typed by users.
+//
+// User names are mapped to credentials.OtpId lookups in the RealmId Realm. PAP can not carry
+// an authentication session, hence the EPHEMSEC challenge is static: it is made of EphemKey and
+// Nonce that Card applications obtain out of band, eg when the Card is enrolled.
+// Replay of a validated OTP is prevented by recording the last validated pseudo time of each Card,
+// an OtpAuthenticator shall not be shared by several RADIUS Server. Retransmitted Access-Request
+// are answered by Server.Serve from its response cache and do not reach the OtpAuthenticator.
+// A Card is locked for 15 minutes after 10 invalid OTP, this limits online guessing of short OTP.
+type OtpAuthenticator struct {
+	RealmId [32]byte
+
+	// EPHEMSEC scheme, it shall generate OTP using E1S1 or E1S2 key exchange
+	Scheme uint16
+
+	// EPHEMSEC Context
+	Context []byte
+
+	// static challenge
+	EphemKey credentials.PrivateKeyHandle
+	Nonce    []byte
+
+	// Kst provides the Realm static key of E1S2 scheme
+	Kst credentials.KeyStore
+
+	Scs credentials.ServerCredStore
+
+	// Uses is optional, it records the Card usage of successful authentications
+	Uses *credentials.CardUseRecorder
+
+	mut      sync.Mutex
+	ptime    map[string]int64
+	failures map[string]*cardFailures // indexed by CardId
+}
+
+// Check returns an error if the OtpAuthenticator is invalid.
+func (self *OtpAuthenticator) Check() error {
+	if nil == self {
+		return wrapError(ErrValidation, "nil OtpAuthenticator")
+	}
+	sch, err := ephemsec.GetScheme(self.Scheme)
+	if nil != err {
+		return wrapError(err, "failed loading Scheme")
+	}
+	if 256 == sch.B() {
+		return wrapError(ErrValidation, "unsupported OTK Scheme")
+	}
+	switch sch.KeyExchangePattern() {
+	case "E1S1":
+	case "E1S2":
+		var sk credentials.ServerKey
+		if nil == self.Kst || !self.Kst.GetServerKey(context.Background(), self.RealmId[:], sch.Name(), &sk) {
+			return wrapError(ErrValidation, "failed loading Scheme static key")
+		}
+	default:
+		return wrapError(ErrValidation, "unsupported %s key exchange", sch.KeyExchangePattern())
+	}
+	if nil == self.EphemKey.PrivateKey || self.EphemKey.PrivateKey.Curve() != sch.Curve().Curve {
+		return wrapError(ErrValidation, "invalid EphemKey")
+	}
+	if 0 == len(self.Nonce) {
+		return wrapError(ErrValidation, "empty Nonce")
+	}
+	if nil == self.Scs {
+		return wrapError(ErrValidation, "nil credentials ServerCredStore")
+	}
+
+	return nil
+}
+
+// Authenticate returns nil if password is a valid OTP for the user Card.
+// It errors if the Card can not be loaded, or if password is invalid or was already used.
+func (self *OtpAuthenticator) Authenticate(ctx context.Context, user string, password string) error {
+	obs := observability.GetObservability(ctx)
+	err := self.authenticate(ctx, user, password)
+	outcome := "valid"
+	switch {
+	case errors.Is(err, ErrLocked):
+		outcome = "locked"
+	case nil != err:
+		outcome = "invalid"
+	}
+	obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", outcome))
+
+	return err
+}
+
+func (self *OtpAuthenticator) authenticate(ctx context.Context, user string, password string) error {
+	sch, err := ephemsec.GetScheme(self.Scheme)
+	if nil != err {
+		return wrapError(err, "failed loading Scheme")
+	}
+
+	// load the Card
+	var card credentials.ServerCard
+	err = self.Scs.LoadCard(ctx, credentials.OtpId{Realm: self.RealmId[:], Username: user}, &card)
+	if nil != err {
+		return wrapError(err, "failed loading card")
+	}
+	if !slices.Equal(card.RealmId, self.RealmId[:]) {
+		return wrapError(ErrValidation, "invalid card Realm")
+	}
+	err = card.CheckActive()
+	if nil != err {
+		return wrapError(err, "invalid card")
+	}
+
+	cid := string(card.CardId)
+	self.mut.Lock()
+	locked := self.cardLocked(cid, time.Now())
+	self.mut.Unlock()
+	if locked {
+		return wrapError(ErrLocked, "too many invalid OTP")
+	}
+
+	// load server static key if scheme requires 1
+	var sk credentials.ServerKey
+	if "E1S2" == sch.KeyExchangePattern() {
+		found := self.Kst.GetServerKey(ctx, self.RealmId[:], sch.Name(), &sk)
+		if !found {
+			return newError("failed loading scheme static key")
+		}
+	}
+
+	// verify the OTP
+	vrf := ephemsec.Verifier{Scheme: sch, Separator: '-'}
+	res, err := vrf.Verify(&ephemsec.VerifierParams{
+		Context:         self.Context,
+		Nonce:           self.Nonce,
+		EphemKey:        self.EphemKey.PrivateKey,
+		StaticKey:       sk.Kh.PrivateKey,
+		RemoteStaticKey: card.Kh.PublicKey,
+		Psk:             card.Psk,
+	}, password)
+	if nil != err {
+		return wrapError(err, "failed OTP verification")
+	}
+	self.mut.Lock()
+	defer self.mut.Unlock()
+	if !res.Match {
+		self.cardFailed(cid, time.Now())
+		return wrapError(ErrRejected, "invalid OTP")
+	}
+
+	// reject replayed OTP
+	if nil == self.ptime {
+		self.ptime = make(map[string]int64)
+	}
+	if last, found := self.ptime[cid]; found && res.PTime <= last {
+		return wrapError(ErrRejected, "replayed OTP")
+	}
+	self.ptime[cid] = res.PTime
+	delete(self.failures, cid)
+	if nil != self.Uses {
+		err = self.Uses.Record(card.CardId, time.Now())
+		if nil != err {
+			log := observability.GetObservability(ctx).Log()
+			log.Info("failed recording card use", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// cardLocked returns true if the cid Card reached maxCardFailures. It shall be called with mut locked.
+func (self *OtpAuthenticator) cardLocked(cid string, now time.Time) bool {
+	f, found := self.failures[cid]
+	return found && !now.After(f.expiry) && f.count >= maxCardFailures
+}
+
+// cardFailed counts an invalid OTP of the cid Card and removes expired failures.
+// It shall be called with mut locked.
+func (self *OtpAuthenticator) cardFailed(cid string, now time.Time) {
+	if nil == self.failures {
+		self.failures = make(map[string]*cardFailures)
+	}
+	maps.DeleteFunc(self.failures, func(_ string, f *cardFailures) bool { return now.After(f.expiry) })
+	f, found := self.failures[cid]
+	if !found {
+		f = &cardFailures{expiry: now.Add(cardFailuresWindow)}
+		self.failures[cid] = f
+	}
+	f.count += 1
+}
+
+var _ Authenticator = &OtpAuthenticator{}
@@ -0,0 +1,295 @@
+// Package radius implements a minimal RADIUS (RFC 2865) server that validates KerPass OTP.
+//
+// It supports PAP Access-Request, allowing RADIUS clients such as VPN concentrators to
+// delegate user authentication to KerPass.
+package radius
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"slices"
+)
+
+const (
+	// RADIUS packet codes
+	CodeAccessRequest = byte(1)
+	CodeAccessAccept  = byte(2)
+	CodeAccessReject  = byte(3)
+
+	// RADIUS attribute types
+	AttrUserName             = byte(1)
+	AttrUserPassword         = byte(2)
+	AttrReplyMessage         = byte(18)
+	AttrMessageAuthenticator = byte(80)
+
+	headerSize        = 20
+	authenticatorSize = 16
+	maxPacketSize     = 4096
+	maxAttributeSize  = 253
+	maxPasswordSize   = 128
+)
+
+// Attribute is a RADIUS attribute.
+type Attribute struct {
+	Type  byte
+	Value []byte
+}
+
+// Packet is a RADIUS packet.
+type Packet struct {
+	Code          byte
+	Identifier    byte
+	Authenticator [authenticatorSize]byte
+	Attributes    []Attribute
+}
+
+// NewAccessRequest returns a signed PAP Access-Request, as sent by a RADIUS client.
+// It errors if the password can not be hidden.
+func NewAccessRequest(secret []byte, identifier byte, user string, password string) (*Packet, error) {
+	rv := &Packet{Code: CodeAccessRequest, Identifier: identifier}
+	rand.Read(rv.Authenticator[:])
+	rv.Attributes = append(rv.Attributes, Attribute{Type: AttrUserName, Value: []byte(user)})
+	err := rv.SetPassword(secret, password)
+	if nil != err {
+		return nil, wrapError(err, "failed SetPassword")
+	}
+	err = rv.Sign(secret, nil)
+	if nil != err {
+		return nil, wrapError(err, "failed Sign")
+	}
+
+	return rv, nil
+}
+
+// Attribute returns the Value of the first attribute with type typ.
+func (self *Packet) Attribute(typ byte) ([]byte, bool) {
+	idx := self.indexAttribute(typ)
+	if idx < 0 {
+		return nil, false
+	}
+	return self.Attributes[idx].Value, true
+}
+
+// AppendBinary appends the Packet wire encoding to dst.
+// It errors if an attribute or the Packet is too large.
+func (self *Packet) AppendBinary(dst []byte) ([]byte, error) {
+	size := headerSize
+	for _, attr := range self.Attributes {
+		if len(attr.Value) > maxAttributeSize {
+			return nil, wrapError(ErrInvalidPacket, "attribute %d Value size exceeds %d", attr.Type, maxAttributeSize)
+		}
+		size += 2 + len(attr.Value)
+	}
+	if size > maxPacketSize {
+		return nil, wrapError(ErrInvalidPacket, "Packet size exceeds %d", maxPacketSize)
+	}
+	dst = append(dst, self.Code, self.Identifier)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(size))
+	dst = append(dst, self.Authenticator[:]...)
+	for _, attr := range self.Attributes {
+		dst = append(dst, attr.Type, byte(2+len(attr.Value)))
+		dst = append(dst, attr.Value...)
+	}
+
+	return dst, nil
+}
+
+// UnmarshalBinary loads the Packet from its wire encoding.
+// The Packet attributes reference data memory.
+func (self *Packet) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize {
+		return wrapError(ErrInvalidPacket, "Packet size %d < %d", len(data), headerSize)
+	}
+	size := int(binary.BigEndian.Uint16(data[2:]))
+	if size < headerSize || size > maxPacketSize || size > len(data) {
+		return wrapError(ErrInvalidPacket, "invalid Packet length %d", size)
+	}
+	// octets beyond size are padding that shall be ignored
+	rest := data[headerSize:size]
+	var attrs []Attribute
+	for len(rest) > 0 {
+		if len(rest) < 2 {
+			return wrapError(ErrInvalidPacket, "truncated attribute")
+		}
+		asz := int(rest[1])
+		if asz < 2 || asz > len(rest) {
+			return wrapError(ErrInvalidPacket, "invalid attribute %d length %d", rest[0], asz)
+		}
+		attrs = append(attrs, Attribute{Type: rest[0], Value: rest[2:asz]})
+		rest = rest[asz:]
+	}
+	self.Code = data[0]
+	self.Identifier = data[1]
+	copy(self.Authenticator[:], data[4:headerSize])
+	self.Attributes = attrs
+
+	return nil
+}
+
+// SetPassword sets the Packet User-Password attribute, hiding password as detailed in RFC 2865 §5.2.
+// It errors if password is too large.
+func (self *Packet) SetPassword(secret []byte, password string) error {
+	if len(password) > maxPasswordSize {
+		return wrapError(ErrValidation, "password size exceeds %d", maxPasswordSize)
+	}
+	size := max(16, (len(password)+15)/16*16)
+	value := make([]byte, size)
+	copy(value, password)
+	self.hidePassword(secret, value, true)
+	self.setAttribute(AttrUserPassword, value)
+
+	return nil
+}
+
+// Password returns the Packet User-Password attribute, revealing it as detailed in RFC 2865 §5.2.
+// It errors if the attribute is missing or invalid.
+func (self *Packet) Password(secret []byte) (string, error) {
+	value, found := self.Attribute(AttrUserPassword)
+	if !found {
+		return "", wrapError(ErrInvalidPacket, "missing User-Password")
+	}
+	if 0 == len(value) || 0 != len(value)%16 || len(value) > maxPasswordSize {
+		return "", wrapError(ErrInvalidPacket, "invalid User-Password length %d", len(value))
+	}
+	value = slices.Clone(value)
+	self.hidePassword(secret, value, false)
+	end := len(value)
+	for end > 0 && 0 == value[end-1] {
+		end -= 1
+	}
+
+	return string(value[:end]), nil
+}
+
+// Sign adds a Message-Authenticator attribute to the Packet.
+// If req is not nil, the Packet is a response to req and Sign also sets its Response Authenticator.
+func (self *Packet) Sign(secret []byte, req *Packet) error {
+	auth := self.Authenticator
+	if nil != req {
+		auth = req.Authenticator
+	}
+	self.setAttribute(AttrMessageAuthenticator, make([]byte, md5.Size))
+	mac, err := self.messageAuthenticator(secret, auth)
+	if nil != err {
+		return wrapError(err, "failed computing Message-Authenticator")
+	}
+	self.setAttribute(AttrMessageAuthenticator, mac)
+	if nil != req {
+		self.Authenticator, err = self.responseAuthenticator(secret, auth)
+		if nil != err {
+			return wrapError(err, "failed computing Response Authenticator")
+		}
+	}
+
+	return nil
+}
+
+// Verify checks the Packet Message-Authenticator attribute if present.
+// If req is not nil, the Packet is a response to req and Verify also checks its Response Authenticator.
+// It returns true if the Packet has a Message-Authenticator, and errors if a check fails.
+func (self *Packet) Verify(secret []byte, req *Packet) (bool, error) {
+	auth := self.Authenticator
+	if nil != req {
+		if self.Identifier != req.Identifier {
+			return false, wrapError(ErrInvalidPacket, "Identifier mismatch")
+		}
+		expected, err := self.responseAuthenticator(secret, req.Authenticator)
+		if nil != err {
+			return false, wrapError(err, "failed computing Response Authenticator")
+		}
+		if !hmac.Equal(expected[:], self.Authenticator[:]) {
+			return false, wrapError(ErrInvalidPacket, "invalid Response Authenticator")
+		}
+		auth = req.Authenticator
+	}
+
+	idx := self.indexAttribute(AttrMessageAuthenticator)
+	if idx < 0 {
+		return false, nil
+	}
+	received := self.Attributes[idx].Value
+	if md5.Size != len(received) {
+		return true, wrapError(ErrInvalidPacket, "invalid Message-Authenticator length")
+	}
+	pkt := *self
+	pkt.Attributes = slices.Clone(self.Attributes)
+	pkt.Attributes[idx].Value = make([]byte, md5.Size)
+	expected, err := pkt.messageAuthenticator(secret, auth)
+	if nil != err {
+		return true, wrapError(err, "failed computing Message-Authenticator")
+	}
+	if !hmac.Equal(expected, received) {
+		return true, wrapError(ErrInvalidPacket, "invalid Message-Authenticator")
+	}
+
+	return true, nil
+}
+
+// hidePassword hides or reveals value in place, value length shall be a multiple of 16.
+func (self *Packet) hidePassword(secret []byte, value []byte, hide bool) {
+	prev := self.Authenticator[:]
+	var b [md5.Size]byte
+	for pos := 0; pos < len(value); pos += 16 {
+		h := md5.New()
+		h.Write(secret)
+		h.Write(prev)
+		h.Sum(b[:0])
+		chunk := value[pos : pos+16]
+		if !hide {
+			prev = slices.Clone(chunk)
+		}
+		for i := range chunk {
+			chunk[i] ^= b[i]
+		}
+		if hide {
+			prev = chunk
+		}
+	}
+}
+
+// messageAuthenticator returns the HMAC-MD5 of the Packet encoded with auth as Authenticator.
+func (self *Packet) messageAuthenticator(secret []byte, auth [authenticatorSize]byte) ([]byte, error) {
+	pkt := *self
+	pkt.Authenticator = auth
+	srz, err := pkt.AppendBinary(nil)
+	if nil != err {
+		return nil, err
+	}
+	mac := hmac.New(md5.New, secret)
+	mac.Write(srz)
+
+	return mac.Sum(nil), nil
+}
+
+// responseAuthenticator returns the Response Authenticator of a response to a request with reqAuth Authenticator.
+func (self *Packet) responseAuthenticator(secret []byte, reqAuth [authenticatorSize]byte) ([authenticatorSize]byte, error) {
+	var rv [authenticatorSize]byte
+	pkt := *self
+	pkt.Authenticator = reqAuth
+	srz, err := pkt.AppendBinary(nil)
+	if nil != err {
+		return rv, err
+	}
+	h := md5.New()
+	h.Write(srz)
+	h.Write(secret)
+	h.Sum(rv[:0])
+
+	return rv, nil
+}
+
+// setAttribute replaces the Value of the first attribute with type typ, or appends a new attribute.
+func (self *Packet) setAttribute(typ byte, value []byte) {
+	idx := self.indexAttribute(typ)
+	if idx < 0 {
+		self.Attributes = append(self.Attributes, Attribute{Type: typ, Value: value})
+	} else {
+		self.Attributes[idx].Value = value
+	}
+}
+
+func (self *Packet) indexAttribute(typ byte) int {
+	return slices.IndexFunc(self.Attributes, func(attr Attribute) bool { return typ == attr.Type })
+}
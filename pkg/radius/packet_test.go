@@ -0,0 +1,131 @@
+package radius
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// RFC 2865 §7.1 example
+const (
+	rfcSecret   = "xyzzy5461"
+	rfcRequest  = "010000380f403f9473978057bd83d5cb98f4227a01066e656d6f02120dbe708d93d413ce3196e43f782a0aee0406c0a80110050600000003"
+	rfcResponse = "0200002686fe220e7624ba2a1005f6bf9b55e0b20606000000010f06000000000e06c0a80103"
+)
+
+func TestPacketRfcExample(t *testing.T) {
+	var req Packet
+	err := req.UnmarshalBinary(mustDecodeHex(t, rfcRequest))
+	if nil != err {
+		t.Fatalf("failed request UnmarshalBinary, got error %v", err)
+	}
+	user, _ := req.Attribute(AttrUserName)
+	if "nemo" != string(user) {
+		t.Fatalf("failed User-Name control, got %q", user)
+	}
+	password, err := req.Password([]byte(rfcSecret))
+	if nil != err {
+		t.Fatalf("failed Password, got error %v", err)
+	}
+	if "arctangent" != password {
+		t.Fatalf("failed Password control, got %q", password)
+	}
+
+	var resp Packet
+	err = resp.UnmarshalBinary(mustDecodeHex(t, rfcResponse))
+	if nil != err {
+		t.Fatalf("failed response UnmarshalBinary, got error %v", err)
+	}
+	signed, err := resp.Verify([]byte(rfcSecret), &req)
+	if nil != err {
+		t.Fatalf("failed response Verify, got error %v", err)
+	}
+	if signed {
+		t.Fatal("failed Verify, response has no Message-Authenticator")
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	secret := []byte("secret")
+	for _, password := range []string{"", "123456", "0123456789ABCDEF", "0123456789ABCDEFG"} {
+		req, err := NewAccessRequest(secret, 7, "alice", password)
+		if nil != err {
+			t.Fatalf("failed NewAccessRequest, got error %v", err)
+		}
+		srz, err := req.AppendBinary(nil)
+		if nil != err {
+			t.Fatalf("failed AppendBinary, got error %v", err)
+		}
+		var rcvd Packet
+		err = rcvd.UnmarshalBinary(srz)
+		if nil != err {
+			t.Fatalf("failed UnmarshalBinary, got error %v", err)
+		}
+		if !reflect.DeepEqual(*req, rcvd) {
+			t.Fatalf("failed Packet control, got %+v", rcvd)
+		}
+		signed, err := rcvd.Verify(secret, nil)
+		if nil != err || !signed {
+			t.Fatalf("failed request Verify, got error %v", err)
+		}
+		_, err = rcvd.Verify([]byte("invalid"), nil)
+		if !errors.Is(err, ErrInvalidPacket) {
+			t.Fatalf("failed Verify error control, got error %v", err)
+		}
+		rpassword, err := rcvd.Password(secret)
+		if nil != err {
+			t.Fatalf("failed Password, got error %v", err)
+		}
+		if password != rpassword {
+			t.Fatalf("failed Password control, got %q", rpassword)
+		}
+
+		resp := Packet{Code: CodeAccessAccept, Identifier: rcvd.Identifier}
+		err = resp.Sign(secret, &rcvd)
+		if nil != err {
+			t.Fatalf("failed response Sign, got error %v", err)
+		}
+		signed, err = resp.Verify(secret, req)
+		if nil != err || !signed {
+			t.Fatalf("failed response Verify, got error %v", err)
+		}
+		resp.Code = CodeAccessReject
+		_, err = resp.Verify(secret, req)
+		if !errors.Is(err, ErrInvalidPacket) {
+			t.Fatalf("failed tampered response Verify error control, got error %v", err)
+		}
+	}
+}
+
+func TestPacketInvalid(t *testing.T) {
+	testcases := [][]byte{
+		nil,
+		bytes.Repeat([]byte{0}, headerSize-1),
+		append([]byte{1, 0, 0, 21}, make([]byte, 16)...),
+		append([]byte{1, 0, 0, 21}, make([]byte, 17)...),
+		append([]byte{1, 0, 0, 22}, append(make([]byte, 16), 1, 1)...),
+		append([]byte{1, 0, 0, 22}, append(make([]byte, 16), 1, 3)...),
+	}
+	for pos, tc := range testcases {
+		var pkt Packet
+		err := pkt.UnmarshalBinary(tc)
+		if nil == err {
+			t.Errorf("case#%d: UnmarshalBinary succeeded", pos)
+		}
+	}
+
+	_, err := NewAccessRequest([]byte("secret"), 0, "alice", string(make([]byte, maxPasswordSize+1)))
+	if nil == err {
+		t.Error("NewAccessRequest succeeded with too large password")
+	}
+}
+
+func mustDecodeHex(t *testing.T, src string) []byte {
+	rv, err := hex.DecodeString(src)
+	if nil != err {
+		t.Fatalf("failed hex decoding, got error %v", err)
+	}
+	return rv
+}
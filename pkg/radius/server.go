@@ -0,0 +1,242 @@
+package radius
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"code.kerpass.org/golang/internal/observability"
+)
+
+const (
+	// DefaultDuplicateWindow is the Server DuplicateWindow used when it is 0.
+	DefaultDuplicateWindow = 5 * time.Second
+
+	// DefaultMaxInflight is the Server MaxInflight used when it is 0.
+	DefaultMaxInflight = 64
+)
+
+// Authenticator validates PAP credentials.
+type Authenticator interface {
+	// Authenticate returns nil if password is valid for user.
+	// It errors if the credentials are rejected or could not be validated.
+	Authenticate(ctx context.Context, user string, password string) error
+}
+
+// Server answers RADIUS PAP Access-Request using an Authenticator.
+type Server struct {
+	// Secret shared with the RADIUS clients
+	Secret []byte
+
+	// Auth validates the Access-Request credentials
+	Auth Authenticator
+
+	// RequireMessageAuthenticator makes the Server drop Access-Request without Message-Authenticator
+	RequireMessageAuthenticator bool
+
+	// DuplicateWindow is the time Serve keeps a response to answer retransmissions of its request.
+	// If 0, DefaultDuplicateWindow is used.
+	DuplicateWindow time.Duration
+
+	// MaxInflight is the maximum number of Access-Request that Serve handles concurrently.
+	// If 0, DefaultMaxInflight is used.
+	MaxInflight int
+}
+
+// NewServer returns a Server that requires signed Access-Request.
+// It errors if the Server is invalid.
+func NewServer(secret []byte, auth Authenticator) (*Server, error) {
+	rv := &Server{Secret: secret, Auth: auth, RequireMessageAuthenticator: true}
+
+	return rv, wrapError(rv.Check(), "failed Server Check")
+}
+
+// Check returns an error if the Server is invalid.
+func (self *Server) Check() error {
+	if nil == self {
+		return wrapError(ErrValidation, "nil Server")
+	}
+	if 0 == len(self.Secret) {
+		return wrapError(ErrValidation, "empty Secret")
+	}
+	if nil == self.Auth {
+		return wrapError(ErrValidation, "nil Authenticator")
+	}
+	if self.DuplicateWindow < 0 || self.MaxInflight < 0 {
+		return wrapError(ErrValidation, "negative DuplicateWindow or MaxInflight")
+	}
+
+	return nil
+}
+
+// Serve answers the Access-Request received on conn until ctx is done.
+// It closes conn when it returns, and errors if conn fails before ctx is done.
+//
+// Retransmitted Access-Request are detected as recommended by RFC 5080 section 2.2.2,
+// they are answered with the cached response of the original request or dropped if it is
+// still being handled.
+func (self *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	defer conn.Close()
+	log := observability.GetObservability(ctx).Log().With("handler", "radius")
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	window := self.DuplicateWindow
+	if 0 == window {
+		window = DefaultDuplicateWindow
+	}
+	replies := newReplyCache(window)
+	maxInflight := self.MaxInflight
+	if 0 == maxInflight {
+		maxInflight = DefaultMaxInflight
+	}
+	inflight := make(chan struct{}, maxInflight)
+
+	for {
+		buf := make([]byte, maxPacketSize)
+		n, addr, err := conn.ReadFrom(buf)
+		if nil != err {
+			if nil != ctx.Err() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return wrapError(err, "failed reading packet")
+		}
+		select {
+		case inflight <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		go func() {
+			defer func() { <-inflight }()
+			resp, err := self.reply(ctx, replies, buf[:n], addr)
+			if nil != err {
+				log.Debug("dropped packet", "remote", addr.String(), "error", err)
+				return
+			}
+			conn.WriteTo(resp, addr)
+		}()
+	}
+}
+
+// reply returns the response to data received from addr, using replies to answer retransmissions.
+// It errors if data shall be dropped.
+func (self *Server) reply(ctx context.Context, replies *replyCache, data []byte, addr net.Addr) ([]byte, error) {
+	if len(data) < headerSize {
+		return self.Handle(ctx, data)
+	}
+	key := requestKey{addr: addr.String(), identifier: data[1]}
+	copy(key.authenticator[:], data[4:headerSize])
+	cached, handle := replies.lookup(key, time.Now())
+	if !handle {
+		if nil == cached {
+			return nil, wrapError(ErrInvalidPacket, "duplicate of a pending or dropped request")
+		}
+		return cached, nil
+	}
+
+	resp, err := self.Handle(ctx, data)
+	replies.complete(key, resp, time.Now())
+
+	return resp, err
+}
+
+// Handle returns the wire encoded response to the Access-Request data.
+// It errors if data is not a valid Access-Request, such request shall be silently dropped.
+func (self *Server) Handle(ctx context.Context, data []byte) ([]byte, error) {
+	var req Packet
+	err := req.UnmarshalBinary(data)
+	if nil != err {
+		return nil, wrapError(err, "failed Packet decoding")
+	}
+	if CodeAccessRequest != req.Code {
+		return nil, wrapError(ErrInvalidPacket, "unsupported Packet code %d", req.Code)
+	}
+	signed, err := req.Verify(self.Secret, nil)
+	if nil != err {
+		return nil, wrapError(err, "failed Access-Request verification")
+	}
+	if !signed && self.RequireMessageAuthenticator {
+		return nil, wrapError(ErrInvalidPacket, "missing Message-Authenticator")
+	}
+	user, found := req.Attribute(AttrUserName)
+	if !found {
+		return nil, wrapError(ErrInvalidPacket, "missing User-Name")
+	}
+	password, err := req.Password(self.Secret)
+	if nil != err {
+		return nil, wrapError(err, "failed reading User-Password")
+	}
+
+	resp := Packet{Code: CodeAccessAccept, Identifier: req.Identifier}
+	err = self.Auth.Authenticate(ctx, string(user), password)
+	if nil != err {
+		log := observability.GetObservability(ctx).Log().With("handler", "radius")
+		log.Info("rejected Access-Request", "user", string(user), "error", err)
+		resp.Code = CodeAccessReject
+	}
+	err = resp.Sign(self.Secret, &req)
+	if nil != err {
+		return nil, wrapError(err, "failed signing response")
+	}
+
+	return resp.AppendBinary(nil)
+}
+
+// requestKey identifies the retransmissions of an Access-Request, see RFC 5080 section 2.2.2.
+type requestKey struct {
+	addr          string
+	identifier    byte
+	authenticator [authenticatorSize]byte
+}
+
+// cachedReply holds the response of a request, expires is zero while the request is handled.
+type cachedReply struct {
+	data    []byte // nil if the request was dropped
+	expires time.Time
+}
+
+// replyCache holds the responses of recent requests.
+type replyCache struct {
+	window    time.Duration
+	mut       sync.Mutex
+	replies   map[requestKey]*cachedReply
+	lastSweep time.Time
+}
+
+func newReplyCache(window time.Duration) *replyCache {
+	return &replyCache{window: window, replies: make(map[requestKey]*cachedReply)}
+}
+
+// lookup returns the cached response of key.
+// If key is not known, lookup registers it as pending & returns handle true, the caller then
+// shall handle the request and complete key.
+func (self *replyCache) lookup(key requestKey, now time.Time) ([]byte, bool) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	if now.Sub(self.lastSweep) >= self.window {
+		for k, r := range self.replies {
+			if !r.expires.IsZero() && now.After(r.expires) {
+				delete(self.replies, k)
+			}
+		}
+		self.lastSweep = now
+	}
+	r, found := self.replies[key]
+	if found && (r.expires.IsZero() || !now.After(r.expires)) {
+		return r.data, false
+	}
+	self.replies[key] = &cachedReply{}
+
+	return nil, true
+}
+
+// complete sets the response of the pending key request, data is nil if the request was dropped.
+func (self *replyCache) complete(key requestKey, data []byte, now time.Time) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	self.replies[key] = &cachedReply{data: data, expires: now.Add(self.window)}
+}
@@ -0,0 +1,462 @@
+package radius
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/ephemsec"
+)
+
+var testSecret = []byte("radius-secret")
+
+func TestServerOtp(t *testing.T) {
+	for _, schref := range []uint16{ephemsec.SHA512_X25519_E1S1_T600B10P8, ephemsec.SHA512_X25519_E1S2_T600B32P9} {
+		sch, err := ephemsec.GetScheme(schref)
+		if nil != err {
+			t.Fatalf("failed loading scheme, got error %v", err)
+		}
+		t.Run(sch.Name(), func(t *testing.T) {
+			st := newStage(t, schref)
+			addr := st.serve(t)
+
+			otp := st.cardOtp(t)
+			testcases := []struct {
+				name     string
+				user     string
+				password string
+				expected byte
+			}{
+				{name: "unknown user", user: "bob", password: otp, expected: CodeAccessReject},
+				{name: "invalid otp", user: "alice", password: "0000000000", expected: CodeAccessReject},
+				{name: "valid otp", user: "alice", password: otp, expected: CodeAccessAccept},
+				{name: "replayed otp", user: "alice", password: otp, expected: CodeAccessReject},
+			}
+			for pos, tc := range testcases {
+				req, err := NewAccessRequest(testSecret, byte(pos), tc.user, tc.password)
+				if nil != err {
+					t.Fatalf("%s: failed NewAccessRequest, got error %v", tc.name, err)
+				}
+				resp, err := exchange(addr, testSecret, req)
+				if nil != err {
+					t.Fatalf("%s: failed exchange, got error %v", tc.name, err)
+				}
+				if tc.expected != resp.Code {
+					t.Errorf("%s: failed response Code control, got %d", tc.name, resp.Code)
+				}
+			}
+
+			// requests with invalid secret are dropped
+			req, err := NewAccessRequest([]byte("invalid"), 0, "alice", otp)
+			if nil != err {
+				t.Fatalf("failed NewAccessRequest, got error %v", err)
+			}
+			_, err = exchange(addr, testSecret, req)
+			var nerr net.Error
+			if !errors.As(err, &nerr) || !nerr.Timeout() {
+				t.Fatalf("failed exchange error control, got error %v", err)
+			}
+		})
+	}
+}
+
+func TestOtpAuthenticatorLockout(t *testing.T) {
+	st := newStage(t, ephemsec.SHA512_X25519_E1S1_T600B10P8)
+	ctx := context.Background()
+	otp := st.cardOtp(t)
+	invalid := []byte(otp)
+	invalid[0] = '0' + (invalid[0]-'0'+1)%10
+
+	for i := range maxCardFailures {
+		err := st.auth.Authenticate(ctx, "alice", string(invalid))
+		if !errors.Is(err, ErrRejected) {
+			t.Fatalf("invalid otp #%d: Authenticate did not fail with ErrRejected, got error %v", i, err)
+		}
+	}
+	err := st.auth.Authenticate(ctx, "alice", otp)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("Authenticate did not fail with ErrLocked, got error %v", err)
+	}
+
+	// the lock expires with the failures window
+	st.auth.mut.Lock()
+	for _, f := range st.auth.failures {
+		f.expiry = time.Now().Add(-time.Second)
+	}
+	st.auth.mut.Unlock()
+	err = st.auth.Authenticate(ctx, "alice", otp)
+	if nil != err {
+		t.Fatalf("failed Authenticate after lock expiry, got error %v", err)
+	}
+	if 0 != len(st.auth.failures) {
+		t.Errorf("failed failures reset control, got %d entries", len(st.auth.failures))
+	}
+}
+
+func TestServerHandleUnsigned(t *testing.T) {
+	st := newStage(t, ephemsec.SHA512_X25519_E1S1_T600B10P8)
+	srv, err := NewServer(testSecret, st.auth)
+	if nil != err {
+		t.Fatalf("failed NewServer, got error %v", err)
+	}
+	req := Packet{Code: CodeAccessRequest, Attributes: []Attribute{{Type: AttrUserName, Value: []byte("alice")}}}
+	err = req.SetPassword(testSecret, st.cardOtp(t))
+	if nil != err {
+		t.Fatalf("failed SetPassword, got error %v", err)
+	}
+	srz, err := req.AppendBinary(nil)
+	if nil != err {
+		t.Fatalf("failed AppendBinary, got error %v", err)
+	}
+	_, err = srv.Handle(context.Background(), srz)
+	if !errors.Is(err, ErrInvalidPacket) {
+		t.Fatalf("failed Handle error control, got error %v", err)
+	}
+
+	srv.RequireMessageAuthenticator = false
+	srzresp, err := srv.Handle(context.Background(), srz)
+	if nil != err {
+		t.Fatalf("failed Handle, got error %v", err)
+	}
+	var resp Packet
+	err = resp.UnmarshalBinary(srzresp)
+	if nil != err {
+		t.Fatalf("failed UnmarshalBinary, got error %v", err)
+	}
+	signed, err := resp.Verify(testSecret, &req)
+	if nil != err || !signed {
+		t.Fatalf("failed response Verify, got error %v", err)
+	}
+	if CodeAccessAccept != resp.Code {
+		t.Fatalf("failed response Code control, got %d", resp.Code)
+	}
+}
+
+func TestServerDuplicateRequest(t *testing.T) {
+	st := newStage(t, ephemsec.SHA512_X25519_E1S1_T600B10P8)
+	addr := st.serve(t)
+	conn, err := net.Dial("udp", addr.String())
+	if nil != err {
+		t.Fatalf("failed Dial, got error %v", err)
+	}
+	defer conn.Close()
+
+	otp := st.cardOtp(t)
+	req, err := NewAccessRequest(testSecret, 1, "alice", otp)
+	if nil != err {
+		t.Fatalf("failed NewAccessRequest, got error %v", err)
+	}
+	// retransmissions get the cached response
+	for i := range 3 {
+		resp, err := roundTrip(conn, testSecret, req)
+		if nil != err {
+			t.Fatalf("#%d: failed roundTrip, got error %v", i, err)
+		}
+		if CodeAccessAccept != resp.Code {
+			t.Fatalf("#%d: failed response Code control, got %d", i, resp.Code)
+		}
+	}
+
+	// new request reusing the OTP is a replay
+	req, err = NewAccessRequest(testSecret, 1, "alice", otp)
+	if nil != err {
+		t.Fatalf("failed NewAccessRequest, got error %v", err)
+	}
+	resp, err := roundTrip(conn, testSecret, req)
+	if nil != err {
+		t.Fatalf("failed roundTrip, got error %v", err)
+	}
+	if CodeAccessReject != resp.Code {
+		t.Fatalf("failed replay response Code control, got %d", resp.Code)
+	}
+}
+
+func TestReplyCache(t *testing.T) {
+	now := time.Now()
+	rc := newReplyCache(time.Second)
+	key := requestKey{addr: "127.0.0.1:1812", identifier: 7}
+
+	_, handle := rc.lookup(key, now)
+	if !handle {
+		t.Fatal("failed first lookup handle control")
+	}
+	data, handle := rc.lookup(key, now)
+	if handle || nil != data {
+		t.Fatal("failed pending lookup control")
+	}
+	rc.complete(key, []byte("reply"), now)
+	data, handle = rc.lookup(key, now.Add(time.Second))
+	if handle || "reply" != string(data) {
+		t.Fatalf("failed completed lookup control, got %q", data)
+	}
+	other := key
+	other.authenticator[0] = 1
+	_, handle = rc.lookup(other, now)
+	if !handle {
+		t.Fatal("failed other key lookup control")
+	}
+	_, handle = rc.lookup(key, now.Add(2*time.Second))
+	if !handle {
+		t.Fatal("failed expired lookup control")
+	}
+}
+
+// slowAuthenticator records the maximum number of concurrent Authenticate calls.
+type slowAuthenticator struct {
+	mut     sync.Mutex
+	current int
+	max     int
+}
+
+func (self *slowAuthenticator) Authenticate(_ context.Context, _ string, _ string) error {
+	self.mut.Lock()
+	self.current += 1
+	self.max = max(self.max, self.current)
+	self.mut.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	self.mut.Lock()
+	self.current -= 1
+	self.mut.Unlock()
+	return nil
+}
+
+func TestServerMaxInflight(t *testing.T) {
+	auth := &slowAuthenticator{}
+	srv, err := NewServer(testSecret, auth)
+	if nil != err {
+		t.Fatalf("failed NewServer, got error %v", err)
+	}
+	srv.MaxInflight = 2
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("failed ListenPacket, got error %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- srv.Serve(ctx, conn) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Go(func() {
+			req, err := NewAccessRequest(testSecret, byte(i), "alice", "password")
+			if nil != err {
+				t.Errorf("failed NewAccessRequest, got error %v", err)
+				return
+			}
+			resp, err := exchange(conn.LocalAddr(), testSecret, req)
+			if nil != err {
+				t.Errorf("failed exchange, got error %v", err)
+				return
+			}
+			if CodeAccessAccept != resp.Code {
+				t.Errorf("failed response Code control, got %d", resp.Code)
+			}
+		})
+	}
+	wg.Wait()
+
+	auth.mut.Lock()
+	defer auth.mut.Unlock()
+	if auth.max > 2 {
+		t.Fatalf("failed MaxInflight control, got %d concurrent requests", auth.max)
+	}
+}
+
+type stage struct {
+	auth *OtpAuthenticator
+	card *credentials.Card
+	sk   *ecdh.PublicKey
+}
+
+func TestOtpAuthenticatorCardUses(t *testing.T) {
+	st := newStage(t, ephemsec.SHA512_X25519_E1S2_T600B32P9)
+	ctx := context.Background()
+	otp := st.cardOtp(t)
+
+	for _, password := range []string{otp, otp} {
+		st.auth.Authenticate(ctx, "alice", password) // the replayed otp is rejected
+	}
+	err := st.auth.Uses.Flush(ctx)
+	if nil != err {
+		t.Fatalf("failed card uses Flush, got error %v", err)
+	}
+	page, err := st.auth.Scs.ListCards(ctx, credentials.ServerCardQuery{})
+	if nil != err {
+		t.Fatalf("failed ListCards, got error %v", err)
+	}
+	if 1 != len(page.Cards) || 1 != page.Cards[0].UseCount || page.Cards[0].LastUsed.IsZero() {
+		t.Errorf("failed card uses control, got %+v", page.Cards)
+	}
+}
+
+func newStage(t *testing.T, schref uint16) *stage {
+	ctx := context.Background()
+	sch, err := ephemsec.GetScheme(schref)
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	curve := ecdh.X25519()
+
+	// register Realm & Realm static key
+	scs, err := credentials.NewMemServerCredStore()
+	if nil != err {
+		t.Fatalf("failed instantiating scs, got error %v", err)
+	}
+	realmId := [32]byte{1, 2, 3, 4}
+	err = scs.SaveRealm(ctx, &credentials.Realm{RealmId: realmId[:], AppName: "VPN"})
+	if nil != err {
+		t.Fatalf("failed saving realm, got error %v", err)
+	}
+	kst := credentials.NewMemKeyStore()
+	sk := credentials.ServerKey{RealmId: realmId[:], Certificate: []byte("TBD")}
+	sk.Kh.PrivateKey, err = curve.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating realm static key, got error %v", err)
+	}
+	err = kst.SaveServerKey(ctx, sch.Name(), sk)
+	if nil != err {
+		t.Fatalf("failed saving realm static key, got error %v", err)
+	}
+
+	// register alice Card
+	cc := credentials.Card{RealmId: realmId[:], UserId: "alice", Psk: make([]byte, 32)}
+	rand.Read(cc.Psk)
+	cc.Kh.PrivateKey, err = curve.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating card key, got error %v", err)
+	}
+	sc := credentials.ServerCard{RealmId: realmId[:], Psk: cc.Psk}
+	sc.Kh.PublicKey = cc.Kh.PrivateKey.PublicKey()
+	err = scs.SaveCard(ctx, credentials.OtpId{Realm: realmId[:], Username: cc.UserId}, &sc)
+	if nil != err {
+		t.Fatalf("failed saving server card, got error %v", err)
+	}
+
+	// static challenge
+	auth := &OtpAuthenticator{
+		RealmId: realmId,
+		Scheme:  schref,
+		Context: []byte("vpn.kerpass.org"),
+		Nonce:   make([]byte, 32),
+		Kst:     kst,
+		Scs:     scs,
+	}
+	idh, err := credentials.NewIdHasher(nil)
+	if nil != err {
+		t.Fatalf("failed IdHasher creation, got error %v", err)
+	}
+	auth.Uses, err = credentials.NewCardUseRecorder(scs, idh, time.Hour, 0)
+	if nil != err {
+		t.Fatalf("failed CardUseRecorder creation, got error %v", err)
+	}
+	rand.Read(auth.Nonce)
+	auth.EphemKey.PrivateKey, err = curve.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating challenge ephemeral key, got error %v", err)
+	}
+	err = auth.Check()
+	if nil != err {
+		t.Fatalf("failed OtpAuthenticator Check, got error %v", err)
+	}
+
+	return &stage{auth: auth, card: &cc, sk: sk.Kh.PrivateKey.PublicKey()}
+}
+
+// serve starts a Server on a local udp port and returns its address.
+func (self *stage) serve(t *testing.T) net.Addr {
+	srv, err := NewServer(testSecret, self.auth)
+	if nil != err {
+		t.Fatalf("failed NewServer, got error %v", err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("failed ListenPacket, got error %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- srv.Serve(ctx, conn) }()
+	t.Cleanup(func() {
+		cancel()
+		err := <-done
+		if nil != err {
+			t.Errorf("failed Serve, got error %v", err)
+		}
+	})
+
+	return conn.LocalAddr()
+}
+
+// cardOtp returns the OTP generated by the Card application.
+func (self *stage) cardOtp(t *testing.T) string {
+	sch, err := ephemsec.GetScheme(self.auth.Scheme)
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	eps := ephemsec.State{
+		Context:        self.auth.Context,
+		Nonce:          self.auth.Nonce,
+		StaticKey:      self.card.Kh.PrivateKey,
+		RemoteEphemKey: self.auth.EphemKey.PrivateKey.PublicKey(),
+		Psk:            self.card.Psk,
+	}
+	if "E1S2" == sch.KeyExchangePattern() {
+		eps.RemoteStaticKey = self.sk
+	}
+	digits, err := eps.EPHEMSEC(sch, ephemsec.Responder, nil)
+	if nil != err {
+		t.Fatalf("failed card OTP generation, got error %v", err)
+	}
+	otp, err := sch.Alphabet().Format(digits, 4, '-')
+	if nil != err {
+		t.Fatalf("failed OTP formatting, got error %v", err)
+	}
+	return otp
+}
+
+// exchange is a RADIUS client stand-in, it sends req to addr and returns the verified response.
+func exchange(addr net.Addr, secret []byte, req *Packet) (*Packet, error) {
+	conn, err := net.Dial("udp", addr.String())
+	if nil != err {
+		return nil, err
+	}
+	defer conn.Close()
+	return roundTrip(conn, secret, req)
+}
+
+// roundTrip sends req on conn and returns the verified response.
+func roundTrip(conn net.Conn, secret []byte, req *Packet) (*Packet, error) {
+	srz, err := req.AppendBinary(nil)
+	if nil != err {
+		return nil, err
+	}
+	_, err = conn.Write(srz)
+	if nil != err {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	buf := make([]byte, maxPacketSize)
+	n, err := conn.Read(buf)
+	if nil != err {
+		return nil, err
+	}
+	var resp Packet
+	err = resp.UnmarshalBinary(buf[:n])
+	if nil != err {
+		return nil, err
+	}
+	_, err = resp.Verify(secret, req)
+	if nil != err {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"crypto"
 	"crypto/rand"
+	"crypto/subtle"
+	"runtime"
 	"slices"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/hkdf"
 
 	"code.kerpass.org/golang/internal/algos"
+	"code.kerpass.org/golang/internal/observability"
 	"code.kerpass.org/golang/internal/session"
 	"code.kerpass.org/golang/pkg/credentials"
 	"code.kerpass.org/golang/pkg/ephemsec"
@@ -98,16 +102,31 @@ func (self *HkdfChalSetter) SetChal(crv algos.Curve, sid []byte, dst *SessionCha
 type ChallengeFactory interface {
 	// GetCardChallenge generates a CardChallenge in response to a CardChallengeRequest.
 	// Returns an error if the request does not match any configured AuthContext or challenge generation fails.
-	GetCardChallenge(req *CardChallengeRequest, dst *CardChallenge) error
+	GetCardChallenge(ctx context.Context, req *CardChallengeRequest, dst *CardChallenge) error
 
 	// GetAgentAuthContext retrieves the AgentAuthContext bound to the given session ID.
 	// Returns an error if the session ID is invalid or expired, or the AuthContext cannot be reconstructed.
-	GetAgentAuthContext(sid []byte, dst *AgentAuthContext) error
+	GetAgentAuthContext(ctx context.Context, sid []byte, dst *AgentAuthContext) error
 
 	// GetServerOtp derives the server-side OTP/OTK matching the one independently derived
 	// by the Client for the authentication session referenced in cc.
 	// Returns an error if the session is invalid, the card cannot be loaded, or OTP derivation fails.
-	GetServerOtp(cc *CardChalResponse, dst []byte) ([]byte, error)
+	GetServerOtp(ctx context.Context, cc *CardChalResponse, dst []byte) ([]byte, error)
+}
+
+// CardUseTracker is implemented by the ChallengeFactory that tracks Card usage.
+type CardUseTracker interface {
+	// CardUsed is called when the OTP/OTK derived by GetServerOtp for cc matched the Client one.
+	// It shall not block on storage access.
+	CardUsed(ctx context.Context, cc *CardChalResponse)
+}
+
+// RecordCardUse reports to factory that the OTP/OTK derived for cc matched the Client one.
+// It does nothing if factory does not implement CardUseTracker.
+func RecordCardUse(ctx context.Context, factory ChallengeFactory, cc *CardChalResponse) {
+	if cut, ok := factory.(CardUseTracker); ok {
+		cut.CardUsed(ctx, cc)
+	}
 }
 
 // AuthContext holds ChallengeFactoryImpl configuration for a specific authentication realm.
@@ -180,6 +199,9 @@ type ChallengeFactoryImpl struct {
 	Scs  credentials.ServerCredStore
 	Cst  ChalSetter
 	Cfgs []AuthContext
+
+	// Uses is optional, it records the Card usage reported by CardUsed
+	Uses *credentials.CardUseRecorder
 }
 
 // NewChallengeFactoryImpl creates and initializes a new ChallengeFactoryImpl.
@@ -235,6 +257,10 @@ func (self *ChallengeFactoryImpl) Check() error {
 		if nil != err {
 			return wrapError(err, "failed loading cfg[%d] scheme", pos)
 		}
+		// KEM ciphertext can not be carried by CardChallenge
+		if nil != sch.Kem() {
+			return wrapError(ErrValidation, "unsupported hybrid scheme for cfg[%d]", pos)
+		}
 		kx := sch.KeyExchangePattern()
 		if kx == "E1S2" || kx == "E2S2" {
 			sk := credentials.ServerKey{}
@@ -252,7 +278,7 @@ func (self *ChallengeFactoryImpl) Check() error {
 // It validates the request against configured AuthContexts, generates a session ID,
 // creates an authentication challenge using the configured ChalSetter, and loads
 // appropriate static keys for the selected EPHEMSEC scheme.
-func (self *ChallengeFactoryImpl) GetCardChallenge(req *CardChallengeRequest, dst *CardChallenge) error {
+func (self *ChallengeFactoryImpl) GetCardChallenge(ctx context.Context, req *CardChallengeRequest, dst *CardChallenge) error {
 
 	// load the AuthContext that corresponds to req.
 	var realmId [32]byte
@@ -286,7 +312,7 @@ func (self *ChallengeFactoryImpl) GetCardChallenge(req *CardChallengeRequest, ds
 	kx := sch.KeyExchangePattern()
 	if kx == "E1S2" || kx == "E2S2" {
 		sk := credentials.ServerKey{}
-		found := self.Kst.GetServerKey(context.Background(), req.RealmId, sch.Name(), &sk)
+		found := self.Kst.GetServerKey(ctx, req.RealmId, sch.Name(), &sk)
 		if !found {
 			return newError("failed loading scheme static key, with keyref{[%d][%v], %s}", len(req.RealmId), req.RealmId, sch.Name())
 		}
@@ -308,7 +334,7 @@ func (self *ChallengeFactoryImpl) GetCardChallenge(req *CardChallengeRequest, ds
 // It validates the session ID, looks up the corresponding AuthContext configuration,
 // loads the appropriate static key certificate if needed, and populates the
 // AgentAuthContext with all necessary authentication protocol information.
-func (self *ChallengeFactoryImpl) GetAgentAuthContext(sid []byte, dst *AgentAuthContext) error {
+func (self *ChallengeFactoryImpl) GetAgentAuthContext(ctx context.Context, sid []byte, dst *AgentAuthContext) error {
 
 	// check session sid
 	var sId session.Sid
@@ -338,7 +364,7 @@ func (self *ChallengeFactoryImpl) GetAgentAuthContext(sid []byte, dst *AgentAuth
 	kx := sch.KeyExchangePattern()
 	if kx == "E1S2" || kx == "E2S2" {
 		sk := credentials.ServerKey{}
-		found := self.Kst.GetServerKey(context.Background(), cfg.RealmId[:], sch.Name(), &sk)
+		found := self.Kst.GetServerKey(ctx, cfg.RealmId[:], sch.Name(), &sk)
 		if !found {
 			return newError("failed loading scheme static key")
 		}
@@ -365,55 +391,235 @@ func (self *ChallengeFactoryImpl) GetAgentAuthContext(sid []byte, dst *AgentAuth
 // The result matches what the Client independently derived, enabling mutual authentication
 // without transmission of the shared secret.
 // Returns an error if the session is invalid, the card cannot be loaded, or OTP derivation fails.
-func (self *ChallengeFactoryImpl) GetServerOtp(cc *CardChalResponse, dst []byte) ([]byte, error) {
+func (self *ChallengeFactoryImpl) GetServerOtp(ctx context.Context, cc *CardChalResponse, dst []byte) ([]byte, error) {
+	var tsk otpTask
+	err := self.initOtpTask(cc, &tsk)
+	if nil != err {
+		return nil, err
+	}
+
+	// load the Card
+	var card credentials.ServerCard
+	err = self.Scs.LoadCard(ctx, tsk.sca, &card)
+	if nil != err {
+		return nil, wrapError(err, "failed loading card")
+	}
+
+	return self.deriveOtp(ctx, &tsk, &card, dst)
+}
+
+// CardUsed records in Uses that the Client Card referenced in cc successfully authenticated.
+// It does nothing if Uses is nil.
+func (self *ChallengeFactoryImpl) CardUsed(ctx context.Context, cc *CardChalResponse) {
+	if nil == self.Uses {
+		return
+	}
+	var tsk otpTask
+	err := self.initOtpTask(cc, &tsk)
+	if nil == err {
+		err = self.Uses.Record(tsk.sca, time.Now())
+	}
+	if nil != err {
+		log := observability.GetObservability(ctx).Log()
+		log.Info("failed recording card use", "error", err)
+	}
+}
+
+// SessionScheme returns the EPHEMSEC Scheme of the session sessionId.
+// It errors if the session is invalid or expired.
+func (self *ChallengeFactoryImpl) SessionScheme(sessionId []byte) (*ephemsec.Scheme, error) {
+	var tsk otpTask
+	err := self.initOtpTask(&CardChalResponse{SessionId: sessionId}, &tsk)
+	if nil != err {
+		return nil, err
+	}
+
+	return tsk.sch, nil
+}
+
+// CardAccess returns the key that allows loading the Client Card referenced in cc.
+// It errors if the cc session is invalid.
+func (self *ChallengeFactoryImpl) CardAccess(cc *CardChalResponse) (credentials.ServerCardAccess, error) {
+	var tsk otpTask
+	err := self.initOtpTask(cc, &tsk)
+	if nil != err {
+		return nil, err
+	}
+
+	return tsk.sca, nil
+}
+
+// OtpResult holds the outcome of a GetServerOtps derivation.
+// Err is nil if Otp was successfully derived.
+// Valid is set by CheckServerOtps if Otp matched the Client OTP/OTK.
+type OtpResult struct {
+	Otp   []byte
+	Err   error
+	Valid bool
+}
+
+// GetServerOtps derives the server-side OTP/OTK for each CardChalResponse in ccs.
+// It loads all the Client Cards with a single ServerCredStore LoadCards call,
+// then runs the EPHEMSEC derivations on a pool of workers goroutines.
+// If workers is not positive, runtime.GOMAXPROCS(0) workers are used.
+// The returned results are in ccs order, with a per item error for invalid items.
+// Returns an error if the ServerCredStore could not load the Cards.
+// GetServerOtps does not record Card uses, see CheckServerOtps.
+func (self *ChallengeFactoryImpl) GetServerOtps(ctx context.Context, ccs []*CardChalResponse, workers int) ([]OtpResult, error) {
+	rv := make([]OtpResult, len(ccs))
+
+	// validate sessions
+	tsks := make([]otpTask, len(ccs))
+	scas := make([]credentials.ServerCardAccess, 0, len(ccs))
+	idxs := make([]int, 0, len(ccs))
+	for pos, cc := range ccs {
+		err := self.initOtpTask(cc, &tsks[pos])
+		if nil != err {
+			rv[pos].Err = err
+			continue
+		}
+		scas = append(scas, tsks[pos].sca)
+		idxs = append(idxs, pos)
+	}
+	if 0 == len(idxs) {
+		return rv, nil
+	}
+
+	// load the Cards
+	cards := make([]credentials.ServerCard, len(scas))
+	errs, err := self.Scs.LoadCards(ctx, scas, cards)
+	if nil != err {
+		return nil, wrapError(err, "failed loading cards")
+	}
+	for pos, err := range errs {
+		if nil != err {
+			rv[idxs[pos]].Err = wrapError(err, "failed loading card")
+		}
+	}
+
+	// derive the OTPs
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(idxs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for pos := range jobs {
+				idx := idxs[pos]
+				if err := ctx.Err(); nil != err {
+					rv[idx].Err = wrapError(err, "failed OTP derivation")
+					continue
+				}
+				rv[idx].Otp, rv[idx].Err = self.deriveOtp(ctx, &tsks[idx], &cards[pos], nil)
+			}
+		})
+	}
+	for pos, idx := range idxs {
+		if nil == rv[idx].Err {
+			jobs <- pos
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return rv, nil
+}
+
+// CheckServerOtps validates otps, otps[i] being the Client OTP/OTK of ccs[i].
+// It derives the server-side OTP/OTK as GetServerOtps does, sets the Valid flag of the results
+// that match their Client OTP/OTK, and records their Card use with CardUsed.
+// Returns an error if ccs and otps lengths differ or if GetServerOtps failed.
+func (self *ChallengeFactoryImpl) CheckServerOtps(ctx context.Context, ccs []*CardChalResponse, otps [][]byte, workers int) ([]OtpResult, error) {
+	if len(ccs) != len(otps) {
+		return nil, wrapError(ErrValidation, "ccs & otps lengths differ")
+	}
+	rv, err := self.GetServerOtps(ctx, ccs, workers)
+	if nil != err {
+		return nil, err
+	}
+	for pos := range rv {
+		res := &rv[pos]
+		if nil == res.Err && 1 == subtle.ConstantTimeCompare(res.Otp, otps[pos]) {
+			res.Valid = true
+			self.CardUsed(ctx, ccs[pos])
+		}
+	}
+
+	return rv, nil
+}
+
+// otpTask holds the CardChalResponse session data needed to derive the server-side OTP/OTK.
+type otpTask struct {
+	cc  *CardChalResponse
+	cfg *AuthContext
+	sch *ephemsec.Scheme
+	sca credentials.ServerCardAccess
+}
+
+// initOtpTask validates cc session and initializes dst with the session AuthContext,
+// EPHEMSEC scheme and Card access key.
+func (self *ChallengeFactoryImpl) initOtpTask(cc *CardChalResponse, dst *otpTask) error {
 	if nil == cc {
-		return nil, wrapError(ErrValidation, "nil CardChalResponse")
+		return wrapError(ErrValidation, "nil CardChalResponse")
 	}
 	// retrieve session cfg
-	sId := session.Sid(cc.SessionId)
+	var sId session.Sid
 	if len(sId) != len(cc.SessionId) {
-		return nil, wrapError(ErrValidation, "invalid sid length")
+		return wrapError(ErrValidation, "invalid sid length")
 	}
+	copy(sId[:], cc.SessionId)
 	err := self.Skf.Check(sId)
 	if nil != err {
-		return nil, wrapError(err, "failed sId validation")
+		return wrapError(err, "failed sId validation")
 	}
 	cfgIdx := sId.AD()
 	if cfgIdx >= uint64(len(self.Cfgs)) {
-		return nil, wrapError(ErrValidation, "invalid cfg index")
+		return wrapError(ErrValidation, "invalid cfg index")
 	}
-	cfg := self.Cfgs[int(cfgIdx)]
+	cfg := &self.Cfgs[int(cfgIdx)]
 
 	// retrieve session EPHEMSEC scheme
 	sch, err := ephemsec.GetScheme(cfg.AuthMethod.Scheme)
 	if nil != err {
-		return nil, wrapError(err, "failed loading SelectedMethod scheme")
+		return wrapError(err, "failed loading SelectedMethod scheme")
 	}
 
-	// load the Card
-	var card credentials.ServerCard
-	var sca credentials.ServerCardAccess
+	// set the Card access key
 	if 256 == sch.B() {
 		// OTK case
-		sca = credentials.IdToken(cc.CardId)
+		dst.sca = credentials.IdToken(cc.CardId)
 	} else {
 		// OTP case
-		sca = credentials.OtpId{Realm: cfg.RealmId[:], Username: string(cc.CardId)}
+		dst.sca = credentials.OtpId{Realm: cfg.RealmId[:], Username: string(cc.CardId)}
 	}
-	// TODO: consider passing a context parameter
-	err = self.Scs.LoadCard(context.Background(), sca, &card)
-	if nil != err {
-		return nil, wrapError(err, "failed loading card")
+	dst.cc = cc
+	dst.cfg = cfg
+	dst.sch = sch
+
+	return nil
+}
+
+// deriveOtp runs EPHEMSEC as Initiator for tsk and card, and appends the resulting OTP/OTK to dst.
+func (self *ChallengeFactoryImpl) deriveOtp(ctx context.Context, tsk *otpTask, card *credentials.ServerCard, dst []byte) ([]byte, error) {
+	cc, cfg, sch := tsk.cc, tsk.cfg, tsk.sch
+	if int(cc.SyncHint) >= sch.B() {
+		return nil, wrapError(ErrMalformedOtp, "invalid SyncHint")
 	}
 	if !slices.Equal(card.RealmId, cfg.RealmId[:]) {
 		return nil, wrapError(ErrValidation, "invalid card Realm")
 	}
+	err := card.CheckActive()
+	if nil != err {
+		return nil, wrapError(err, "invalid card")
+	}
 
 	// load server static key if scheme requires 1
 	var sk credentials.ServerKey // sk.Kh.PrivateKey (*ecdh.PrivateKey) & sk.Certificate
 	kx := sch.KeyExchangePattern()
 	if kx == "E1S2" || kx == "E2S2" {
-		found := self.Kst.GetServerKey(context.Background(), cfg.RealmId[:], sch.Name(), &sk)
+		found := self.Kst.GetServerKey(ctx, cfg.RealmId[:], sch.Name(), &sk)
 		if !found {
 			return nil, newError("failed loading scheme static key")
 		}
@@ -465,3 +671,4 @@ func (self *ChallengeFactoryImpl) GetServerOtp(cc *CardChalResponse, dst []byte)
 }
 
 var _ ChallengeFactory = &ChallengeFactoryImpl{}
+var _ CardUseTracker = &ChallengeFactoryImpl{}
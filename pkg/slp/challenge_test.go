@@ -6,6 +6,7 @@ import (
 	"crypto"
 	"crypto/ecdh"
 	"crypto/rand"
+	"errors"
 	"testing"
 	"time"
 
@@ -316,6 +317,7 @@ func testFactorySetup(t *testing.T) *ChallengeFactoryImpl {
 // TestChallenge_FactoryImpl_GetCardChallenge tests card challenge generation
 func TestChallenge_FactoryImpl_GetCardChallenge(t *testing.T) {
 	factory := testFactorySetup(t)
+	ctx := context.Background()
 
 	t.Run("E1S1_Scheme_NoStaticKey", func(t *testing.T) {
 		req := &CardChallengeRequest{
@@ -325,7 +327,7 @@ func TestChallenge_FactoryImpl_GetCardChallenge(t *testing.T) {
 		}
 
 		var dst CardChallenge
-		err := factory.GetCardChallenge(req, &dst)
+		err := factory.GetCardChallenge(ctx, req, &dst)
 		if err != nil {
 			t.Fatalf("GetCardChallenge failed: %v", err)
 		}
@@ -365,7 +367,7 @@ func TestChallenge_FactoryImpl_GetCardChallenge(t *testing.T) {
 		}
 
 		var dst CardChallenge
-		err := factory.GetCardChallenge(req, &dst)
+		err := factory.GetCardChallenge(ctx, req, &dst)
 		if err != nil {
 			t.Fatalf("GetCardChallenge failed: %v", err)
 		}
@@ -398,7 +400,7 @@ func TestChallenge_FactoryImpl_GetCardChallenge(t *testing.T) {
 		}
 
 		var dst CardChallenge
-		err := factory.GetCardChallenge(req, &dst)
+		err := factory.GetCardChallenge(ctx, req, &dst)
 		if err != nil {
 			t.Fatalf("GetCardChallenge failed: %v", err)
 		}
@@ -426,7 +428,7 @@ func TestChallenge_FactoryImpl_GetCardChallenge(t *testing.T) {
 		}
 
 		var dst CardChallenge
-		err := factory.GetCardChallenge(req, &dst)
+		err := factory.GetCardChallenge(ctx, req, &dst)
 		if err == nil {
 			t.Error("Expected error for non-existent realm, got nil")
 		}
@@ -440,7 +442,7 @@ func TestChallenge_FactoryImpl_GetCardChallenge(t *testing.T) {
 		}
 
 		var dst CardChallenge
-		err := factory.GetCardChallenge(req, &dst)
+		err := factory.GetCardChallenge(ctx, req, &dst)
 		if err == nil {
 			t.Error("Expected error for wrong AppContextUrl, got nil")
 		}
@@ -480,7 +482,7 @@ func TestChallenge_FactoryImpl_GetCardChallenge(t *testing.T) {
 		}
 
 		var dst CardChallenge
-		err = factory.GetCardChallenge(req, &dst)
+		err = factory.GetCardChallenge(ctx, req, &dst)
 		if err == nil {
 			t.Error("Expected error for missing static key, got nil")
 		}
@@ -500,7 +502,7 @@ func TestChallenge_FactoryImpl_GetCardChallenge(t *testing.T) {
 			}
 		}()
 
-		err := factory.GetCardChallenge(req, nil)
+		err := factory.GetCardChallenge(ctx, req, nil)
 		if err != nil {
 			// If it returns an error instead of panicking, that's okay
 			t.Logf("GetCardChallenge returned error (expected): %v", err)
@@ -511,6 +513,7 @@ func TestChallenge_FactoryImpl_GetCardChallenge(t *testing.T) {
 // TestChallenge_FactoryImpl_GetAgentAuthContext tests agent auth context retrieval
 func TestChallenge_FactoryImpl_GetAgentAuthContext(t *testing.T) {
 	factory := testFactorySetup(t)
+	ctx := context.Background()
 
 	// First create a valid session by getting a card challenge
 	req := &CardChallengeRequest{
@@ -520,14 +523,14 @@ func TestChallenge_FactoryImpl_GetAgentAuthContext(t *testing.T) {
 	}
 
 	var cardChallenge CardChallenge
-	err := factory.GetCardChallenge(req, &cardChallenge)
+	err := factory.GetCardChallenge(ctx, req, &cardChallenge)
 	if err != nil {
 		t.Fatalf("Setup failed: %v", err)
 	}
 
 	t.Run("ValidSessionID", func(t *testing.T) {
 		var dst AgentAuthContext
-		err := factory.GetAgentAuthContext(cardChallenge.SessionId, &dst)
+		err := factory.GetAgentAuthContext(ctx, cardChallenge.SessionId, &dst)
 		if err != nil {
 			t.Fatalf("GetAgentAuthContext failed: %v", err)
 		}
@@ -572,13 +575,13 @@ func TestChallenge_FactoryImpl_GetAgentAuthContext(t *testing.T) {
 		}
 
 		var challengeE1S1 CardChallenge
-		err := factory.GetCardChallenge(reqE1S1, &challengeE1S1)
+		err := factory.GetCardChallenge(ctx, reqE1S1, &challengeE1S1)
 		if err != nil {
 			t.Fatalf("Setup E1S1 failed: %v", err)
 		}
 
 		var ctxE1S1 AgentAuthContext
-		err = factory.GetAgentAuthContext(challengeE1S1.SessionId, &ctxE1S1)
+		err = factory.GetAgentAuthContext(ctx, challengeE1S1.SessionId, &ctxE1S1)
 		if err != nil {
 			t.Fatalf("GetAgentAuthContext for E1S1 failed: %v", err)
 		}
@@ -597,7 +600,7 @@ func TestChallenge_FactoryImpl_GetAgentAuthContext(t *testing.T) {
 		var dst AgentAuthContext
 		invalidSid := []byte("too-short")
 
-		err := factory.GetAgentAuthContext(invalidSid, &dst)
+		err := factory.GetAgentAuthContext(ctx, invalidSid, &dst)
 		if err == nil {
 			t.Error("Expected error for invalid session ID length, got nil")
 		}
@@ -610,7 +613,7 @@ func TestChallenge_FactoryImpl_GetAgentAuthContext(t *testing.T) {
 		invalidSid := make([]byte, 64) // Wrong size
 		rand.Read(invalidSid)
 
-		err := factory.GetAgentAuthContext(invalidSid, &dst)
+		err := factory.GetAgentAuthContext(ctx, invalidSid, &dst)
 		if err == nil {
 			t.Error("Expected error for invalid session ID format, got nil")
 		}
@@ -629,7 +632,7 @@ func TestChallenge_FactoryImpl_GetAgentAuthContext(t *testing.T) {
 		sid := skf.New(999)
 
 		var dst AgentAuthContext
-		err = factory.GetAgentAuthContext(sid[:], &dst)
+		err = factory.GetAgentAuthContext(ctx, sid[:], &dst)
 		if err == nil {
 			t.Error("Expected error for out-of-bounds config index, got nil")
 		}
@@ -643,7 +646,7 @@ func TestChallenge_FactoryImpl_GetAgentAuthContext(t *testing.T) {
 			}
 		}()
 
-		err := factory.GetAgentAuthContext(cardChallenge.SessionId, nil)
+		err := factory.GetAgentAuthContext(ctx, cardChallenge.SessionId, nil)
 		if err != nil {
 			// If it returns an error instead of panicking, that's okay
 			t.Logf("GetAgentAuthContext returned error (expected): %v", err)
@@ -654,6 +657,7 @@ func TestChallenge_FactoryImpl_GetAgentAuthContext(t *testing.T) {
 // TestChallenge_FactoryImpl_InterfaceCompliance verifies interface implementation
 func TestChallenge_FactoryImpl_InterfaceCompliance(t *testing.T) {
 	factory := testFactorySetup(t)
+	ctx := context.Background()
 
 	// Verify the factory implements the ChallengeFactory interface
 	var _ ChallengeFactory = factory
@@ -666,21 +670,168 @@ func TestChallenge_FactoryImpl_InterfaceCompliance(t *testing.T) {
 	}
 
 	var challenge CardChallenge
-	err := factory.GetCardChallenge(req, &challenge)
+	err := factory.GetCardChallenge(ctx, req, &challenge)
 	if err != nil {
 		t.Fatalf("Interface method GetCardChallenge failed: %v", err)
 	}
 
 	var authCtx AgentAuthContext
-	err = factory.GetAgentAuthContext(challenge.SessionId, &authCtx)
+	err = factory.GetAgentAuthContext(ctx, challenge.SessionId, &authCtx)
 	if err != nil {
 		t.Fatalf("Interface method GetAgentAuthContext failed: %v", err)
 	}
 }
 
+// TestChallenge_FactoryImpl_GetServerOtps tests batch OTP/OTK derivation
+func TestChallenge_FactoryImpl_GetServerOtps(t *testing.T) {
+	st := newStage(t)
+	ctx := context.Background()
+
+	// one valid CardChalResponse per scheme
+	var ccs []*CardChalResponse
+	var otps [][]byte
+	for i, schref := range schemes {
+		sch, err := ephemsec.GetScheme(schref)
+		if nil != err {
+			t.Fatalf("failed loading scheme #%d, got error %v", i, err)
+		}
+		ccr, err := st.NewCardChallengeRequest(i)
+		if nil != err {
+			t.Fatalf("failed instantiating CardChallengeRequest, got error %v", err)
+		}
+		chal := CardChallenge{}
+		err = st.chf.GetCardChallenge(ctx, ccr, &chal)
+		if nil != err {
+			t.Fatalf("failed GetCardChallenge, got error %v", err)
+		}
+		aac := AgentAuthContext{}
+		err = st.chf.GetAgentAuthContext(ctx, chal.SessionId, &aac)
+		if nil != err {
+			t.Fatalf("failed GetAgentAuthContext, got error %v", err)
+		}
+		ach, err := aac.Sum(nil)
+		if nil != err {
+			t.Fatalf("failed hashing AgentAuthContext, got error %v", err)
+		}
+		ach, err = EphemSecContextHash(ccr.RealmId, ach, nil)
+		if nil != err {
+			t.Fatalf("failed ephemsec context hashing, got error %v", err)
+		}
+		cc := &CardChalResponse{SessionId: chal.SessionId}
+		var ephemkey *ecdh.PrivateKey
+		if "E2S2" == sch.KeyExchangePattern() {
+			ephemkey, err = ecdh.X25519().GenerateKey(rand.Reader)
+			if nil != err {
+				t.Fatalf("failed generating client ephemeral key, got error %v", err)
+			}
+			cc.E.PublicKey = ephemkey.PublicKey()
+		}
+		eps := ephemsec.State{
+			Context:         ach,
+			Nonce:           chal.INonce,
+			EphemKey:        ephemkey,
+			StaticKey:       st.card.Kh.PrivateKey,
+			RemoteEphemKey:  chal.E.PublicKey,
+			RemoteStaticKey: chal.S.PublicKey,
+			Psk:             st.card.Psk,
+		}
+		otp, err := eps.EPHEMSEC(sch, ephemsec.Responder, nil)
+		if nil != err {
+			t.Fatalf("failed client OTP calculation, got error %v", err)
+		}
+		cc.SyncHint = byte(eps.SynchroHint)
+		if 256 == sch.B() {
+			cc.CardId = st.card.IdToken
+		} else {
+			cc.CardId = []byte(st.card.UserId)
+		}
+		ccs = append(ccs, cc)
+		otps = append(otps, otp)
+	}
+
+	// invalid CardChalResponses
+	unknown := *ccs[0]
+	unknown.CardId = []byte("unknown-user")
+	ccs = append(ccs, nil, &CardChalResponse{SessionId: []byte("invalid")}, &unknown)
+
+	for _, workers := range []int{0, 1, 3} {
+		results, err := st.chf.GetServerOtps(ctx, ccs, workers)
+		if nil != err {
+			t.Fatalf("failed GetServerOtps, got error %v", err)
+		}
+		if len(ccs) != len(results) {
+			t.Fatalf("failed results length control, got %d", len(results))
+		}
+		for pos, otp := range otps {
+			if nil != results[pos].Err {
+				t.Fatalf("workers=%d: failed results[%d], got error %v", workers, pos, results[pos].Err)
+			}
+			if !bytes.Equal(otp, results[pos].Otp) {
+				t.Errorf("workers=%d: results[%d] does not match client OTP", workers, pos)
+			}
+
+			// batch derivation matches single derivation
+			single, err := st.chf.GetServerOtp(ctx, ccs[pos], nil)
+			if nil != err || !bytes.Equal(single, results[pos].Otp) {
+				t.Errorf("workers=%d: results[%d] does not match GetServerOtp", workers, pos)
+			}
+		}
+		for pos := len(otps); pos < len(ccs); pos++ {
+			if nil == results[pos].Err {
+				t.Errorf("workers=%d: results[%d] succeeded for invalid CardChalResponse", workers, pos)
+			}
+		}
+		if !errors.Is(results[len(ccs)-1].Err, credentials.ErrNotFound) {
+			t.Errorf("workers=%d: unexpected unknown card error %v", workers, results[len(ccs)-1].Err)
+		}
+	}
+
+	// CheckServerOtps validates the client OTPs & records the uses of the matching Cards
+	idh, err := credentials.NewIdHasher(nil)
+	if nil != err {
+		t.Fatalf("failed IdHasher creation, got error %v", err)
+	}
+	st.chf.Uses, err = credentials.NewCardUseRecorder(st.chf.Scs, idh, time.Hour, 0)
+	if nil != err {
+		t.Fatalf("failed CardUseRecorder creation, got error %v", err)
+	}
+	clientOtps := make([][]byte, len(ccs))
+	copy(clientOtps, otps)
+	clientOtps[0] = append([]byte{1 ^ otps[0][0]}, otps[0][1:]...)
+	results, err := st.chf.CheckServerOtps(ctx, ccs, clientOtps, 0)
+	if nil != err {
+		t.Fatalf("failed CheckServerOtps, got error %v", err)
+	}
+	for pos, res := range results {
+		if expected := pos > 0 && pos < len(otps); expected != res.Valid {
+			t.Errorf("failed results[%d] Valid control, got %v", pos, res.Valid)
+		}
+	}
+	err = st.chf.Uses.Flush(ctx)
+	if nil != err {
+		t.Fatalf("failed card uses Flush, got error %v", err)
+	}
+	page, err := st.chf.Scs.ListCards(ctx, credentials.ServerCardQuery{})
+	if nil != err {
+		t.Fatalf("failed ListCards, got error %v", err)
+	}
+	var count int64
+	for _, info := range page.Cards {
+		count += info.UseCount
+	}
+	if int64(len(otps)-1) != count {
+		t.Errorf("failed card uses control, got %d uses", count)
+	}
+	_, err = st.chf.CheckServerOtps(ctx, ccs, otps, 0)
+	if nil == err {
+		t.Error("failed CheckServerOtps length control, got no error")
+	}
+}
+
 // TestChallenge_Integration_CompleteFlow tests complete authentication flow
 func TestChallenge_Integration_CompleteFlow(t *testing.T) {
 	factory := testFactorySetup(t)
+	ctx := context.Background()
 
 	testCases := []struct {
 		name     string
@@ -722,7 +873,7 @@ func TestChallenge_Integration_CompleteFlow(t *testing.T) {
 			}
 
 			var challenge CardChallenge
-			err := factory.GetCardChallenge(req, &challenge)
+			err := factory.GetCardChallenge(ctx, req, &challenge)
 			if err != nil {
 				t.Fatalf("[%s] GetCardChallenge failed: %v", tc.name, err)
 			}
@@ -734,7 +885,7 @@ func TestChallenge_Integration_CompleteFlow(t *testing.T) {
 
 			// Step 2: Get agent auth context
 			var authCtx AgentAuthContext
-			err = factory.GetAgentAuthContext(challenge.SessionId, &authCtx)
+			err = factory.GetAgentAuthContext(ctx, challenge.SessionId, &authCtx)
 			if err != nil {
 				t.Fatalf("[%s] GetAgentAuthContext failed: %v", tc.name, err)
 			}
@@ -784,3 +935,47 @@ func TestChallenge_Integration_CompleteFlow(t *testing.T) {
 		})
 	}
 }
+
+// TestChallenge_FactoryImpl_ContextPropagation tests that request context reaches the KeyStore
+func TestChallenge_FactoryImpl_ContextPropagation(t *testing.T) {
+	factory := testFactorySetup(t)
+	kst := &ctxKeyStore{KeyStore: factory.Kst}
+	factory.Kst = kst
+
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	req := &CardChallengeRequest{
+		RealmId:        realmId(2),
+		SelectedMethod: AuthMethod{Protocol: SlpNXpsk2, Scheme: ephemsec.BLAKE2B_X25519_E2S2_T1024B256P33},
+		AppContextUrl:  "https://app2.example.com/context",
+	}
+	var challenge CardChallenge
+	err := factory.GetCardChallenge(ctx, req, &challenge)
+	if err != nil {
+		t.Fatalf("GetCardChallenge failed: %v", err)
+	}
+	if nil == kst.last || "request" != kst.last.Value(ctxKey{}) {
+		t.Error("GetCardChallenge did not forward ctx to KeyStore")
+	}
+
+	kst.last = nil
+	var authCtx AgentAuthContext
+	err = factory.GetAgentAuthContext(ctx, challenge.SessionId, &authCtx)
+	if err != nil {
+		t.Fatalf("GetAgentAuthContext failed: %v", err)
+	}
+	if nil == kst.last || "request" != kst.last.Value(ctxKey{}) {
+		t.Error("GetAgentAuthContext did not forward ctx to KeyStore")
+	}
+}
+
+// ctxKeyStore records the context passed to GetServerKey.
+type ctxKeyStore struct {
+	credentials.KeyStore
+	last context.Context
+}
+
+func (self *ctxKeyStore) GetServerKey(ctx context.Context, realmId []byte, name string, srvkey *credentials.ServerKey) bool {
+	self.last = ctx
+	return self.KeyStore.GetServerKey(ctx, realmId, name, srvkey)
+}
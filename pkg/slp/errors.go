@@ -16,6 +16,7 @@ const (
 	ErrUnsafeMethod = errorFlag("slp: Unsafe AuthMethod")
 	ErrNotSupported = errorFlag("slp: Unsupported AuthMethod")
 	ErrHttpStatus   = errorFlag("slp: failed Http submission")
+	ErrMalformedOtp = errorFlag("slp: Malformed OTP")
 	noError         = errorFlag("")
 )
 
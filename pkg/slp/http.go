@@ -4,10 +4,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/subtle"
+	"errors"
 	"io"
+	"log/slog"
 	"net/http"
+	"strings"
+	"unicode/utf8"
 
+	"code.kerpass.org/golang/internal/observability"
 	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/ephemsec"
 )
 
 const (
@@ -70,7 +76,7 @@ func (self *CardChallengeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Requ
 
 	// 4. Generate the CardChallenge using the factory
 	var resp CardChallenge
-	if err := self.factory.GetCardChallenge(&req, &resp); err != nil {
+	if err := self.factory.GetCardChallenge(r.Context(), &req, &resp); err != nil {
 		// If the factory returns an error, we assume Internal Server Error
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -193,24 +199,39 @@ func (self *DirectEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 4. transform dlr in CardChalResponse
-	osz := len(dlr.Otp) // osz > 0 enforced by dlr.Check
-	cr := CardChalResponse{
-		SessionId: dlr.SessionId,
-		CardId:    dlr.CardId,
-		SyncHint:  dlr.Otp[osz-1],
-		E:         dlr.E,
-	}
-
-	// 5. calculate the expected otp
-	otp, err := self.factory.GetServerOtp(&cr, nil)
-	if nil != err {
+	obs := observability.GetObservability(r.Context())
+	digits, err := dlr.OtpDigits(self.factory)
+	var otp []byte
+	cr := CardChalResponse{SessionId: dlr.SessionId, CardId: dlr.CardId, E: dlr.E}
+	if nil == err {
+		cr.SyncHint = digits[len(digits)-1] // len(digits) > 0 enforced by dlr.Check & OtpDigits
+
+		// 5. calculate the expected otp
+		otp, err = self.factory.GetServerOtp(r.Context(), &cr, nil)
+	}
+	malformed := errors.Is(err, ErrMalformedOtp) || (nil == err && len(otp) != len(digits))
+	if nil != err && !malformed {
+		obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "error"))
 		http.Error(w, "failed otp calculation", http.StatusBadRequest)
+		return
 	}
 
 	// 6. compare calculated otp with received one
-	res := DirectValidationResult{
-		Valid: (subtle.ConstantTimeCompare(otp, dlr.Otp) == 1),
-	}
+	// malformed otp can not be valid, they are reported distinctly to allow Clients
+	// to signal typing mistakes.
+	var res DirectValidationResult
+	outcome := "malformed"
+	switch {
+	case malformed:
+		res.Malformed = true
+	case 1 == subtle.ConstantTimeCompare(otp, digits):
+		res.Valid = true
+		outcome = "valid"
+		RecordCardUse(r.Context(), self.factory, &cr)
+	default:
+		outcome = "invalid"
+	}
+	obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", outcome))
 
 	// 7. Marshal the response to CBOR
 	data, err := ctapSrz.Marshal(&res)
@@ -231,6 +252,7 @@ func (self *DirectEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // The caller is responsible for enforcing deadlines via the context.
 // Returns an error if the request cannot be sent, the response is non-2xx,
 // or the response body cannot be decoded.
+// Returns an error wrapping ErrMalformedOtp if the server reported a malformed OTP.
 func DirectCheckOtp(ctx context.Context, client HttpClient, directLoginUrl string, dlr *DirectLoginRequest) (status bool, err error) {
 
 	// marshal dlr to CBOR
@@ -271,6 +293,9 @@ func DirectCheckOtp(ctx context.Context, client HttpClient, directLoginUrl strin
 	if err != nil {
 		return status, wrapError(err, "failed to unmarshal CBOR resp")
 	}
+	if dvr.Malformed {
+		return status, wrapError(ErrMalformedOtp, "server reported malformed otp")
+	}
 	status = dvr.Valid
 
 	return status, nil
@@ -287,11 +312,19 @@ type HttpClient interface {
 // It carries the session reference, card identity, client-generated OTP, and optionally
 // a client ephemeral key for schemes using E2S2 key exchange.
 // The last byte of Otp encodes the synchronization hint used by the server to align OTP time windows.
+//
+// The OTP is either carried decoded in Otp or as typed by the user in Code. In the latter case,
+// Code is the OTP masked with OtpPad, formatted with the session Scheme Alphabet and followed by
+// its Alphabet CheckDigit if CheckDigit is true. This allows the server to report typing mistakes
+// as malformed OTP.
 type DirectLoginRequest struct {
-	SessionId []byte                      `json:"sid" cbor:"1,keyasint"`
-	CardId    []byte                      `json:"cid" cbor:"2,keyasint"`
-	Otp       []byte                      `json:"otp" cbor:"3,keyasint"`
-	E         credentials.PublicKeyHandle `json:"e,omitzero" cbor:"4,keyasint,omitzero"`
+	SessionId  []byte                      `json:"sid" cbor:"1,keyasint"`
+	CardId     []byte                      `json:"cid" cbor:"2,keyasint"`
+	Otp        []byte                      `json:"otp,omitempty" cbor:"3,keyasint,omitempty"`
+	E          credentials.PublicKeyHandle `json:"e,omitzero" cbor:"4,keyasint,omitzero"`
+	Code       string                      `json:"code,omitempty" cbor:"5,keyasint,omitempty"`
+	OtpPad     []byte                      `json:"pad,omitempty" cbor:"6,keyasint,omitempty"`
+	CheckDigit bool                        `json:"chk,omitempty" cbor:"7,keyasint,omitempty"`
 }
 
 // Check validates the DirectLoginRequest and returns an error if any required field is missing.
@@ -305,15 +338,87 @@ func (self *DirectLoginRequest) Check() error {
 	if 0 == len(self.CardId) {
 		return wrapError(ErrValidation, "empty CardId")
 	}
-	if 0 == len(self.Otp) {
-		return wrapError(ErrValidation, "empty Otp")
+	if (0 == len(self.Otp)) == ("" == self.Code) {
+		return wrapError(ErrValidation, "requires one of Otp or Code")
+	}
+	if "" == self.Code && (0 != len(self.OtpPad) || self.CheckDigit) {
+		return wrapError(ErrValidation, "OtpPad & CheckDigit require Code")
 	}
 
 	return nil
 
 }
 
+// OtpDigits returns the OTP digits of the DirectLoginRequest.
+// If Code is set, it is decoded with the Scheme of the session, which requires factory to
+// implement SessionSchemer, and OtpPad is removed from the decoded digits.
+// It errors wrapping ErrMalformedOtp if Code can not be decoded or if its check digit is invalid.
+func (self *DirectLoginRequest) OtpDigits(factory ChallengeFactory) ([]byte, error) {
+	if "" == self.Code {
+		return self.Otp, nil
+	}
+	ssr, ok := factory.(SessionSchemer)
+	if !ok {
+		return nil, wrapError(ErrValidation, "factory can not decode Code")
+	}
+	sch, err := ssr.SessionScheme(self.SessionId)
+	if nil != err {
+		return nil, wrapError(err, "failed loading session Scheme")
+	}
+	alphabet := sch.Alphabet()
+	n := alphabet.Size()
+	if 0 == n {
+		return nil, wrapError(ErrMalformedOtp, "session Scheme code is not an OTP")
+	}
+	code := strings.Map(func(r rune) rune {
+		if ' ' == r || '-' == r {
+			return -1
+		}
+		return r
+	}, self.Code)
+	size := sch.P()
+	if self.CheckDigit {
+		size += 1
+	}
+	var digits []byte
+	if utf8.RuneCountInString(code) != size {
+		err = newError("invalid Code length")
+	} else if self.CheckDigit {
+		digits, err = alphabet.DecodeCheck(code, 0, sch.P(), nil)
+	} else {
+		digits, err = alphabet.Decode(code, 0, sch.P(), nil)
+	}
+	if nil != err {
+		return nil, wrapError(ErrMalformedOtp, "failed Code decoding")
+	}
+	if 0 == len(self.OtpPad) {
+		return digits, nil
+	}
+	if len(self.OtpPad) != len(digits) {
+		return nil, wrapError(ErrMalformedOtp, "invalid OtpPad length")
+	}
+	for pos, p := range self.OtpPad {
+		if int(p) >= n {
+			return nil, wrapError(ErrMalformedOtp, "invalid OtpPad digit")
+		}
+		digits[pos] = byte((int(digits[pos]) + n - int(p)) % n)
+	}
+
+	return digits, nil
+}
+
+// SessionSchemer is implemented by the ChallengeFactory that can return the EPHEMSEC Scheme
+// of a session. It allows decoding the Code of a DirectLoginRequest.
+type SessionSchemer interface {
+	// SessionScheme returns the EPHEMSEC Scheme of the session sessionId.
+	// Returns an error if the session is invalid or expired.
+	SessionScheme(sessionId []byte) (*ephemsec.Scheme, error)
+}
+
 // DirectValidationResult holds the outcome of an SlpDirect OTP validation.
 type DirectValidationResult struct {
 	Valid bool `json:"valid" cbor:"1,keyasint"`
+
+	// Malformed is true if the OTP length or digits are not compatible with the session scheme
+	Malformed bool `json:"malformed,omitempty" cbor:"2,keyasint,omitempty"`
 }
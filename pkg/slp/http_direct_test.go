@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/ecdh"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
@@ -146,9 +147,149 @@ func TestSlpDirect(t *testing.T) {
 
 }
 
+func TestSlpDirectMalformed(t *testing.T) {
+	st := newStage(t)
+	sch, err := ephemsec.GetScheme(schemes[schOtpE1S1])
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	testcases := []struct {
+		name string
+		otp  []byte
+	}{
+		{name: "short otp", otp: make([]byte, sch.P()-1)},
+		{name: "long otp", otp: make([]byte, sch.P()+1)},
+		{name: "invalid sync hint", otp: append(make([]byte, sch.P()-1), byte(sch.B()))},
+	}
+	for _, tc := range testcases {
+		ccr, err := st.NewCardChallengeRequest(schOtpE1S1)
+		if nil != err {
+			t.Fatalf("%s: failed instantiating CardChallengeRequest, got error %v", tc.name, err)
+		}
+		cc := CardChallenge{}
+		err = GetCardChallenge(context.Background(), http.DefaultClient, st.GetChalUrl(), ccr, &cc)
+		if nil != err {
+			t.Fatalf("%s: failed obtaining CardChallenge, got error %v", tc.name, err)
+		}
+		dlr := DirectLoginRequest{SessionId: cc.SessionId, CardId: []byte(st.card.UserId), Otp: tc.otp}
+		valid, err := DirectCheckOtp(context.Background(), http.DefaultClient, st.DirectLoginUrl(), &dlr)
+		if valid || !errors.Is(err, ErrMalformedOtp) {
+			t.Errorf("%s: failed DirectCheckOtp error control, got error %v", tc.name, err)
+		}
+	}
+}
+
+func TestSlpDirectCode(t *testing.T) {
+	st := newStage(t)
+	sch, err := ephemsec.GetScheme(schemes[schOtpE1S2])
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	alphabet := sch.Alphabet()
+	pad := make([]byte, sch.P())
+	for pos := range pad {
+		pad[pos] = byte(pos % sch.B())
+	}
+	testcases := []struct {
+		name      string
+		check     bool
+		mistype   bool
+		valid     bool
+		malformed bool
+	}{
+		{name: "code", valid: true},
+		{name: "code with check digit", check: true, valid: true},
+		{name: "mistyped code", mistype: true},
+		{name: "mistyped code with check digit", check: true, mistype: true, malformed: true},
+	}
+	for _, tc := range testcases {
+		ccr, err := st.NewCardChallengeRequest(schOtpE1S2)
+		if nil != err {
+			t.Fatalf("%s: failed instantiating CardChallengeRequest, got error %v", tc.name, err)
+		}
+		cc := CardChallenge{}
+		err = GetCardChallenge(context.Background(), http.DefaultClient, st.GetChalUrl(), ccr, &cc)
+		if nil != err {
+			t.Fatalf("%s: failed obtaining CardChallenge, got error %v", tc.name, err)
+		}
+		aac := AgentAuthContext{
+			SelectedProtocol:     SlpDirect,
+			SessionId:            cc.SessionId,
+			StaticKeyCert:        cc.StaticKeyCert,
+			AppContextUrl:        ccr.AppContextUrl,
+			AuthServerGetChalUrl: "https://ats.kerpass.org/get-card-chal",
+			AuthServerLoginUrl:   cc.AuthServerLoginUrl,
+			AppStartUrl:          cc.AppStartUrl,
+		}
+		ach, err := aac.Sum(nil)
+		if nil != err {
+			t.Fatalf("%s: failed hashing AgentAuthContext, got error %v", tc.name, err)
+		}
+		ach, err = EphemSecContextHash(ccr.RealmId, ach, nil)
+		if nil != err {
+			t.Fatalf("%s: failed ephemsec context hashing, got error %v", tc.name, err)
+		}
+		eps := ephemsec.State{
+			Context:         ach,
+			Nonce:           cc.INonce,
+			StaticKey:       st.card.Kh.PrivateKey,
+			RemoteEphemKey:  cc.E.PublicKey,
+			RemoteStaticKey: cc.S.PublicKey,
+			Psk:             st.card.Psk,
+		}
+		otp, err := eps.EPHEMSEC(sch, ephemsec.Responder, nil)
+		if nil != err {
+			t.Fatalf("%s: failed client OTP calculation, got error %v", tc.name, err)
+		}
+
+		// mask & format the otp as the CardApp does
+		for pos := range otp {
+			otp[pos] = byte((int(otp[pos]) + int(pad[pos])) % sch.B())
+		}
+		var code string
+		if tc.check {
+			code, err = alphabet.FormatCheck(otp, 3, '-')
+		} else {
+			code, err = alphabet.Format(otp, 3, '-')
+		}
+		if nil != err {
+			t.Fatalf("%s: failed code formatting, got error %v", tc.name, err)
+		}
+		if tc.mistype {
+			// a single mistyped character
+			otp[0] = byte((int(otp[0]) + 1) % sch.B())
+			mistyped, err := alphabet.Format(otp, 3, '-')
+			if nil != err {
+				t.Fatalf("%s: failed code formatting, got error %v", tc.name, err)
+			}
+			code = mistyped + code[len(mistyped):]
+		}
+
+		dlr := DirectLoginRequest{
+			SessionId:  cc.SessionId,
+			CardId:     []byte(st.card.UserId),
+			Code:       code,
+			OtpPad:     pad,
+			CheckDigit: tc.check,
+		}
+		valid, err := DirectCheckOtp(context.Background(), http.DefaultClient, st.DirectLoginUrl(), &dlr)
+		switch {
+		case tc.malformed:
+			if valid || !errors.Is(err, ErrMalformedOtp) {
+				t.Errorf("%s: failed DirectCheckOtp error control, got error %v", tc.name, err)
+			}
+		case nil != err:
+			t.Errorf("%s: failed DirectCheckOtp, got error %v", tc.name, err)
+		case valid != tc.valid:
+			t.Errorf("%s: failed DirectCheckOtp control, got valid %v", tc.name, valid)
+		}
+	}
+}
+
 type stage struct {
 	realmId []byte
 	card    *credentials.Card
+	chf     *ChallengeFactoryImpl
 	server  *httptest.Server
 }
 
@@ -291,7 +432,7 @@ func newStage(t *testing.T) *stage {
 	// start test server
 	srv := httptest.NewServer(mux)
 
-	return &stage{realmId: realmId[:], card: &cc, server: srv}
+	return &stage{realmId: realmId[:], card: &cc, chf: chf, server: srv}
 }
 
 // initCards initializes a pair of client/server cards.
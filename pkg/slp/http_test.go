@@ -427,7 +427,7 @@ type mockChallengeFactory struct {
 	challenge  *CardChallenge
 }
 
-func (m *mockChallengeFactory) GetCardChallenge(req *CardChallengeRequest, dst *CardChallenge) error {
+func (m *mockChallengeFactory) GetCardChallenge(_ context.Context, req *CardChallengeRequest, dst *CardChallenge) error {
 	if m.shouldFail {
 		return newError("mock factory error")
 	}
@@ -437,11 +437,11 @@ func (m *mockChallengeFactory) GetCardChallenge(req *CardChallengeRequest, dst *
 	return nil
 }
 
-func (m *mockChallengeFactory) GetAgentAuthContext(sid []byte, dst *AgentAuthContext) error {
+func (m *mockChallengeFactory) GetAgentAuthContext(_ context.Context, sid []byte, dst *AgentAuthContext) error {
 	return nil
 }
 
-func (m *mockChallengeFactory) GetServerOtp(cc *CardChalResponse, dst []byte) ([]byte, error) {
+func (m *mockChallengeFactory) GetServerOtp(_ context.Context, cc *CardChalResponse, dst []byte) ([]byte, error) {
 	return nil, nil
 }
 
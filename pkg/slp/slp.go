@@ -177,7 +177,7 @@ type CardChallenge struct {
 
 	// AuthServer EPHEMSEC static key
 	// It is set if the selected EPHEMSEC scheme uses E1S2 or E2S2 key exchange pattern
-	S credentials.PublicKeyHandle `json:"S" cbor:"4,keyasint,omitzero"`
+	S credentials.PublicKeyHandle `json:"S,omitzero" cbor:"4,keyasint,omitzero"`
 
 	// Static key certificate
 	// It is set if the selected EPHEMSEC scheme uses E1S2 or E2S2 key exchange pattern
@@ -0,0 +1,218 @@
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.kerpass.org/golang/internal/observability"
+	"code.kerpass.org/golang/internal/session"
+	"code.kerpass.org/golang/internal/transport"
+	"code.kerpass.org/golang/pkg/credentials"
+)
+
+const (
+	// DefaultDeviceSessionLifetime is the DeviceToken validity used when Config DeviceSessionLifetime is 0.
+	DefaultDeviceSessionLifetime = 10 * time.Minute
+
+	cborContentType = "application/cbor"
+	bearerPrefix    = "Bearer "
+)
+
+var cborSrz = transport.WrapInSafeSerializer(transport.NewCBORSerializer())
+
+// Device describes a Card enrolled by the logged in user.
+type Device struct {
+	CardId    []byte    `json:"cId" cbor:"1,keyasint"`
+	Label     string    `json:"label,omitempty" cbor:"2,keyasint,omitempty"`
+	CreatedAt time.Time `json:"createdAt" cbor:"3,keyasint"`
+	Suspended bool      `json:"suspended,omitempty" cbor:"4,keyasint,omitempty"`
+	LastUsed  time.Time `json:"lastUsed,omitzero" cbor:"5,keyasint,omitzero"` // zero if never used
+}
+
+// DeviceList is returned by the device listing endpoint.
+type DeviceList struct {
+	Devices []Device `json:"devices" cbor:"1,keyasint"`
+}
+
+// RevokeDeviceRequest removes the Card with CardId identifier.
+type RevokeDeviceRequest struct {
+	CardId []byte `json:"cId" cbor:"1,keyasint"`
+}
+
+// Check returns an error if the RevokeDeviceRequest is invalid.
+func (self *RevokeDeviceRequest) Check() error {
+	if nil == self {
+		return wrapError(ErrValidation, "nil RevokeDeviceRequest")
+	}
+	if 32 != len(self.CardId) {
+		return wrapError(ErrValidation, "invalid CardId, length != 32")
+	}
+	return nil
+}
+
+// devices holds the device sessions opened by successful logins.
+// A device session is indexed by the DeviceToken returned in the LoginResult & holds the login UserId.
+type devices struct {
+	sessions *session.MemStore[session.Sid, string]
+}
+
+func newDevices(lifetime time.Duration) (*devices, error) {
+	if 0 == lifetime {
+		lifetime = DefaultDeviceSessionLifetime
+	}
+	skf, err := session.NewSidFactory(lifetime)
+	if nil != err {
+		return nil, wrapError(err, "failed SidFactory instantiation")
+	}
+	sessions, err := session.NewMemStore[session.Sid, string](skf)
+	if nil != err {
+		return nil, wrapError(err, "failed MemStore instantiation")
+	}
+
+	return &devices{sessions: sessions}, nil
+}
+
+// newDeviceToken opens a device session for userId and returns its DeviceToken.
+func (self *Handler) newDeviceToken(userId string) (string, error) {
+	sid, err := self.devices.sessions.Save(userId)
+	if nil != err {
+		return "", wrapError(err, "failed saving device session")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(sid[:]), nil
+}
+
+// deviceUser returns the UserId of the device session which DeviceToken is in r Authorization header.
+func (self *Handler) deviceUser(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerPrefix) {
+		return "", false
+	}
+	var sid session.Sid
+	srzsid, err := base64.RawURLEncoding.DecodeString(auth[len(bearerPrefix):])
+	if nil != err || len(srzsid) != len(sid) {
+		return "", false
+	}
+	copy(sid[:], srzsid)
+
+	return self.devices.sessions.Get(sid)
+}
+
+// userCardId returns the ServerCardIdKey of the userId Card in the configured Realm.
+// The Card IdToken derives from userId, see credentials.IdHasher.IdTokenOfUserId.
+func (self *Handler) userCardId(userId string) (credentials.IdToken, credentials.ServerCardIdKey, error) {
+	idToken, err := self.cfg.Hasher.IdTokenOfUserId(self.cfg.RealmId[:], userId, nil)
+	if nil != err {
+		return nil, nil, wrapError(err, "failed IdToken derivation")
+	}
+	var aks credentials.AccessKeys
+	err = self.cfg.Hasher.DeriveFromCardAccess(credentials.IdToken(idToken), &aks)
+	if nil != err {
+		return nil, nil, wrapError(err, "failed AccessKeys derivation")
+	}
+
+	return credentials.IdToken(idToken), credentials.ServerCardIdKey(aks.IdKey[:]), nil
+}
+
+// serveListDevices returns the DeviceList of the logged in user.
+func (self *Handler) serveListDevices(w http.ResponseWriter, r *http.Request) {
+	userId, found := self.deviceUser(r)
+	if !found {
+		http.Error(w, "invalid device token", http.StatusUnauthorized)
+		return
+	}
+	log := observability.GetObservability(r.Context()).Log().With("handler", "web-list-devices")
+	_, cardId, err := self.userCardId(userId)
+	if nil != err {
+		log.Info("failed card id derivation", "error", err)
+		http.Error(w, "failed listing devices", http.StatusInternalServerError)
+		return
+	}
+	infos, err := self.cfg.Repo.ListUserCards(r.Context(), userId)
+	if nil != err {
+		log.Info("failed ListUserCards", "error", err)
+		http.Error(w, "failed listing devices", http.StatusInternalServerError)
+		return
+	}
+
+	rv := DeviceList{Devices: []Device{}}
+	for _, info := range infos {
+		if !bytes.Equal(cardId, info.CardId) {
+			continue
+		}
+		rv.Devices = append(rv.Devices, Device{
+			CardId:    info.CardId,
+			Label:     info.Label,
+			CreatedAt: info.CreatedAt,
+			Suspended: credentials.CardActive != info.State,
+			LastUsed:  info.LastUsed,
+		})
+	}
+	writeReply(w, r, http.StatusOK, &rv)
+}
+
+// serveRevokeDevice removes a Card of the logged in user.
+func (self *Handler) serveRevokeDevice(w http.ResponseWriter, r *http.Request) {
+	userId, found := self.deviceUser(r)
+	if !found {
+		http.Error(w, "invalid device token", http.StatusUnauthorized)
+		return
+	}
+	var req RevokeDeviceRequest
+	err := readRequest(w, r, &req)
+	if nil != err {
+		http.Error(w, "failed to decode request", http.StatusBadRequest)
+		return
+	}
+	log := observability.GetObservability(r.Context()).Log().With("handler", "web-revoke-device")
+	idToken, cardId, err := self.userCardId(userId)
+	if nil != err {
+		log.Info("failed card id derivation", "error", err)
+		http.Error(w, "failed revoking device", http.StatusInternalServerError)
+		return
+	}
+	if !bytes.Equal(cardId, req.CardId) || !self.cfg.Repo.RemoveCard(r.Context(), idToken) {
+		http.Error(w, "unknown device", http.StatusNotFound)
+		return
+	}
+	log.Info("revoked device", "cId", base64.RawURLEncoding.EncodeToString(cardId))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readRequest decodes r body in dst and validates it.
+// The body is CBOR encoded if r Content-Type is application/cbor, JSON encoded otherwise.
+func readRequest(w http.ResponseWriter, r *http.Request, dst checker) error {
+	mtype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if cborContentType != mtype {
+		return readJSON(w, r, dst)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONRequestSize)
+	body, err := io.ReadAll(r.Body)
+	if nil != err {
+		return wrapError(err, "failed to read request body")
+	}
+
+	return wrapError(cborSrz.Unmarshal(body, dst), "failed cbor decoding")
+}
+
+// writeReply writes v CBOR encoded if r accepts application/cbor, JSON encoded otherwise.
+func writeReply(w http.ResponseWriter, r *http.Request, status int, v any) {
+	if !strings.Contains(r.Header.Get("Accept"), cborContentType) {
+		writeJSON(w, status, v)
+		return
+	}
+	data, err := cborSrz.Marshal(v)
+	if nil != err {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", cborContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(data)
+}
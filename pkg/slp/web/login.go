@@ -0,0 +1,448 @@
+package web
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"code.kerpass.org/golang/internal/observability"
+	"code.kerpass.org/golang/pkg/airgap"
+	"code.kerpass.org/golang/pkg/airgap/qrcode"
+	"code.kerpass.org/golang/pkg/ephemsec"
+	"code.kerpass.org/golang/pkg/slp"
+)
+
+const (
+	padInfo = "kerpass web otp pad"
+
+	// qrScale is the number of pixels per QR code module
+	qrScale = 4
+
+	// maxSubmitAttempts is the number of invalid OTP accepted per login
+	maxSubmitAttempts = 3
+
+	// submitAttemptsLifetime bounds the lifetime of the logins invalid OTP counts,
+	// it exceeds the SLP sessions lifetime
+	submitAttemptsLifetime = 15 * time.Minute
+
+	// a Card is locked for cardFailuresWindow after maxCardFailures invalid OTP,
+	// this bounds the OTP guesses made with new logins
+	maxCardFailures    = 10
+	cardFailuresWindow = 15 * time.Minute
+)
+
+// LoginStartRequest starts a login, it selects one of the configured login Methods.
+type LoginStartRequest struct {
+	Scheme uint16 `json:"scheme"`
+}
+
+// Check returns an error if the LoginStartRequest is invalid.
+func (self *LoginStartRequest) Check() error {
+	if nil == self {
+		return wrapError(ErrValidation, "nil LoginStartRequest")
+	}
+	return nil
+}
+
+// LoginChallenge is returned when a login starts.
+type LoginChallenge struct {
+	// SLP session id
+	SessionId []byte `json:"sId"`
+
+	// Qr holds the airgap.TextParts of the enveloped AgentCardChallenge, it has more than 1 Part if the
+	// challenge is to be displayed as an animated QR code
+	Qr []string `json:"qr"`
+
+	// QrImages holds the PNG data urls of the Qr Parts
+	QrImages []string `json:"qrImages"`
+
+	// Scheme of the OTP
+	Scheme uint16 `json:"scheme"`
+
+	// Size is the number of OTP characters that the user types, separators excluded
+	Size int `json:"size"`
+
+	// Alphabet of the OTP characters
+	Alphabet string `json:"alphabet"`
+
+	// Separator is inserted every Group characters when formatting the OTP
+	Separator string `json:"sep,omitempty"`
+	Group     int    `json:"group,omitempty"`
+}
+
+// LoginSubmitRequest submits the OTP typed by the user.
+type LoginSubmitRequest struct {
+	SessionId []byte `json:"sId"`
+	Scheme    uint16 `json:"scheme"`
+	UserId    string `json:"uId"`
+	Code      string `json:"code"`
+}
+
+// Check returns an error if the LoginSubmitRequest is invalid.
+func (self *LoginSubmitRequest) Check() error {
+	if nil == self {
+		return wrapError(ErrValidation, "nil LoginSubmitRequest")
+	}
+	if 0 == len(self.SessionId) {
+		return wrapError(ErrValidation, "empty SessionId")
+	}
+	if 0 == len(self.UserId) {
+		return wrapError(ErrValidation, "empty UserId")
+	}
+	if 0 == len(self.Code) {
+		return wrapError(ErrValidation, "empty Code")
+	}
+	return nil
+}
+
+// LoginResult is returned when the OTP is submitted.
+// RedirectTo is set by the Config Authenticated function if the OTP is valid.
+// DeviceToken is set if the OTP is valid and the Handler serves the device management endpoints,
+// it is sent as an Authorization Bearer token to those endpoints.
+type LoginResult struct {
+	Valid       bool   `json:"valid"`
+	Malformed   bool   `json:"malformed,omitempty"`
+	RedirectTo  string `json:"redirectTo,omitempty"`
+	DeviceToken string `json:"dTkn,omitempty"`
+}
+
+// serveLoginStart obtains a CardChallenge for the selected method and returns the
+// airgap.AgentCardChallenge that the CardApp uses to generate the OTP.
+func (self *Handler) serveLoginStart(w http.ResponseWriter, r *http.Request) {
+	var req LoginStartRequest
+	err := readJSON(w, r, &req)
+	if nil != err {
+		http.Error(w, "failed to decode json request", http.StatusBadRequest)
+		return
+	}
+	mtd, found := self.method(req.Scheme)
+	if !found {
+		http.Error(w, "unsupported scheme", http.StatusBadRequest)
+		return
+	}
+	lc, err := self.newLoginChallenge(r, mtd)
+	if nil != err {
+		log := observability.GetObservability(r.Context()).Log().With("handler", "web-login-start")
+		log.Info("failed login start", "error", err)
+		http.Error(w, "failed to generate challenge", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, lc)
+}
+
+func (self *Handler) newLoginChallenge(r *http.Request, mtd slp.AuthMethod) (*LoginChallenge, error) {
+	ctx := r.Context()
+	sch, err := ephemsec.GetScheme(mtd.Scheme)
+	if nil != err {
+		return nil, wrapError(err, "failed loading scheme")
+	}
+
+	// obtain the session challenge
+	var cc slp.CardChallenge
+	err = self.cfg.Factory.GetCardChallenge(ctx, &slp.CardChallengeRequest{
+		RealmId:        self.cfg.RealmId[:],
+		SelectedMethod: mtd,
+		AppContextUrl:  self.cfg.AppContextUrl,
+	}, &cc)
+	if nil != err {
+		return nil, wrapError(err, "failed GetCardChallenge")
+	}
+
+	// calculate the EPHEMSEC context as the CardAgent does
+	var aac slp.AgentAuthContext
+	err = self.cfg.Factory.GetAgentAuthContext(ctx, cc.SessionId, &aac)
+	if nil != err {
+		return nil, wrapError(err, "failed GetAgentAuthContext")
+	}
+	ach, err := aac.Sum(nil)
+	if nil != err {
+		return nil, wrapError(err, "failed hashing AgentAuthContext")
+	}
+	ach, err = slp.EphemSecContextHash(self.cfg.RealmId[:], ach, ach[:0])
+	if nil != err {
+		return nil, wrapError(err, "failed hashing ephemsec Context")
+	}
+
+	pad, err := self.pad(cc.SessionId, sch)
+	if nil != err {
+		return nil, err
+	}
+	env := airgap.Envelope{Capabilities: airgap.CapOTP | airgap.CapFountain}
+	for _, m := range self.cfg.Methods {
+		env.Schemes = append(env.Schemes, m.Scheme)
+	}
+	if self.cfg.CheckDigit {
+		// CardApps that ignore the CheckDigit field would display codes that can not be decoded
+		env.Critical = []int{9}
+	}
+	srzacc, err := airgap.MarshalAgentEnvelope(env, &airgap.AgentCardChallenge{
+		RealmId:    self.cfg.RealmId[:],
+		Context:    ach,
+		Scheme:     mtd.Scheme,
+		OtpPad:     pad,
+		E:          cc.E,
+		S:          cc.S,
+		INonce:     cc.INonce,
+		CheckDigit: self.cfg.CheckDigit,
+	})
+	if nil != err {
+		return nil, wrapError(err, "failed AgentCardChallenge encoding")
+	}
+
+	parts, err := airgap.TextParts(srzacc, airgap.DefaultFragmentSize)
+	if nil != err {
+		return nil, wrapError(err, "failed AgentCardChallenge text encoding")
+	}
+	images := make([]string, 0, len(parts))
+	for _, part := range parts {
+		code, err := qrcode.Encode(part, qrcode.LevelM)
+		if nil != err {
+			return nil, wrapError(err, "failed QR encoding")
+		}
+		srzimg, err := code.PNG(qrScale)
+		if nil != err {
+			return nil, wrapError(err, "failed QR rendering")
+		}
+		images = append(images, "data:image/png;base64,"+base64.StdEncoding.EncodeToString(srzimg))
+	}
+
+	rv := LoginChallenge{
+		SessionId: cc.SessionId,
+		Qr:        parts,
+		QrImages:  images,
+		Scheme:    mtd.Scheme,
+		Size:      sch.P(),
+		Alphabet:  string(sch.Alphabet()),
+		Group:     self.cfg.Group,
+	}
+	if 0 != self.cfg.Separator {
+		rv.Separator = string(self.cfg.Separator)
+	}
+	if self.cfg.CheckDigit {
+		rv.Size += 1
+	}
+
+	return &rv, nil
+}
+
+// serveLoginSubmit validates the OTP typed by the user.
+func (self *Handler) serveLoginSubmit(w http.ResponseWriter, r *http.Request) {
+	var req LoginSubmitRequest
+	err := readJSON(w, r, &req)
+	if nil != err {
+		http.Error(w, "failed to decode json request", http.StatusBadRequest)
+		return
+	}
+	mtd, found := self.method(req.Scheme)
+	if !found {
+		http.Error(w, "unsupported scheme", http.StatusBadRequest)
+		return
+	}
+	sch, err := ephemsec.GetScheme(mtd.Scheme)
+	if nil != err {
+		http.Error(w, "unsupported scheme", http.StatusBadRequest)
+		return
+	}
+
+	// decode the typed code & remove the pad
+	alphabet := sch.Alphabet()
+	size := sch.P()
+	if self.cfg.CheckDigit {
+		size += 1
+	}
+	code := strings.Map(func(r rune) rune {
+		if ' ' == r || self.cfg.Separator == r {
+			return -1
+		}
+		return r
+	}, req.Code)
+	var digits []byte
+	if utf8.RuneCountInString(code) != size {
+		err = wrapError(ErrValidation, "invalid code length")
+	} else if self.cfg.CheckDigit {
+		digits, err = alphabet.DecodeCheck(code, 0, sch.P(), nil)
+	} else {
+		digits, err = alphabet.Decode(code, 0, sch.P(), nil)
+	}
+	if nil != err {
+		obs := observability.GetObservability(r.Context())
+		obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "malformed"))
+		writeJSON(w, http.StatusOK, LoginResult{Malformed: true})
+		return
+	}
+	pad, err := self.pad(req.SessionId, sch)
+	if nil != err {
+		http.Error(w, "failed pad derivation", http.StatusInternalServerError)
+		return
+	}
+	digits, err = airgap.RemovePad(alphabet, digits, pad, digits[:0])
+	if nil != err {
+		http.Error(w, "failed pad removal", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := self.checkOtp(r, &slp.DirectLoginRequest{
+		SessionId: req.SessionId,
+		CardId:    []byte(req.UserId),
+		Otp:       digits,
+	})
+	if errors.Is(err, errLocked) {
+		writeJSON(w, http.StatusTooManyRequests, LoginResult{})
+		return
+	}
+	if nil != err {
+		http.Error(w, "failed otp calculation", http.StatusBadRequest)
+		return
+	}
+	rv := LoginResult{Valid: res.Valid, Malformed: res.Malformed}
+	if rv.Valid && nil != self.cfg.Authenticated {
+		rv.RedirectTo, err = self.cfg.Authenticated(w, r, req.UserId)
+		if nil != err {
+			http.Error(w, "failed login completion", http.StatusInternalServerError)
+			return
+		}
+	}
+	if rv.Valid && nil != self.devices {
+		rv.DeviceToken, err = self.newDeviceToken(req.UserId)
+		if nil != err {
+			http.Error(w, "failed login completion", http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, rv)
+}
+
+// checkOtp validates dlr as slp.DirectEndpoint does.
+// It counts the invalid OTP per login and per Card, and errors wrapping errLocked if the dlr
+// login or Card submitted too many invalid OTP.
+func (self *Handler) checkOtp(r *http.Request, dlr *slp.DirectLoginRequest) (slp.DirectValidationResult, error) {
+	var rv slp.DirectValidationResult
+	obs := observability.GetObservability(r.Context())
+	now := time.Now()
+	if self.attempts.exhausted(dlr.SessionId, now) || self.cards.exhausted(dlr.CardId, now) {
+		obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "locked"))
+		return rv, wrapError(errLocked, "too many invalid OTP")
+	}
+	digits, err := dlr.OtpDigits(self.cfg.Factory)
+	var otp []byte
+	cr := slp.CardChalResponse{SessionId: dlr.SessionId, CardId: dlr.CardId, E: dlr.E}
+	if nil == err {
+		cr.SyncHint = digits[len(digits)-1] // len(digits) > 0 enforced by dlr.Check & OtpDigits
+		otp, err = self.cfg.Factory.GetServerOtp(r.Context(), &cr, nil)
+	}
+	malformed := errors.Is(err, slp.ErrMalformedOtp) || (nil == err && len(otp) != len(digits))
+	if nil != err && !malformed {
+		obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", "error"))
+		return rv, wrapError(err, "failed GetServerOtp")
+	}
+	outcome := "malformed"
+	switch {
+	case malformed:
+		rv.Malformed = true
+	case 1 == subtle.ConstantTimeCompare(otp, digits):
+		rv.Valid = true
+		outcome = "valid"
+		self.cards.reset(dlr.CardId)
+		slp.RecordCardUse(r.Context(), self.cfg.Factory, &cr)
+	default:
+		outcome = "invalid"
+		self.attempts.failed(dlr.SessionId, now)
+		self.cards.failed(dlr.CardId, now)
+	}
+	obs.Add(observability.MetricOtpValidations, 1, slog.String("outcome", outcome))
+
+	return rv, nil
+}
+
+// pad returns the OtpPad of the session sid.
+// The CardApp applies the pad to the OTP digits, see airgap.ApplyPad.
+// Pad digits are uniformly distributed, they are sampled by rejecting the HKDF output bytes that
+// are not below the largest multiple of the Scheme base.
+func (self *Handler) pad(sid []byte, sch *ephemsec.Scheme) ([]byte, error) {
+	prk, err := hkdf.Extract(sha256.New, self.padKey, sid)
+	if nil != err {
+		return nil, wrapError(err, "failed pad derivation")
+	}
+	b := sch.B()
+	limit := 256 - 256%b
+	pad := make([]byte, 0, sch.P())
+	for block := 0; len(pad) < sch.P(); block++ {
+		buf, err := hkdf.Expand(sha256.New, prk, padInfo+" "+strconv.Itoa(block), 2*sch.P())
+		if nil != err {
+			return nil, wrapError(err, "failed pad derivation")
+		}
+		for _, v := range buf {
+			if int(v) >= limit {
+				continue
+			}
+			pad = append(pad, byte(int(v)%b))
+			if len(pad) == sch.P() {
+				break
+			}
+		}
+	}
+
+	return pad, nil
+}
+
+// submitAttempts counts the invalid OTP submitted per key, a login SLP session id or a CardId.
+type submitAttempts struct {
+	mut       sync.Mutex
+	max       int
+	lifetime  time.Duration
+	counts    map[string]*submitCount
+	lastSweep time.Time
+}
+
+type submitCount struct {
+	count  int
+	expiry time.Time
+}
+
+func newSubmitAttempts(max int, lifetime time.Duration) *submitAttempts {
+	return &submitAttempts{max: max, lifetime: lifetime, counts: make(map[string]*submitCount)}
+}
+
+// exhausted returns true if max invalid OTP were submitted for key.
+func (self *submitAttempts) exhausted(key []byte, now time.Time) bool {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	sc, found := self.counts[string(key)]
+	return found && !now.After(sc.expiry) && sc.count >= self.max
+}
+
+// failed counts an invalid OTP submitted for key.
+func (self *submitAttempts) failed(key []byte, now time.Time) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	if now.Sub(self.lastSweep) >= self.lifetime {
+		maps.DeleteFunc(self.counts, func(_ string, sc *submitCount) bool { return now.After(sc.expiry) })
+		self.lastSweep = now
+	}
+	sc, found := self.counts[string(key)]
+	if !found || now.After(sc.expiry) {
+		sc = &submitCount{expiry: now.Add(self.lifetime)}
+		self.counts[string(key)] = sc
+	}
+	sc.count += 1
+}
+
+// reset forgets the invalid OTP submitted for key.
+func (self *submitAttempts) reset(key []byte) {
+	self.mut.Lock()
+	defer self.mut.Unlock()
+
+	delete(self.counts, string(key))
+}
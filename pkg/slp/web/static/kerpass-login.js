@@ -0,0 +1,111 @@
+// KerPass reference login agent.
+//
+// The login state machine runs idle -> challenge -> code -> done, and returns to idle when
+// the challenge expires or when the user fails entering the code.
+// Endpoints urls are relative to the login page url.
+"use strict";
+
+var KerPass = (function () {
+  var States = Object.freeze({ IDLE: "idle", CHALLENGE: "challenge", CODE: "code", DONE: "done" });
+
+  async function postJSON(url, body) {
+    var resp = await fetch(url, {
+      method: "POST",
+      headers: { "Content-Type": "application/json", "Accept": "application/json" },
+      body: JSON.stringify(body),
+      credentials: "same-origin",
+    });
+    if (!resp.ok) {
+      throw new Error(url + " failed with status " + resp.status);
+    }
+    return resp.json();
+  }
+
+  // renderQr displays the challenge QR code images in elem, looping over the frames of an
+  // animated QR code. It returns a function that stops the animation.
+  function renderQr(elem, images, frameMs) {
+    var img = elem.querySelector("img") || elem.appendChild(document.createElement("img"));
+    img.alt = "KerPass challenge";
+    var frame = 0;
+    img.src = images[0];
+    if (images.length < 2) {
+      return function () {};
+    }
+    var timer = setInterval(function () {
+      frame = (frame + 1) % images.length;
+      img.src = images[frame];
+    }, frameMs || 250);
+    return function () { clearInterval(timer); };
+  }
+
+  // login binds the state machine to form.
+  // form holds a "user" & a "code" input, and the kp-qr, kp-code-row & kp-status elements.
+  function login(form, opts) {
+    opts = Object.assign({ renderQr: renderQr, scheme: 0 }, opts || {});
+    var qr = form.querySelector("#kp-qr");
+    var codeRow = form.querySelector("#kp-code-row");
+    var status = form.querySelector("#kp-status");
+    var machine = { state: States.IDLE, chal: null, stopQr: null };
+
+    function transition(state, msg) {
+      machine.state = state;
+      if (States.CODE !== state && machine.stopQr) {
+        machine.stopQr();
+        machine.stopQr = null;
+      }
+      qr.hidden = codeRow.hidden = (States.CODE !== state);
+      form.elements.user.readOnly = (States.IDLE !== state);
+      status.textContent = msg || "";
+    }
+
+    async function start() {
+      transition(States.CHALLENGE, "Requesting challenge...");
+      var scheme = opts.scheme;
+      if (!scheme) {
+        var aar = await fetch("app-auth-request").then(function (r) { return r.json(); });
+        scheme = aar.methods[0].scheme;
+      }
+      machine.chal = await postJSON("login-start", { scheme: scheme });
+      machine.stopQr = opts.renderQr(qr, machine.chal.qrImages);
+      form.elements.code.maxLength = machine.chal.size + 8;
+      form.elements.code.value = "";
+      transition(States.CODE, "Scan the QR code with your KerPass app and type the displayed code.");
+      form.elements.code.focus();
+    }
+
+    async function submit() {
+      var res = await postJSON("login-submit", {
+        sId: machine.chal.sId,
+        scheme: machine.chal.scheme,
+        uId: form.elements.user.value,
+        code: form.elements.code.value,
+      });
+      if (res.malformed) {
+        // typing mistake, the challenge remains usable
+        transition(States.CODE, "The code is mistyped, please check it.");
+        return;
+      }
+      if (!res.valid) {
+        transition(States.IDLE, "Login failed.");
+        return;
+      }
+      transition(States.DONE, "Logged in.");
+      if (res.redirectTo) {
+        window.location.assign(res.redirectTo);
+      }
+    }
+
+    form.addEventListener("submit", function (evt) {
+      evt.preventDefault();
+      var step = (States.CODE === machine.state) ? submit : start;
+      step().catch(function (err) {
+        transition(States.IDLE, err.message);
+      });
+    });
+    transition(States.IDLE);
+
+    return machine;
+  }
+
+  return { login: login, renderQr: renderQr, States: States };
+})();
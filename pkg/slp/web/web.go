@@ -0,0 +1,313 @@
+// Package web allows web applications to add KerPass login without writing a CardAgent.
+//
+// The Handler serves JSON equivalents of the CTAP2-CBOR SLP endpoints, and a login flow where
+// the browser acts as CardAgent: the login page obtains an airgap.AgentCardChallenge that it
+// renders as a QR code, the user scans it with the CardApp and types the displayed OTP.
+// A reference login page & JavaScript agent are embedded in the package.
+//
+// The typed OTP is masked with the AgentCardChallenge OtpPad, the pad is derived from the
+// session id using the Config PadKey. The Handler only keeps the counts of invalid OTP submitted
+// per login and per Card, which it limits to maxSubmitAttempts and maxCardFailures. These limits
+// also apply to the JSON SlpDirect endpoint.
+//
+// If the Config PadKey is empty, each Handler generates a random one: a login started on a
+// Handler then fails on another, and load balanced Handler instances shall share a PadKey.
+//
+// If the Config has a Repo, a successful login also opens a device session that allows the user
+// to list & revoke its enrolled Cards, see DeviceList & RevokeDeviceRequest.
+package web
+
+import (
+	"crypto/rand"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"slices"
+	"time"
+
+	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/ephemsec"
+	"code.kerpass.org/golang/pkg/slp"
+)
+
+const (
+	// Handler endpoints paths
+	// Handler is intended to be mounted using http.StripPrefix, the login page uses relative urls
+	PathAppAuthRequest = "/app-auth-request"
+	PathGetCardChal    = "/get-card-chal"
+	PathDirectLogin    = "/slp-direct"
+	PathLoginStart     = "/login-start"
+	PathLoginSubmit    = "/login-submit"
+	PathLoginPage      = "/login"
+	PathLoginScript    = "/kerpass-login.js"
+	PathDevices        = "/devices"
+	PathRevokeDevice   = "/devices/revoke"
+
+	maxJSONRequestSize = 1024
+	padKeySize         = 32
+)
+
+//go:embed static
+var static embed.FS
+
+// Assets holds the reference login page & JavaScript agent.
+var Assets, _ = fs.Sub(static, "static")
+
+// AuthenticatedFunc is called by the Handler after a successful login.
+// It allows the web application to open its session, eg setting a cookie on w.
+// It returns the url where the login page redirects the browser.
+type AuthenticatedFunc func(w http.ResponseWriter, r *http.Request, userId string) (redirectTo string, err error)
+
+// Config holds the Handler configuration.
+type Config struct {
+	// Realm of the Cards that authenticate with the web application
+	RealmId [32]byte
+
+	// SLP get-card-chal url, forwarded in slp.AppAuthRequest
+	AuthServerGetChalUrl string
+
+	// AppContextUrl shall match the Factory AuthContext of the login Methods
+	AppContextUrl string
+
+	// SlpDirect methods used by the login page
+	// Scheme shall generate OTP using E1S1 or E1S2 key exchange
+	Methods []slp.AuthMethod
+
+	// Separator groups the OTP characters, Group characters per group
+	Separator rune
+	Group     int
+
+	// CheckDigit is true if the CardApp shall append an Alphabet CheckDigit to the OTP
+	CheckDigit bool
+
+	Factory slp.ChallengeFactory
+
+	// Authenticated is optional
+	Authenticated AuthenticatedFunc
+
+	// Repo is optional, it enables the device management endpoints
+	Repo credentials.ServerCredStore
+
+	// Hasher derives the Card IdToken of the login UserId, it is required if Repo is set
+	// and shall use the same seed as the Repo
+	Hasher *credentials.IdHasher
+
+	// DeviceSessionLifetime is the validity of the LoginResult DeviceToken,
+	// 0 for DefaultDeviceSessionLifetime
+	DeviceSessionLifetime time.Duration
+
+	// PadKey derives the OtpPad of the logins, it is at least 32 bytes.
+	// PadKey is optional, if empty the Handler uses a random PadKey. Handler instances that
+	// serve the same logins, eg behind a load balancer, shall be configured with the same PadKey.
+	PadKey []byte
+}
+
+// Check returns an error if the Config is invalid.
+func (self *Config) Check() error {
+	if nil == self {
+		return wrapError(ErrValidation, "nil Config")
+	}
+	if 0 == len(self.AuthServerGetChalUrl) {
+		return wrapError(ErrValidation, "empty AuthServerGetChalUrl")
+	}
+	if 0 == len(self.AppContextUrl) {
+		return wrapError(ErrValidation, "empty AppContextUrl")
+	}
+	if 0 == len(self.Methods) {
+		return wrapError(ErrValidation, "empty Methods")
+	}
+	for pos, mtd := range self.Methods {
+		err := mtd.Check()
+		if nil != err {
+			return wrapError(err, "invalid Methods[%d]", pos)
+		}
+		if slp.SlpDirect != mtd.Protocol {
+			return wrapError(ErrValidation, "unsupported Methods[%d] protocol", pos)
+		}
+		sch, err := ephemsec.GetScheme(mtd.Scheme)
+		if nil != err {
+			return wrapError(err, "failed loading Methods[%d] scheme", pos)
+		}
+		if ephemsec.NullAlphabet == sch.Alphabet() || nil != sch.Kem() {
+			return wrapError(ErrValidation, "unsupported Methods[%d] scheme, not an OTP scheme", pos)
+		}
+		switch sch.KeyExchangePattern() {
+		case "E1S1", "E1S2":
+		default:
+			return wrapError(ErrValidation, "unsupported Methods[%d] scheme key exchange", pos)
+		}
+	}
+	if self.Group < 0 {
+		return wrapError(ErrValidation, "negative Group")
+	}
+	if nil == self.Factory {
+		return wrapError(ErrValidation, "nil Factory")
+	}
+	if nil != self.Repo && nil == self.Hasher {
+		return wrapError(ErrValidation, "nil Hasher")
+	}
+	if self.DeviceSessionLifetime < 0 {
+		return wrapError(ErrValidation, "negative DeviceSessionLifetime")
+	}
+	if 0 != len(self.PadKey) && len(self.PadKey) < padKeySize {
+		return wrapError(ErrValidation, "PadKey shorter than %d bytes", padKeySize)
+	}
+
+	return nil
+}
+
+// Handler serves the JSON SLP endpoints, the login flow endpoints, the reference login page
+// and optionally the device management endpoints.
+// It implements http.Handler.
+//
+// The Handler padKey is the Config PadKey, or a random key generated by NewHandler if the Config
+// has no PadKey; in the latter case logins only succeed on the Handler that started them.
+type Handler struct {
+	cfg      Config
+	padKey   []byte
+	attempts *submitAttempts // invalid OTP per login
+	cards    *submitAttempts // invalid OTP per Card
+	devices  *devices        // nil if the Config has no Repo
+	mux      *http.ServeMux
+}
+
+// NewHandler returns a Handler configured with cfg.
+// It errors if cfg is invalid.
+func NewHandler(cfg Config) (*Handler, error) {
+	err := cfg.Check()
+	if nil != err {
+		return nil, wrapError(err, "invalid Config")
+	}
+	rv := &Handler{
+		cfg:      cfg,
+		padKey:   cfg.PadKey,
+		attempts: newSubmitAttempts(maxSubmitAttempts, submitAttemptsLifetime),
+		cards:    newSubmitAttempts(maxCardFailures, cardFailuresWindow),
+	}
+	if 0 == len(rv.padKey) {
+		rv.padKey = make([]byte, padKeySize)
+		rand.Read(rv.padKey)
+	}
+
+	rv.mux = http.NewServeMux()
+	rv.mux.HandleFunc("GET "+PathAppAuthRequest, rv.serveAppAuthRequest)
+	rv.mux.HandleFunc("POST "+PathGetCardChal, rv.serveGetCardChal)
+	rv.mux.HandleFunc("POST "+PathDirectLogin, rv.serveDirectLogin)
+	rv.mux.HandleFunc("POST "+PathLoginStart, rv.serveLoginStart)
+	rv.mux.HandleFunc("POST "+PathLoginSubmit, rv.serveLoginSubmit)
+	rv.mux.HandleFunc("GET "+PathLoginPage, serveAsset("login.html"))
+	rv.mux.HandleFunc("GET "+PathLoginScript, serveAsset("kerpass-login.js"))
+
+	if nil != cfg.Repo {
+		rv.devices, err = newDevices(cfg.DeviceSessionLifetime)
+		if nil != err {
+			return nil, wrapError(err, "failed device sessions initialization")
+		}
+		rv.mux.HandleFunc("GET "+PathDevices, rv.serveListDevices)
+		rv.mux.HandleFunc("POST "+PathRevokeDevice, rv.serveRevokeDevice)
+	}
+
+	return rv, nil
+}
+
+// ServeHTTP dispatches r to the Handler endpoints.
+func (self *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.mux.ServeHTTP(w, r)
+}
+
+// serveAppAuthRequest returns the JSON slp.AppAuthRequest of the login Methods.
+func (self *Handler) serveAppAuthRequest(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, slp.AppAuthRequest{
+		RealmId:              self.cfg.RealmId[:],
+		AuthServerGetChalUrl: self.cfg.AuthServerGetChalUrl,
+		AllowedMethods:       self.cfg.Methods,
+	})
+}
+
+// serveGetCardChal is the JSON equivalent of slp.CardChallengeEndpoint.
+func (self *Handler) serveGetCardChal(w http.ResponseWriter, r *http.Request) {
+	var req slp.CardChallengeRequest
+	err := readJSON(w, r, &req)
+	if nil != err {
+		http.Error(w, "failed to decode json request", http.StatusBadRequest)
+		return
+	}
+	var cc slp.CardChallenge
+	err = self.cfg.Factory.GetCardChallenge(r.Context(), &req, &cc)
+	if nil != err {
+		http.Error(w, "failed to generate challenge", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, &cc)
+}
+
+// serveDirectLogin is the JSON equivalent of slp.DirectEndpoint.
+func (self *Handler) serveDirectLogin(w http.ResponseWriter, r *http.Request) {
+	var dlr slp.DirectLoginRequest
+	err := readJSON(w, r, &dlr)
+	if nil != err {
+		http.Error(w, "failed to decode json request", http.StatusBadRequest)
+		return
+	}
+	res, err := self.checkOtp(r, &dlr)
+	if errors.Is(err, errLocked) {
+		writeJSON(w, http.StatusTooManyRequests, &slp.DirectValidationResult{})
+		return
+	}
+	if nil != err {
+		http.Error(w, "failed otp calculation", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, &res)
+}
+
+// checker is implemented by the SLP messages.
+type checker interface {
+	Check() error
+}
+
+// readJSON decodes r JSON body in dst and validates it.
+func readJSON(w http.ResponseWriter, r *http.Request, dst checker) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONRequestSize)
+	body, err := io.ReadAll(r.Body)
+	if nil != err {
+		return wrapError(err, "failed to read request body")
+	}
+	err = json.Unmarshal(body, dst)
+	if nil != err {
+		return wrapError(err, "failed json decoding")
+	}
+
+	return wrapError(dst.Check(), "failed request validation")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if nil != err {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// serveAsset returns an http.HandlerFunc that serves the Assets file name.
+func serveAsset(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, Assets, name)
+	}
+}
+
+// method returns the configured login method that uses scheme.
+func (self *Handler) method(scheme uint16) (slp.AuthMethod, bool) {
+	idx := slices.IndexFunc(self.cfg.Methods, func(m slp.AuthMethod) bool { return m.Scheme == scheme })
+	if idx < 0 {
+		return slp.AuthMethod{}, false
+	}
+	return self.cfg.Methods[idx], true
+}
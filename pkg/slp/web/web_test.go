@@ -0,0 +1,584 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"code.kerpass.org/golang/pkg/airgap"
+	"code.kerpass.org/golang/pkg/credentials"
+	"code.kerpass.org/golang/pkg/ephemsec"
+	"code.kerpass.org/golang/pkg/slp"
+)
+
+const testAppUrl = "https://demo.kerpass.org/kp/login"
+
+var testSchemes = []uint16{ephemsec.SHA512_X25519_E1S1_T600B10P8, ephemsec.SHA512_X25519_E1S2_T600B32P9}
+
+func TestLoginFlow(t *testing.T) {
+	st := newStage(t)
+	for _, schref := range testSchemes {
+		sch, err := ephemsec.GetScheme(schref)
+		if nil != err {
+			t.Fatalf("failed loading scheme, got error %v", err)
+		}
+		t.Run(sch.Name(), func(t *testing.T) {
+			var lc LoginChallenge
+			st.postJSON(t, PathLoginStart, LoginStartRequest{Scheme: schref}, &lc)
+			if sch.P()+1 != lc.Size || string(sch.Alphabet()) != lc.Alphabet {
+				t.Fatalf("failed LoginChallenge control, got %+v", lc)
+			}
+			digits := st.cardApp(t, &lc)
+			alphabet := sch.Alphabet()
+
+			testcases := []struct {
+				name     string
+				user     string
+				digits   []byte
+				mistype  bool
+				expected LoginResult
+			}{
+				{name: "mistyped", user: "alice", digits: digits, mistype: true, expected: LoginResult{Malformed: true}},
+				{name: "wrong code", user: "alice", digits: alter(digits, sch.B()), expected: LoginResult{}},
+				{name: "valid", user: "alice", digits: digits, expected: LoginResult{Valid: true, RedirectTo: "/home"}},
+			}
+			for _, tc := range testcases {
+				code, err := alphabet.FormatCheck(tc.digits, 3, '-')
+				if nil != err {
+					t.Fatalf("%s: failed FormatCheck, got error %v", tc.name, err)
+				}
+				if tc.mistype {
+					// swap the 1st character for a different one
+					runes := []rune(code)
+					runes[0] = []rune(alphabet)[(strings.IndexRune(string(alphabet), runes[0])+1)%alphabet.Size()]
+					code = string(runes)
+				}
+				var res LoginResult
+				st.postJSON(t, PathLoginSubmit, LoginSubmitRequest{SessionId: lc.SessionId, Scheme: schref, UserId: tc.user, Code: code}, &res)
+				if res.Valid == ("" == res.DeviceToken) {
+					t.Errorf("%s: failed DeviceToken control, got %+v", tc.name, res)
+				}
+				res.DeviceToken = ""
+				if tc.expected != res {
+					t.Errorf("%s: failed LoginResult control, got %+v", tc.name, res)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginSubmitAttempts(t *testing.T) {
+	st := newStage(t)
+	schref := testSchemes[0]
+	sch, err := ephemsec.GetScheme(schref)
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	var lc LoginChallenge
+	st.postJSON(t, PathLoginStart, LoginStartRequest{Scheme: schref}, &lc)
+	digits := st.cardApp(t, &lc)
+	submit := func(digits []byte) (int, LoginResult) {
+		code, err := sch.Alphabet().FormatCheck(digits, 3, '-')
+		if nil != err {
+			t.Fatalf("failed FormatCheck, got error %v", err)
+		}
+		srzreq, _ := json.Marshal(LoginSubmitRequest{SessionId: lc.SessionId, Scheme: schref, UserId: "alice", Code: code})
+		resp, err := http.Post(st.server.URL+PathLoginSubmit, "application/json", bytes.NewReader(srzreq))
+		if nil != err {
+			t.Fatalf("failed POST %s, got error %v", PathLoginSubmit, err)
+		}
+		defer resp.Body.Close()
+		var res LoginResult
+		json.NewDecoder(resp.Body).Decode(&res)
+		return resp.StatusCode, res
+	}
+
+	for i := range maxSubmitAttempts {
+		status, res := submit(alter(digits, sch.B()))
+		if http.StatusOK != status || res.Valid {
+			t.Fatalf("#%d: failed invalid submit control, got status %d", i, status)
+		}
+	}
+	status, res := submit(digits)
+	if http.StatusTooManyRequests != status || res.Valid {
+		t.Fatalf("failed exhausted login control, got status %d", status)
+	}
+}
+
+func TestHandlerPad(t *testing.T) {
+	sch, err := ephemsec.GetScheme(ephemsec.SHA512_X25519_E1S1_T600B10P8)
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	padKey := make([]byte, 32)
+	rand.Read(padKey)
+	sid := []byte("session-id")
+	var pads [][]byte
+	for _, key := range [][]byte{padKey, padKey, nil} {
+		hdlr := &Handler{padKey: key}
+		if nil == key {
+			hdlr.padKey = make([]byte, 32)
+			rand.Read(hdlr.padKey)
+		}
+		pad, err := hdlr.pad(sid, sch)
+		if nil != err {
+			t.Fatalf("failed pad, got error %v", err)
+		}
+		if sch.P() != len(pad) {
+			t.Fatalf("failed pad size control, got %d", len(pad))
+		}
+		for _, v := range pad {
+			if int(v) >= sch.B() {
+				t.Fatalf("failed pad digit control, got %d", v)
+			}
+		}
+		pads = append(pads, pad)
+	}
+	// Handlers sharing a PadKey derive the same pads
+	if !bytes.Equal(pads[0], pads[1]) || bytes.Equal(pads[0], pads[2]) {
+		t.Fatalf("failed PadKey control, got %v", pads)
+	}
+}
+
+func TestJSONEndpoints(t *testing.T) {
+	st := newStage(t)
+
+	var aar slp.AppAuthRequest
+	resp, err := http.Get(st.server.URL + PathAppAuthRequest)
+	if nil != err {
+		t.Fatalf("failed GET app-auth-request, got error %v", err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&aar)
+	resp.Body.Close()
+	if nil != err || nil != aar.Check() {
+		t.Fatalf("failed AppAuthRequest control, got error %v", err)
+	}
+
+	// E1S1 scheme CardChallenge has no S key
+	ccr := slp.CardChallengeRequest{RealmId: aar.RealmId, SelectedMethod: aar.AllowedMethods[0], AppContextUrl: testAppUrl}
+	var cc slp.CardChallenge
+	st.postJSON(t, PathGetCardChal, &ccr, &cc)
+	if nil != cc.Check() {
+		t.Fatalf("failed CardChallenge Check, got error %v", cc.Check())
+	}
+
+	// calculate the otp as a CardAgent
+	sch, _ := ephemsec.GetScheme(ccr.SelectedMethod.Scheme)
+	aac := slp.AgentAuthContext{
+		SelectedProtocol:     slp.SlpDirect,
+		SessionId:            cc.SessionId,
+		AppContextUrl:        testAppUrl,
+		AuthServerGetChalUrl: aar.AuthServerGetChalUrl,
+		AuthServerLoginUrl:   cc.AuthServerLoginUrl,
+		AppStartUrl:          cc.AppStartUrl,
+	}
+	ach, err := aac.Sum(nil)
+	if nil != err {
+		t.Fatalf("failed hashing AgentAuthContext, got error %v", err)
+	}
+	ach, err = slp.EphemSecContextHash(aar.RealmId, ach, nil)
+	if nil != err {
+		t.Fatalf("failed ephemsec context hashing, got error %v", err)
+	}
+	eps := ephemsec.State{
+		Context:        ach,
+		Nonce:          cc.INonce,
+		StaticKey:      st.card.Kh.PrivateKey,
+		RemoteEphemKey: cc.E.PublicKey,
+		Psk:            st.card.Psk,
+	}
+	otp, err := eps.EPHEMSEC(sch, ephemsec.Responder, nil)
+	if nil != err {
+		t.Fatalf("failed client OTP calculation, got error %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		otp      []byte
+		expected slp.DirectValidationResult
+	}{
+		{name: "malformed", otp: otp[1:], expected: slp.DirectValidationResult{Malformed: true}},
+		{name: "invalid", otp: alter(otp, sch.B()), expected: slp.DirectValidationResult{}},
+		{name: "valid", otp: otp, expected: slp.DirectValidationResult{Valid: true}},
+	} {
+		var res slp.DirectValidationResult
+		st.postJSON(t, PathDirectLogin, &slp.DirectLoginRequest{SessionId: cc.SessionId, CardId: []byte("alice"), Otp: tc.otp}, &res)
+		if tc.expected != res {
+			t.Errorf("%s: failed DirectValidationResult control, got %+v", tc.name, res)
+		}
+	}
+
+	// the login is locked after maxSubmitAttempts invalid OTP
+	dlr := slp.DirectLoginRequest{SessionId: cc.SessionId, CardId: []byte("alice"), Otp: alter(otp, sch.B())}
+	for i := 1; i < maxSubmitAttempts; i++ {
+		if status := st.postStatus(t, PathDirectLogin, &dlr); http.StatusOK != status {
+			t.Fatalf("#%d: failed invalid direct login control, got status %d", i, status)
+		}
+	}
+	dlr.Otp = otp
+	if status := st.postStatus(t, PathDirectLogin, &dlr); http.StatusTooManyRequests != status {
+		t.Errorf("failed exhausted direct login control, got status %d", status)
+	}
+}
+
+func TestCardLockout(t *testing.T) {
+	st := newStage(t)
+	schref := testSchemes[0]
+	sch, err := ephemsec.GetScheme(schref)
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	submit := func(invalid bool) int {
+		var lc LoginChallenge
+		st.postJSON(t, PathLoginStart, LoginStartRequest{Scheme: schref}, &lc)
+		digits := st.cardApp(t, &lc)
+		if invalid {
+			digits = alter(digits, sch.B())
+		}
+		code, err := sch.Alphabet().FormatCheck(digits, 3, '-')
+		if nil != err {
+			t.Fatalf("failed FormatCheck, got error %v", err)
+		}
+		return st.postStatus(t, PathLoginSubmit, LoginSubmitRequest{SessionId: lc.SessionId, Scheme: schref, UserId: "alice", Code: code})
+	}
+
+	// the invalid OTP submitted with new logins count against the Card
+	for i := range maxCardFailures {
+		if status := submit(true); http.StatusOK != status {
+			t.Fatalf("#%d: failed invalid submit control, got status %d", i, status)
+		}
+	}
+	if status := submit(false); http.StatusTooManyRequests != status {
+		t.Errorf("failed locked card control, got status %d", status)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	st := newStage(t)
+	res := st.login(t, "alice")
+	if !res.Valid || "" == res.DeviceToken {
+		t.Fatalf("failed login, got %+v", res)
+	}
+	err := st.uses.Flush(context.Background())
+	if nil != err {
+		t.Fatalf("failed card uses Flush, got error %v", err)
+	}
+
+	// device endpoints require a DeviceToken
+	for _, tkn := range []string{"", "invalid", res.DeviceToken[1:]} {
+		status, _ := st.devicesRequest(t, tkn, http.MethodGet, PathDevices, "", nil, "application/json")
+		if http.StatusUnauthorized != status {
+			t.Errorf("failed invalid token %q control, got status %d", tkn, status)
+		}
+	}
+
+	var devs DeviceList
+	for _, accept := range []string{"application/json", "application/cbor"} {
+		status, body := st.devicesRequest(t, res.DeviceToken, http.MethodGet, PathDevices, "", nil, accept)
+		if http.StatusOK != status {
+			t.Fatalf("failed GET %s, got status %d", PathDevices, status)
+		}
+		devs = DeviceList{}
+		if "application/cbor" == accept {
+			err = cbor.Unmarshal(body, &devs)
+		} else {
+			err = json.Unmarshal(body, &devs)
+		}
+		if nil != err {
+			t.Fatalf("failed decoding %s DeviceList, got error %v", accept, err)
+		}
+		if 1 != len(devs.Devices) || "alice phone" != devs.Devices[0].Label || devs.Devices[0].CreatedAt.IsZero() ||
+			devs.Devices[0].LastUsed.IsZero() {
+			t.Fatalf("failed %s DeviceList control, got %+v", accept, devs)
+		}
+	}
+
+	// unknown card can not be revoked
+	other := RevokeDeviceRequest{CardId: make([]byte, 32)}
+	srzreq, _ := json.Marshal(other)
+	status, _ := st.devicesRequest(t, res.DeviceToken, http.MethodPost, PathRevokeDevice, "application/json", srzreq, "")
+	if http.StatusNotFound != status {
+		t.Errorf("failed unknown card revocation control, got status %d", status)
+	}
+
+	srzreq, err = cbor.Marshal(RevokeDeviceRequest{CardId: devs.Devices[0].CardId})
+	if nil != err {
+		t.Fatalf("failed encoding RevokeDeviceRequest, got error %v", err)
+	}
+	status, _ = st.devicesRequest(t, res.DeviceToken, http.MethodPost, PathRevokeDevice, "application/cbor", srzreq, "")
+	if http.StatusNoContent != status {
+		t.Fatalf("failed POST %s, got status %d", PathRevokeDevice, status)
+	}
+	count, _ := st.scs.CardCount(context.Background())
+	if 0 != count {
+		t.Errorf("failed card removal control, got %d cards", count)
+	}
+	status, body := st.devicesRequest(t, res.DeviceToken, http.MethodGet, PathDevices, "", nil, "")
+	if http.StatusOK != status || `{"devices":[]}` != string(body) {
+		t.Errorf("failed empty DeviceList control, got status %d [%s]", status, body)
+	}
+}
+
+func TestAssets(t *testing.T) {
+	st := newStage(t)
+	for _, pth := range []string{PathLoginPage, PathLoginScript} {
+		resp, err := http.Get(st.server.URL + pth)
+		if nil != err {
+			t.Fatalf("failed GET %s, got error %v", pth, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if http.StatusOK != resp.StatusCode || !bytes.Contains(body, []byte("KerPass")) {
+			t.Errorf("failed %s control, got status %d", pth, resp.StatusCode)
+		}
+	}
+}
+
+type stage struct {
+	card   *credentials.Card
+	sk     *ecdh.PublicKey
+	scs    *credentials.MemServerCredStore
+	uses   *credentials.CardUseRecorder
+	server *httptest.Server
+}
+
+func newStage(t *testing.T) *stage {
+	ctx := context.Background()
+	curve := ecdh.X25519()
+
+	// register Realm, Realm static key & alice Card
+	scs, err := credentials.NewMemServerCredStore()
+	if nil != err {
+		t.Fatalf("failed instantiating scs, got error %v", err)
+	}
+	realmId := [32]byte{1, 2, 3, 4}
+	err = scs.SaveRealm(ctx, &credentials.Realm{RealmId: realmId[:], AppName: "Demo"})
+	if nil != err {
+		t.Fatalf("failed saving realm, got error %v", err)
+	}
+	kst := credentials.NewMemKeyStore()
+	sk := credentials.ServerKey{RealmId: realmId[:], Certificate: []byte("TBD")}
+	sk.Kh.PrivateKey, err = curve.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating realm static key, got error %v", err)
+	}
+	cc := credentials.Card{RealmId: realmId[:], UserId: "alice", Psk: make([]byte, 32)}
+	rand.Read(cc.Psk)
+	cc.Kh.PrivateKey, err = curve.GenerateKey(rand.Reader)
+	if nil != err {
+		t.Fatalf("failed generating card key, got error %v", err)
+	}
+	sc := credentials.ServerCard{RealmId: realmId[:], Psk: cc.Psk, Label: "alice phone"}
+	sc.Kh.PublicKey = cc.Kh.PrivateKey.PublicKey()
+	err = scs.SaveCard(ctx, credentials.OtpId{Realm: realmId[:], Username: cc.UserId}, &sc)
+	if nil != err {
+		t.Fatalf("failed saving server card, got error %v", err)
+	}
+
+	// ChallengeFactory
+	var acs []slp.AuthContext
+	var methods []slp.AuthMethod
+	for _, schref := range testSchemes {
+		sch, err := ephemsec.GetScheme(schref)
+		if nil != err {
+			t.Fatalf("failed loading scheme, got error %v", err)
+		}
+		err = kst.SaveServerKey(ctx, sch.Name(), sk)
+		if nil != err {
+			t.Fatalf("failed saving realm static key, got error %v", err)
+		}
+		mtd := slp.AuthMethod{Protocol: slp.SlpDirect, Scheme: schref}
+		methods = append(methods, mtd)
+		acs = append(acs, slp.AuthContext{
+			RealmId:              realmId,
+			AuthMethod:           mtd,
+			AppContextUrl:        testAppUrl,
+			AuthServerGetChalUrl: "https://demo.kerpass.org/kp/get-card-chal",
+			AuthServerLoginUrl:   "https://demo.kerpass.org/kp/login-submit",
+			AppStartUrl:          "https://demo.kerpass.org",
+		})
+	}
+	chf, err := slp.NewChallengeFactoryImpl(5*time.Minute, kst, scs, acs)
+	if nil != err {
+		t.Fatalf("failed ChallengeFactory creation, got error %v", err)
+	}
+	idh, err := credentials.NewIdHasher(nil)
+	if nil != err {
+		t.Fatalf("failed IdHasher creation, got error %v", err)
+	}
+	chf.Uses, err = credentials.NewCardUseRecorder(scs, idh, time.Hour, 0)
+	if nil != err {
+		t.Fatalf("failed CardUseRecorder creation, got error %v", err)
+	}
+
+	hdlr, err := NewHandler(Config{
+		RealmId:              realmId,
+		AuthServerGetChalUrl: "https://demo.kerpass.org/kp/get-card-chal",
+		AppContextUrl:        testAppUrl,
+		Methods:              methods,
+		Separator:            '-',
+		Group:                3,
+		CheckDigit:           true,
+		Factory:              chf,
+		Authenticated: func(w http.ResponseWriter, r *http.Request, userId string) (string, error) {
+			return "/home", nil
+		},
+		Repo:   scs,
+		Hasher: idh,
+	})
+	if nil != err {
+		t.Fatalf("failed NewHandler, got error %v", err)
+	}
+	srv := httptest.NewServer(hdlr)
+	t.Cleanup(srv.Close)
+
+	return &stage{card: &cc, sk: sk.Kh.PrivateKey.PublicKey(), scs: scs, uses: chf.Uses, server: srv}
+}
+
+func (self *stage) postJSON(t *testing.T, pth string, req any, dst any) {
+	srzreq, err := json.Marshal(req)
+	if nil != err {
+		t.Fatalf("failed encoding %s request, got error %v", pth, err)
+	}
+	resp, err := http.Post(self.server.URL+pth, "application/json", bytes.NewReader(srzreq))
+	if nil != err {
+		t.Fatalf("failed POST %s, got error %v", pth, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if http.StatusOK != resp.StatusCode {
+		t.Fatalf("failed POST %s, got status %d [%s]", pth, resp.StatusCode, body)
+	}
+	err = json.Unmarshal(body, dst)
+	if nil != err {
+		t.Fatalf("failed decoding %s response, got error %v", pth, err)
+	}
+}
+
+// postStatus posts req to pth & returns the response status.
+func (self *stage) postStatus(t *testing.T, pth string, req any) int {
+	srzreq, err := json.Marshal(req)
+	if nil != err {
+		t.Fatalf("failed encoding %s request, got error %v", pth, err)
+	}
+	resp, err := http.Post(self.server.URL+pth, "application/json", bytes.NewReader(srzreq))
+	if nil != err {
+		t.Fatalf("failed POST %s, got error %v", pth, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// login performs the login flow of userId & returns the LoginResult.
+func (self *stage) login(t *testing.T, userId string) LoginResult {
+	schref := testSchemes[0]
+	sch, err := ephemsec.GetScheme(schref)
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	var lc LoginChallenge
+	self.postJSON(t, PathLoginStart, LoginStartRequest{Scheme: schref}, &lc)
+	code, err := sch.Alphabet().FormatCheck(self.cardApp(t, &lc), 3, '-')
+	if nil != err {
+		t.Fatalf("failed FormatCheck, got error %v", err)
+	}
+	var res LoginResult
+	self.postJSON(t, PathLoginSubmit, LoginSubmitRequest{SessionId: lc.SessionId, Scheme: schref, UserId: userId, Code: code}, &res)
+	return res
+}
+
+// devicesRequest sends a device management request authenticated with tkn & returns the response status & body.
+func (self *stage) devicesRequest(t *testing.T, tkn, method, pth, ctype string, body []byte, accept string) (int, []byte) {
+	req, err := http.NewRequest(method, self.server.URL+pth, bytes.NewReader(body))
+	if nil != err {
+		t.Fatalf("failed creating %s request, got error %v", pth, err)
+	}
+	if "" != tkn {
+		req.Header.Set("Authorization", "Bearer "+tkn)
+	}
+	if "" != ctype {
+		req.Header.Set("Content-Type", ctype)
+	}
+	if "" != accept {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if nil != err {
+		t.Fatalf("failed %s %s, got error %v", method, pth, err)
+	}
+	defer resp.Body.Close()
+	rv, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, rv
+}
+
+// cardApp decodes the LoginChallenge QR payload and returns the padded OTP digits.
+func (self *stage) cardApp(t *testing.T, lc *LoginChallenge) []byte {
+	if len(lc.Qr) != len(lc.QrImages) {
+		t.Fatalf("failed LoginChallenge control, got %d QrImages for %d Qr parts", len(lc.QrImages), len(lc.Qr))
+	}
+	dec := airgap.FountainDecoder{}
+	for _, text := range lc.Qr {
+		var part airgap.Part
+		err := part.UnmarshalText([]byte(text))
+		if nil != err {
+			t.Fatalf("failed decoding qr part, got error %v", err)
+		}
+		err = dec.Receive(&part)
+		if nil != err {
+			t.Fatalf("failed receiving qr part, got error %v", err)
+		}
+	}
+	srzmsg, err := dec.Message()
+	if nil != err {
+		t.Fatalf("failed decoding qr payload, got error %v", err)
+	}
+	_, msg, err := airgap.UnmarshalAgentEnvelope(srzmsg)
+	if nil != err {
+		t.Fatalf("failed UnmarshalAgentEnvelope, got error %v", err)
+	}
+	acc, ok := msg.(*airgap.AgentCardChallenge)
+	if !ok {
+		t.Fatalf("failed AgentMsg type control, got %T", msg)
+	}
+	if !acc.CheckDigit {
+		t.Fatalf("failed AgentCardChallenge control, CheckDigit not requested")
+	}
+	sch, err := ephemsec.GetScheme(acc.Scheme)
+	if nil != err {
+		t.Fatalf("failed loading scheme, got error %v", err)
+	}
+	eps := ephemsec.State{
+		Context:         acc.Context,
+		Nonce:           acc.INonce,
+		StaticKey:       self.card.Kh.PrivateKey,
+		RemoteEphemKey:  acc.E.PublicKey,
+		RemoteStaticKey: acc.S.PublicKey,
+		Psk:             self.card.Psk,
+	}
+	digits, err := eps.EPHEMSEC(sch, ephemsec.Responder, nil)
+	if nil != err {
+		t.Fatalf("failed card OTP generation, got error %v", err)
+	}
+	digits, err = airgap.ApplyPad(sch.Alphabet(), digits, acc.OtpPad, digits[:0])
+	if nil != err {
+		t.Fatalf("failed ApplyPad, got error %v", err)
+	}
+	return digits
+}
+
+// alter returns a copy of digits with a different 1st digit.
+func alter(digits []byte, b int) []byte {
+	rv := append([]byte{}, digits...)
+	rv[0] = byte((int(rv[0]) + 1) % b)
+	return rv
+}